@@ -1,69 +0,0 @@
-// Copyright 2014 The goyacc Authors. All rights reserved.
-// Use of this source code is governed by a BSD-style
-// license that can be found in the LICENSE file.
-
-package main
-
-import (
-	"flag"
-	"fmt"
-	"os"
-	"path"
-	"runtime"
-	"strings"
-	"testing"
-)
-
-func caller(s string, va ...interface{}) {
-	_, fn, fl, _ := runtime.Caller(2)
-	fmt.Printf("caller: %s:%d: ", path.Base(fn), fl)
-	fmt.Printf(s, va...)
-	fmt.Println()
-	_, fn, fl, _ = runtime.Caller(1)
-	fmt.Printf("\tcallee: %s:%d: ", path.Base(fn), fl)
-	fmt.Println()
-}
-
-func dbg(s string, va ...interface{}) {
-	if s == "" {
-		s = strings.Repeat("%v ", len(va))
-	}
-	_, fn, fl, _ := runtime.Caller(1)
-	fmt.Printf("dbg %s:%d: ", path.Base(fn), fl)
-	fmt.Printf(s, va...)
-	fmt.Println()
-}
-
-func TODO(...interface{}) string {
-	_, fn, fl, _ := runtime.Caller(1)
-	return fmt.Sprintf("TODO: %s:%d:\n", path.Base(fn), fl)
-}
-
-func use(...interface{}) {}
-
-func init() {
-	use(caller, dbg, TODO) //TODOOK
-}
-
-// ============================================================================
-
-var (
-	oSrc    = flag.String("src", "", "test src")
-	oDev    = flag.Bool("dev", false, "enable dev test(s)")
-	oDevOut = flag.String("devout", os.DevNull, "dev test -o replacement")
-)
-
-func TestDev(t *testing.T) {
-	if !*oDev {
-		t.Log("use -dev to enable")
-		return
-	}
-
-	*oOut = *oDevOut
-	if s := *oSrc; s != "" {
-		err := main1(s)
-		if err != nil {
-			t.Fatal(err)
-		}
-	}
-}
@@ -0,0 +1,2399 @@
+// Copyright 2014 The goyacc Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gen
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"go/token"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/cznic/y"
+)
+
+func caller(s string, va ...interface{}) {
+	_, fn, fl, _ := runtime.Caller(2)
+	fmt.Printf("caller: %s:%d: ", path.Base(fn), fl)
+	fmt.Printf(s, va...)
+	fmt.Println()
+	_, fn, fl, _ = runtime.Caller(1)
+	fmt.Printf("\tcallee: %s:%d: ", path.Base(fn), fl)
+	fmt.Println()
+}
+
+func dbg(s string, va ...interface{}) {
+	if s == "" {
+		s = strings.Repeat("%v ", len(va))
+	}
+	_, fn, fl, _ := runtime.Caller(1)
+	fmt.Printf("dbg %s:%d: ", path.Base(fn), fl)
+	fmt.Printf(s, va...)
+	fmt.Println()
+}
+
+func TODO(...interface{}) string {
+	_, fn, fl, _ := runtime.Caller(1)
+	return fmt.Sprintf("TODO: %s:%d:\n", path.Base(fn), fl)
+}
+
+func use(...interface{}) {}
+
+func init() {
+	use(caller, dbg, TODO) //TODOOK
+}
+
+// ============================================================================
+
+var (
+	oSrc    = flag.String("src", "", "test src")
+	oDev    = flag.Bool("dev", false, "enable dev test(s)")
+	oDevOut = flag.String("devout", os.DevNull, "dev test -o replacement")
+)
+
+func TestDev(t *testing.T) {
+	if !*oDev {
+		t.Log("use -dev to enable")
+		return
+	}
+
+	g := newGenerator(NewOptions())
+	g.Out = *oDevOut
+	if s := *oSrc; s != "" {
+		err := g.main1(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestGenerateSource(t *testing.T) {
+	o := NewOptions()
+	o.Prefix = "calc"
+	r, err := GenerateSource("test.y", []byte("%{\npackage calc\n%}\n%token NUM\n%%\ne: e '+' NUM | NUM\n"), o)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Contains(r.Parser, []byte("func calcParse(")) {
+		t.Fatalf("missing calcParse in\n%s", r.Parser)
+	}
+
+	if len(r.Report) == 0 {
+		t.Fatal("missing report")
+	}
+}
+
+func TestGenerateConcurrent(t *testing.T) {
+	src := []byte("%{\npackage calc\n%}\n%token NUM\n%%\ne: e '+' NUM | NUM\n")
+	var wg sync.WaitGroup
+	errs := make([]error, 8)
+	for i := range errs {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			o := NewOptions()
+			o.Prefix = fmt.Sprintf("p%d", i)
+			o.PtrStack = i%2 != 0
+			r, err := GenerateSource("test.y", src, o)
+			switch {
+			case err != nil:
+				errs[i] = err
+			case !bytes.Contains(r.Parser, []byte("func "+o.Prefix+"Parse(")):
+				errs[i] = fmt.Errorf("missing %sParse", o.Prefix)
+			case bytes.Contains(r.Parser, []byte(o.Prefix+"growStack")) != o.PtrStack:
+				errs[i] = fmt.Errorf("-ptrstack %v not honored", o.PtrStack)
+			}
+		}(i)
+	}
+	wg.Wait()
+	for i, err := range errs {
+		if err != nil {
+			t.Fatalf("%d: %v", i, err)
+		}
+	}
+}
+
+func TestFormatGrammar(t *testing.T) {
+	src := "%{\npackage calc\n%}\n%token   <n>   NUM // Number.\n%token B A\n%%\n// Sums.\ne :   e '+' NUM { $$ = $1 + $3 }\n   | NUM ;\n%ifdef X\nf: | f 'a'..'z'\n%endif\n%%\nfunc f() {}\n"
+	e := "%{\npackage calc\n%}\n%token <n> NUM // Number.\n%token A B\n\n%%\n\n// Sums.\ne:\n\te '+' NUM { $$ = $1 + $3 }\n|\tNUM\n%ifdef X\nf:\n|\tf 'a'..'z'\n%endif\n\n%%\nfunc f() {}\n"
+	b, err := formatGrammar("test.y", []byte(src), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if g := string(b); g != e {
+		t.Fatalf("got\n%s\nexp\n%s", g, e)
+	}
+
+	if b, err = formatGrammar("test.y", b, true); err != nil {
+		t.Fatal(err)
+	}
+
+	if g := string(b); g != e {
+		t.Fatalf("not idempotent, got\n%s\nexp\n%s", g, e)
+	}
+}
+
+func TestHeader(t *testing.T) {
+	src := []byte("%{\npackage calc\n%}\n%token NUM\n%%\nE: E '+' NUM | NUM\n")
+	o := NewOptions()
+	o.Command = []string{"/bin/goyacc", "-o", "calc.go", "my grammar.y"}
+	o.Header = "Code generated by {{.Command}}. DO NOT EDIT.\n\n{{.Grammar}} {{.SHA256}}"
+	r, err := GenerateSource("test.y", src, o)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	e := fmt.Sprintf("// Code generated by goyacc -o calc.go 'my grammar.y'. DO NOT EDIT.\n//\n// test.y %x\n\npackage calc\n", sha256.Sum256(src))
+	if g := string(r.Parser); !strings.HasPrefix(g, e) {
+		t.Fatalf("got\n%s\nexp prefix\n%s", g, e)
+	}
+
+	o.Header = "Generated by goyacc."
+	if _, err := GenerateSource("test.y", src, o); err == nil {
+		t.Fatal("expected error")
+	}
+}
+
+func TestFingerprint(t *testing.T) {
+	src := []byte("%{\npackage calc\n%}\n%token NUM\n%%\nE: E '+' NUM | NUM\n")
+	fp := func(o *Options) string {
+		r, err := GenerateSource("test.y", src, o)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		m := regexp.MustCompile(`yyFingerprint += "(sha256:[0-9a-f]{64})"`).FindSubmatch(r.Parser)
+		if m == nil {
+			t.Fatalf("no fingerprint in\n%s", r.Parser)
+		}
+
+		return string(m[1])
+	}
+
+	e := fp(NewOptions())
+	o := NewOptions()
+	o.Out, o.Report, o.Werror = "calc.go", "calc.output", true
+	if g := fp(o); g != e {
+		t.Fatalf("got %s, exp %s", g, e)
+	}
+
+	o.NoLines = true
+	if g := fp(o); g == e {
+		t.Fatalf("-l does not change the fingerprint %s", g)
+	}
+}
+
+func TestEmbed(t *testing.T) {
+	src := []byte("%{\npackage calc\n%}\n%token NUM\n%%\nE: E '+' NUM | NUM\n")
+	for _, format := range []string{"text", "gzip"} {
+		o := NewOptions()
+		o.Embed = format
+		r, err := GenerateSource("test.y", src, o)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		m := regexp.MustCompile(`(?m)^const yyGrammarSource = (".*")$`).FindSubmatch(r.Parser)
+		if m == nil {
+			t.Fatalf("%s: no yyGrammarSource in\n%s", format, r.Parser)
+		}
+
+		b, err := strconv.Unquote(string(m[1]))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if format == "gzip" {
+			z, err := gzip.NewReader(strings.NewReader(b))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			u, err := ioutil.ReadAll(z)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			b = string(u)
+		}
+		if b != string(src) {
+			t.Fatalf("%s: got %q, exp %q", format, b, src)
+		}
+	}
+}
+
+func TestCover(t *testing.T) {
+	src := []byte("%{\npackage calc\n%}\n%token NUM\n%%\nE: E '+' NUM | NUM\n")
+	for _, pure := range []bool{false, true} {
+		o := NewOptions()
+		o.Cover = true
+		o.Pure = pure
+		r, err := GenerateSource("test.y", src, o)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		exp := []string{
+			"var yyCoverRules = [3]string{",
+			`"E: E '+' NUM",`,
+			"func yyCoverage() []uint64 {",
+			"__yyatomic__.AddUint64(&yyCoverCounts[r], 1)",
+		}
+		if pure {
+			exp = []string{
+				"var yyCoverRules = [3]string{",
+				"func (p *yyParser) Coverage() []uint64 {",
+				"yyrcvr.coverCounts[r]++",
+			}
+		}
+		for _, v := range exp {
+			if !bytes.Contains(r.Parser, []byte(v)) {
+				t.Fatalf("pure %v: no %q in\n%s", pure, v, r.Parser)
+			}
+		}
+	}
+}
+
+func TestRaceGuard(t *testing.T) {
+	o := NewOptions()
+	o.RaceGuard = true
+	r, err := GenerateSource("test.y", []byte("%{\npackage calc\n%}\n%token NUM\n%%\nE: E '+' NUM | NUM\n"), o)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Contains(r.Parser, []byte("if !__yyatomic__.CompareAndSwapInt32(&yyrcvr.busy, 0, 1) {")) {
+		t.Fatalf("no guard in\n%s", r.Parser)
+	}
+}
+
+func TestSkeleton(t *testing.T) {
+	dir, err := ioutil.TempDir("", "goyacc-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	o := NewOptions()
+	o.Skeleton = filepath.Join(dir, "skel.tmpl")
+	tmpl := "{{.Prologue}}\nvar rules = []string{ {{range .Rules}}{{printf \"%q\" .Text}}, {{end}} }\n"
+	if err := ioutil.WriteFile(o.Skeleton, []byte(tmpl), 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := GenerateSource("test.y", []byte("%{\npackage calc\n%}\n%token NUM\n%%\nE: E '+' NUM | NUM\n"), o)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if g, e := string(r.Parser), "package calc\n\nvar rules = []string{\"$accept: E $end\", \"E: E '+' NUM\", \"E: NUM\"}\n"; g != e {
+		t.Fatalf("got\n%s\nexp\n%s", g, e)
+	}
+}
+
+func TestAliases(t *testing.T) {
+	g := newGenerator(NewOptions())
+	src := `%token PLUS "+" NUM 300 "number"
+%left "+"
+%%
+e: e "+" "number" %prec "+" { $$ = "+" } | NUM
+%%
+var s = "+"
+`
+	exp := `%token PLUS "+" NUM 300 "number"
+%left PLUS
+%%
+e: e PLUS NUM %prec PLUS { $$ = "+" } | NUM
+%%
+var s = "+"
+`
+	pp, err := g.preprocess(token.NewFileSet(), "test.y", []byte(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if g, e := string(pp.src), exp; g != e {
+		t.Fatalf("got\n%s\nexp\n%s", g, e)
+	}
+
+	if _, err = g.preprocess(token.NewFileSet(), "test.y", []byte("%%\ne: \"-\"\n")); err == nil {
+		t.Fatal("expected error")
+	}
+}
+
+func TestValueType(t *testing.T) {
+	g := newGenerator(NewOptions())
+	src := "%define api.value.type {interface{}}\n%token NUM\n%%\ne: NUM\n"
+	pp, err := g.preprocess(token.NewFileSet(), "test.y", []byte(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if g, e := string(pp.src), "\n%token NUM\n%%\ne: NUM\n"; g != e {
+		t.Fatalf("got %q, exp %q", g, e)
+	}
+
+	if g, e := pp.define["api.value.type"].val, "interface{}"; g != e {
+		t.Fatalf("got %q, exp %q", g, e)
+	}
+
+	src = "%define api.value.type {interface{}}\n%union{ n int }\n%%\ne: NUM\n"
+	if _, err := g.preprocess(token.NewFileSet(), "test.y", []byte(src)); err == nil {
+		t.Fatal("expected error")
+	}
+}
+
+func TestDuplicates(t *testing.T) {
+	g := newGenerator(NewOptions())
+	src := "%%\na: b | c\nb: 'b'\na: d\nc: 'c'\nd: 'd'\n"
+	pp, err := g.preprocess(token.NewFileSet(), "test.y", []byte(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if g, e := len(pp.warnings), 1; g != e {
+		t.Fatalf("got %v warnings, exp %v: %v", g, e, pp.warnings)
+	}
+
+	if g, e := pp.warnings[0].Msg, "nonterminal a defined 2 times, alternatives merged in this order: test.y:2:1, test.y:4:1"; g != e {
+		t.Fatalf("got %q, exp %q", g, e)
+	}
+
+	g.NoDups = true
+	if _, err = g.preprocess(token.NewFileSet(), "test.y", []byte(src)); err == nil {
+		t.Fatal("expected error")
+	}
+}
+
+func TestWarnings(t *testing.T) {
+	g := newGenerator(NewOptions())
+	src := "%token <n> A\n%type <s> A b\n%%\nb: A | %empty | c\nc:\n"
+	pp, err := g.preprocess(token.NewFileSet(), "test.y", []byte(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var a []string
+	for _, v := range pp.warnings {
+		a = append(a, fmt.Sprintf("%s %v", v.category, v.Error))
+	}
+	if g, e := strings.Join(a, "\n"), `type test.y:2:11: conflicting types <n> and <s> of A, first declared at test.y:1:12
+empty-rule test.y:5:1: empty rule c: without %empty`; g != e {
+		t.Fatalf("got\n%s\nexp\n%s", g, e)
+	}
+
+	src = "%%\na: 'a' %empty\n"
+	if _, err := g.preprocess(token.NewFileSet(), "test.y", []byte(src)); err == nil {
+		t.Fatal("expected error")
+	}
+}
+
+func TestTokenGroups(t *testing.T) {
+	g := newGenerator(NewOptions())
+	src := `// Keywords.
+%token IF ELSE // else keyword
+
+%token <n> NUM 300 "number" // integer
+%left PLUS IF
+%%
+e: NUM
+`
+	pp, err := g.preprocess(token.NewFileSet(), "test.y", []byte(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if g, e := fmt.Sprintf("%q", pp.tokens), `[{map["ELSE":"// else keyword"] ["// Keywords."] ["IF" "ELSE"]} {map["NUM":"// integer"] [] ["NUM"]} {map[] [] ["PLUS"]}]`; g != e {
+		t.Fatalf("got %s\nexp %s", g, e)
+	}
+}
+
+func TestMidRules(t *testing.T) {
+	g := newGenerator(NewOptions())
+	src := `%%
+a: b <int>{ $$ = $1 } c { use($2, $<int>2, $$, "$2") } | b <int>{ $$ = 0 } <string>{ $$ = "" } { f($2, $3) }
+;
+b: <int>{ $$ = 1 }
+`
+	exp := `%%
+a: b { $<int>$ = $1 } c { use($<int>2, $<int>2, $$, "$2") } | b { $<int>$ = 0 } { $<string>$ = "" } { f($<int>2, $<string>3) }
+;
+b: <int>{ $$ = 1 }
+`
+	_, err := g.preprocess(token.NewFileSet(), "test.y", []byte(src))
+	if err == nil {
+		t.Fatal("expected error")
+	}
+
+	src = strings.Replace(src, "b: <int>", "b: ", 1)
+	exp = strings.Replace(exp, "b: <int>", "b: ", 1)
+	pp, err := g.preprocess(token.NewFileSet(), "test.y", []byte(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if g, e := string(pp.src), exp; g != e {
+		t.Fatalf("got\n%s\nexp\n%s", g, e)
+	}
+}
+
+func TestEntries(t *testing.T) {
+	g := newGenerator(NewOptions())
+	src := `%token NUM
+%entry e
+	f
+%start s
+%%
+s: e ;
+e: NUM ;
+f: e ;
+`
+	exp := `%token NUM
+%token yyEntry_e yyEntry_f
+
+%start yyEntry
+%% yyEntry: s { *yyVAL = yyS[yypt] } | yyEntry_e e { *yyVAL = yyS[yypt] } | yyEntry_f f { *yyVAL = yyS[yypt] } ;
+s: e ;
+e: NUM ;
+f: e ;
+`
+	pp, err := g.preprocess(token.NewFileSet(), "test.y", []byte(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if g, e := string(pp.src), exp; g != e {
+		t.Fatalf("got\n%s\nexp\n%s", g, e)
+	}
+
+	if _, err := g.preprocess(token.NewFileSet(), "test.y", []byte("%entry e e\n%%\ne: ;\n")); err == nil {
+		t.Fatal("expected error")
+	}
+}
+
+func TestConditionals(t *testing.T) {
+	src := `a
+%ifdef X
+b
+%if Y == 2
+c
+%elif !Z
+d
+%else
+e
+%endif
+%else
+f
+%endif
+g`
+	lines := strings.Split(src, "\n")
+	for i, v := range []struct {
+		d    Defines
+		keep []int // Line numbers.
+	}{
+		{Defines{}, []int{1, 12, 14}},
+		{Defines{"X": "1"}, []int{1, 3, 7, 14}},
+		{Defines{"X": "1", "Y": "2"}, []int{1, 3, 5, 14}},
+		{Defines{"X": "1", "Z": "1"}, []int{1, 3, 9, 14}},
+	} {
+		b, err := conditionals("test.y", []byte(src), v.d)
+		if err != nil {
+			t.Fatal(i, err)
+		}
+
+		exp := make([]string, len(lines))
+		for _, n := range v.keep {
+			exp[n-1] = lines[n-1]
+		}
+		if g, e := string(b), strings.Join(exp, "\n"); g != e {
+			t.Fatalf("%d: got %q, exp %q", i, g, e)
+		}
+	}
+
+	for _, src := range []string{"%if X\n", "%endif\n", "%ifdef X Y\n%endif\n", "%else\n"} {
+		if _, err := conditionals("test.y", []byte(src), Defines{}); err == nil {
+			t.Fatalf("%q: expected error", src)
+		}
+	}
+}
+
+func TestExpect(t *testing.T) {
+	g := newGenerator(NewOptions())
+	src := `%token NUM "number"
+%expect 2
+%left '+' "number" %expect 1
+%%
+e: e '+' e %expect 1 %expect-rr 2
+| "number" { } e
+;
+`
+	pp, err := g.preprocess(token.NewFileSet(), "test.y", []byte(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if g, e := fmt.Sprintf("%v %v %v %q", pp.expect.pos, pp.expect.sr, pp.expect.rr, pp.expect.what), `test.y:2:1 2 -1 ""`; g != e {
+		t.Fatalf("got %s, exp %s", g, e)
+	}
+
+	plus, num := pp.precExpect["'+'"], pp.precExpect["NUM"]
+	if plus == nil || plus != num {
+		t.Fatalf("%v %v", plus, num)
+	}
+
+	if g, e := fmt.Sprintf("%v %v %v", plus.pos, plus.sr, plus.what), `test.y:3:1 1 %left '+' "number"`; g != e {
+		t.Fatalf("got %s, exp %s", g, e)
+	}
+
+	var a []string
+	for _, v := range pp.rules {
+		s := v.String()
+		if v.expect != nil {
+			s += fmt.Sprintf(" [%v %v]", v.expect.sr, v.expect.rr)
+		}
+		a = append(a, s)
+	}
+	if g, e := strings.Join(a, ", "), "e: e '+' e [1 2], e: NUM {} e"; g != e {
+		t.Fatalf("got %s, exp %s", g, e)
+	}
+
+	if bytes.Contains(pp.src, []byte("%expect")) {
+		t.Fatalf("%s", pp.src)
+	}
+}
+
+func TestRanges(t *testing.T) {
+	g := newGenerator(NewOptions())
+	src := `%token <c> 'a'..'z'
+%%
+id: 'a'..'z' | id 'a'..'z' | id '0'..'9' | id '_'
+`
+	pp, err := g.preprocess(token.NewFileSet(), "test.y", []byte(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if g, e := fmt.Sprint(pp.ranges), "['0'..'9' 'a'..'z']"; g != e {
+		t.Fatalf("got %s, exp %s", g, e)
+	}
+
+	if g, e := string(pp.src), `%token <c> yyRange_61_7a
+%token yyRange_30_39 %%
+id: yyRange_61_7a | id yyRange_61_7a | id yyRange_30_39 | id '_'
+`; g != e {
+		t.Fatalf("got\n%s\nexp\n%s", g, e)
+	}
+
+	for _, src := range []string{
+		"%%\na: 'a'..'z' | 'A'..'b'\n",
+		"%%\na: 'a'..'z' | 'q'\n",
+		"%%\na: 'z'..'a'\n",
+	} {
+		if _, err := g.preprocess(token.NewFileSet(), "test.y", []byte(src)); err == nil {
+			t.Fatalf("%q: expected error", src)
+		}
+	}
+}
+
+// TestHostIndependence checks the parser output does not depend on the host
+// architecture or the map iteration order by comparing the output of a 386
+// build of goyacc to repeated outputs of the test binary.
+func TestHostIndependence(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipped in short mode")
+	}
+
+	dir, err := ioutil.TempDir("", "goyacc-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	src := `%{
+package main
+%}
+
+%token A a B b
+
+%left '+'
+
+%%
+
+s: e | s ';' e
+e: A | a | B | b | e '+' e | '(' s ')' | error
+`
+	in := filepath.Join(dir, "t.y")
+	if err := ioutil.WriteFile(in, []byte(src), 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	o := NewOptions()
+	o.Out, o.Report = filepath.Join(dir, "y.go"), filepath.Join(dir, "y.output")
+	var want []byte
+	for i := 0; i < 5; i++ {
+		if err := Generate(in, o); err != nil {
+			t.Fatal(err)
+		}
+
+		b, err := ioutil.ReadFile(o.Out)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if i == 0 {
+			want = b
+			continue
+		}
+
+		if !bytes.Equal(b, want) {
+			t.Fatal("output differs between runs")
+		}
+	}
+
+	bin := filepath.Join(dir, "goyacc386")
+	cmd := exec.Command("go", "build", "-o", bin, "..")
+	cmd.Env = append(os.Environ(), "GOARCH=386", "CGO_ENABLED=0")
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Skipf("cannot build goyacc for 386: %v\n%s", err, out)
+	}
+
+	out := filepath.Join(dir, "y.go") // The line directives name the output.
+	if b, err := exec.Command(bin, "-o", out, "-v", os.DevNull, in).CombinedOutput(); err != nil {
+		if _, ok := err.(*exec.ExitError); !ok { // The host cannot run 386 binaries.
+			t.Skipf("cannot run goyacc for 386: %v", err)
+		}
+
+		t.Fatalf("goyacc for 386 failed: %v\n%s", err, b)
+	}
+
+	b, err := ioutil.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(b, want) {
+		t.Fatal("output of goyacc for 386 differs")
+	}
+}
+
+func TestCaseless(t *testing.T) {
+	g := newGenerator(NewOptions())
+	src := `%token-caseless SELECT <s> ORDER_BY 300 "Order By"
+%token ID
+%%
+q: SELECT ID ORDER_BY ID
+`
+	pp, err := g.preprocess(token.NewFileSet(), "test.y", []byte(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if g, e := fmt.Sprint(pp.keywords), "map[order by:ORDER_BY select:SELECT]"; g != e {
+		t.Fatalf("got %s, exp %s", g, e)
+	}
+
+	if g, e := string(pp.src[:strings.IndexByte(string(pp.src), '\n')]), `%token SELECT <s> ORDER_BY 300 "Order By"`; g != e {
+		t.Fatalf("got %s, exp %s", g, e)
+	}
+
+	if g, e := fmt.Sprintf("%q", pp.tokens[0].names), `["SELECT" "ORDER_BY"]`; g != e {
+		t.Fatalf("got %s, exp %s", g, e)
+	}
+
+	if _, err := g.preprocess(token.NewFileSet(), "test.y", []byte("%token-caseless A \"x\" B \"X\"\n%%\na: A B\n")); err == nil {
+		t.Fatal("expected error")
+	}
+}
+
+func TestLint(t *testing.T) {
+	g := newGenerator(NewOptions())
+	src := []byte("%token NUM\n%%\nE: E '+' NUM | NUM | NUM\n")
+	fset := token.NewFileSet()
+	pp, err := g.preprocess(fset, "test.y", src)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p, err := y.ProcessSource(fset, "test.y", pp.src, &y.Options{AllowConflicts: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	w, err := g.lint(fset, p, pp)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var a []string
+	for _, v := range w {
+		if v.category == "identical" {
+			a = append(a, v.Error.Error())
+		}
+	}
+	if g, e := strings.Join(a, "\n"), "test.y:3:20: rule E: NUM identical to the one at test.y:3:14"; g != e {
+		t.Fatalf("got %q, exp %q", g, e)
+	}
+}
+
+func TestOverlay(t *testing.T) {
+	g := newGenerator(NewOptions())
+	g.Overlays["PLUS"] = "1"
+	src := []byte("%token NUM\n%%\nE:\n%ifdef PLUS\n\tE '+' NUM |\n%endif\n\tNUM\n")
+	fset := token.NewFileSet()
+	pp, err := g.preprocessDefines(fset, "test.y", src, g.overlayDefines(g.overlayNames()...))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p, err := y.ProcessSource(fset, "test.y", pp.src, &y.Options{AllowConflicts: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cells, err := g.overlays(fset, "test.y", src, p)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	plus := 0
+	for _, v := range cells {
+		if g, e := strings.Join(v.names, " "), "PLUS"; g != e {
+			t.Fatalf("state %d, %s: got %q, exp %q", v.state, v.sym.Name, g, e)
+		}
+
+		if v.sym.Name == "'+'" {
+			plus++
+		}
+	}
+	if plus == 0 {
+		t.Fatal("no overlay cells on '+'")
+	}
+}
+
+func TestTokenValues(t *testing.T) {
+	g := newGenerator(NewOptions())
+	pp, err := g.preprocess(token.NewFileSet(), "test.y", []byte("%token A = 300 \"a\" B\n%%\ns: A B\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if g, e := string(pp.src), "%token A  300 \"a\" B\n%%\ns: A B\n"; g != e {
+		t.Fatalf("got %q, exp %q", g, e)
+	}
+
+	dir, err := ioutil.TempDir("", "goyacc-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	fn := filepath.Join(dir, "tokens")
+	for _, v := range []struct {
+		toks map[string]int
+		ok   bool
+	}{
+		{map[string]int{"A": 300, "B": 57346}, true},
+		{map[string]int{"A": 300, "B": 57346, "C": 57347}, true},
+		{map[string]int{"A": 300, "C": 57346}, false}, // renumbered
+		{map[string]int{"A": 300, "D": 57346}, false}, // value reused
+		{map[string]int{"A": 300, "C": 57347, "D": 57348}, true},
+	} {
+		if err := freezeTokens(fn, v.toks); (err == nil) != v.ok {
+			t.Fatalf("%v: %v", v.toks, err)
+		}
+	}
+
+	b, err := ioutil.ReadFile(fn)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if g, e := string(b[bytes.IndexByte(b, '\n')+1:]), "A 300\nB 57346\nC 57347\nD 57348\n"; g != e {
+		t.Fatalf("got %q, exp %q", g, e)
+	}
+}
+
+func TestUselessPrec(t *testing.T) {
+	g := newGenerator(NewOptions())
+	src := `%token NUM
+%left '+'
+%%
+E: E '+' NUM | NUM %prec '+'
+`
+	fset := token.NewFileSet()
+	pp, err := g.preprocess(fset, "test.y", []byte(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p, err := y.ProcessSource(fset, "test.y", pp.src, &y.Options{AllowConflicts: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	w, err := g.uselessPrec(p, pp)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if g, e := fmt.Sprint(w), "test.y:2:7: useless precedence of '+' (and 1 more errors)"; g != e {
+		t.Fatalf("got %s, exp %s", g, e)
+	}
+
+	if g, e := w[1].Error(), "test.y:4:20: useless %prec '+' in rule E: NUM"; g != e {
+		t.Fatalf("got %s, exp %s", g, e)
+	}
+}
+
+func TestCounterexamples(t *testing.T) {
+	g := newGenerator(NewOptions())
+	src := `%token NUM
+%%
+E: E '+' E | NUM
+`
+	fset := token.NewFileSet()
+	pp, err := g.preprocess(fset, "test.y", []byte(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p, err := y.ProcessSource(fset, "test.y", pp.src, &y.Options{AllowConflicts: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	w, err := g.counterexamples(p, pp)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if g, e := len(w), 1; g != e {
+		t.Fatalf("got %v counterexamples, exp %v", g, e)
+	}
+
+	if g, e := w[0].Error.Error(), `test.y:3:1: shift/reduce conflict on '+' in state 4
+  Example: E '+' E • '+' E
+  Shift derivation: E → [ E '+' E → [ E • '+' E ] ]
+  Reduce derivation: E → [ E → [ E '+' E • ] '+' E ]`; g != e {
+		t.Fatalf("got\n%s\nexp\n%s", g, e)
+	}
+}
+
+func TestConflictTraces(t *testing.T) {
+	g := newGenerator(NewOptions())
+	src := `%token NUM
+%%
+E: E '+' E | NUM
+`
+	fset := token.NewFileSet()
+	pp, err := g.preprocess(fset, "test.y", []byte(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p, err := y.ProcessSource(fset, "test.y", pp.src, &y.Options{AllowConflicts: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	a, err := g.analyze(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if g, e := len(a.conflicts), 1; g != e {
+		t.Fatalf("got %v conflicts, exp %v", g, e)
+	}
+
+	var buf bytes.Buffer
+	a.writeTraces(&buf, a.conflicts[0], "")
+	if g, e := buf.String(), `shift E: E . '+' E
+	E
+	⇒ [ E '+' E ]
+	⇒ E '+' [ E • '+' E ]
+reduce E: E '+' E . on '+'
+	E
+	⇒ [ E '+' E ]
+	⇒ [ E '+' E • ] '+' E
+`; g != e {
+		t.Fatalf("got\n%s\nexp\n%s", g, e)
+	}
+}
+
+func TestRuleGraph(t *testing.T) {
+	// t; A: B t | t; B: A; C: C A | D; D: t; $accept: C.
+	sym := func(nm string) *y.Symbol { return &y.Symbol{Name: nm} }
+	a := &automaton{
+		p:      &y.Parser{Start: "C"},
+		nterms: 1,
+		syms:   []*y.Symbol{sym("t"), sym("A"), sym("B"), sym("C"), sym("D"), sym("$accept")},
+		rhs:    [][]int{{3}, {2, 0}, {0}, {1}, {3, 1}, {4}, {0}},
+		rules:  [][]int{{1, 2}, {3}, {4, 5}, {6}, {0}},
+	}
+	g := newRuleGraph(a)
+	b, err := json.Marshal(g)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if g, e := string(b), `{"start":"C","nonterminals":[`+
+		`{"name":"A","rules":[1,2],"references":["B"],"component":0},`+
+		`{"name":"B","rules":[3],"references":["A"],"component":0},`+
+		`{"name":"C","rules":[4,5],"references":["A","C","D"],"component":1},`+
+		`{"name":"D","rules":[6],"references":[],"component":-1}],`+
+		`"components":[["A","B"],["C"]]}`; g != e {
+		t.Fatalf("got\n%s\nexp\n%s", g, e)
+	}
+}
+
+func TestAnalyzeOnDemand(t *testing.T) {
+	g := newGenerator(NewOptions())
+	if err := g.generate("test.y", []byte("%{\npackage calc\n%}\n%token NUM\n%%\nE: E '+' NUM | NUM\n"), ioutil.Discard, ioutil.Discard); err != nil {
+		t.Fatal(err)
+	}
+
+	if g.analysis.p != nil {
+		t.Fatal("plain generation analyzed the automaton")
+	}
+
+	fset := token.NewFileSet()
+	p, err := y.ProcessSource(fset, "test.y", []byte("%token NUM\n%%\nE: E '+' NUM | NUM\n"), &y.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	a, err := g.analyze(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if b, _ := g.analyze(p); b != a {
+		t.Fatal("automaton not reused")
+	}
+}
+
+func TestWriteDiff(t *testing.T) {
+	a := &grammarSummary{
+		rules:     []string{"E: E '+' NUM", "E: NUM", "E: NUM"},
+		states:    5,
+		conflicts: []string{"c1", "c2"},
+		stateOf:   map[string]int{"c1": 3, "c2": 4},
+		tokens:    map[string]int{"$end": 0, "FOO": 57347, "NUM": 57346},
+	}
+	b := &grammarSummary{
+		rules:     []string{"E: E '+' E", "E: NUM"},
+		states:    6,
+		sr:        1,
+		conflicts: []string{"c2", "c3"},
+		stateOf:   map[string]int{"c2": 2, "c3": 5},
+		tokens:    map[string]int{"$end": 0, "BAR": 57348, "NUM": 57347},
+	}
+	var buf bytes.Buffer
+	if err := writeDiff(&buf, "old.y", "new.y", a, b); err != nil {
+		t.Fatal(err)
+	}
+
+	if g, e := buf.String(), `--- old.y
++++ new.y
+- rule E: E '+' NUM
+- rule E: NUM
++ rule E: E '+' E
+states: 5 -> 6
+conflicts: 0 -> 1 shift/reduce, 0 -> 0 reduce/reduce
+- c1, in state 3
++ c3, in state 5
++ token BAR 57348
+- token FOO 57347
+token NUM: 57346 -> 57347
+`; g != e {
+		t.Fatalf("got\n%s\nexp\n%s", g, e)
+	}
+}
+
+func TestOutputNames(t *testing.T) {
+	g := newGenerator(NewOptions())
+	for _, v := range []struct {
+		src, out, report string
+		flags            []string
+	}{
+		{"%%\na: 'a'\n", "y.go", "y.output", nil},
+		{"%output \"p.go\"\n%%\na: 'a'\n", "p.go", "p.output", nil},
+		{"%file-prefix \"q\"\n%%\na: 'a'\n", "q.go", "q.output", nil},
+		{"%file-prefix \"q\"\n%output \"p.go\"\n%%\na: 'a'\n", "p.go", "q.output", nil},
+		{"%file-prefix \"q\"\n%%\na: 'a'\n", "y.go", "q.output", []string{"o"}},
+		{"%output \"p.go\"\n%%\na: 'a'\n", "p.go", "y.output", []string{"v"}},
+	} {
+		pp, err := g.preprocess(token.NewFileSet(), "test.y", []byte(v.src))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		g.Set = map[string]bool{}
+		for _, f := range v.flags {
+			g.Set[f] = true
+		}
+		if out, report := g.outputNames(pp); out != v.out || report != v.report {
+			t.Fatalf("%q %v: got %s %s, exp %s %s", v.src, v.flags, out, report, v.out, v.report)
+		}
+	}
+
+	g.Set = map[string]bool{}
+	pp, err := g.preprocess(token.NewFileSet(), "test.y", []byte("%file-prefix \"q\"\n%%\na: 'a'\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, v := range []struct{ format, report string }{
+		{"html", "q.html"},
+		{"json", "q.json"},
+		{"markdown", "q.md"},
+	} {
+		g.ReportFormat = v.format
+		if _, report := g.outputNames(pp); report != v.report {
+			t.Fatalf("-report %s: got %s, exp %s", v.format, report, v.report)
+		}
+	}
+}
+
+func TestInjectImport(t *testing.T) {
+	for _, v := range []struct{ src, pkg, exp string }{
+		{"\npackage p\n", "", "\npackage p\n\nimport (\n%s)\n\n"},
+		{"\npackage p\n\nimport (\n\t\"fmt\"\n)\n", "", "\npackage p\n\nimport (\n%s\n\t\"fmt\"\n)\n"},
+		{"\nvar x int\n", "q", "package q\n\nimport (\n%s)\n\nvar x int\n"},
+	} {
+		var inj string
+		for _, w := range generatedImports {
+			inj += fmt.Sprintf("\t%s %q\n", w.name, w.path)
+		}
+		if g, e := injectImport(v.src, v.pkg, ""), fmt.Sprintf(v.exp, inj); g != e {
+			t.Fatalf("%q: got\n%s\nexp\n%s", v.src, g, e)
+		}
+	}
+
+	g := injectImport("package p\n\nimport __yyfmt__ \"fmt\"\n", "", "")
+	if n := strings.Count(g, `__yyfmt__ "fmt"`); n != 1 {
+		t.Fatalf("got %d imports of fmt in\n%s", n, g)
+	}
+
+	src := "package p\n\nimport (\n\t__yyfmt__ \"fmt\"\n\t__yyio__ \"io\"\n\t\"os\"\n)\n\nvar w __yyio__.Writer = os.Stdout\n"
+	if g, e := string(pruneImports([]byte(src))), strings.Replace(src, "\t__yyfmt__ \"fmt\"\n", "", 1); g != e {
+		t.Fatalf("got\n%s\nexp\n%s", g, e)
+	}
+}
+
+func TestSetPackage(t *testing.T) {
+	g := newGenerator(NewOptions())
+	for _, v := range []struct{ src, exp string }{
+		{"\n// c\npackage main\n\nimport \"fmt\"\n", "\n// c\npackage calc\n\nimport \"fmt\"\n"},
+		{"\nimport \"fmt\"\n", "package calc\n\nimport \"fmt\"\n"},
+	} {
+		if g := setPackage(v.src, "calc"); g != v.exp {
+			t.Fatalf("got %q, exp %q", g, v.exp)
+		}
+	}
+
+	pp, err := g.preprocess(token.NewFileSet(), "test.y", []byte("%package calc\n%%\na: 'a'\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if d := pp.settings["%package"]; d == nil || d.val != "calc" {
+		t.Fatal(d)
+	}
+}
+
+func TestParseBenchOutput(t *testing.T) {
+	dir, err := ioutil.TempDir("", "goyacc-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	fn := filepath.Join(dir, "a b.txt")
+	if err := ioutil.WriteFile(fn, []byte("1+2"), 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	out := `goos: linux
+BenchmarkGoyacc/a_b.txt-8         	    1000	       200.0 ns/op	  15.00 MB/s	     128 B/op	       5 allocs/op
+BenchmarkGoyacc/a_b.txt-8         	    3000	       100.0 ns/op	  30.00 MB/s	     128 B/op	       5 allocs/op
+PASS
+`
+	a, err := parseBenchOutput(strings.NewReader(out), []string{fn})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if g, e := fmt.Sprintf("%+v", *a[0]), fmt.Sprintf("{File:%s Bytes:3 N:4000 NsPerOp:150 MBPerS:22.5 BytesPerOp:128 AllocsPerOp:5}", fn); g != e {
+		t.Fatalf("got %s, exp %s", g, e)
+	}
+}
+
+func TestBenchRun(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipped in short mode")
+	}
+
+	if _, err := exec.LookPath("go"); err != nil {
+		t.Skip(err)
+	}
+
+	dir, err := ioutil.TempDir("", "goyacc-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	r, err := GenerateSource("t.y", []byte(runGrammar), NewOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pkg, corpus := filepath.Join(dir, "parser"), filepath.Join(dir, "corpus")
+	for nm, b := range map[string][]byte{
+		filepath.Join(pkg, "y.go"):   r.Parser,
+		filepath.Join(pkg, "go.mod"): []byte("module parser\n\ngo 1.18\n"),
+		filepath.Join(pkg, "bench.go"): []byte(`package parser
+
+type byteLexer struct {
+	b   []byte
+	err bool
+}
+
+func (l *byteLexer) Lex(lval *yySymType) int {
+	if len(l.b) == 0 {
+		return 0
+	}
+
+	c := l.b[0]
+	l.b = l.b[1:]
+	if c == '+' {
+		return '+'
+	}
+
+	lval.n = int(c - '0')
+	return NUM
+}
+
+func (l *byteLexer) Error(s string) { l.err = true }
+
+func benchParse(b []byte) error { return yyParseErr(&byteLexer{b: b}) }
+`),
+		filepath.Join(corpus, "a"): []byte("1+2+3"),
+	} {
+		if err := os.MkdirAll(filepath.Dir(nm), 0777); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := ioutil.WriteFile(nm, b, 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	out := filepath.Join(dir, "bench.json")
+	if err := Bench([]string{"run", "-corpus", corpus, "-pkg", pkg, "-o", out, "-benchtime", "10x"}); err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := ioutil.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var rep benchReport
+	if err := json.Unmarshal(b, &rep); err != nil {
+		t.Fatal(err)
+	}
+
+	cmd := exec.Command("go", "env", "GOVERSION")
+	cmd.Dir = pkg
+	goVersion, err := cmd.Output()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	switch {
+	case rep.GoyaccVersion != version():
+		t.Fatalf("goyacc version %q, exp %q", rep.GoyaccVersion, version())
+	case !bytes.Contains(r.Parser, []byte(strconv.Quote(rep.Fingerprint))) || !strings.HasPrefix(rep.Fingerprint, "sha256:"):
+		t.Fatalf("fingerprint %q", rep.Fingerprint)
+	case rep.GoVersion != strings.TrimSpace(string(goVersion)):
+		t.Fatalf("go version %q, exp %q", rep.GoVersion, goVersion)
+	case len(rep.Results) != 1 || rep.Results[0].N == 0:
+		t.Fatalf("results %s", b)
+	}
+}
+
+func TestUnion(t *testing.T) {
+	g := newGenerator(NewOptions())
+	src := "// Doc.\n%union {\n\t// N.\n\tN int `json:\"n\"` // c\n}\n%%\na: 'a'\n"
+	pp, err := g.preprocess(token.NewFileSet(), "test.y", []byte(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if g, e := fmt.Sprintf("%q", *pp.union), "{[\"// Doc.\"] \"{\\n\\t// N.\\n\\tN int `json:\\\"n\\\"` // c\\n}\"}"; g != e {
+		t.Fatalf("got %s, exp %s", g, e)
+	}
+
+	if _, err := g.preprocess(token.NewFileSet(), "test.y", []byte("%union {\n\tN int `json`x\n}\n%%\na: 'a'\n")); err == nil {
+		t.Fatal("expected error")
+	}
+}
+
+func TestLex(t *testing.T) {
+	g := newGenerator(NewOptions())
+	src := "%token IF ID\n%lex {\n\tIF\t`if`\n\tID\t`(?i)[a-z]+` { n++ }\n\t_\t\" \"\n}\n%%\na: IF ID\n"
+	pp, err := g.preprocess(token.NewFileSet(), "test.y", []byte(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if g, e := len(pp.lex), 3; g != e {
+		t.Fatalf("got %v rules, exp %v", g, e)
+	}
+
+	if g, e := pp.lex[1].action, "{ n++ }"; g != e {
+		t.Fatalf("got %q, exp %q", g, e)
+	}
+
+	dfa := lexDFA(pp.lex)
+	for _, v := range []struct {
+		s    string
+		rule int
+	}{
+		{"if", 0},
+		{"iF", 1},
+		{"iff", 1},
+		{"K", 1},
+		{"ſ", 1}, // Folds to s.
+		{" ", 2},
+		{"  ", -1},
+		{"0", -1},
+	} {
+		state := 0
+		for _, c := range v.s {
+			next := -1
+			for _, tr := range dfa[state].trans {
+				if tr.lo <= c && c <= tr.hi {
+					next = tr.next
+				}
+			}
+			if state = next; state < 0 {
+				break
+			}
+		}
+		rule := -1
+		if state >= 0 {
+			rule = dfa[state].accept
+		}
+		if rule != v.rule {
+			t.Errorf("%q: got rule %v, exp %v", v.s, rule, v.rule)
+		}
+	}
+
+	for _, v := range []string{
+		"%lex {\n\tID\t`^a`\n}\n%%\na: ID\n",
+		"%lex {\n\tID\t`a(`\n}\n%%\na: ID\n",
+		"%lex {\n\t_\t`a` { n++ }\n}\n%%\na: 'a'\n",
+		"%lex {\n}\n%%\na: 'a'\n",
+	} {
+		if _, err := g.preprocess(token.NewFileSet(), "test.y", []byte(v)); err == nil {
+			t.Errorf("%q: expected error", v)
+		}
+	}
+}
+
+func TestCheckPure(t *testing.T) {
+	g := newGenerator(NewOptions())
+	for i, v := range []struct {
+		src string
+		ok  bool
+	}{
+		{"package p\nvar yyDebug int\nfunc f() { yyDebug := 1; yyDebug++ }\n", true},
+		{"package p\nvar yyDebug int\nfunc f() { yyDebug++ }\n", false},
+		{"package p\nvar yyTab [2][]int\nfunc f() { yyTab[0][1] = 1 }\n", false},
+		{"package p\nvar yyM = map[string]bool{}\nfunc f() { (yyM)[\"a\"] = true }\n", false},
+		{"package p\nvar other int\nfunc f() { other = 1 }\n", true},
+	} {
+		if err := g.checkPure("y.go", []byte(v.src)); (err == nil) != v.ok {
+			t.Errorf("%d: %v", i, err)
+		}
+	}
+}
+
+func TestLineDirectives(t *testing.T) {
+	src := "switch r {\ncase 1:\n\t//line ../g.y:7\n\t{\n\t}\n\t" + lineReset + "\n}\n"
+	if g, e := string(resetLines([]byte(src), "y.go")), "switch r {\ncase 1:\n//line ../g.y:7\n\t{\n\t}\n//line y.go:7\n}\n"; g != e {
+		t.Fatalf("got %q, exp %q", g, e)
+	}
+
+	if g, e := lineFileName("g.y", filepath.Join("out", "y.go")), "../g.y"; g != e {
+		t.Fatalf("got %q, exp %q", g, e)
+	}
+}
+
+func TestToggleDirectives(t *testing.T) {
+	g := newGenerator(NewOptions())
+	pp, err := g.preprocess(token.NewFileSet(), "test.y", []byte("%token-table\n%pure\n%lexer-feedback\n%checkpoint\n%token A\n%%\ns: A\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if pp.settings["%token-table"] == nil || pp.settings["%pure"] == nil || pp.settings["%lexer-feedback"] == nil || pp.settings["%checkpoint"] == nil {
+		t.Fatal(pp.settings)
+	}
+
+	if g, e := string(pp.src), "\n\n\n\n%token A\n%%\ns: A\n"; g != e {
+		t.Fatalf("got %q, exp %q", g, e)
+	}
+
+	for _, v := range []string{"%token-table A\n%%\ns: 'a'\n", "%pure\n%pure\n%%\ns: 'a'\n"} {
+		if _, err := g.preprocess(token.NewFileSet(), "test.y", []byte(v)); err == nil {
+			t.Errorf("%q: expected error", v)
+		}
+	}
+}
+
+func TestPrefix(t *testing.T) {
+	g := newGenerator(NewOptions())
+	pp, err := g.preprocess(token.NewFileSet(), "test.y", []byte("%define api.prefix {calc}\n%{\npackage main\n%}\n%%\ns: 'a'..'z'\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if g, e := pp.prefix, "calc"; g != e {
+		t.Fatalf("got %q, exp %q", g, e)
+	}
+
+	if g, e := pp.ranges[0].name, "calcRange_61_7a"; g != e {
+		t.Fatalf("got %q, exp %q", g, e)
+	}
+
+	for _, v := range []string{"%define api.prefix {1yy}\n%%\ns: 'a'\n", "%define api.prefix {a.b}\n%%\ns: 'a'\n"} {
+		if _, err := g.preprocess(token.NewFileSet(), "test.y", []byte(v)); err == nil {
+			t.Errorf("%q: expected error", v)
+		}
+	}
+
+	for _, v := range []struct {
+		s string
+		e bool
+	}{
+		{"yyAction", false},
+		{"yyAction12", true},
+		{"yyParse", true},
+		{"yyParser2", false},
+		{"YyTokens", true},
+		{"PLUS", false},
+	} {
+		p := &y.Parser{Syms: map[string]*y.Symbol{v.s: {Name: v.s, IsTerminal: true}}}
+		if err := g.checkPrefix(token.NewFileSet(), p, &preprocessed{prefix: "yy"}); (err != nil) != v.e {
+			t.Errorf("%s: %v", v.s, err)
+		}
+	}
+}
+
+func TestEOF(t *testing.T) {
+	g := newGenerator(NewOptions())
+	pp, err := g.preprocess(token.NewFileSet(), "test.y", []byte("%eof END 0x10\n%%\ns: 'a'\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if g, e := pp.settings["%eof"].val, "END=0x10"; g != e {
+		t.Fatalf("got %q, exp %q", g, e)
+	}
+
+	for _, v := range []struct {
+		s     string
+		name  string
+		value int
+	}{
+		{"END", "END", -1},
+		{"END=0", "END", 0},
+		{"END=0x10", "END", 16},
+		{"END=-1", "", 0},
+		{"_=1", "", 0},
+		{"1END", "", 0},
+	} {
+		nm, n, err := eofSpec(v.s)
+		if nm != v.name || n != v.value || (err != nil) != (v.name == "") {
+			t.Errorf("%q: got %q, %d, %v", v.s, nm, n, err)
+		}
+	}
+}
+
+func TestParseError(t *testing.T) {
+	g := newGenerator(NewOptions())
+	for _, v := range []struct {
+		s  string
+		ok bool
+	}{
+		{"%define parse.error simple\n%%\ns: 'a'\n", true},
+		{"%define parse.error detailed\n%%\ns: 'a'\n", true},
+		{"%define parse.error {detailed}\n%%\ns: 'a'\n", true},
+		{"%define parse.error verbose\n%%\ns: 'a'\n", false},
+		{"%define parse.error \"detailed\"\n%%\ns: 'a'\n", false},
+	} {
+		if _, err := g.preprocess(token.NewFileSet(), "test.y", []byte(v.s)); (err == nil) != v.ok {
+			t.Errorf("%q: %v", v.s, err)
+		}
+	}
+}
+
+func TestBuildTags(t *testing.T) {
+	g := newGenerator(NewOptions())
+	pp, err := g.preprocess(token.NewFileSet(), "test.y", []byte("%build-tags \"linux || darwin\"\n%%\ns: 'a'\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if g, e := g.buildConstraint(pp), "linux || darwin"; g != e {
+		t.Fatalf("got %q, exp %q", g, e)
+	}
+
+	g.Tags = "!purego"
+	if g, e := g.buildConstraint(pp), "(linux || darwin) && !purego"; g != e {
+		t.Fatalf("got %q, exp %q", g, e)
+	}
+
+	if _, err := g.preprocess(token.NewFileSet(), "test.y", []byte("%build-tags \"linux ||\"\n%%\ns: 'a'\n")); err == nil {
+		t.Fatal("expected error")
+	}
+}
+
+func TestPushPull(t *testing.T) {
+	g := newGenerator(NewOptions())
+	for _, v := range []struct {
+		s  string
+		ok bool
+	}{
+		{"%define api.push-pull pull\n%%\ns: 'a'\n", true},
+		{"%define api.push-pull push\n%%\ns: 'a'\n", true},
+		{"%define api.push-pull both\n%%\ns: 'a'\n", false},
+	} {
+		if _, err := g.preprocess(token.NewFileSet(), "test.y", []byte(v.s)); (err == nil) != v.ok {
+			t.Errorf("%q: %v", v.s, err)
+		}
+	}
+}
+
+func TestSegmentXLAT(t *testing.T) {
+	a := segmentXLAT([]int{-1, 0, 43, 256, 57346, 57347})
+	if g, e := fmt.Sprint(a), "[{-1 43 0} {256 256 45} {57346 57347 46}]"; g != e {
+		t.Fatalf("got %s, exp %s", g, e)
+	}
+
+	if g, e := a.index(57347), 47; g != e {
+		t.Fatalf("got %v, exp %v", g, e)
+	}
+
+	var sparse []int
+	for i := 0; i < 10; i++ {
+		sparse = append(sparse, i*1000)
+	}
+	if a := segmentXLAT(sparse); a != nil {
+		t.Fatalf("got %v, exp nil", a)
+	}
+}
+
+func TestPackRows(t *testing.T) {
+	rows := [][]int{{1, 2}, {0, 1, 2, 3}, nil, {3, 4, 5}, {1, 2}, {256, 1}}
+	data, offs := packRows(rows, true)
+	if g, e := fmt.Sprint(data, offs), "[0 1 2 3 4 5 256 1] [1 0 0 3 1 6]"; g != e {
+		t.Fatalf("got %s, exp %s", g, e)
+	}
+
+	data, offs = packRows(rows, false)
+	if g, e := fmt.Sprint(data, offs), "[1 2 0 1 2 3 3 4 5 1 2 256 1] [0 2 6 6 9 11]"; g != e {
+		t.Fatalf("got %s, exp %s", g, e)
+	}
+}
+
+// TestZeroAllocs verifies that a parse by a reused parser does not allocate,
+// with and without -ptrstack, using a test of the generated parser which also
+// benchmarks it.
+func TestZeroAllocs(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipped in short mode")
+	}
+
+	if _, err := exec.LookPath("go"); err != nil {
+		t.Skip(err)
+	}
+
+	dir, err := ioutil.TempDir("", "goyacc-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	src := `%{
+package parser
+%}
+
+%union {
+	n int
+}
+
+%token <n> NUM
+%type <n> e
+
+%%
+
+e: e '+' NUM { $$ = $1 + $3 } | NUM
+`
+	test := `package parser
+
+import "testing"
+
+type lexer struct {
+	toks []int
+	i    int
+}
+
+func (l *lexer) Lex(lval *yySymType) int {
+	if l.i == len(l.toks) {
+		return 0
+	}
+
+	lval.n = l.i
+	l.i++
+	return l.toks[l.i-1]
+}
+
+func (l *lexer) Error(s string) { panic(s) }
+
+var input = []int{NUM, '+', NUM, '+', NUM, '+', NUM, '+', NUM}
+
+func TestAllocs(t *testing.T) {
+	p := NewYYParser()
+	l := &lexer{toks: input}
+	if n := testing.AllocsPerRun(100, func() {
+		l.i = 0
+		if p.Parse(l) != 0 {
+			t.Fatal("parse failed")
+		}
+	}); n != 0 {
+		t.Fatalf("%v allocations per parse", n)
+	}
+}
+
+func TestValue(t *testing.T) {
+	v, err := NewYYParser().ParseResult(&lexer{toks: input})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if g, e := v.n, 0+2+4+6+8; g != e {
+		t.Fatalf("got %v, exp %v", g, e)
+	}
+}
+
+func BenchmarkParse(b *testing.B) {
+	p := NewYYParser()
+	l := &lexer{toks: input}
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		l.i = 0
+		p.Parse(l)
+	}
+}
+`
+	in := filepath.Join(dir, "t.y")
+	for nm, s := range map[string]string{
+		in:                              src,
+		filepath.Join(dir, "t_test.go"): test,
+		filepath.Join(dir, "go.mod"):    "module parser\n\ngo 1.18\n",
+	} {
+		if err := ioutil.WriteFile(nm, []byte(s), 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	o := NewOptions()
+	o.Out, o.Report = filepath.Join(dir, "y.go"), os.DevNull
+	for _, o.PtrStack = range []bool{false, true} {
+		if err := Generate(in, o); err != nil {
+			t.Fatal(err)
+		}
+
+		cmd := exec.Command("go", "test", "-bench", ".", "-benchtime", "100x")
+		cmd.Dir = dir
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("-ptrstack=%v: %v\n%s", o.PtrStack, err, out)
+		}
+	}
+}
+
+// runGrammar is the grammar of the parsers run by runParser.
+const runGrammar = `%{
+package parser
+%}
+
+%union {
+	n int
+}
+
+%token <n> NUM
+%type <n> E
+
+%%
+
+E: E '+' NUM { $$ = $1 + $3 } | NUM
+`
+
+// runLexer is the lexer of the tests run by runParser. It returns the
+// tokens of toks, the value of a NUM being its index in toks, and records
+// the syntax errors.
+const runLexer = `
+type lexer struct {
+	toks []int
+	i    int
+	errs []string
+}
+
+func (l *lexer) Lex(lval *yySymType) int {
+	if l.i == len(l.toks) {
+		return 0
+	}
+
+	lval.n = l.i
+	l.i++
+	return l.toks[l.i-1]
+}
+
+func (l *lexer) Error(s string) { l.errs = append(l.errs, s) }
+`
+
+// runParser generates the parser of runGrammar with the options o and runs
+// the tests of test, a test file of package parser using runLexer, against
+// it.
+func runParser(t *testing.T, o *Options, test string) {
+	t.Helper()
+	runGrammarParser(t, runGrammar, o, test)
+}
+
+// runGrammarParser is like runParser but generates the parser of grammar,
+// which must declare the union and the tokens of runGrammar.
+func runGrammarParser(t *testing.T, grammar string, o *Options, test string) {
+	t.Helper()
+	if testing.Short() {
+		t.Skip("skipped in short mode")
+	}
+
+	if _, err := exec.LookPath("go"); err != nil {
+		t.Skip(err)
+	}
+
+	r, err := GenerateSource("t.y", []byte(grammar), o)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir, err := ioutil.TempDir("", "goyacc-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	for nm, b := range map[string][]byte{
+		"y.go":      r.Parser,
+		"t_test.go": []byte(test + runLexer),
+		"go.mod":    []byte("module parser\n\ngo 1.18\n"),
+	} {
+		if err := ioutil.WriteFile(filepath.Join(dir, nm), b, 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	cmd := exec.Command("go", "test")
+	cmd.Dir = dir
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("%v\n%s", err, out)
+	}
+}
+
+func TestReducedStop(t *testing.T) {
+	runParser(t, NewOptions(), `package parser
+
+import "testing"
+
+type stopLexer struct{ lexer }
+
+func (l *stopLexer) Reduced(rule, state int, lval *yySymType) bool { return rule == 1 }
+
+func TestStop(t *testing.T) {
+	toks := []int{NUM, '+', NUM, '+', NUM}
+	if g := NewYYParser().Parse(&stopLexer{lexer{toks: toks}}); g != -1 {
+		t.Fatalf("Parse: got %v, exp -1", g)
+	}
+
+	for _, err := range []error{
+		NewYYParser().ParseErr(&stopLexer{lexer{toks: toks}}),
+		func() error { _, err := yyParseResult(&stopLexer{lexer{toks: toks}}); return err }(),
+	} {
+		if err == nil || err.Error() != "parse stopped by Reduced" {
+			t.Fatalf("got %v, exp parse stopped by Reduced", err)
+		}
+	}
+
+	if errs := yyParseErrors(&stopLexer{lexer{toks: toks}}); len(errs) != 1 {
+		t.Fatalf("ParseErrors: got %v", errs)
+	}
+
+	v, err := yyParseResult(&lexer{toks: toks})
+	if err != nil || v.n != 0+2+4 {
+		t.Fatalf("got %v, %v, exp 6", v.n, err)
+	}
+}
+`)
+}
+
+func TestStackOverflow(t *testing.T) {
+	for _, ptrStack := range []bool{false, true} {
+		o := NewOptions()
+		o.PtrStack, o.Stack = ptrStack, 3
+		runParser(t, o, `package parser
+
+import "testing"
+
+func TestOverflow(t *testing.T) {
+	p := NewYYParser()
+	p.MaxDepth = 3
+	err := p.ParseErr(&lexer{toks: []int{NUM, '+', NUM}})
+	e, ok := err.(*yySyntaxError)
+	if !ok || e.Msg != "stack overflow" || e.Stack != "E '+'" {
+		t.Fatalf("got %#v", err)
+	}
+
+	p.MaxDepth = 4
+	if err := p.ParseErr(&lexer{toks: []int{NUM, '+', NUM, '+', NUM}}); err != nil {
+		t.Fatal(err)
+	}
+}
+`)
+	}
+}
+
+func TestMaxDepth(t *testing.T) {
+	o := NewOptions()
+	o.MaxDepth = 3
+	runParser(t, o, `package parser
+
+import "testing"
+
+func TestMaxDepth(t *testing.T) {
+	if yyMaxDepth != 3 {
+		t.Fatalf("yyMaxDepth %v", yyMaxDepth)
+	}
+
+	if err := yyParseErr(&lexer{toks: []int{NUM, '+', NUM}}); err == nil || err.Error() != "stack overflow" {
+		t.Fatalf("got %v, exp stack overflow", err)
+	}
+
+	p := NewYYParser()
+	p.MaxDepth = 4
+	if err := p.ParseErr(&lexer{toks: []int{NUM, '+', NUM}}); err != nil {
+		t.Fatal(err)
+	}
+}
+`)
+}
+
+func TestParseRuntime(t *testing.T) {
+	o := NewOptions()
+	o.Cancel = 1
+	runParser(t, o, `package parser
+
+import (
+	"context"
+	"sort"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	valid := []int{NUM, '+', NUM, '+', NUM}
+	if err := yyParseErr(&lexer{toks: valid}); err != nil {
+		t.Fatal(err)
+	}
+
+	v, err := NewYYParser().ParseResult(&lexer{toks: valid})
+	if err != nil || v.n != 0+2+4 {
+		t.Fatalf("got %v, %v, exp 6", v.n, err)
+	}
+
+	if err := yyParseContext(context.Background(), &lexer{toks: valid}); err != nil {
+		t.Fatal(err)
+	}
+
+	l := &lexer{toks: []int{NUM, NUM}}
+	err = NewYYParser().ParseErr(l)
+	e, ok := err.(*yySyntaxError)
+	if !ok || e.Msg != "unexpected "+yySymName(NUM) || e.Token != NUM || e.Pos != -1 {
+		t.Fatalf("got %#v", err)
+	}
+
+	if len(l.errs) != 1 || l.errs[0] != e.Msg {
+		t.Fatalf("lexer errors %q", l.errs)
+	}
+
+	exp := []int{'+', yyEofCode}
+	sort.Ints(exp)
+	sort.Ints(e.Expected)
+	if len(e.Expected) != 2 || e.Expected[0] != exp[0] || e.Expected[1] != exp[1] {
+		t.Fatalf("expected %v, exp %v", e.Expected, exp)
+	}
+
+	names := yyExpectedNames(e.State)
+	sort.Strings(names)
+	if len(names) != 2 || names[0] != "$end" || names[1] != yySymName('+') {
+		t.Fatalf("expected names %q", names)
+	}
+
+	if _, err := yyParseResult(&lexer{toks: []int{'+'}}); err == nil || err.Error() != "unexpected "+yySymName('+') {
+		t.Fatalf("got %v", err)
+	}
+
+	if errs := yyParseErrors(&lexer{toks: []int{NUM, '+'}}); len(errs) != 1 || errs[0].Msg != "syntax error" {
+		t.Fatalf("got %v", errs)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := yyParseContext(ctx, &lexer{toks: valid}); err != context.Canceled {
+		t.Fatalf("got %v, exp %v", err, context.Canceled)
+	}
+
+	if err := yyParseContext(context.Background(), &lexer{toks: []int{NUM, NUM}}); err == nil || err.Error() != "unexpected "+yySymName(NUM) {
+		t.Fatalf("got %v", err)
+	}
+}
+`)
+}
+
+func TestRecovererRuntime(t *testing.T) {
+	runParser(t, NewOptions(), `package parser
+
+import "testing"
+
+// plusLexer recovers by inserting the missing '+'.
+type plusLexer struct {
+	lexer
+	states []int
+}
+
+func (l *plusLexer) Recover(states []int, tok int, lval *yySymType) (int, bool) {
+	l.states = append([]int(nil), states...)
+	if tok != NUM {
+		return 0, false
+	}
+
+	l.i--
+	return '+', true
+}
+
+func TestRecover(t *testing.T) {
+	l := &plusLexer{lexer: lexer{toks: []int{NUM, NUM}}}
+	errs := NewYYParser().ParseErrors(l)
+	if len(errs) != 1 || errs[0].Msg != "unexpected "+yySymName(NUM) {
+		t.Fatalf("got %v", errs)
+	}
+
+	if len(l.states) == 0 || l.states[len(l.states)-1] != errs[0].State {
+		t.Fatalf("states %v, error state %v", l.states, errs[0].State)
+	}
+
+	l = &plusLexer{lexer: lexer{toks: []int{NUM, NUM, '+', NUM}}}
+	if v, _ := yyParseResult(l); v.n != 0+1+3 {
+		t.Fatalf("got %v, exp 4", v.n)
+	}
+
+	l = &plusLexer{lexer: lexer{toks: []int{NUM, '+', '+'}}}
+	if err := yyParseErr(l); err == nil || err.Error() != "unexpected "+yySymName('+') {
+		t.Fatalf("got %v", err)
+	}
+}
+`)
+}
+
+func TestLexerExtensionsRuntime(t *testing.T) {
+	runParser(t, NewOptions(), `package parser
+
+import "testing"
+
+// spanLexer reports the token i as spanning 2*i to 2*i+1 and is at the
+// position 10*i.
+type spanLexer struct{ lexer }
+
+func (l *spanLexer) Span() (int, int) { return 2 * (l.i - 1), 2*(l.i-1) + 1 }
+
+func (l *spanLexer) Pos() int { return 10 * l.i }
+
+func TestSpan(t *testing.T) {
+	err := yyParseErr(&spanLexer{lexer{toks: []int{NUM, '+', NUM, NUM}}})
+	e, ok := err.(*yySyntaxError)
+	if !ok || e.Span != (yySpan{6, 7}) || e.Pos != 40 {
+		t.Fatalf("got %#v", err)
+	}
+
+	if err := yyParseErr(&spanLexer{lexer{toks: []int{NUM, '+', NUM}}}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// partialLexer records the values passed to Partial.
+type partialLexer struct {
+	lexer
+	stack string
+	n     int
+}
+
+func (l *partialLexer) Partial(values []yySymType) {
+	l.stack = yyStackString(values)
+	l.n = values[len(values)-1].n
+}
+
+func TestPartial(t *testing.T) {
+	l := &partialLexer{lexer: lexer{toks: []int{NUM, '+', NUM, '+', '+'}}}
+	if err := yyParseErr(l); err == nil {
+		t.Fatal("expected error")
+	}
+
+	if l.stack != "E '+'" {
+		t.Fatalf("got %q, exp %q", l.stack, "E '+'")
+	}
+
+	l = &partialLexer{lexer: lexer{toks: []int{NUM, '+', NUM}}}
+	if err := yyParseErr(l); err != nil || l.stack != "" {
+		t.Fatalf("got %v, %q", err, l.stack)
+	}
+}
+
+// errorExLexer records the errors passed to ErrorEx.
+type errorExLexer struct {
+	lexer
+	errs []*yySyntaxError
+}
+
+func (l *errorExLexer) ErrorEx(err *yySyntaxError) { l.errs = append(l.errs, err) }
+
+func TestErrorEx(t *testing.T) {
+	l := &errorExLexer{lexer: lexer{toks: []int{NUM, NUM}}}
+	err := yyParseErr(l)
+	if len(l.errs) != 1 || l.errs[0] != err || l.errs[0].Msg != "unexpected "+yySymName(NUM) {
+		t.Fatalf("got %v, %v", l.errs, err)
+	}
+
+	if len(l.lexer.errs) != 0 {
+		t.Fatalf("Error called with %q", l.lexer.errs)
+	}
+
+	l = &errorExLexer{lexer: lexer{toks: []int{NUM}}}
+	if err := yyParseErr(l); err != nil || len(l.errs) != 0 {
+		t.Fatalf("got %v, %v", err, l.errs)
+	}
+}
+`)
+}
+
+func TestRecoveredErrorRuntime(t *testing.T) {
+	grammar := strings.Replace(runGrammar, "| NUM\n", "| NUM | error\n", 1)
+	o := NewOptions()
+	o.Cancel = 1
+	runGrammarParser(t, grammar, o, `package parser
+
+import (
+	"context"
+	"testing"
+)
+
+func TestRecovered(t *testing.T) {
+	// The error rule recovers, so the parse succeeds.
+	toks := []int{NUM, NUM}
+	l := &lexer{toks: toks}
+	if g := yyParse(l); g != 0 || len(l.errs) != 1 {
+		t.Fatalf("got %v, %q", g, l.errs)
+	}
+
+	for _, err := range []error{
+		yyParseErr(&lexer{toks: toks}),
+		func() error { _, err := yyParseResult(&lexer{toks: toks}); return err }(),
+		yyParseContext(context.Background(), &lexer{toks: toks}),
+	} {
+		if err == nil || err.Error() != "unexpected "+yySymName(NUM) {
+			t.Fatalf("got %v", err)
+		}
+	}
+
+	if err := yyParseErr(&lexer{toks: []int{NUM, '+', NUM}}); err != nil {
+		t.Fatal(err)
+	}
+}
+`)
+}
+
+func TestLexGuardRuntime(t *testing.T) {
+	grammar := strings.Replace(runGrammar, "| NUM\n", "| NUM | error\n", 1)
+	o := NewOptions()
+	o.LexGuard = 5
+	runGrammarParser(t, grammar, o, `package parser
+
+import (
+	"strings"
+	"testing"
+)
+
+// stuckLexer returns NUM forever, or until it returned max tokens.
+type stuckLexer struct {
+	lexer
+	max int
+}
+
+func (l *stuckLexer) Lex(lval *yySymType) int {
+	if l.i == l.max {
+		return 0
+	}
+
+	l.i++
+	return NUM
+}
+
+// posLexer is a stuckLexer reporting the position pos.
+type posLexer struct {
+	stuckLexer
+	pos int
+}
+
+func (l *posLexer) Pos() int { return l.pos }
+
+// constPosLexer is a lexer reporting the same position for all its tokens.
+type constPosLexer struct{ lexer }
+
+func (l *constPosLexer) Pos() int { return 42 }
+
+func TestStuck(t *testing.T) {
+	for _, l := range []yyLexer{
+		&stuckLexer{max: 1000},
+		&posLexer{stuckLexer{max: 1000}, 7},
+	} {
+		if g := yyParse(l); g != 1 {
+			t.Fatalf("%T: got %v, exp 1", l, g)
+		}
+
+		var errs []string
+		var n int
+		switch x := l.(type) {
+		case *stuckLexer:
+			errs, n = x.errs, x.i
+		case *posLexer:
+			errs, n = x.errs, x.i
+		}
+		if n >= 1000 || len(errs) == 0 || !strings.HasPrefix(errs[len(errs)-1], "lexer makes no progress, returned 5 tokens") {
+			t.Fatalf("%T: %d tokens, errors %q", l, n, errs)
+		}
+	}
+}
+
+func TestShiftedAtOnePosition(t *testing.T) {
+	toks := []int{NUM, '+', NUM, '+', NUM, '+', NUM, '+', NUM}
+	v, err := yyParseResult(&constPosLexer{lexer{toks: toks}})
+	if err != nil || v.n != 0+2+4+6+8 {
+		t.Fatalf("got %v, %v, exp 20", v.n, err)
+	}
+}
+`)
+}
+
+func TestPushRuntime(t *testing.T) {
+	grammar := "%define api.push-pull push\n" + runGrammar
+	ptr := NewOptions()
+	ptr.PtrStack, ptr.LexGuard = true, 5
+	for _, o := range []*Options{NewOptions(), ptr} {
+		runGrammarParser(t, grammar, o, `package parser
+
+import (
+	"runtime"
+	"testing"
+)
+
+// acceptTracer records the value of the start symbol.
+type acceptTracer struct {
+	val *int
+	panicShift bool
+}
+
+func (t acceptTracer) Shift(state, sym int, val *yySymType) {
+	if t.panicShift {
+		panic("shift")
+	}
+}
+
+func (acceptTracer) Reduce(rule, state, sym int, val *yySymType) {}
+func (acceptTracer) ErrorRecovery(state, sym int)                {}
+func (t acceptTracer) Accept(state int, val *yySymType)         { *t.val = val.n }
+
+func TestPush(t *testing.T) {
+	var n int
+	p := yyNewParser()
+	p.Tracer = acceptTracer{val: &n}
+	for i, v := range []struct{ tok, n, exp int }{
+		{NUM, 1, yyPushMore},
+		{'+', 0, yyPushMore},
+		{NUM, 2, yyPushMore},
+		{'+', 0, yyPushMore},
+		{NUM, 3, yyPushMore},
+		{0, 0, yyPushAccepted},
+		{NUM, 4, yyPushAccepted},
+	} {
+		if g := p.Push(v.tok, &yySymType{n: v.n}); g != v.exp {
+			t.Fatalf("%v: got %v, exp %v", i, g, v.exp)
+		}
+	}
+	if n != 6 || len(p.Errs) != 0 {
+		t.Fatalf("got %v, %q", n, p.Errs)
+	}
+}
+
+func TestPushError(t *testing.T) {
+	p := yyNewParser()
+	if g := p.Push(NUM, nil); g != yyPushMore {
+		t.Fatalf("got %v", g)
+	}
+
+	if g := p.Push(NUM, nil); g != yyPushError || len(p.Errs) != 1 || p.Errs[0] != "unexpected "+yySymName(NUM) {
+		t.Fatalf("got %v, %q", g, p.Errs)
+	}
+
+	if g := p.Push(0, nil); g != yyPushError {
+		t.Fatalf("got %v", g)
+	}
+}
+
+func TestPushMaxDepth(t *testing.T) {
+	var p yyPushParser
+	p.MaxDepth = 2
+	p.Push(NUM, nil)
+	if g := p.Push('+', nil); g != yyPushError || len(p.Errs) != 1 || p.Errs[0] != "stack overflow" {
+		t.Fatalf("got %v, %q", g, p.Errs)
+	}
+}
+
+func TestPushPanic(t *testing.T) {
+	var n int
+	p := yyNewParser()
+	p.Tracer = acceptTracer{val: &n, panicShift: true}
+	func() {
+		defer func() {
+			if e := recover(); e != "shift" {
+				t.Fatalf("got %v", e)
+			}
+		}()
+
+		p.Push(NUM, nil)
+		t.Fatal("no panic")
+	}()
+	if g := p.Push(0, nil); g != yyPushError {
+		t.Fatalf("got %v", g)
+	}
+}
+
+func TestPushAbandoned(t *testing.T) {
+	n := runtime.NumGoroutine()
+	for i := 0; i < 100; i++ {
+		yyNewParser().Push(NUM, nil)
+	}
+	if g := runtime.NumGoroutine(); g != n {
+		t.Fatalf("got %v goroutines, exp %v", g, n)
+	}
+}
+`)
+	}
+}
+
+func TestCheckOutput(t *testing.T) {
+	dir, err := ioutil.TempDir("", "goyacc-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	fn := filepath.Join(dir, "y.go")
+	if err := ioutil.WriteFile(fn, []byte("a\nb\nc\nd\n"), 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := checkOutput(fn, []byte("a\nb\nc\nd\n")); err != nil {
+		t.Fatal(err)
+	}
+
+	err = checkOutput(fn, []byte("a\nB\nC\nx\nd\n"))
+	if err == nil {
+		t.Fatal("expected error")
+	}
+
+	if g, e := err.Error(), fn+": parser output is out of date, 2 lines at line 2 would be replaced by 3 lines\n-b\n-c\n+B\n+C\n+x"; g != e {
+		t.Fatalf("got %q, exp %q", g, e)
+	}
+}
+
+func TestCheckSideOutputs(t *testing.T) {
+	dir, err := ioutil.TempDir("", "goyacc-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	in := filepath.Join(dir, "t.y")
+	for nm, s := range map[string]string{
+		in:                           "%{\npackage calc\n%}\n%token NUM\n%%\nE: E '+' NUM | NUM\n",
+		filepath.Join(dir, "go.mod"): "module calc\n",
+	} {
+		if err := ioutil.WriteFile(nm, []byte(s), 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	o := NewOptions()
+	o.Out, o.Report = filepath.Join(dir, "y.go"), os.DevNull
+	o.Freeze, o.Tokens = filepath.Join(dir, "tokens.freeze"), filepath.Join(dir, "tok", "tokens.go")
+	if err := Generate(in, o); err != nil {
+		t.Fatal(err)
+	}
+
+	o.Check = true
+	if err := Generate(in, o); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestTokensPackage(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipped in short mode")
+	}
+
+	if _, err := exec.LookPath("go"); err != nil {
+		t.Skip(err)
+	}
+
+	dir, err := ioutil.TempDir("", "goyacc-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	test := `package parser
+
+import (
+	"testing"
+
+	"example.com/calc/internal/token"
+)
+
+type lexer struct{ toks []int }
+
+func (l *lexer) Lex(lval *yySymType) int {
+	if len(l.toks) == 0 {
+		return 0
+	}
+
+	t := l.toks[0]
+	l.toks = l.toks[1:]
+	return t
+}
+
+func (l *lexer) Error(s string) {}
+
+func TestParse(t *testing.T) {
+	if err := yyParseErr(&lexer{[]int{token.NUM, '+', token.NUM}}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := yyParseErr(&lexer{[]int{token.NUM, token.NUM}}); err == nil {
+		t.Fatal("expected error")
+	}
+
+	if g, e := token.YyTokenNames[NUM], "NUM"; g != e {
+		t.Fatalf("got %q, exp %q", g, e)
+	}
+}
+`
+	in := filepath.Join(dir, "calc.y")
+	for nm, s := range map[string]string{
+		in:                           runGrammar,
+		filepath.Join(dir, "go.mod"): "module example.com/calc\n\ngo 1.18\n",
+		filepath.Join(dir, "internal", "parser", "y_test.go"): test,
+	} {
+		if err := os.MkdirAll(filepath.Dir(nm), 0775); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := ioutil.WriteFile(nm, []byte(s), 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	o := NewOptions()
+	o.OutDir, o.Report = filepath.Join(dir, "internal", "parser"), os.DevNull
+	o.Tokens = filepath.Join(dir, "internal", "token", "tokens.go")
+	if err := Generate(in, o); err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := ioutil.ReadFile(filepath.Join(o.OutDir, "y.go"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, v := range []string{`__yytokens__ "example.com/calc/internal/token"`, "NUM = __yytokens__.NUM"} {
+		if !bytes.Contains(b, []byte(v)) {
+			t.Fatalf("no %q in\n%s", v, b)
+		}
+	}
+
+	cmd := exec.Command("go", "test", "./...")
+	cmd.Dir = dir
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("%v\n%s", err, out)
+	}
+}
+
+func TestFilterTextReport(t *testing.T) {
+	var buf bytes.Buffer
+	src := "header\nstate 0 //\n\n    a\n\nstate 1 // x\n\n    b\n\nstate 12 // y\n\n    c\n"
+	if err := filterTextReport(&buf, []byte(src), map[int]bool{1: true}); err != nil {
+		t.Fatal(err)
+	}
+
+	if g, e := buf.String(), "header\nstate 1 // x\n\n    b\n\n"; g != e {
+		t.Fatalf("got %q, exp %q", g, e)
+	}
+}
@@ -0,0 +1,573 @@
+// Copyright 2014 The goyacc Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gen
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"go/format"
+	"go/parser"
+	"go/scanner"
+	"go/token"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cznic/y"
+)
+
+const benchFile = "goyacc_bench_test.go"
+
+// benchResult is the result of benchmarking the parse of a corpus file.
+type benchResult struct {
+	File        string  `json:"file"`
+	Bytes       int64   `json:"bytes"`
+	N           int     `json:"n"`
+	NsPerOp     float64 `json:"nsPerOp"`
+	MBPerS      float64 `json:"mbPerS,omitempty"`
+	BytesPerOp  int64   `json:"bytesPerOp"`
+	AllocsPerOp int64   `json:"allocsPerOp"`
+}
+
+// benchReport is the JSON document written by goyacc bench run.
+type benchReport struct {
+	Time          time.Time      `json:"time"`
+	GoyaccVersion string         `json:"goyaccVersion"` // Generating the parser.
+	Fingerprint   string         `json:"fingerprint"`   // Of the parser.
+	GoVersion     string         `json:"goVersion"`     // Of the toolchain running the benchmarks.
+	GOOS          string         `json:"goos"`
+	GOARCH        string         `json:"goarch"`
+	Package       string         `json:"package"`
+	Corpus        string         `json:"corpus"`
+	Func          string         `json:"func"`
+	Results       []*benchResult `json:"results"`
+}
+
+// benchStamp matches the goyacc version and fingerprint constants of a parser
+// output.
+var benchStamp = regexp.MustCompile(`(?m)^\s*\w*(GoyaccVersion|Fingerprint)\s*=\s*("[^"]*")`)
+
+// Bench implements the bench command of goyacc, args are its arguments.
+func Bench(args []string) error {
+	if len(args) == 0 || args[0] != "run" {
+		return fmt.Errorf("usage: goyacc bench run [options]")
+	}
+
+	fs := flag.NewFlagSet("bench run", flag.ContinueOnError)
+	benchTime := fs.String("benchtime", "", "passed to go test -benchtime")
+	corpus := fs.String("corpus", "", "directory of the input files")
+	count := fs.Int("count", 1, "passed to go test -count")
+	fn := fs.String("func", "benchParse", "name of the func([]byte) error parsing its argument")
+	out := fs.String("o", "", "JSON output file, standard output if empty")
+	pkg := fs.String("pkg", ".", "directory of the generated parser package")
+	if err := fs.Parse(args[1:]); err != nil {
+		return err
+	}
+
+	if *corpus == "" {
+		return fmt.Errorf("bench run: missing -corpus")
+	}
+
+	files, err := benchCorpus(*corpus)
+	if err != nil {
+		return err
+	}
+
+	nm, err := benchPackage(*pkg)
+	if err != nil {
+		return err
+	}
+
+	rep := &benchReport{
+		GOOS:    runtime.GOOS,
+		GOARCH:  runtime.GOARCH,
+		Package: *pkg,
+		Corpus:  *corpus,
+		Func:    *fn,
+	}
+	if rep.GoyaccVersion, rep.Fingerprint, err = benchParser(*pkg); err != nil {
+		return err
+	}
+
+	goenv := exec.Command("go", "env", "GOVERSION")
+	goenv.Dir = *pkg
+	b, err := goenv.Output()
+	if err != nil {
+		return fmt.Errorf("bench run: go env GOVERSION: %v", err)
+	}
+
+	rep.GoVersion = strings.TrimSpace(string(b))
+
+	test := filepath.Join(*pkg, benchFile)
+	if _, err := os.Stat(test); err == nil {
+		return fmt.Errorf("bench run: %s exists", test)
+	}
+
+	if err := ioutil.WriteFile(test, benchSource(nm, *fn, files), 0666); err != nil {
+		return err
+	}
+
+	defer os.Remove(test)
+
+	a := []string{"test", "-run", "^$", "-bench", "^BenchmarkGoyacc$", "-benchmem", "-count", strconv.Itoa(*count)}
+	if *benchTime != "" {
+		a = append(a, "-benchtime", *benchTime)
+	}
+	cmd := exec.Command("go", a...)
+	cmd.Dir = *pkg
+	if b, err = cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("bench run: %v\n%s", err, b)
+	}
+
+	if rep.Results, err = parseBenchOutput(bytes.NewReader(b), files); err != nil {
+		return err
+	}
+
+	rep.Time = time.Now().UTC()
+	if abs, err := filepath.Abs(*pkg); err == nil {
+		rep.Package = abs
+	}
+	if abs, err := filepath.Abs(*corpus); err == nil {
+		rep.Corpus = abs
+	}
+	j, err := json.MarshalIndent(rep, "", "\t")
+	if err != nil {
+		return err
+	}
+
+	j = append(j, '\n')
+	if *out == "" {
+		_, err = os.Stdout.Write(j)
+		return err
+	}
+
+	return ioutil.WriteFile(*out, j, 0666)
+}
+
+// benchCorpus returns the absolute paths of the regular files in dir, sorted.
+func benchCorpus(dir string) ([]string, error) {
+	fis, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var r []string
+	for _, fi := range fis {
+		if !fi.Mode().IsRegular() {
+			continue
+		}
+
+		fn, err := filepath.Abs(filepath.Join(dir, fi.Name()))
+		if err != nil {
+			return nil, err
+		}
+
+		r = append(r, fn)
+	}
+	if len(r) == 0 {
+		return nil, fmt.Errorf("bench run: no files in %s", dir)
+	}
+
+	sort.Strings(r)
+	return r, nil
+}
+
+// benchName returns the sub-benchmark name of the corpus file fn.
+func benchName(fn string) string {
+	return strings.Map(func(r rune) rune {
+		if r <= ' ' || r == '/' {
+			return '_'
+		}
+
+		return r
+	}, filepath.Base(fn))
+}
+
+// benchPackage returns the package name of the Go package in dir.
+func benchPackage(dir string) (string, error) {
+	fns, err := filepath.Glob(filepath.Join(dir, "*.go"))
+	if err != nil {
+		return "", err
+	}
+
+	for _, fn := range fns {
+		if strings.HasSuffix(fn, "_test.go") {
+			continue
+		}
+
+		f, err := parser.ParseFile(token.NewFileSet(), fn, nil, parser.PackageClauseOnly)
+		if err != nil {
+			return "", err
+		}
+
+		return f.Name.Name, nil
+	}
+	return "", fmt.Errorf("bench run: no Go files in %s", dir)
+}
+
+// benchParser returns the goyacc version and the fingerprint of the parser
+// output in the package in dir.
+func benchParser(dir string) (version, fingerprint string, err error) {
+	fns, err := filepath.Glob(filepath.Join(dir, "*.go"))
+	if err != nil {
+		return "", "", err
+	}
+
+	for _, fn := range fns {
+		if strings.HasSuffix(fn, "_test.go") {
+			continue
+		}
+
+		b, err := ioutil.ReadFile(fn)
+		if err != nil {
+			return "", "", err
+		}
+
+		for _, m := range benchStamp.FindAllSubmatch(b, -1) {
+			s, err := strconv.Unquote(string(m[2]))
+			if err != nil {
+				return "", "", err
+			}
+
+			switch string(m[1]) {
+			case "GoyaccVersion":
+				version = s
+			default:
+				fingerprint = s
+			}
+		}
+		if version != "" && fingerprint != "" {
+			return version, fingerprint, nil
+		}
+	}
+	return "", "", fmt.Errorf("bench run: no parser output of goyacc in %s", dir)
+}
+
+// benchSource returns the source of the test file of package pkg
+// benchmarking fn on files.
+func benchSource(pkg, fn string, files []string) []byte {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, `// Code generated by goyacc bench run. DO NOT EDIT.
+
+package %s
+
+import (
+	"io/ioutil"
+	"testing"
+)
+
+func BenchmarkGoyacc(b *testing.B) {
+	for _, v := range []struct{ name, file string }{
+`, pkg)
+	for _, f := range files {
+		fmt.Fprintf(&buf, "\t\t{%q, %q},\n", benchName(f), f)
+	}
+	fmt.Fprintf(&buf, `	} {
+		src, err := ioutil.ReadFile(v.file)
+		if err != nil {
+			b.Fatal(err)
+		}
+
+		if err := %[1]s(src); err != nil {
+			b.Fatalf("%%s: %%v", v.file, err)
+		}
+
+		b.Run(v.name, func(b *testing.B) {
+			b.SetBytes(int64(len(src)))
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				%[1]s(src)
+			}
+		})
+	}
+}
+`, fn)
+	return buf.Bytes()
+}
+
+// writePoolBench writes the -poolbench test file of the parser output out
+// having the source src. The parser stack is a []stackElem made by the
+// expression newStack.
+func (g *generator) writePoolBench(out string, src []byte, stackElem, newStack string) error {
+	f, err := parser.ParseFile(token.NewFileSet(), out, src, parser.PackageClauseOnly)
+	if err != nil {
+		return err
+	}
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, `// Code generated by goyacc -poolbench. DO NOT EDIT.
+
+package %[2]s
+
+import "testing"
+
+var %[1]sBenchStack []%[4]s
+
+// Benchmark%[3]sStackPool measures getting the parser stack from the pool and
+// returning it, like the parser generated with -pool does.
+func Benchmark%[3]sStackPool(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		p := %[1]sPool.Get().(*[]%[4]s)
+		%[1]sPool.Put(p)
+	}
+}
+
+// Benchmark%[3]sStackMake measures allocating the parser stack, like the
+// parser generated without -pool does.
+func Benchmark%[3]sStackMake(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		%[1]sBenchStack = %[5]s
+	}
+}
+`, g.Prefix, f.Name.Name, g.exportedPrefix(), stackElem, newStack)
+	return ioutil.WriteFile(strings.TrimSuffix(out, ".go")+"_pool_test.go", buf.Bytes(), 0666)
+}
+
+var benchLine = regexp.MustCompile(`^BenchmarkGoyacc/(\S+?)(-\d+)?\s+(\d+)\s+(.*)$`)
+
+// parseBenchOutput returns the results reported by go test -bench -benchmem
+// in r. Repeated results of a file, see -count, are averaged.
+func parseBenchOutput(r io.Reader, files []string) ([]*benchResult, error) {
+	byName := map[string]*benchResult{}
+	var a []*benchResult
+	for _, f := range files {
+		fi, err := os.Stat(f)
+		if err != nil {
+			return nil, err
+		}
+
+		v := &benchResult{File: f, Bytes: fi.Size()}
+		byName[benchName(f)] = v
+		a = append(a, v)
+	}
+	runs := map[*benchResult]int{}
+	s := bufio.NewScanner(r)
+	for s.Scan() {
+		m := benchLine.FindStringSubmatch(s.Text())
+		if m == nil {
+			continue
+		}
+
+		v := byName[m[1]]
+		if v == nil {
+			continue
+		}
+
+		n, _ := strconv.Atoi(m[3])
+		runs[v]++
+		v.N += n
+		f := strings.Fields(m[4])
+		for i := 0; i+1 < len(f); i += 2 {
+			x, err := strconv.ParseFloat(f[i], 64)
+			if err != nil {
+				return nil, fmt.Errorf("bench run: cannot parse %q", s.Text())
+			}
+
+			switch f[i+1] {
+			case "ns/op":
+				v.NsPerOp += x
+			case "MB/s":
+				v.MBPerS += x
+			case "B/op":
+				v.BytesPerOp += int64(x)
+			case "allocs/op":
+				v.AllocsPerOp += int64(x)
+			}
+		}
+	}
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+
+	for _, v := range a {
+		n := runs[v]
+		if n == 0 {
+			return nil, fmt.Errorf("bench run: no result for %s", v.File)
+		}
+
+		v.NsPerOp /= float64(n)
+		v.MBPerS /= float64(n)
+		v.BytesPerOp /= int64(n)
+		v.AllocsPerOp /= int64(n)
+	}
+	return a, nil
+}
+
+// writeBench writes the -bench test file of the parser output out having the
+// source src. The benchmark parses a shortest sentence of the grammar of p
+// and the examples of the -xe file, having the source xerrors, if any.
+func (g *generator) writeBench(out string, src []byte, p *y.Parser, xerrors []byte) error {
+	f, err := parser.ParseFile(token.NewFileSet(), out, src, parser.PackageClauseOnly)
+	if err != nil {
+		return err
+	}
+
+	var inputs [][]*y.Symbol
+	if s := shortestSentence(p); s != nil {
+		inputs = append(inputs, s)
+	}
+	inputs = append(inputs, xeExamples(p, xerrors)...)
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, `// Code generated by goyacc -bench. DO NOT EDIT.
+
+package %[2]s
+
+import "testing"
+
+// %[1]sBenchInputs are the token sequences parsed by Benchmark%[3]sParse.
+var %[1]sBenchInputs = [][]int{
+`, g.Prefix, f.Name.Name, g.exportedPrefix())
+	for _, v := range inputs {
+		var vals, names []string
+		for _, sym := range v {
+			vals = append(vals, strconv.Itoa(sym.Value))
+			names = append(names, sym.Name)
+		}
+		fmt.Fprintf(&buf, "\t{%s}, // %s\n", strings.Join(vals, ", "), strings.Join(names, " "))
+	}
+	fmt.Fprintf(&buf, `}
+
+// %[1]sBenchLexer is a lexer returning the tokens of an input, having zero
+// values.
+type %[1]sBenchLexer struct {
+	toks []int
+}
+
+func (l *%[1]sBenchLexer) Lex(lval *%[1]sSymType) int {
+	if len(l.toks) == 0 {
+		return 0
+	}
+
+	t := l.toks[0]
+	l.toks = l.toks[1:]
+	return t
+}
+
+func (l *%[1]sBenchLexer) Error(s string) {}
+
+// Benchmark%[2]sParse measures parsing %[1]sBenchInputs by a reused parser.
+// The rule actions get zero semantic values and a *%[1]sBenchLexer.
+func Benchmark%[2]sParse(b *testing.B) {
+	var p %[1]sParser
+	var l %[1]sBenchLexer
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		for _, v := range %[1]sBenchInputs {
+			l.toks = v
+			p.Parse(&l)
+		}
+	}
+}
+`, g.Prefix, g.exportedPrefix())
+	b, err := format.Source(buf.Bytes())
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(strings.TrimSuffix(out, ".go")+"_bench_test.go", b, 0666)
+}
+
+// shortestSentence returns a shortest sequence of terminals derived from the
+// start symbol of p, less the end of input, or nil if there is none. Rules
+// using the error token are not used.
+func shortestSentence(p *y.Parser) []*y.Symbol {
+	accept := p.Syms["$accept"]
+	if accept == nil {
+		return nil
+	}
+
+	var names []string
+	for nm, sym := range p.Syms {
+		if !sym.IsTerminal {
+			names = append(names, nm)
+		}
+	}
+	sort.Strings(names)
+	best := map[string][]*y.Symbol{} // Nonterminal: shortest derived terminals.
+	for changed := true; changed; {
+		changed = false
+		for _, nm := range names {
+		rules:
+			for _, rule := range p.Syms[nm].Rules {
+				var s []*y.Symbol
+				for _, c := range rule.Components {
+					sym := p.Syms[c]
+					switch {
+					case sym == nil || c == "error":
+						continue rules
+					case sym.IsTerminal:
+						if c != "$end" {
+							s = append(s, sym)
+						}
+					default:
+						t, ok := best[c]
+						if !ok {
+							continue rules
+						}
+
+						s = append(s, t...)
+					}
+				}
+				if t, ok := best[nm]; !ok || len(s) < len(t) {
+					best[nm] = s
+					changed = true
+				}
+			}
+		}
+	}
+	return best["$accept"]
+}
+
+// xeExamples returns the token sequences of the examples in the -xe source
+// src. Examples having other than terminals are ignored.
+func xeExamples(p *y.Parser, src []byte) (r [][]*y.Symbol) {
+	var s scanner.Scanner
+	fset := token.NewFileSet()
+	s.Init(fset.AddFile("", -1, len(src)), src, nil, 0)
+	var ex []*y.Symbol
+	ok, msg := true, false // Example has only terminals, in the message part of a group.
+	for {
+		_, tok, lit := s.Scan()
+		switch tok {
+		case token.EOF:
+			return r
+		case token.OR:
+			msg = true
+		case token.IDENT, token.CHAR:
+			if msg {
+				break
+			}
+
+			if sym := p.Syms[lit]; sym != nil && sym.IsTerminal && sym.Value > 0 {
+				ex = append(ex, sym)
+				break
+			}
+
+			ok = false
+		case token.SEMICOLON:
+			if ok && len(ex) != 0 {
+				r = append(r, ex)
+			}
+			ex, ok = nil, true
+			if lit == "\n" && msg {
+				msg = false
+			}
+		}
+	}
+}
@@ -0,0 +1,59 @@
+// Copyright 2014 The goyacc Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gen
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+)
+
+// checkOutput returns an error summarizing the difference of the file fn
+// and the parser output b, if any.
+func checkOutput(fn string, b []byte) error {
+	old, err := ioutil.ReadFile(fn)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return fmt.Errorf("%s: parser output does not exist", fn)
+		}
+
+		return err
+	}
+
+	if bytes.Equal(old, b) {
+		return nil
+	}
+
+	x, y := bytes.SplitAfter(old, []byte("\n")), bytes.SplitAfter(b, []byte("\n"))
+	i := 0 // Common leading lines.
+	for i < len(x) && i < len(y) && bytes.Equal(x[i], y[i]) {
+		i++
+	}
+	j := 0 // Common trailing lines.
+	for j < len(x)-i && j < len(y)-i && bytes.Equal(x[len(x)-1-j], y[len(y)-1-j]) {
+		j++
+	}
+	x, y = x[i:len(x)-j], y[i:len(y)-j]
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "%s: parser output is out of date, %d lines at line %d would be replaced by %d lines", fn, len(x), i+1, len(y))
+	for _, v := range []struct {
+		prefix string
+		lines  [][]byte
+	}{
+		{"-", x},
+		{"+", y},
+	} {
+		for k, line := range v.lines {
+			if k == 3 {
+				fmt.Fprintf(&buf, "\n%s...", v.prefix)
+				break
+			}
+
+			fmt.Fprintf(&buf, "\n%s%s", v.prefix, bytes.TrimRight(line, "\n"))
+		}
+	}
+	return fmt.Errorf("%s", buf.Bytes())
+}
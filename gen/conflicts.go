@@ -0,0 +1,97 @@
+// Copyright 2014 The goyacc Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gen
+
+import (
+	"encoding/json"
+	"io"
+
+	"github.com/cznic/y"
+)
+
+// conflictsDoc is the -conflicts json document.
+type conflictsDoc struct {
+	ShiftReduce  int              `json:"shiftReduce"`  // Unresolved shift/reduce conflicts.
+	ReduceReduce int              `json:"reduceReduce"` // Unresolved reduce/reduce conflicts.
+	Conflicts    []conflictRecord `json:"conflicts"`
+}
+
+// conflictRecord is a conflict of the actions of a state on a lookahead
+// terminal.
+type conflictRecord struct {
+	State      int            `json:"state"` // -1 if not in the table.
+	Lookahead  string         `json:"lookahead"`
+	Kind       string         `json:"kind"`             // "shift/reduce", "reduce/reduce" or both, like "shift/reduce/reduce".
+	Shifts     []conflictRule `json:"shifts,omitempty"` // The rules shifting the lookahead in the state.
+	Reduces    []conflictRule `json:"reduces"`
+	Resolution string         `json:"resolution,omitempty"` // "shift", "reduce" or "error".
+	Rule       int            `json:"rule,omitempty"`       // Rule reduced by the resolution.
+	Precedence bool           `json:"precedence"`           // Resolved by precedence and/or associativity.
+}
+
+// conflictRule is a rule involved in a conflict.
+type conflictRule struct {
+	Rule     int    `json:"rule"`
+	Text     string `json:"text"`               // Like expr: expr '+' expr.
+	Position string `json:"position,omitempty"` // Of the rule in the grammar, like expr.y:12:3.
+}
+
+// writeConflicts writes the conflicts of p to w in the -conflicts format,
+// which is json.
+func (g *generator) writeConflicts(w io.Writer, p *y.Parser, pp *preprocessed) error {
+	a, err := g.analyze(p)
+	if err != nil {
+		return err
+	}
+
+	rules := matchRules(p, pp.rules)
+	rule := func(r int) conflictRule {
+		v := conflictRule{Rule: r, Text: ruleText(p.Rules[r])}
+		if x := rules[r]; x != nil {
+			v.Position = x.pos.String()
+		}
+		return v
+	}
+	doc := &conflictsDoc{ShiftReduce: p.ConflictsSR, ReduceReduce: p.ConflictsRR, Conflicts: []conflictRecord{}}
+	for _, c := range a.conflicts {
+		v := conflictRecord{State: c.state.n, Lookahead: a.syms[c.sym].Name, Reduces: []conflictRule{}, Precedence: c.prec}
+		switch {
+		case c.shift && len(c.reduces) > 1:
+			v.Kind = "shift/reduce/reduce"
+		case c.shift:
+			v.Kind = "shift/reduce"
+		default:
+			v.Kind = "reduce/reduce"
+		}
+		if c.shift {
+			seen := map[int]bool{}
+			for _, it := range c.state.items {
+				if rhs := a.rhs[it.rule]; it.dot < len(rhs) && rhs[it.dot] == c.sym && !seen[it.rule] {
+					seen[it.rule] = true
+					v.Shifts = append(v.Shifts, rule(it.rule))
+				}
+			}
+		}
+		for _, r := range c.reduces {
+			v.Reduces = append(v.Reduces, rule(r))
+		}
+		switch c.resolution {
+		case 'e':
+			v.Resolution = "error"
+		case 'r':
+			v.Resolution, v.Rule = "reduce", c.rule
+		case 's':
+			v.Resolution = "shift"
+		}
+		doc.Conflicts = append(doc.Conflicts, v)
+	}
+	b, err := json.MarshalIndent(doc, "", "\t")
+	if err != nil {
+		return err
+	}
+
+	_, err = w.Write(append(b, '\n'))
+	return err
+}
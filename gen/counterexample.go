@@ -0,0 +1,333 @@
+// Copyright 2014 The goyacc Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gen
+
+import (
+	"bufio"
+	"fmt"
+	"go/token"
+	"io"
+	"strings"
+
+	"github.com/cznic/y"
+)
+
+// stateItem is an item of a state of the automaton. Unless negative, la is
+// the terminal that must follow the completion of the item.
+type stateItem struct {
+	s  *lrState
+	it item
+	la int
+}
+
+// derivation returns the items of the shortest derivation reaching it in the
+// state s from the start item of state 0, outermost first. Each item is the
+// one whose symbol after the dot derives the next one. If la is not negative
+// la must follow the completion of it.
+func (a *automaton) derivation(s *lrState, it item, la int) []item {
+	preds := map[*lrState][]*lrState{}
+	for _, v := range a.states {
+		for _, t := range v.next {
+			preds[t] = append(preds[t], v)
+		}
+	}
+	type step struct {
+		next       stateItem
+		production bool
+	}
+	start := stateItem{s, it, la}
+	seen := map[stateItem]step{start: {}}
+	queue := []stateItem{start}
+	var goal *stateItem
+	for len(queue) != 0 && goal == nil {
+		v := queue[0]
+		queue = queue[1:]
+		add := func(u stateItem, production bool) {
+			if _, ok := seen[u]; ok {
+				return
+			}
+
+			seen[u] = step{v, production}
+			if u.s == a.states[0] && u.it == (item{}) && (u.la < 0 || u.la == a.end) {
+				goal = &u
+			}
+			queue = append(queue, u)
+		}
+		if v.it.dot != 0 {
+			sym := a.rhs[v.it.rule][v.it.dot-1]
+			for _, u := range preds[v.s] {
+				if u.next[sym] == v.s {
+					add(stateItem{u, item{v.it.rule, v.it.dot - 1}, v.la}, false)
+				}
+			}
+			continue
+		}
+
+		lhs := a.index[a.p.Rules[v.it.rule].Sym]
+		for _, jt := range v.s.items {
+			rhs := a.rhs[jt.rule]
+			if jt.dot == len(rhs) || rhs[jt.dot] != lhs {
+				continue
+			}
+
+			la := v.la
+			if la >= 0 {
+				f := a.newSymSet()
+				nullable := a.firstSeq(f, rhs[jt.dot+1:])
+				switch {
+				case f.has(la):
+					la = -1
+				case !nullable:
+					continue
+				}
+			}
+			add(stateItem{v.s, jt, la}, true)
+		}
+	}
+	if goal == nil {
+		return nil
+	}
+
+	r := []item{goal.it}
+	for v := *goal; v != start; {
+		st := seen[v]
+		if st.production {
+			r = append(r, st.next.it)
+		} else {
+			r[len(r)-1] = st.next.it
+		}
+		v = st.next
+	}
+	return r
+}
+
+// derivationString returns the derivation d, skipping the start rule, in the
+// form
+//
+//	e → [ e '+' e → [ e • '+' e ] ]
+//
+// and the sentential form it derives, like e '+' e • '+' e.
+func (a *automaton) derivationString(d []item) (deriv, example string) {
+	if len(d) > 1 && d[0].rule == 0 {
+		d = d[1:]
+	}
+	var prefix, suffix []string
+	var render func(d []item) string
+	render = func(d []item) string {
+		it := d[0]
+		rhs := a.rhs[it.rule]
+		var b []string
+		for _, sym := range rhs[:it.dot] {
+			b = append(b, a.syms[sym].Name)
+			prefix = append(prefix, a.syms[sym].Name)
+		}
+		rest := rhs[it.dot:]
+		if len(d) == 1 {
+			b = append(b, "•")
+		} else {
+			b = append(b, render(d[1:]))
+			rest = rest[1:]
+		}
+		var s []string
+		for _, sym := range rest {
+			if sym != a.end {
+				b = append(b, a.syms[sym].Name)
+				s = append(s, a.syms[sym].Name)
+			}
+		}
+		suffix = append(suffix, s...)
+		return fmt.Sprintf("%s → [ %s ]", a.p.Rules[it.rule].Sym.Name, strings.Join(b, " "))
+	}
+	deriv = render(d)
+	return deriv, strings.Join(append(append(prefix, "•"), suffix...), " ")
+}
+
+// counterexamples returns a warning for each conflict not resolved by
+// precedence, showing the derivations of the competing actions.
+func (g *generator) counterexamples(p *y.Parser, pp *preprocessed) (warnings, error) {
+	a, err := g.analyze(p)
+	if err != nil {
+		return nil, err
+	}
+
+	rules := matchRules(p, pp.rules)
+	var w warnings
+	for _, c := range a.conflicts {
+		if c.prec {
+			continue
+		}
+
+		var kind []string
+		if c.shift {
+			kind = append(kind, "shift/reduce")
+		}
+		if len(c.reduces) > 1 {
+			kind = append(kind, "reduce/reduce")
+		}
+		type shown struct{ what, deriv, example string }
+		var shows []shown
+		show := func(what string, d []item) {
+			if d == nil {
+				shows = append(shows, shown{what: what})
+				return
+			}
+
+			deriv, example := a.derivationString(d)
+			shows = append(shows, shown{what, deriv, example})
+		}
+		if c.shift {
+			for _, it := range c.state.items {
+				if rhs := a.rhs[it.rule]; it.dot < len(rhs) && rhs[it.dot] == c.sym {
+					show("Shift", a.derivation(c.state, it, -1))
+					break
+				}
+			}
+		}
+		for _, r := range c.reduces {
+			show("Reduce", a.derivation(c.state, item{r, len(a.rhs[r])}, c.sym))
+		}
+		var b strings.Builder
+		fmt.Fprintf(&b, "%s conflict on %s in state %s", strings.Join(kind, " and "), a.syms[c.sym].Name, stateName(c.state))
+		unified := true
+		for _, v := range shows {
+			unified = unified && v.example == shows[0].example
+		}
+		if unified && shows[0].example != "" {
+			fmt.Fprintf(&b, "\n  Example: %s", shows[0].example)
+		}
+		for _, v := range shows {
+			switch {
+			case v.deriv == "":
+				fmt.Fprintf(&b, "\n  %s derivation not found", v.what)
+			case unified:
+				fmt.Fprintf(&b, "\n  %s derivation: %s", v.what, v.deriv)
+			default:
+				fmt.Fprintf(&b, "\n  Example: %s\n  %s derivation: %s", v.example, v.what, v.deriv)
+			}
+		}
+		var pos token.Position
+		if v := rules[c.reduces[0]]; v != nil {
+			pos = v.pos
+		}
+		w.add("counterexamples", pos, b.String())
+	}
+	return w, nil
+}
+
+// derivationSteps returns the derivation d, skipping the start rule, as the
+// sentential forms derived from the start symbol, the symbols produced by
+// each step enclosed in brackets and the last form having a • at the dot of
+// the last item, like
+//
+//	e
+//	[ e '+' e ]
+//	e '+' [ e • '+' e ]
+func (a *automaton) derivationSteps(d []item) []string {
+	if len(d) > 1 && d[0].rule == 0 {
+		d = d[1:]
+	}
+	names := func(syms []int) (r []string) {
+		for _, sym := range syms {
+			if sym != a.end {
+				r = append(r, a.syms[sym].Name)
+			}
+		}
+		return r
+	}
+	steps := []string{a.p.Rules[d[0].rule].Sym.Name}
+	var prefix, suffix []string
+	form := func(a ...[]string) string {
+		var r []string
+		for _, v := range a {
+			r = append(r, v...)
+		}
+		return strings.Join(r, " ")
+	}
+	for _, it := range d[:len(d)-1] {
+		rhs := a.rhs[it.rule]
+		steps = append(steps, form(prefix, []string{"["}, names(rhs), []string{"]"}, suffix))
+		prefix = append(prefix, names(rhs[:it.dot])...)
+		suffix = append(names(rhs[it.dot+1:]), suffix...)
+	}
+	it := d[len(d)-1]
+	rhs := a.rhs[it.rule]
+	return append(steps, form(prefix, []string{"["}, names(rhs[:it.dot]), []string{"•"}, names(rhs[it.dot:]), []string{"]"}, suffix))
+}
+
+// conflictTrace is the derivation reaching an action of a conflict.
+type conflictTrace struct {
+	action string   // Like shift E: E . '+' E or reduce E: E '+' E . on '+'.
+	steps  []string // The sentential forms of derivationSteps, nil if not found.
+}
+
+// conflictTraces returns the derivations reaching the competing actions of c.
+func (a *automaton) conflictTraces(c *conflict) []conflictTrace {
+	var r []conflictTrace
+	trace := func(action string, d []item) {
+		v := conflictTrace{action: action}
+		if d != nil {
+			v.steps = a.derivationSteps(d)
+		}
+		r = append(r, v)
+	}
+	if c.shift {
+		for _, it := range c.state.items {
+			if rhs := a.rhs[it.rule]; it.dot < len(rhs) && rhs[it.dot] == c.sym {
+				trace("shift "+a.ruleString(it.rule, it.dot), a.derivation(c.state, it, -1))
+				break
+			}
+		}
+	}
+	for _, rule := range c.reduces {
+		it := item{rule, len(a.rhs[rule])}
+		trace(fmt.Sprintf("reduce %s on %s", a.ruleString(it.rule, it.dot), a.syms[c.sym].Name), a.derivation(c.state, it, c.sym))
+	}
+	return r
+}
+
+// writeTraces writes the traces of c to w, each line prefixed by indent,
+// like
+//
+//	shift E: E . '+' E
+//		E
+//		⇒ [ E '+' E ]
+//		⇒ E '+' [ E • '+' E ]
+func (a *automaton) writeTraces(w io.Writer, c *conflict, indent string) {
+	for _, v := range a.conflictTraces(c) {
+		fmt.Fprintf(w, "%s%s\n", indent, v.action)
+		if v.steps == nil {
+			fmt.Fprintf(w, "%s\tderivation not found\n", indent)
+			continue
+		}
+
+		for i, s := range v.steps {
+			if i != 0 {
+				s = "⇒ " + s
+			}
+			fmt.Fprintf(w, "%s\t%s\n", indent, s)
+		}
+	}
+}
+
+// writeTextDerivations writes the derivations of the conflicts of p in the
+// states in keep, or all if nil, to w in the text report format.
+func (g *generator) writeTextDerivations(w io.Writer, p *y.Parser, keep map[int]bool) error {
+	a, err := g.analyze(p)
+	if err != nil {
+		return err
+	}
+
+	b := bufio.NewWriter(w)
+	b.WriteString("\nConflict derivations\n")
+	for _, c := range a.conflicts {
+		if keep != nil && !keep[c.state.n] {
+			continue
+		}
+
+		fmt.Fprintf(b, "\nstate %s: %s conflict on %s\n", stateName(c.state), c.kind(), a.syms[c.sym].Name)
+		a.writeTraces(b, c, "\t")
+	}
+	return b.Flush()
+}
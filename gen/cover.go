@@ -0,0 +1,86 @@
+// Copyright 2014 The goyacc Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gen
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/cznic/y"
+)
+
+// coverage returns the -cover declarations of the parser of rules, the parser
+// field holding the counters if pure, and the statement counting the
+// reduction by the rule r.
+func (g *generator) coverage(rules []*y.Rule, pure bool) (decl, field, count string) {
+	var b strings.Builder
+	fmt.Fprintf(&b, `
+// %[1]sCoverRules are the rules counted by the coverage, indexed by the rule
+// number.
+var %[1]sCoverRules = [%[2]d]string{
+`, g.Prefix, len(rules))
+	for _, rule := range rules {
+		fmt.Fprintf(&b, "\t%q,\n", ruleText(rule))
+	}
+	b.WriteString("}\n")
+	if pure {
+		fmt.Fprintf(&b, `
+// Coverage returns the numbers of reductions by p of each rule, indexed by the
+// rule number, since p was created. Rule 0, of $accept, is never reduced.
+func (p *%[1]sParser) Coverage() []uint64 {
+	return append([]uint64(nil), p.coverCounts[:]...)
+}
+
+// WriteCoverage writes the coverage report of p to w, see Coverage.
+func (p *%[1]sParser) WriteCoverage(w __yyio__.Writer) error {
+	return %[1]swriteCoverage(w, p.Coverage())
+}
+`, g.Prefix)
+		field = fmt.Sprintf("\n\tcoverCounts [%d]uint64 // Of Coverage.", len(rules))
+		count = "\tyyrcvr.coverCounts[r]++\n"
+	} else {
+		fmt.Fprintf(&b, `
+// %[1]sCoverCounts are the numbers of reductions of each rule, see
+// %[1]sCoverage.
+var %[1]sCoverCounts [%[2]d]uint64
+
+// %[1]sCoverage returns the numbers of reductions of each rule, indexed by the
+// rule number, by all the parsers since the program started. Rule 0, of
+// $accept, is never reduced.
+func %[1]sCoverage() []uint64 {
+	r := make([]uint64, len(%[1]sCoverCounts))
+	for i := range r {
+		r[i] = __yyatomic__.LoadUint64(&%[1]sCoverCounts[i])
+	}
+	return r
+}
+
+// %[1]sWriteCoverage writes the coverage report to w, see %[1]sCoverage.
+func %[1]sWriteCoverage(w __yyio__.Writer) error {
+	return %[1]swriteCoverage(w, %[1]sCoverage())
+}
+`, g.Prefix, len(rules))
+		count = fmt.Sprintf("\t__yyatomic__.AddUint64(&%sCoverCounts[r], 1)\n", g.Prefix)
+	}
+	fmt.Fprintf(&b, `
+// %[1]swriteCoverage writes the numbers of reductions of the rules in counts
+// to w, one rule per line, followed by the number of the rules reduced at
+// least once.
+func %[1]swriteCoverage(w __yyio__.Writer, counts []uint64) error {
+	var n int
+	for r, v := range counts[1:] {
+		if v != 0 {
+			n++
+		}
+		if _, err := __yyfmt__.Fprintf(w, "%%10d rule %%d %%s\n", v, r+1, %[1]sCoverRules[r+1]); err != nil {
+			return err
+		}
+	}
+	_, err := __yyfmt__.Fprintf(w, "%%d of %%d rules covered (%%.1f%%%%)\n", n, len(counts)-1, 100*float64(n)/float64(len(counts)-1))
+	return err
+}
+`, g.Prefix)
+	return b.String(), field, count
+}
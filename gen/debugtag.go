@@ -0,0 +1,64 @@
+// Copyright 2014 The goyacc Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gen
+
+import (
+	"bytes"
+	"fmt"
+	"go/build/constraint"
+	"go/parser"
+	"go/token"
+	"io/ioutil"
+	"strings"
+)
+
+// writeDebugTag writes the -debugtag files of the parser output out having
+// the source src and the build constraint expr, if any. Without the build
+// tag, yydebugLevel returns zero, so the compiler removes the debug code of
+// the parser.
+func (g *generator) writeDebugTag(out string, src []byte, expr string, pure bool) error {
+	f, err := parser.ParseFile(token.NewFileSet(), out, src, parser.PackageClauseOnly)
+	if err != nil {
+		return err
+	}
+
+	tag := &constraint.TagExpr{Tag: g.DebugTag}
+	for _, v := range []struct {
+		suffix string
+		x      constraint.Expr
+		decl   string
+	}{
+		{"_debug.go", tag, `// %[1]sDebug is the parser debug level, 0 to 4.
+var %[1]sDebug = 0
+`},
+		{"_nodebug.go", &constraint.NotExpr{X: tag}, `// %[1]sDebug is zero without the build tag %[2]s.
+const %[1]sDebug = 0
+`},
+	} {
+		decl := `// %[1]sdebugLevel returns the parser debug level n.
+func %[1]sdebugLevel(n int) int { return n }
+`
+		if v.x != tag {
+			decl = `// %[1]sdebugLevel returns zero without the build tag %[2]s.
+func %[1]sdebugLevel(n int) int { return 0 }
+`
+		}
+		if !pure {
+			decl = v.decl + "\n" + decl
+		}
+		x := v.x
+		if expr != "" {
+			y, _ := constraint.Parse("//go:build " + expr)
+			x = &constraint.AndExpr{X: y, Y: x}
+		}
+		var buf bytes.Buffer
+		fmt.Fprintf(&buf, "// Code generated by goyacc -debugtag. DO NOT EDIT.\n\n//go:build %s\n\npackage %s\n\n", x, f.Name.Name)
+		fmt.Fprintf(&buf, decl, g.Prefix, g.DebugTag)
+		if err := ioutil.WriteFile(strings.TrimSuffix(out, ".go")+v.suffix, buf.Bytes(), 0666); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,176 @@
+// Copyright 2014 The goyacc Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gen
+
+import (
+	"fmt"
+	"go/token"
+	"io"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+)
+
+// Diff implements the goyacc diff command. It compares the grammar files old
+// and new, preprocessed with the defines of o, and writes the rules added and
+// removed, the changes of the numbers of states and conflicts, the conflicts
+// added and removed and the tokens renumbered to os.Stdout.
+func Diff(old, new string, o *Options) error {
+	g := newGenerator(o)
+	a, err := g.summarize(old)
+	if err != nil {
+		return err
+	}
+
+	b, err := g.summarize(new)
+	if err != nil {
+		return err
+	}
+
+	return writeDiff(os.Stdout, old, new, a, b)
+}
+
+// grammarSummary is what goyacc diff compares of a grammar.
+type grammarSummary struct {
+	conflicts []string       // Like shift/reduce conflict on '+' reducing E: E '+' E, without the state.
+	rr, sr    int            // Unresolved conflicts.
+	rules     []string       // Like E: E '+' E, except rule 0.
+	states    int            // Of the parse table.
+	stateOf   map[string]int // Conflict: its state.
+	tokens    map[string]int // Terminal: value.
+}
+
+func (g *generator) summarize(fn string) (*grammarSummary, error) {
+	src, err := ioutil.ReadFile(fn)
+	if err != nil {
+		return nil, err
+	}
+
+	p, err := g.overlayParser(token.NewFileSet(), fn, src)
+	if err != nil {
+		return nil, err
+	}
+
+	a, err := g.analyze(p)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &grammarSummary{rr: p.ConflictsRR, sr: p.ConflictsSR, states: len(p.Table), stateOf: map[string]int{}, tokens: map[string]int{}}
+	for _, rule := range p.Rules[1:] {
+		s.rules = append(s.rules, ruleText(rule))
+	}
+	for _, c := range a.conflicts {
+		var b strings.Builder
+		fmt.Fprintf(&b, "%s conflict on %s", c.kind(), a.syms[c.sym].Name)
+		for i, r := range c.reduces {
+			if i != 0 {
+				b.WriteString(" and")
+			}
+			fmt.Fprintf(&b, " reducing %s", ruleText(p.Rules[r]))
+		}
+		switch c.resolution {
+		case 'e':
+			b.WriteString(", resolved as an error")
+		case 'r':
+			fmt.Fprintf(&b, ", resolved as reduce %s", ruleText(p.Rules[c.rule]))
+		case 's':
+			b.WriteString(", resolved as shift")
+		}
+		if c.prec {
+			b.WriteString(" by precedence")
+		}
+		k := b.String()
+		if _, ok := s.stateOf[k]; !ok {
+			s.conflicts = append(s.conflicts, k)
+			s.stateOf[k] = c.state.n
+		}
+	}
+	for _, sym := range a.syms[:a.nterms] {
+		if sym.Name != "$default" {
+			s.tokens[sym.Name] = sym.Value
+		}
+	}
+	return s, nil
+}
+
+// writeDiff writes the differences of the grammars old and new, summarized
+// by a and b, to w.
+func writeDiff(w io.Writer, old, new string, a, b *grammarSummary) error {
+	var buf strings.Builder
+	fmt.Fprintf(&buf, "--- %s\n+++ %s\n", old, new)
+	removed, added := diffLists(a.rules, b.rules)
+	for _, v := range removed {
+		fmt.Fprintf(&buf, "- rule %s\n", v)
+	}
+	for _, v := range added {
+		fmt.Fprintf(&buf, "+ rule %s\n", v)
+	}
+	fmt.Fprintf(&buf, "states: %d -> %d\n", a.states, b.states)
+	fmt.Fprintf(&buf, "conflicts: %d -> %d shift/reduce, %d -> %d reduce/reduce\n", a.sr, b.sr, a.rr, b.rr)
+	removed, added = diffLists(a.conflicts, b.conflicts)
+	for _, v := range removed {
+		fmt.Fprintf(&buf, "- %s, in state %d\n", v, a.stateOf[v])
+	}
+	for _, v := range added {
+		fmt.Fprintf(&buf, "+ %s, in state %d\n", v, b.stateOf[v])
+	}
+	var nms []string
+	for nm := range a.tokens {
+		nms = append(nms, nm)
+	}
+	for nm := range b.tokens {
+		if _, ok := a.tokens[nm]; !ok {
+			nms = append(nms, nm)
+		}
+	}
+	sort.Strings(nms)
+	for _, nm := range nms {
+		v, inA := a.tokens[nm]
+		u, inB := b.tokens[nm]
+		switch {
+		case !inB:
+			fmt.Fprintf(&buf, "- token %s %d\n", nm, v)
+		case !inA:
+			fmt.Fprintf(&buf, "+ token %s %d\n", nm, u)
+		case u != v:
+			fmt.Fprintf(&buf, "token %s: %d -> %d\n", nm, v, u)
+		}
+	}
+	_, err := io.WriteString(w, buf.String())
+	return err
+}
+
+// diffLists returns the items of a not in b and of b not in a, in their
+// order. An item occurring n times in a and m < n times in b is removed n-m
+// times.
+func diffLists(a, b []string) (removed, added []string) {
+	n := map[string]int{}
+	for _, v := range b {
+		n[v]++
+	}
+	for _, v := range a {
+		if n[v] > 0 {
+			n[v]--
+			continue
+		}
+
+		removed = append(removed, v)
+	}
+	n = map[string]int{}
+	for _, v := range a {
+		n[v]++
+	}
+	for _, v := range b {
+		if n[v] > 0 {
+			n[v]--
+			continue
+		}
+
+		added = append(added, v)
+	}
+	return removed, added
+}
@@ -0,0 +1,96 @@
+// Copyright 2014 The goyacc Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gen
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strings"
+
+	"github.com/cznic/y"
+)
+
+// dotEscaper escapes the text of a quoted Graphviz string.
+var dotEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`)
+
+// writeDot writes the LALR automaton of p to the file fn as a Graphviz
+// graph. The states are labeled by their kernel items, the edges by the
+// shifted terminals and, dashed, by the nonterminals of the gotos. The states
+// having conflicts are red. With conflictsOnly the graph is limited to the
+// states having conflicts and their predecessors.
+func (g *generator) writeDot(fn string, p *y.Parser, conflictsOnly bool) error {
+	a, err := g.analyze(p)
+	if err != nil {
+		return err
+	}
+
+	conflicted := map[*lrState]bool{}
+	for _, c := range a.conflicts {
+		conflicted[c.state] = true
+	}
+	show := map[*lrState]bool{}
+	for _, s := range a.states {
+		if !conflictsOnly || conflicted[s] {
+			show[s] = true
+			continue
+		}
+
+		for _, t := range s.next {
+			if conflicted[t] {
+				show[s] = true
+				break
+			}
+		}
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString("digraph automaton {\n\trankdir=LR;\n\tnode [shape=box, fontname=monospace];\n")
+	id := map[*lrState]int{}
+	for i, s := range a.states {
+		id[s] = i
+	}
+	for _, s := range a.states {
+		if !show[s] {
+			continue
+		}
+
+		label := "state " + stateName(s) + `\l`
+		for _, it := range s.kernel {
+			label += dotEscaper.Replace(a.ruleString(it.rule, it.dot)) + `\l`
+		}
+		attrs := ""
+		if conflicted[s] {
+			attrs = ", color=red"
+		}
+		fmt.Fprintf(&buf, "\ts%d [label=\"%s\"%s];\n", id[s], label, attrs)
+	}
+	for _, s := range a.states {
+		if !show[s] {
+			continue
+		}
+
+		var syms []int
+		for sym := range s.next {
+			syms = append(syms, sym)
+		}
+		sort.Ints(syms)
+		for _, sym := range syms {
+			t := s.next[sym]
+			if !show[t] {
+				continue
+			}
+
+			attrs := ""
+			if !a.isTerminal(sym) {
+				attrs = ", style=dashed"
+			}
+			fmt.Fprintf(&buf, "\ts%d -> s%d [label=\"%s\"%s];\n", id[s], id[t], dotEscaper.Replace(a.syms[sym].Name), attrs)
+		}
+	}
+	buf.WriteString("}\n")
+	return ioutil.WriteFile(fn, buf.Bytes(), 0666)
+}
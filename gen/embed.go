@@ -0,0 +1,56 @@
+// Copyright 2014 The goyacc Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gen
+
+import (
+	"bytes"
+	"compress/gzip"
+	"strconv"
+
+	"github.com/cznic/strutil"
+)
+
+// embedGrammar writes the -embed declarations of the grammar source src of
+// the grammar file name, the constant yyGrammarSource and its accessor
+// yyGrammar, which decompresses it with -embed gzip.
+func (g *generator) embedGrammar(f strutil.Formatter, name string, src []byte) {
+	lit := strconv.Quote(string(src))
+	if g.Embed == "gzip" {
+		var buf bytes.Buffer
+		w, err := gzip.NewWriterLevel(&buf, gzip.BestCompression)
+		if err != nil {
+			panic("internal error 012")
+		}
+
+		w.Write(src)
+		w.Close()
+		lit = strconv.QuoteToASCII(buf.String())
+	}
+
+	f.Format("\n\n// %sGrammarSource is the source of the grammar %s", g.Prefix, name)
+	if g.Embed == "gzip" {
+		f.Format(", compressed by gzip")
+	}
+	f.Format(".\nconst %sGrammarSource = %s\n", g.Prefix, lit)
+	f.Format("\n// %sGrammar returns the source of the grammar %s the parser was generated from.\n", g.Prefix, name)
+	if g.Embed != "gzip" {
+		f.Format("func %[1]sGrammar() string { return %[1]sGrammarSource }", g.Prefix)
+		return
+	}
+
+	f.Format(`func %[1]sGrammar() string {
+	r, err := __yygzip__.NewReader(__yystrings__.NewReader(%[1]sGrammarSource))
+	if err != nil {
+		panic(err)
+	}
+
+	b, err := __yyioutil__.ReadAll(r)
+	if err != nil {
+		panic(err)
+	}
+
+	return string(b)
+}`, g.Prefix)
+}
@@ -0,0 +1,54 @@
+// Copyright 2014 The goyacc Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gen
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"runtime/debug"
+)
+
+// version returns the version of the goyacc module, like v1.2.0, or (devel)
+// if it is not known.
+func version() string {
+	if bi, ok := debug.ReadBuildInfo(); ok {
+		if v := bi.Main.Version; v != "" && bi.Main.Path == "github.com/cznic/goyacc" {
+			return v
+		}
+
+		for _, m := range bi.Deps {
+			if m.Path == "github.com/cznic/goyacc" {
+				return m.Version
+			}
+		}
+	}
+	return "(devel)"
+}
+
+// fingerprint returns the SHA-256 hash, like sha256:f00d..., of the grammar
+// source src, the goyacc version and the options generating the parser. The
+// options naming the outputs and selecting the reports, the checks and the
+// profiles do not change it.
+func (g *generator) fingerprint(src []byte) string {
+	o := g.Options
+	o.Set, o.Command, o.Warnings = nil, nil, nil
+	o.CPUProfile, o.MemProfile, o.Profile = "", "", false
+	o.Check, o.NoOutput, o.Watch = false, false, false
+	o.Closures, o.Derivations, o.LA, o.Resolved = false, false, false, false
+	o.Conflicts, o.Dot, o.DotConflicts, o.JSON, o.RuleGraph = "", "", false, "", ""
+	o.Report, o.ReportFormat, o.ReportStates, o.ReportSymbols = "", "", "", ""
+	o.NoDups, o.Reducible, o.Strict, o.Werror = false, false, false, false
+	o.GitAttributes, o.Out, o.OutDir = false, "", ""
+	b, err := json.Marshal(&o)
+	if err != nil {
+		panic("internal error 011")
+	}
+
+	h := sha256.New()
+	fmt.Fprintf(h, "goyacc %s\n%s\n", version(), b)
+	h.Write(src)
+	return fmt.Sprintf("sha256:%x", h.Sum(nil))
+}
@@ -0,0 +1,416 @@
+// Copyright 2014 The goyacc Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gen
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"go/token"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+)
+
+// Fmt implements the goyacc fmt command, which formats grammar files.
+func Fmt(args []string) error {
+	fs := flag.NewFlagSet("fmt", flag.ContinueOnError)
+	list := fs.Bool("l", false, "list the files whose formatting differs")
+	sortTokens := fs.Bool("sorttokens", false, "sort the names declared by %token directives")
+	write := fs.Bool("w", false, "write the result to the file instead of standard output")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if fs.NArg() == 0 {
+		if *list || *write {
+			return fmt.Errorf("fmt: cannot use -l or -w with standard input")
+		}
+
+		src, err := ioutil.ReadAll(os.Stdin)
+		if err != nil {
+			return err
+		}
+
+		b, err := formatGrammar("<standard input>", src, *sortTokens)
+		if err != nil {
+			return err
+		}
+
+		_, err = os.Stdout.Write(b)
+		return err
+	}
+
+	for _, fn := range fs.Args() {
+		src, err := ioutil.ReadFile(fn)
+		if err != nil {
+			return err
+		}
+
+		b, err := formatGrammar(fn, src, *sortTokens)
+		if err != nil {
+			return err
+		}
+
+		if !*list && !*write {
+			if _, err := os.Stdout.Write(b); err != nil {
+				return err
+			}
+
+			continue
+		}
+
+		if bytes.Equal(src, b) {
+			continue
+		}
+
+		if *list {
+			fmt.Println(fn)
+		}
+		if *write {
+			fi, err := os.Stat(fn)
+			if err != nil {
+				return err
+			}
+
+			if err := ioutil.WriteFile(fn, b, fi.Mode().Perm()); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// grammarFormatter writes the canonical form of a grammar.
+type grammarFormatter struct {
+	buf      bytes.Buffer
+	conds    map[int]string // Conditional directive lines not yet written, by line number.
+	g        *grammar
+	items    []gtok // The tokens and the comments up to the second %%.
+	prev     int    // Offset after the last item written.
+	src      []byte // The original source.
+	written  []string
+	comments int // Comments written.
+
+	brk bool // The next item must start a new line, like after a // comment.
+	top bool // The last item written is a comment or a conditional directive, except %endif, at column 0.
+}
+
+// formatGrammar returns src in the canonical form of goyacc fmt. The
+// directives start a line, with their arguments separated by single spaces,
+// the rules are separated by blank lines and written as
+//
+//	lhs:
+//		alternative
+//	|	alternative
+//
+// The prologue, the %union, the actions and the code after the second %% are
+// not changed and the comments are kept. With sortTokens the names declared by
+// a %token directive having no values, aliases and comments are sorted.
+func formatGrammar(name string, src []byte, sortTokens bool) ([]byte, error) {
+	if _, err := newGenerator(NewOptions()).preprocessDefines(token.NewFileSet(), name, src, Defines{}); err != nil {
+		return nil, err
+	}
+
+	scan, conds := blankConditionals(src)
+	f := &grammarFormatter{conds: conds, g: scanGrammar(token.NewFileSet(), name, scan), src: src}
+	f.items = mergeItems(f.g.toks, f.g.comments)
+	rules := len(f.items)
+	for i, t := range f.items {
+		if t.tok == token.REM && t.lit == "%%" {
+			rules = i
+			break
+		}
+	}
+
+	f.defs(f.items[:rules], sortTokens)
+	if rules < len(f.items) {
+		f.newline(true)
+		f.token(f.items[rules])
+		f.rules(f.items[rules+1:])
+	}
+	f.flushConds(f.g.line(f.g.tail) - 1)
+	f.newline(false)
+	if f.g.tail < len(src) {
+		f.buf.WriteByte('\n')
+		f.buf.Write(src[f.g.tail:])
+	}
+	b := f.buf.Bytes()
+
+	// Check the result has the tokens and comments written.
+	scan, _ = blankConditionals(b)
+	g := scanGrammar(token.NewFileSet(), name, scan)
+	n := 0
+	for _, t := range g.toks {
+		if n >= len(f.written) || string(b[t.off:t.end]) != f.written[n] {
+			panic("internal error 009")
+		}
+
+		n++
+	}
+	semicolons := 0
+	for _, t := range f.g.toks {
+		if t.tok == token.SEMICOLON && t.sect == sectRules {
+			semicolons++
+		}
+	}
+	if n != len(f.written) || n != len(f.g.toks)-semicolons || len(g.comments) != f.comments || len(g.comments) != len(f.g.comments) {
+		panic("internal error 010")
+	}
+
+	return b, nil
+}
+
+// blankConditionals returns src with the conditional directive lines replaced
+// by spaces, preserving the offsets, and the directives by line number.
+func blankConditionals(src []byte) ([]byte, map[int]string) {
+	r := append([]byte(nil), src...)
+	m := map[int]string{}
+	off := 0
+	for i, line := range bytes.SplitAfter(src, []byte{'\n'}) {
+		if dir, _ := conditionalDirective(line); dir != "" {
+			m[i+1] = strings.TrimSpace(string(line))
+			for j := range bytes.TrimRight(line, "\n") {
+				r[off+j] = ' '
+			}
+		}
+		off += len(line)
+	}
+	return r, m
+}
+
+// mergeItems returns toks and comments merged in the source order.
+func mergeItems(toks, comments []gtok) []gtok {
+	r := make([]gtok, 0, len(toks)+len(comments))
+	r = append(append(r, toks...), comments...)
+	sort.SliceStable(r, func(i, j int) bool { return r[i].off < r[j].off })
+	return r
+}
+
+// newline ends the current line, if any, followed by a blank line if blank.
+func (f *grammarFormatter) newline(blank bool) {
+	b := bytes.TrimRight(f.buf.Bytes(), " \t")
+	f.buf.Truncate(len(b))
+	if len(b) == 0 {
+		return
+	}
+
+	if !bytes.HasSuffix(b, []byte{'\n'}) {
+		f.buf.WriteByte('\n')
+	}
+	if blank && !bytes.HasSuffix(f.buf.Bytes(), []byte("\n\n")) {
+		f.buf.WriteByte('\n')
+	}
+	f.brk = false
+}
+
+// gap reports whether there are blank lines between the last item written and
+// the offset off.
+func (f *grammarFormatter) gap(off int) bool {
+	return f.prev > 0 && f.g.line(off)-f.g.line(f.prev-1) > 1
+}
+
+// sameLine reports whether the item at off continues the line of the last
+// item written.
+func (f *grammarFormatter) sameLine(off int) bool {
+	return !f.brk && f.prev > 0 && f.g.line(f.prev-1) == f.g.line(off)
+}
+
+// flushConds writes the conditional directive lines up to line.
+func (f *grammarFormatter) flushConds(line int) {
+	var a []int
+	for k := range f.conds {
+		if k <= line {
+			a = append(a, k)
+		}
+	}
+	sort.Ints(a)
+	for _, k := range a {
+		f.newline(!f.top && f.prev > 0 && k-f.g.line(f.prev-1) > 1)
+		dir, _ := conditionalDirective([]byte(f.conds[k]))
+		f.buf.WriteString(f.conds[k])
+		delete(f.conds, k)
+		f.brk, f.top = true, dir != "%endif" // A rule following %endif is separated by a blank line.
+	}
+}
+
+// token writes t and drops the conditional directive lines it encloses.
+func (f *grammarFormatter) token(t gtok) {
+	s := string(f.src[t.off:t.end]) // The whole block of a brace enclosed block or a prologue.
+	for k := f.g.line(t.off); k <= f.g.line(t.end-1); k++ {
+		delete(f.conds, k)
+	}
+	f.buf.WriteString(s)
+	f.prev = t.end
+	f.top = false
+	f.brk = t.tok == token.COMMENT && strings.HasPrefix(s, "//")
+	if t.tok == token.COMMENT {
+		f.comments++
+		return
+	}
+
+	f.written = append(f.written, s)
+}
+
+// comment writes the comment t, at column 0 if top, on a new line preceded by
+// a blank line if blank, unless it follows the last item on its line.
+func (f *grammarFormatter) comment(t gtok, top, blank bool) {
+	if f.sameLine(t.off) {
+		f.buf.WriteByte(' ')
+		f.token(t)
+		return
+	}
+
+	f.newline(top && blank)
+	if !top {
+		f.buf.WriteByte('\t')
+	}
+	f.token(t)
+	f.top = top
+}
+
+// next returns the first token of items after index i which is not a comment.
+func next(items []gtok, i int) (gtok, bool) {
+	for i++; i < len(items); i++ {
+		if items[i].tok != token.COMMENT {
+			return items[i], true
+		}
+	}
+	return gtok{}, false
+}
+
+// defs writes the definitions section.
+func (f *grammarFormatter) defs(items []gtok, sortTokens bool) {
+	for i := 0; i < len(items); i++ {
+		t := items[i]
+		f.flushConds(f.g.line(t.off) - 1)
+		switch {
+		case t.tok == token.COMMENT:
+			u, ok := next(items, i)
+			f.comment(t, !ok || u.tok == token.REM || u.lit == "%{", f.gap(t.off))
+		case t.tok == token.REM || t.lit == "%{":
+			f.newline(f.gap(t.off))
+			f.token(t)
+			if sortTokens && t.lit == "%token" {
+				i += f.sortedTokens(items[i+1:])
+			}
+		default:
+			switch {
+			case f.sameLine(t.off):
+				if t.off > f.prev {
+					f.buf.WriteByte(' ')
+				}
+			default:
+				f.newline(false)
+				f.buf.WriteByte('\t')
+			}
+			f.token(t)
+		}
+	}
+}
+
+// sortedTokens writes the arguments of a %token directive, the names sorted,
+// and returns their number, or 0 if they cannot be sorted.
+func (f *grammarFormatter) sortedTokens(items []gtok) int {
+	n := 0
+	for n < len(items) && items[n].tok != token.REM && items[n].lit != "%{" {
+		n++
+	}
+	args := items[:n]
+	var typ []gtok
+	if len(args) >= 3 && args[0].tok == token.LSS && args[2].tok == token.GTR {
+		typ, args = args[:3], args[3:]
+	}
+	var names []gtok
+	for _, t := range args {
+		if t.tok != token.IDENT {
+			return 0
+		}
+
+		names = append(names, t)
+	}
+	if len(names) == 0 {
+		return 0
+	}
+
+	sort.SliceStable(names, func(i, j int) bool { return names[i].lit < names[j].lit })
+	if len(typ) != 0 {
+		f.buf.WriteByte(' ')
+	}
+	for _, t := range typ {
+		f.token(t)
+	}
+	for _, t := range names {
+		f.buf.WriteByte(' ')
+		f.token(t)
+	}
+	f.prev = items[n-1].end
+	return n
+}
+
+// rules writes the rules section.
+func (f *grammarFormatter) rules(items []gtok) {
+	isRule := func(i int) bool {
+		if items[i].tok != token.IDENT {
+			return false
+		}
+
+		u, ok := next(items, i)
+		return ok && u.tok == token.COLON
+	}
+	alt := false   // The next token starts an alternative.
+	first := false // Of the alternatives of the rule.
+	for i := 0; i < len(items); i++ {
+		t := items[i]
+		f.flushConds(f.g.line(t.off) - 1)
+		switch {
+		case t.tok == token.COMMENT:
+			top := true
+			for j := i + 1; j < len(items); j++ {
+				if items[j].tok != token.COMMENT {
+					top = isRule(j)
+					break
+				}
+			}
+			f.comment(t, top, !f.top || f.gap(t.off))
+		case isRule(i):
+			f.newline(!f.top)
+			f.token(t)
+			var comments []gtok // Between the name and the colon.
+			for i++; items[i].tok == token.COMMENT; i++ {
+				comments = append(comments, items[i])
+			}
+			f.token(items[i])
+			for _, c := range comments {
+				f.comment(c, false, false)
+			}
+			alt, first = true, true
+		case t.tok == token.OR:
+			f.newline(false)
+			f.token(t)
+			alt, first = true, false
+		case t.tok == token.SEMICOLON:
+			f.prev = t.end
+		default:
+			switch {
+			case alt && (first || f.brk):
+				f.newline(false)
+				f.buf.WriteByte('\t')
+			case alt:
+				f.buf.WriteByte('\t')
+			case f.sameLine(t.off):
+				if t.off > f.prev {
+					f.buf.WriteByte(' ')
+				}
+			default:
+				f.newline(false)
+				f.buf.WriteByte('\t')
+			}
+			alt = false
+			f.token(t)
+		}
+	}
+}
@@ -0,0 +1,3411 @@
+// Copyright 2014 The goyacc Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// This source code uses portions of code previously published in the Go tool
+// yacc[0] program, the respective license can be found in the LICENSE-GO-YACC
+// file.
+
+// Package gen implements the parser generator of the goyacc command.
+package gen
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"go/build/constraint"
+	"go/format"
+	"go/scanner"
+	"go/token"
+	"io"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/cznic/mathutil"
+	"github.com/cznic/parser/yacc"
+	"github.com/cznic/sortutil"
+	"github.com/cznic/strutil"
+	"github.com/cznic/y"
+)
+
+// Options are the options of the parser generator, see the goyacc command.
+// The name of the command line flag of an option precedes its description.
+type Options struct {
+	Defines  Defines // D: define name[=value] for %if and %ifdef.
+	Overlays Defines // overlay: define name[=value] in a runtime parse table overlay.
+
+	// Warnings enables or disables the warnings of a category, or of all
+	// of them for "all", like the command line flags Wcategory and
+	// Wno-category.
+	Warnings map[string]bool
+
+	// Set are the names of the options set explicitly, like the command
+	// line flags o, p and v, which then take precedence over the grammar
+	// directives.
+	Set map[string]bool
+
+	// Command is the command line, like os.Args, rendered by the
+	// {{.Command}} of the header option.
+	Command []string
+
+	ActionFuncs   bool   // actionfuncs: emit the rule actions as separate functions.
+	ActionPanic   bool   // actionpanic: re-panic in the rule actions with the rule and its grammar position.
+	Bench         bool   // bench: write a parser benchmark to the output name with suffix _bench_test.go.
+	CPUProfile    string // cpuprofile: write a CPU profile of the generation to this file.
+	Cancel        int    // cancel: add ParseContext checking the context every n parser steps.
+	Check         bool   // check: compare the parser output to the existing file instead of writing any files.
+	Closures      bool   // c: report state closures.
+	Conflicts     string // conflicts: write the conflicts to standard output in this format, json.
+	Cover         bool   // cover: count the reductions of each rule, reported by yyCoverage and yyWriteCoverage.
+	DebugTag      string // debugtag: build tag enabling the parser debug code, which is removed without it.
+	Derivations   bool   // derivations: add the derivations from the start symbol reaching the conflicts to the grammar report.
+	Dlval         string // dlval: debug value (runtime yyDebug >= 3).
+	Dlvalf        string // dlvalf: debug format of -dlval (runtime yyDebug >= 3).
+	Dot           string // dot: write the LALR automaton as a Graphviz graph to this file.
+	DotConflicts  bool   // dotconflicts: limit -dot to the states having conflicts and their predecessors.
+	EOF           string // eof: name[=value] of the end of input token, overrides %eof.
+	Embed         string // embed: store the grammar source in the parser, as text or gzip, returned by yyGrammar.
+	FollowSets    bool   // fs: emit the follow set table.
+	Freeze        string // freeze: file recording the token values, existing values must not change.
+	GitAttributes bool   // gitattributes: mark the parser output linguist-generated in .gitattributes.
+	Header        string // header: text/template of the comment heading the generated files.
+	JSON          string // json: write the parse tables, symbols, rules and conflicts as JSON to this file.
+	JSONTrace     bool   // jsontrace: add the JSON trace of the parser actions.
+	LA            bool   // la: report all lookahead sets.
+	LexGuard      int    // lexguard: abort the parse if the lexer returns the same token this many times without progress.
+	Lexer         string // lexer: use the existing lexer type instead of declaring the yyLexer interface.
+	MaxDepth      int    // maxdepth: default parser stack depth limit, 0 for no limit.
+	MaxErrors     int    // maxerrors: default syntax errors limit, 0 for no limit.
+	MaxSteps      int    // maxsteps: default limit of the parser shifts and reductions, 0 for no limit.
+	MemProfile    string // memprofile: write a memory profile of the generation to this file.
+	NoDups        bool   // nodups: forbid defining a nonterminal at more than one place.
+	NoLines       bool   // l: disable the line directives mapping actions to the grammar.
+	NoOutput      bool   // n: analyze the grammar without writing any files, except the -v report.
+	Out           string // o: parser output, - for standard output.
+	OutDir        string // outdir: directory of the parser output, created if necessary.
+	Package       string // package: package name of the parser output.
+	Pool          bool   // pool: uses sync.Pool to recycle parser stacks.
+	PoolBench     bool   // poolbench: with -pool, write parser stack benchmarks to the output name with suffix _pool_test.go.
+	Prefix        string // p: name prefix to use in generated code, overrides %define api.prefix.
+	Profile       bool   // profile: report the time spent in the phases of the generation.
+	PtrStack      bool   // ptrstack: keep pointers to the semantic values on the parser stack.
+	Pure          bool   // pure: generate a parser without package level mutable state.
+	RaceGuard     bool   // raceguard: panic when a parser instance is used by more than one goroutine at a time.
+	Reducible     bool   // cr: check all states are reducible.
+	Repair        bool   // repair: suggest single token insertion or deletion repairs in syntax errors.
+	Report        string // v: create grammar report.
+	ReportFormat  string // report: format of the grammar report, text, html, json or markdown.
+	ReportStates  string // reportstates: comma separated states the grammar report is limited to, with their neighbors.
+	ReportSymbols string // reportsymbols: comma separated symbols the grammar report is limited to the states of, with their neighbors.
+	Resolved      bool   // ex: explain how were conflicts resolved.
+	RuleGraph     string // rulegraph: write the graph of the nonterminals referencing each other to this file, as JSON if it ends in .json, as a Graphviz graph otherwise.
+	Skeleton      string // skeleton: text/template file generating the parser output instead of the built-in one.
+	SrcName       string // src-name: name of the grammar in the diagnostics and the line directives, like when read from standard input.
+	Stack         int    // stack: initial parser stack capacity.
+	Strict        bool   // strict: fail on the conflicts not expected by %expect and %expect-rr.
+	Tags          string // tags: build constraint expression of the generated //go:build line.
+	Tokens        string // tokens: write the token constants, names and aliases to this file of another package.
+	Watch         bool   // watch: generate the outputs again whenever the grammar changes.
+	Werror        bool   // Werror: make the warnings errors.
+	XErrors       string // xe: generate eXtra errors from examples source file.
+	XErrorsGen    string // xegen: generate error from examples source file automatically from the grammar.
+
+	report bool // Set by Report.
+	vet    bool // Set by Vet.
+}
+
+// NewOptions returns the default options.
+func NewOptions() *Options {
+	return &Options{
+		Defines:      Defines{},
+		Overlays:     Defines{},
+		Set:          map[string]bool{},
+		Warnings:     map[string]bool{},
+		Dlval:        "lval",
+		Dlvalf:       "%+v",
+		Out:          "y.go",
+		Prefix:       "yy",
+		Report:       "y.output",
+		ReportFormat: "text",
+		Stack:        200,
+	}
+}
+
+// generator is a run of the parser generator. It has its own copy of the
+// options, which the grammar directives may change, so the runs do not share
+// any mutable state.
+type generator struct {
+	Options
+
+	analysis  analysis // Of analyze.
+	conflicts [2]int   // Shift/reduce, reduce/reduce of the parser generated.
+	prof      *profile // Of -profile, if any.
+}
+
+// newGenerator returns a generator having a copy of o.
+func newGenerator(o *Options) *generator {
+	g := &generator{Options: *o}
+	if g.Defines == nil {
+		g.Defines = Defines{}
+	}
+	if g.Overlays == nil {
+		g.Overlays = Defines{}
+	}
+	if g.Warnings == nil {
+		g.Warnings = map[string]bool{}
+	}
+	if g.Set == nil {
+		g.Set = map[string]bool{}
+	}
+	return g
+}
+
+// Result is the output of GenerateSource.
+type Result struct {
+	Parser []byte // The parser output.
+	Report []byte // The grammar report, if any.
+}
+
+// Generate generates the parser of the grammar file in, writing the parser
+// output, the grammar report and the other outputs selected by o like the
+// goyacc command does. With the watch option it does not return unless the
+// grammar cannot be watched. The generation uses a copy of o, it may run
+// concurrently with others, except for the -cpuprofile of the process.
+func Generate(in string, o *Options) error {
+	g := newGenerator(o)
+	if g.Watch {
+		return g.watch(in)
+	}
+
+	return g.main1(in)
+}
+
+// GenerateSource is like Generate but the grammar is src, named name in the
+// positions, and it returns the parser output and the grammar report instead
+// of writing them. The outputs named after the parser output, like the -bench
+// and -debugtag files, are not written.
+func GenerateSource(name string, src []byte, o *Options) (*Result, error) {
+	var out, rep bytes.Buffer
+	if err := newGenerator(o).generate(name, src, &out, &rep); err != nil {
+		return nil, err
+	}
+
+	return &Result{Parser: out.Bytes(), Report: rep.Bytes()}, nil
+}
+
+type symUsed struct {
+	sym  *y.Symbol
+	used int
+}
+
+type symsUsed []symUsed
+
+func (s symsUsed) Len() int      { return len(s) }
+func (s symsUsed) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
+
+func (s symsUsed) Less(i, j int) bool {
+	if s[i].used > s[j].used {
+		return true
+	}
+
+	if s[i].used < s[j].used {
+		return false
+	}
+
+	if a, b := strings.ToLower(s[i].sym.Name), strings.ToLower(s[j].sym.Name); a != b {
+		return a < b
+	}
+
+	// Names differing only in case must not be ordered by the map iteration
+	// order of the caller.
+	return s[i].sym.Name < s[j].sym.Name
+}
+
+func (g *generator) main1(in string) error { return g.generate(in, nil, nil, nil) }
+
+// generate runs the parser generator on the grammar file in, or on src if
+// not nil. The parser output and the grammar report go to files, or to
+// outW and repW if not nil.
+func (g *generator) generate(in string, src []byte, outW, repW io.Writer) (err error) {
+	stop, err := g.startProfiles()
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		if e := stop(); e != nil && err == nil {
+			err = e
+		}
+	}()
+	g.prof.enter("preprocess")
+	var out io.Writer
+	if expr := g.Tags; expr != "" {
+		if _, err := constraint.Parse("//go:build " + expr); err != nil {
+			return fmt.Errorf("-tags: %v", err)
+		}
+	}
+
+	if nm := g.Package; nm != "" && (!token.IsIdentifier(nm) || nm == "_") {
+		return fmt.Errorf("-package: invalid package name %q", nm)
+	}
+
+	if fn := g.Tokens; fn != "" {
+		if _, err := tokensPackage(fn); err != nil {
+			return err
+		}
+	}
+
+	for c := range g.Warnings {
+		if _, ok := warningCategories[c]; !ok && c != "all" {
+			return fmt.Errorf("-W%s: unknown warning category", c)
+		}
+	}
+
+	if tag := g.DebugTag; tag != "" {
+		if x, err := constraint.Parse("//go:build " + tag); err != nil {
+			return fmt.Errorf("-debugtag: %v", err)
+		} else if _, ok := x.(*constraint.TagExpr); !ok {
+			return fmt.Errorf("-debugtag: invalid build tag %q", tag)
+		}
+	}
+
+	if g.Bench && g.Lexer != "" {
+		return fmt.Errorf("-bench cannot be used with -lexer")
+	}
+
+	switch g.Conflicts {
+	case "", "json":
+	default:
+		return fmt.Errorf("-conflicts: invalid format %q", g.Conflicts)
+	}
+
+	switch g.Embed {
+	case "", "gzip", "text":
+	default:
+		return fmt.Errorf("-embed: invalid format %q", g.Embed)
+	}
+
+	if g.Cover && g.Skeleton != "" {
+		return fmt.Errorf("-cover cannot be used with -skeleton")
+	}
+
+	if g.Embed != "" && g.Skeleton != "" {
+		return fmt.Errorf("-embed cannot be used with -skeleton")
+	}
+
+	if _, ok := reportExts[g.ReportFormat]; !ok {
+		return fmt.Errorf("-report: invalid format %q", g.ReportFormat)
+	}
+
+	if _, err := g.reportStatesList(); err != nil {
+		return err
+	}
+
+	if g.PoolBench && !g.Pool {
+		return fmt.Errorf("-poolbench requires -pool")
+	}
+
+	if n := g.Stack; n <= 0 {
+		return fmt.Errorf("-stack: invalid capacity %d", n)
+	}
+
+	if s := g.Prefix; s != "" && !validPrefix(s) {
+		return fmt.Errorf("-p: invalid prefix %q", s)
+	}
+
+	// Write no files. The options naming them are kept, the fingerprint and
+	// the parser output depend on some of them.
+	noFiles := g.Check || g.NoOutput
+
+	if src == nil {
+		if src, err = ioutil.ReadFile(in); err != nil {
+			return err
+		}
+	}
+	if nm := g.SrcName; nm != "" {
+		in = nm
+	}
+
+	fset := token.NewFileSet()
+	pp, err := g.preprocessDefines(fset, in, src, g.overlayDefines(g.overlayNames()...))
+	if err != nil {
+		return err
+	}
+
+	if pp.prefix != g.Prefix {
+		defer func(s string) { g.Prefix = s }(g.Prefix)
+		g.Prefix = pp.prefix
+	}
+
+	pure := g.Pure || pp.settings["%pure"] != nil
+	detailed := pp.define["parse.error"] != nil && pp.define["parse.error"].val == "detailed"
+	push := pp.define["api.push-pull"] != nil && pp.define["api.push-pull"].val == "push"
+	if push {
+		var opt string
+		switch {
+		case g.Lexer != "":
+			opt = "-lexer"
+		case g.Pool:
+			opt = "-pool"
+		case g.Repair:
+			opt = "-repair"
+		}
+		if opt != "" {
+			return fmt.Errorf("%s: %%define api.push-pull push cannot be used with %s", pp.define["api.push-pull"].pos, opt)
+		}
+	}
+	outName, reportName := g.outputNames(pp)
+	var lineFile string // Grammar file name in line directives, if any.
+	var inName string   // Grammar file name relative to the parser output.
+	var outPath string
+	if nm := outName; nm != "" {
+		w := outW
+		switch {
+		case w == nil && g.NoOutput:
+			w = ioutil.Discard
+		case w == nil && nm == "-":
+			if err := g.checkStdout(); err != nil {
+				return err
+			}
+
+			w, nm = os.Stdout, stdoutName
+		case w == nil && g.Check:
+			if dir := g.OutDir; dir != "" && !filepath.IsAbs(nm) {
+				nm = filepath.Join(dir, nm)
+			}
+			var buf bytes.Buffer
+			defer func() {
+				if err == nil {
+					err = checkOutput(nm, buf.Bytes())
+				}
+			}()
+			w = &buf
+		case w == nil:
+			if dir := g.OutDir; dir != "" {
+				if !filepath.IsAbs(nm) {
+					nm = filepath.Join(dir, nm)
+				}
+				if err := os.MkdirAll(filepath.Dir(nm), 0775); err != nil {
+					return err
+				}
+			}
+			outPath = nm
+			if fn := g.Tokens; fn != "" && sameDir(fn, nm) {
+				return fmt.Errorf("-tokens: %s is in the package of the parser output", fn)
+			}
+
+			if g.GitAttributes {
+				if err := gitAttributes(nm); err != nil {
+					return err
+				}
+			}
+
+			f, e := os.Create(nm)
+			if e != nil {
+				return e
+			}
+
+			defer func() {
+				if e := f.Close(); e != nil && err == nil {
+					err = e
+				}
+				if err != nil {
+					os.Remove(nm)
+				}
+			}()
+			bw := bufio.NewWriter(f)
+			defer func() {
+				if e := bw.Flush(); e != nil && err == nil {
+					err = e
+				}
+			}()
+			w = bw
+		}
+		inName = lineFileName(in, nm)
+		if !g.NoLines {
+			lineFile = inName
+		}
+		buf := bytes.NewBuffer(nil)
+		out = buf
+		defer func() {
+			g.prof.enter("gofmt")
+			dest, e := format.Source(pruneImports(buf.Bytes()))
+			if e != nil {
+				dest = buf.Bytes()
+			}
+			if lineFile != "" {
+				dest = resetLines(dest, filepath.Base(nm))
+			}
+
+			g.prof.enter("write")
+			if _, e = w.Write(dest); e != nil && err == nil {
+				err = e
+			}
+		}()
+	}
+
+	var rep io.Writer
+	if nm := reportName; nm != "" && repW != nil {
+		rep = repW
+	} else if nm != "" && (g.Check || g.NoOutput && !g.Set["v"] && !g.report) {
+		rep = ioutil.Discard
+	} else if nm != "" {
+		f, err := os.Create(nm)
+		if err != nil {
+			return err
+		}
+
+		defer func() {
+			if e := f.Close(); e != nil && err == nil {
+				err = e
+			}
+		}()
+		w := bufio.NewWriter(f)
+		defer func() {
+			if e := w.Flush(); e != nil && err == nil {
+				err = e
+			}
+		}()
+		rep = w
+	}
+	var textReport io.Writer // Written by package y.
+	var textBuf bytes.Buffer
+	if rep != nil && g.ReportFormat == "text" {
+		textReport = &textBuf
+	}
+
+	var xerrors []byte
+	if nm := g.XErrors; nm != "" {
+		b, err := ioutil.ReadFile(nm)
+		if err != nil {
+			return err
+		}
+
+		xerrors = b
+	}
+
+	if err := pp.warnings.report(g); err != nil {
+		return err
+	}
+
+	var valueType string
+	if d := pp.define["api.value.type"]; d != nil {
+		valueType = d.val
+	}
+
+	g.prof.enter("parse tables (package y)")
+	p, err := y.ProcessSource(fset, in, pp.src, &y.Options{
+		//NoDefault:   *oNoDefault,
+		AllowConflicts:  true,
+		AllowTypeErrors: valueType != "",
+		Closures:        g.Closures,
+		LA:              g.LA,
+		Reducible:       g.Reducible,
+		Report:          textReport,
+		Resolved:        g.Resolved,
+		XErrorsName:     g.XErrors,
+		XErrorsSrc:      xerrors,
+	})
+	if err != nil {
+		if textReport != nil {
+			rep.Write(textBuf.Bytes())
+		}
+		return err
+	}
+
+	g.prof.enter("report")
+	fp := g.fingerprint(src)
+	if rep != nil {
+		keep, err := g.reportFilter(p)
+		if err != nil {
+			return err
+		}
+
+		switch g.ReportFormat {
+		case "html":
+			err = g.writeHTMLReport(rep, p, keep, fp)
+		case "json":
+			err = g.writeJSONReport(rep, p, keep, fp)
+		case "markdown":
+			err = g.writeMarkdownReport(rep, p, keep, fp)
+		default:
+			fmt.Fprintf(rep, "Fingerprint: %s\nGoyacc version: %s\n\n", fp, version())
+			if err = filterTextReport(rep, textBuf.Bytes(), keep); err == nil && g.Derivations {
+				err = g.writeTextDerivations(rep, p, keep)
+			}
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	g.prof.enter("checks and warnings")
+	if err := g.checkExpect(in, p, pp, g.Strict); err != nil {
+		return err
+	}
+
+	if err := checkLexTokens(p, pp); err != nil {
+		return err
+	}
+
+	if err := g.checkPrefix(fset, p, pp); err != nil {
+		return err
+	}
+
+	eofName, err := g.setEOF(p, pp)
+	if err != nil {
+		return err
+	}
+
+	w, err := g.uselessPrec(p, pp)
+	if err != nil {
+		return err
+	}
+
+	ws := g.uselessRules(fset, p, pp)
+	ws.addList("precedence", w)
+	lw, err := g.lint(fset, p, pp)
+	if err != nil {
+		return err
+	}
+
+	ws = append(ws, lw...)
+	if g.warningEnabled("counterexamples") {
+		cw, err := g.counterexamples(p, pp)
+		if err != nil {
+			return err
+		}
+
+		ws = append(ws, cw...)
+	}
+	if err := ws.report(g); err != nil {
+		return err
+	}
+
+	if g.NoOutput && !g.vet {
+		var terms, nonterms int
+		for nm, sym := range p.Syms {
+			switch {
+			case nm == "" || nm == "ε" || nm == "#":
+			case sym.IsTerminal:
+				terms++
+			default:
+				nonterms++
+			}
+		}
+		fmt.Fprintf(os.Stderr, "%d terminals, %d nonterminals, %d rules, %d states\n", terms, nonterms, len(p.Rules)-1, len(p.Table))
+	}
+
+	g.prof.enter("side outputs")
+	if fn := g.Freeze; fn != "" && !noFiles {
+		toks := map[string]int{}
+		for nm, sym := range p.Syms {
+			if sym.IsTerminal && sym.Value > 0 && nm != "error" && nm[0] != '\'' {
+				toks[nm] = sym.Value
+			}
+		}
+		for _, v := range pp.ranges {
+			delete(toks, v.name)
+		}
+		if err := freezeTokens(fn, toks); err != nil {
+			return err
+		}
+	}
+
+	if fn := g.Dot; fn != "" && !noFiles {
+		if err := g.writeDot(fn, p, g.DotConflicts); err != nil {
+			return err
+		}
+	}
+
+	if fn := g.RuleGraph; fn != "" && !noFiles {
+		if err := g.writeRuleGraph(fn, p); err != nil {
+			return err
+		}
+	}
+
+	if fn := g.JSON; fn != "" && !noFiles {
+		if err := g.writeJSON(fn, p); err != nil {
+			return err
+		}
+	}
+
+	if g.Conflicts != "" {
+		if err := g.writeConflicts(os.Stdout, p, pp); err != nil {
+			return err
+		}
+	}
+
+	var overlay []*overlayCell
+	if len(g.Overlays) != 0 {
+		if overlay, err = g.overlays(fset, in, src, p); err != nil {
+			return err
+		}
+	}
+
+	if fn := g.XErrorsGen; fn != "" && !noFiles {
+		f, err := os.OpenFile(fn, os.O_RDWR|os.O_CREATE, 0666)
+		if err != nil {
+			return err
+		}
+
+		b := bufio.NewWriter(f)
+		if err := p.SkeletonXErrors(b); err != nil {
+			return err
+		}
+
+		if err := b.Flush(); err != nil {
+			return err
+		}
+
+		if err := f.Close(); err != nil {
+			return err
+		}
+	}
+
+	msu := make(map[*y.Symbol]int, len(p.Syms)) // sym -> usage
+	for nm, sym := range p.Syms {
+		if nm == "" || nm == "ε" || nm == "$accept" || nm == "#" {
+			continue
+		}
+
+		msu[sym] = 0
+	}
+	var minArg, maxArg int
+	for _, state := range p.Table {
+		for _, act := range state {
+			msu[act.Sym]++
+			k, arg := act.Kind()
+			if k == 'a' {
+				continue
+			}
+
+			if k == 'r' {
+				arg = -arg
+			}
+			minArg, maxArg = mathutil.Min(minArg, arg), mathutil.Max(maxArg, arg)
+		}
+	}
+	su := make(symsUsed, 0, len(msu))
+	for sym, used := range msu {
+		su = append(su, symUsed{sym, used})
+	}
+	sort.Sort(su)
+
+	prologue, pkg := p.Prologue, g.outDirPackage()
+	if nm := g.Package; nm != "" || pp.settings["%package"] != nil {
+		if nm == "" {
+			nm = pp.settings["%package"].val
+		}
+		prologue, pkg = setPackage(prologue, nm), ""
+	}
+	var tokensPath string // Of the -tokens package, imported by the parser.
+	if fn := g.Tokens; fn != "" {
+		if tokensPath, err = tokensImportPath(fn); err != nil {
+			return err
+		}
+	}
+	prologue = injectImport(prologue, pkg, tokensPath)
+	stateType := "int"
+	if d := pp.define["api.state.type"]; d != nil {
+		stateType = d.val
+		if max := intTypeMax[stateType]; uint64(len(p.Table)-1) > max {
+			return fmt.Errorf("%v: %%define api.state.type %s cannot represent state %d", d.pos, stateType, len(p.Table)-1)
+		}
+	}
+
+	unionSrc := p.UnionSrc
+	var unionDoc string
+	if u := pp.union; u != nil {
+		body := strings.TrimRightFunc(u.src[:len(u.src)-1], unicode.IsSpace)
+		unionSrc = "struct " + body + "\n\tyys int\n}"
+		if len(u.doc) != 0 {
+			unionDoc = strings.Join(u.doc, "\n") + "\n"
+		}
+	}
+	switch {
+	case valueType != "":
+		unionSrc = fmt.Sprintf("struct {\n\tyys   %s\n\tvalue %s\n}", stateType, valueType)
+	case stateType != "int":
+		if !yysField.MatchString(unionSrc) {
+			panic("internal error 004")
+		}
+
+		unionSrc = yysField.ReplaceAllString(unionSrc, "${1}"+stateType)
+	}
+	grammarName := inName
+	if grammarName == "" {
+		grammarName = filepath.Base(in)
+	}
+	hdr, err := g.header(grammarName, src)
+	if err != nil {
+		return err
+	}
+
+	g.prof.enter("parser emission")
+	if fn := g.Skeleton; fn != "" {
+		g.printConflicts(p)
+		d := g.newSkeleton(p, pp, prologue, unionSrc, stateType, actionEmitter(fset, p, valueType, lineFile))
+		d.Header, d.Fingerprint, d.Version = hdr, fp, version()
+		return execSkeleton(out, fn, d)
+	}
+
+	// ----------------------------------------------------------- Prologue
+	f := strutil.IndentFormatter(out, "\t")
+	f.Format("%s\n", hdr)
+	if expr := g.buildConstraint(pp); expr != "" {
+		f.Format("//go:build %s\n\n", expr)
+	}
+	f.Format("%s", prologue)
+	stackElem := g.Prefix + "SymType" // Of the parser stack.
+	newStack := fmt.Sprintf("make([]%sSymType, %d)", g.Prefix, g.Stack)
+	if g.PtrStack {
+		stackElem = "*" + stackElem
+		newStack = fmt.Sprintf("%sgrowStack(nil, %d)", g.Prefix, g.Stack)
+	}
+	if g.Pool {
+		f.Format(`
+var %[1]sPool = __sync__.Pool{New: func() interface{} { s := %[2]s; return &s }}
+`, g.Prefix, newStack)
+	}
+	f.Format(`
+%[3]stype %[1]sSymType %i%s%u
+
+type %[1]sXError struct {
+	state, xsym int
+}
+`, g.Prefix, unionSrc, unionDoc)
+
+	// ---------------------------------------------------------- Constants
+	ranges := map[string]*charRange{}
+	for _, v := range pp.ranges {
+		ranges[v.name] = v
+	}
+	nsyms := map[string]*y.Symbol{}
+	a := make([]string, 0, len(msu))
+	maxTokName := 0
+	for sym := range msu {
+		nm := sym.Name
+		if nm == "$default" || nm == "$end" || sym.IsTerminal && nm[0] != '\'' && sym.Value > 0 && ranges[nm] == nil {
+			maxTokName = mathutil.Max(maxTokName, len(nm))
+			a = append(a, nm)
+		}
+		nsyms[nm] = sym
+	}
+	sort.Strings(a)
+	maxTokName += len(g.Prefix)
+	constName := func(pref, v string) string {
+		switch v {
+		case "error":
+			return pref + "ErrCode"
+		case "$default":
+			return pref + "Default"
+		case "$end":
+			if eofName == g.Prefix+"EofCode" {
+				return pref + "EofCode"
+			}
+
+			return eofName
+		}
+
+		return v
+	}
+	// With qual, like "__yytokens__.", a constant is the one of the -tokens
+	// package.
+	constant := func(f strutil.Formatter, pref, qual, v, comment string) {
+		nm := constName(pref, v)
+		val := strconv.Itoa(nsyms[v].Value)
+		if qual != "" {
+			val = qual + constName(g.exportedPrefix(), v)
+		}
+		f.Format("%s%s = %s", nm, strings.Repeat(" ", maxTokName-len(nm)+1), val)
+		switch ls := nsyms[v].LiteralString; {
+		case ls != "" && comment != "":
+			f.Format(" // %s %s", ls, strings.TrimSpace(strings.TrimPrefix(comment, "//")))
+		case ls != "":
+			f.Format(" // %s", ls)
+		case comment != "":
+			f.Format(" %s", comment)
+		}
+		f.Format("\n")
+		if v == "$end" && nm != pref+"EofCode" {
+			f.Format("%sEofCode = %s\n", pref, nm)
+		}
+	}
+	isConst := make(map[string]bool, len(a))
+	for _, v := range a {
+		isConst[v] = true
+	}
+	grouped := map[string]bool{}
+	var declared []string // Named tokens in declaration order.
+	for _, g := range pp.tokens {
+		for _, v := range g.names {
+			if isConst[v] {
+				grouped[v] = true
+				declared = append(declared, v)
+			}
+		}
+	}
+	constants := func(f strutil.Formatter, pref, qual string) {
+		for _, v := range a {
+			if !grouped[v] {
+				constant(f, pref, qual, v, "")
+			}
+		}
+		for _, g := range pp.tokens {
+			var names []string
+			for _, v := range g.names {
+				if isConst[v] {
+					names = append(names, v)
+				}
+			}
+			if len(names) == 0 {
+				continue
+			}
+
+			sort.Strings(names)
+			f.Format("\n")
+			for _, v := range g.doc {
+				f.Format("%s\n", v)
+			}
+			for _, v := range names {
+				constant(f, pref, qual, v, g.comments[v])
+			}
+		}
+	}
+	f.Format("\nconst (%i\n")
+	if tokensPath != "" {
+		constants(f, g.Prefix, "__yytokens__.")
+	} else {
+		constants(f, g.Prefix, "")
+	}
+	minArg-- // eg: [-13, 42], minArg -14 maps -13 to 1 so zero cell values -> empty.
+	f.Format("\n%sMaxDepth  = %d // Parser stack depth limit of a parser having MaxDepth zero, 0 for no limit.\n", g.Prefix, g.MaxDepth)
+	f.Format("%sMaxErrors = %d // Syntax errors limit of a parser having MaxErrors zero, 0 for no limit.\n", g.Prefix, g.MaxErrors)
+	f.Format("%sTabOfs    = %d\n", g.Prefix, minArg)
+	f.Format("\n// %sFingerprint is the hash of the grammar, the goyacc version and the options generating the parser.\n", g.Prefix)
+	f.Format("%sFingerprint   = %q\n", g.Prefix, fp)
+	f.Format("%sGoyaccVersion = %q\n", g.Prefix, version())
+	f.Format("%u)")
+	if g.Embed != "" {
+		g.embedGrammar(f, grammarName, src)
+	}
+
+	if fn := g.Tokens; fn != "" && !noFiles {
+		pref := g.exportedPrefix()
+		var names, aliases []string // Of the token values, as Go map entries.
+		for _, v := range a {
+			if v != "$default" {
+				names = append(names, fmt.Sprintf("%s: %q", constName(pref, v), v))
+			}
+		}
+		for _, v := range su {
+			if sym := v.sym; sym.IsTerminal {
+				ls, _ := strconv.Unquote(sym.LiteralString)
+				if ls = strings.TrimSpace(ls); ls == "" {
+					continue
+				}
+
+				k := strconv.Itoa(sym.Value)
+				if isConst[sym.Name] {
+					k = constName(pref, sym.Name)
+				}
+				aliases = append(aliases, fmt.Sprintf("%s: %q", k, ls))
+			}
+		}
+		if err := g.writeTokens(fn, hdr, func(f strutil.Formatter) { constants(f, pref, "") }, names, aliases); err != nil {
+			return err
+		}
+	}
+
+	// ---------------------------------------------------------- Variables
+	f.Format("\n\nvar (%i\n")
+
+	f.Format("// %sTokens lists the values of the named tokens in declaration order.\n", g.exportedPrefix())
+	f.Format("%sTokens = []int{%i\n", g.exportedPrefix())
+	for _, v := range declared {
+		f.Format("%s,\n", v)
+	}
+	f.Format("%u}\n")
+
+	var tokenInfo string
+	if pp.settings["%token-table"] != nil {
+		caseless := map[string]bool{}
+		for _, v := range pp.keywords {
+			caseless[v] = true
+		}
+		names := append([]string(nil), declared...)
+		for _, v := range a {
+			if !grouped[v] && v != "error" && v[0] != '$' {
+				names = append(names, v)
+			}
+		}
+		f.Format("\n// %[1]sTokenTable describes the named tokens in declaration order.\n", g.exportedPrefix())
+		f.Format("%[1]sTokenTable = []%[1]sTokenInfo{%i\n", g.exportedPrefix())
+		for _, nm := range names {
+			alias, _ := strconv.Unquote(p.Syms[nm].LiteralString)
+			f.Format("{%q, %s, %q, %v},\n", nm, nm, alias, caseless[nm] || strings.EqualFold(alias, nm))
+		}
+		f.Format("%u}\n")
+		tokenInfo = fmt.Sprintf(`
+// %[1]sTokenInfo describes a token of the grammar.
+type %[1]sTokenInfo struct {
+	Name    string // Token name, like NUM.
+	Value   int
+	Alias   string // String alias, like "number", if any.
+	Keyword bool   // Declared by %%token-caseless or the alias is the name in any case, like SELECT "select".
+}
+`, g.exportedPrefix())
+	}
+
+	f.Format("\n%sPrec = map[int]int{%i\n", g.Prefix)
+	for i, v := range p.AssocDefs {
+		for _, w := range v.Syms {
+			if !w.IsTerminal {
+				continue
+			}
+
+			f.Format("%s: %v,\n", w.Name, i)
+		}
+	}
+	f.Format("}%u\n\n")
+
+	if len(pp.keywords) != 0 {
+		var a []string
+		for k, v := range pp.keywords {
+			if isConst[v] {
+				a = append(a, k)
+			}
+		}
+		sort.Strings(a)
+		f.Format("// %sKeywords maps the lower cased case-insensitive keywords to their tokens.\n", g.Prefix)
+		f.Format("%sKeywords = map[string]int{%i\n", g.Prefix)
+		for _, k := range a {
+			f.Format("%q: %s,\n", k, pp.keywords[k])
+		}
+		f.Format("%u}\n\n")
+	}
+
+	if g.FollowSets {
+		f.Format("%sFollow = [][]int{%i\n", g.Prefix)
+		for state, action := range p.Table {
+			f.Format("{")
+			for _, a := range action {
+				f.Format("%v, ", a.Sym.Value)
+			}
+			f.Format("}, // state %v\n", state)
+		}
+		f.Format("%u}\n\n")
+	}
+
+	// Lex translation table
+	xlat := make(map[int]int, len(su))
+	var errSym int
+	var vals []int // Of the symbols in yyXLAT.
+	for i, v := range su {
+		if v.sym.Name == "error" {
+			errSym = i
+		}
+		xlat[v.sym.Value] = i
+		if ranges[v.sym.Name] == nil {
+			vals = append(vals, v.sym.Value)
+		}
+	}
+	sort.Ints(vals)
+	segs := segmentXLAT(vals)
+	switch {
+	case segs == nil:
+		f.Format("%sXLAT = map[int]int{%i\n", g.Prefix)
+	default:
+		f.Format("// %[1]sXLAT maps the token values, see %[1]sxlat, to their symbols plus one,\n// zero for none.\n", g.Prefix)
+		f.Format("%sXLAT = [...]int32{%i\n", g.Prefix)
+	}
+	for _, c := range vals {
+		i := xlat[c]
+		sym := su[i].sym
+		if segs == nil {
+			f.Format("%6d: %3d, // %s (%dx)\n", c, i, sym.Name, msu[sym])
+			continue
+		}
+
+		f.Format("%4d: %3d, // %d: %s (%dx)\n", segs.index(c), i+1, c, sym.Name, msu[sym])
+	}
+	f.Format("%u}\n")
+
+	// Terminal tokens
+	f.Format("\n// %sXSymTokens are the tokens of the terminal symbols, -1 for others.\n", g.Prefix)
+	f.Format("%sXSymTokens = []int{%i\n", g.Prefix)
+	for _, v := range su {
+		tok := v.sym.Value
+		switch r := ranges[v.sym.Name]; {
+		case !v.sym.IsTerminal || v.sym.Name == "error":
+			tok = -1
+		case r != nil:
+			tok = int(r.lo)
+		}
+		f.Format("%d, // %s\n", tok, v.sym.Name)
+	}
+	f.Format("%u}\n")
+
+	// Character ranges, sorted.
+	if len(pp.ranges) != 0 {
+		f.Format("\n%sXLATRanges = []struct{ lo, hi, xsym int }{%i\n", g.Prefix)
+		for _, v := range pp.ranges {
+			f.Format("{%d, %d, %d}, // %v (%dx)\n", v.lo, v.hi, xlat[nsyms[v.name].Value], v, msu[nsyms[v.name]])
+		}
+		f.Format("%u}\n")
+	}
+
+	// Symbol names
+	f.Format("\n%sSymNames = []string{%i\n", g.Prefix)
+	for _, v := range su {
+		nm := v.sym.Name
+		if r := ranges[nm]; r != nil {
+			nm = r.String()
+		}
+		if nm == "$end" && eofName != g.Prefix+"EofCode" {
+			nm = eofName
+		}
+		f.Format("%q,\n", strings.TrimSpace(nm))
+	}
+	f.Format("%u}\n")
+
+	// Token literal strings
+	f.Format("\n%sTokenLiteralStrings = map[int]string{%i\n", g.Prefix)
+	for _, v := range su {
+		if sym := v.sym; sym.IsTerminal {
+			ls := sym.LiteralString
+			ls, _ = strconv.Unquote(ls)
+			ls = strings.TrimSpace(ls)
+			if ls == "" {
+				continue
+			}
+
+			f.Format("%d: %q,\n", sym.Value, ls)
+		}
+	}
+	f.Format("%u}\n")
+
+	// Reduction table
+	f.Format("\n// %sReductions are the symbols and lengths of the rules, by rule number.\n", g.Prefix)
+	f.Format("%sReductions = []struct{ xsym, components int }{%i\n", g.Prefix)
+	for _, rule := range p.Rules {
+		f.Format("{%d, %d},\n", xlat[rule.Sym.Value], len(rule.Components))
+	}
+	f.Format("%u}\n")
+
+	// Accessing symbols
+	stateSyms := make([]int, len(p.Table))
+	stateSyms[0] = -1
+	for _, state := range p.Table {
+		for _, act := range state {
+			if kind, arg := act.Kind(); kind == 's' || kind == 'g' {
+				stateSyms[arg] = xlat[act.Sym.Value]
+			}
+		}
+	}
+	f.Format("\n// %sStateSyms are the symbols entering the states, -1 for the start state.\n", g.Prefix)
+	f.Format("%sStateSyms = []int{%i", g.Prefix)
+	for i, v := range stateSyms {
+		if i%16 == 0 {
+			f.Format("\n")
+		}
+		f.Format("%d, ", v)
+	}
+	f.Format("%u\n}\n")
+
+	// XError table
+	f.Format("\n%[1]sXErrors = map[%[1]sXError]string{%i\n", g.Prefix)
+	for _, xerr := range p.XErrors {
+		state := xerr.Stack[len(xerr.Stack)-1]
+		xsym := -1
+		if xerr.Lookahead != nil {
+			xsym = xlat[xerr.Lookahead.Value]
+		}
+		f.Format("%[1]sXError{%d, %d}: \"%s\",\n", g.Prefix, state, xsym, xerr.Msg)
+	}
+	f.Format("%u}\n\n")
+
+	// Parse table
+	tbits := 32
+	switch n := mathutil.BitLen(maxArg - minArg + 1); {
+	case n < 8:
+		tbits = 8
+	case n < 16:
+		tbits = 16
+	}
+	masked := map[overlayKey]int{} // Overlay cell: its table value.
+	for _, v := range overlay {
+		masked[overlayKey{v.state, v.sym.Name}] = 0
+	}
+	var tabRow sortutil.Uint64Slice
+	var rows [][]int
+	for si, state := range p.Table {
+		tabRow = tabRow[:0]
+		max := 0
+		for _, act := range state {
+			sym := act.Sym
+			xsym, ok := xlat[sym.Value]
+			if !ok {
+				panic("internal error 001")
+			}
+
+			max = mathutil.Max(max, xsym)
+			kind, arg := act.Kind()
+			switch kind {
+			case 'a':
+				arg = 0
+			case 'r':
+				arg *= -1
+			}
+			val := arg - minArg
+			if _, ok := masked[overlayKey{si, sym.Name}]; ok {
+				masked[overlayKey{si, sym.Name}] = val
+				val = 0 // Disabled initially.
+			}
+			tabRow = append(tabRow, uint64(xsym)<<32|uint64(val))
+		}
+		var row []int
+		if len(tabRow) != 0 {
+			row = make([]int, max+1)
+		}
+		for _, v := range tabRow {
+			row[int(uint32(v>>32))] = int(uint32(v))
+		}
+		rows = append(rows, row)
+	}
+	// The overlays modify the rows, which must not be shared then.
+	data, offs := packRows(rows, len(overlay) == 0)
+	nCells := len(data)
+	f.Format("// %[1]sParseData are the rows of %[1]sParseTab, packed.\n", g.Prefix)
+	f.Format("%sParseData = [...]uint%d{%i", g.Prefix, tbits)
+	for i, v := range data {
+		if i%16 == 0 {
+			f.Format("\n")
+		}
+		f.Format("%d, ", v)
+	}
+	f.Format("%u\n}\n\n")
+	f.Format("%sParseTab = [%d][]uint%d{%i\n", g.Prefix, len(p.Table), tbits)
+	for si, row := range rows {
+		if si%5 == 0 {
+			f.Format("// %d\n", si)
+		}
+		lo, hi := offs[si], offs[si]+len(row)
+		f.Format("%sParseData[%d:%d:%[3]d],\n", g.Prefix, lo, hi)
+	}
+	f.Format("%u}\n")
+	if len(overlay) != 0 {
+		if !pure {
+			f.Format("\n%[1]sOverlayOn = map[string]bool{}\n", g.Prefix)
+		}
+		f.Format("\n// Overlay name: parse table cells, {state, xsym, value}.\n")
+		f.Format("%[1]sOverlays = map[string][]%[1]sOverlayCell{%i\n", g.Prefix)
+		for _, nm := range g.overlayNames() {
+			f.Format("%q: {%i\n", nm)
+			for _, v := range overlay {
+				for _, w := range v.names {
+					if w == nm {
+						f.Format("{%d, %d, %d}, // %s\n", v.state, xlat[v.sym.Value], masked[overlayKey{v.state, v.sym.Name}], v.sym.Name)
+					}
+				}
+			}
+			f.Format("%u},\n")
+		}
+		f.Format("%u}\n")
+	}
+	if !g.vet {
+		fmt.Fprintf(os.Stderr, "Parse table entries: %d of %d, x %d bits == %d bytes\n", nCells, len(p.Table)*len(msu), tbits, nCells*tbits/8)
+	}
+	g.printConflicts(p)
+
+	toState, fromState := "yystate", "v.yys"
+	if stateType != "int" {
+		toState, fromState = fmt.Sprintf("%s(yystate)", stateType), "int(v.yys)"
+	}
+
+	var makeYYS string
+	if g.Pool {
+		clear := "yyS[i] = v"
+		if g.PtrStack {
+			clear = "*yyS[i] = v"
+		}
+		makeYYS = fmt.Sprintf(`p := %[1]sPool.Get().(*[]%[2]s)
+yyS := *p
+
+defer func() {
+	var v %[1]sSymType
+	for i := range yyS {
+		%[3]s
+	}
+	*p = yyS // Keep the grown stack.
+	%[1]sPool.Put(p)
+}()
+`, g.Prefix, stackElem, clear)
+	}
+
+	// Without -ptrstack the values are copied to and from the stack.
+	growStack := fmt.Sprintf(`nyys := make([]%[1]sSymType, len(yyS)*2)
+		copy(nyys, yyS)
+		yyS = nyys`, g.Prefix)
+	valsDecl := "yylval, yyVAL := &yyrcvr.lval, &yyrcvr.val // Not escaping to the heap."
+	pushVal, shiftVal, reduceVal := "yyS[yyp] = *yyVAL", "*yyVAL = *yylval", "*yyVAL = yyS[yyp+1]"
+	topPtr, topVal := "&yyS[yyp]", "yyS[yyp]"
+	if g.PtrStack {
+		growStack = fmt.Sprintf("yyS = %sgrowStack(yyS, 2*len(yyS))", g.Prefix)
+		valsDecl = fmt.Sprintf(`if yyrcvr.lval == nil {
+		yyrcvr.lval, yyrcvr.val = new(%[1]sSymType), new(%[1]sSymType)
+	}
+	yylval, yyVAL := yyrcvr.lval, yyrcvr.val
+	yyrcvr.lval, yyrcvr.val = nil, nil // Restored on return, a panic may leave them on the stack.`, g.Prefix)
+		pushVal = "yyS[yyp], yyVAL = yyVAL, yyS[yyp] // Swap the pointers, yyVAL gets a spare value."
+		shiftVal, reduceVal = "yyVAL, yylval = yylval, yyVAL", "*yyVAL = *yyS[yyp+1]"
+		topPtr, topVal = "yyS[yyp]", "*yyS[yyp]"
+	}
+
+	funcs := tokenInfo
+	if g.PtrStack {
+		funcs += fmt.Sprintf(`
+// %[1]sgrowStack returns s grown to n pointers to distinct values.
+func %[1]sgrowStack(s []*%[1]sSymType, n int) []*%[1]sSymType {
+	if n <= len(s) {
+		return s
+	}
+
+	a := make([]%[1]sSymType, n-len(s))
+	for i := range a {
+		s = append(s, &a[i])
+	}
+	return s
+}
+`, g.Prefix)
+	}
+	xlatOf := func(c string) string { return fmt.Sprintf("%sxlat(%s)", g.Prefix, c) }
+	xlatFrom := "%[1]sXLAT"
+	if len(pp.ranges) != 0 {
+		xlatFrom += " and %[1]sXLATRanges"
+	}
+	funcs += fmt.Sprintf(`
+// %[1]sxlat translates the token value c to its symbol using `+xlatFrom+`.
+func %[1]sxlat(c int) (int, bool) {`, g.Prefix)
+	switch {
+	case segs == nil:
+		funcs += fmt.Sprintf(`
+	if x, ok := %[1]sXLAT[c]; ok {
+		return x, true
+	}
+`, g.Prefix)
+	default:
+		funcs += "\n\ti := -1\n\tswitch {\n"
+		for _, v := range segs {
+			switch {
+			case v.lo == v.hi:
+				funcs += fmt.Sprintf("\tcase c == %d:\n", v.lo)
+			default:
+				funcs += fmt.Sprintf("\tcase c >= %d && c <= %d:\n", v.lo, v.hi)
+			}
+			switch d := v.lo - v.base; {
+			case d == 0:
+				funcs += "\t\ti = c\n"
+			case d < 0:
+				funcs += fmt.Sprintf("\t\ti = c + %d\n", -d)
+			default:
+				funcs += fmt.Sprintf("\t\ti = c - %d\n", d)
+			}
+		}
+		funcs += fmt.Sprintf(`	}
+	if i >= 0 {
+		if x := int(%[1]sXLAT[i]) - 1; x >= 0 {
+			return x, true
+		}
+	}
+`, g.Prefix)
+	}
+	if len(pp.ranges) != 0 {
+		funcs += fmt.Sprintf(`
+	lo, hi := 0, len(%[1]sXLATRanges)
+	for lo < hi {
+		m := int(uint(lo+hi) >> 1)
+		if %[1]sXLATRanges[m].hi < c {
+			lo = m + 1
+		} else {
+			hi = m
+		}
+	}
+	if lo < len(%[1]sXLATRanges) && %[1]sXLATRanges[lo].lo <= c {
+		return %[1]sXLATRanges[lo].xsym, true
+	}
+`, g.Prefix)
+	}
+	funcs += "\n\treturn 0, false\n}\n"
+
+	if len(overlay) != 0 {
+		funcs += fmt.Sprintf(`
+type %[1]sOverlayCell struct {
+	state, xsym int
+	val         uint%[2]d
+}
+`, g.Prefix, tbits)
+		if pure {
+			funcs += fmt.Sprintf(`
+// Overlay enables or disables the parse table overlay of the grammar flag
+// name in p and reports whether the overlay exists. All overlays are disabled
+// initially. Overlay must not be called while p is parsing.
+func (p *%[1]sParser) Overlay(name string, on bool) bool {
+	if _, ok := %[1]sOverlays[name]; !ok {
+		return false
+	}
+
+	if p.tab == nil {
+		t := %[1]sParseTab
+		for i, row := range t {
+			t[i] = append([]uint%[2]d(nil), row...)
+		}
+		p.tab = &t
+		p.overlayOn = map[string]bool{}
+	}
+	p.overlayOn[name] = on
+	for nm, cells := range %[1]sOverlays {
+		if !p.overlayOn[nm] {
+			for _, v := range cells {
+				p.tab[v.state][v.xsym] = 0
+			}
+		}
+	}
+	for nm, cells := range %[1]sOverlays {
+		if p.overlayOn[nm] {
+			for _, v := range cells {
+				p.tab[v.state][v.xsym] = v.val
+			}
+		}
+	}
+	return true
+}
+`, g.Prefix, tbits)
+		} else {
+			funcs += fmt.Sprintf(`
+// %[1]sOverlay enables or disables the parse table overlay of the grammar
+// flag name and reports whether the overlay exists. All overlays are disabled
+// initially. %[1]sOverlay must not be called while parsing.
+func %[1]sOverlay(name string, on bool) bool {
+	if _, ok := %[1]sOverlays[name]; !ok {
+		return false
+	}
+
+	%[1]sOverlayOn[name] = on
+	for nm, cells := range %[1]sOverlays {
+		if !%[1]sOverlayOn[nm] {
+			for _, v := range cells {
+				%[1]sParseTab[v.state][v.xsym] = 0
+			}
+		}
+	}
+	for nm, cells := range %[1]sOverlays {
+		if %[1]sOverlayOn[nm] {
+			for _, v := range cells {
+				%[1]sParseTab[v.state][v.xsym] = v.val
+			}
+		}
+	}
+	return true
+}
+`, g.Prefix)
+		}
+	}
+
+	if len(pp.keywords) != 0 {
+		funcs += fmt.Sprintf(`
+// %[1]sKeyword returns the token of the case-insensitive keyword s, if any.
+func %[1]sKeyword(s string) (int, bool) {
+	tok, ok := %[1]sKeywords[__yystrings__.ToLower(s)]
+	return tok, ok
+}
+`, g.Prefix)
+	}
+
+	lexerDecl := fmt.Sprintf(`type %[1]sLexer interface {
+	Lex(lval *%[1]sSymType) int
+	Error(s string)
+}
+
+type %[1]sLexerEx interface {
+	%[1]sLexer
+	Reduced(rule, state int, lval *%[1]sSymType) bool
+}`, g.Prefix)
+	lexer := "yylex"
+	if t := g.Lexer; t != "" {
+		lexerDecl = fmt.Sprintf(`// %[1]sLexer is the lexer type given by -lexer.
+type %[1]sLexer = %[2]s
+
+type %[1]sLexerEx interface {
+	Lex(lval *%[1]sSymType) int
+	Error(s string)
+	Reduced(rule, state int, lval *%[1]sSymType) bool
+}`, g.Prefix, t)
+		lexer = "interface{}(yylex)"
+	}
+
+	funcs += fmt.Sprintf(`
+// %[1]sLexerErrorEx is optionally implemented by the lexer. The parser then
+// reports errors by calling ErrorEx instead of Error. The error must not be
+// modified.
+type %[1]sLexerErrorEx interface {
+	ErrorEx(err *%[1]sSyntaxError)
+}
+
+// %[1]sLexerPos is optionally implemented by the lexer. Pos returns the
+// current input position.
+type %[1]sLexerPos interface {
+	Pos() int
+}
+
+// %[1]sLexerSpan is optionally implemented by the lexer. Span returns the
+// start and end offsets of the last token returned by Lex. The parser then
+// tracks the spans of the symbols on its stack and reports the span of the
+// offending token in its syntax errors.
+type %[1]sLexerSpan interface {
+	Span() (start, end int)
+}
+
+// %[1]sSpan is the input range of a symbol, from its start offset to its end
+// offset. A nonterminal spans its components or, if it has none, it has the
+// empty span at the end of the preceding symbol.
+type %[1]sSpan struct {
+	Start, End int
+}
+
+// %[1]sPartialer is optionally implemented by the lexer. When a parse fails,
+// the parser calls Partial with the semantic values of its stack, bottom
+// first, as they were before the failed error recovery, if any, so a partial
+// result can be built from a broken input. The values must not be retained
+// after the call returns.
+type %[1]sPartialer interface {
+	Partial(values []%[3]s)
+}
+
+// %[1]sRecoverer is optionally implemented by the lexer. On a syntax error,
+// after reporting it, the parser calls Recover with its state stack, bottom
+// first, and the lookahead token having the value lval. If Recover returns
+// true, the parser continues in the same state with the returned token,
+// having the value lval, replacing the lookahead, like after skipping to the
+// next ';'. Otherwise, the default recovery pops states and discards tokens.
+// Until three tokens are shifted, further syntax errors are not reported and
+// Recover is not called.
+type %[1]sRecoverer interface {
+	Recover(states []int, tok int, lval *%[1]sSymType) (int, bool)
+}
+
+// %[1]sSyntaxError is the first syntax error of a parse.
+type %[1]sSyntaxError struct {
+	State    int    // The parser state.
+	Token    int    // The offending token.
+	Expected []int  // The tokens having an action in State.
+	Pos      int    // The input position of a lexer implementing %[1]sLexerPos, -1 otherwise.
+	Span     %[1]sSpan // The offending token of a lexer implementing %[1]sLexerSpan, -1, -1 otherwise.
+	Stack    string // The symbols of the parser stack, see %[1]sStackString.
+	Msg      string // The message passed to the Error method of the lexer.
+}
+
+func (e *%[1]sSyntaxError) Error() string { return e.Msg }
+
+func %[1]snewSyntaxError(yylex interface{}, row []uint%[2]d, stack []%[3]s, state, tok int, span %[1]sSpan, msg string) *%[1]sSyntaxError {
+	e := &%[1]sSyntaxError{State: state, Token: tok, Pos: -1, Span: %[1]sSpan{-1, -1}, Stack: %[1]sStackString(stack), Msg: msg}
+	for x, v := range row {
+		if tok := %[1]sXSymTokens[x]; v != 0 && tok >= 0 {
+			e.Expected = append(e.Expected, tok)
+		}
+	}
+	if l, ok := yylex.(%[1]sLexerPos); ok {
+		e.Pos = l.Pos()
+	}
+	if _, ok := yylex.(%[1]sLexerSpan); ok {
+		e.Span = span
+	}
+	return e
+}
+
+// %[1]sStackString returns the symbols of the parser stack separated by
+// spaces, like "expr '+' term". The start state has no symbol.
+func %[1]sStackString(stack []%[3]s) string {
+	s := ""
+	for _, v := range stack {
+		if x := %[1]sStateSyms[%[4]s]; x >= 0 {
+			if s != "" {
+				s += " "
+			}
+			s += %[1]sSymNames[x]
+		}
+	}
+	return s
+}
+
+// %[1]sTracer receives the events of a parser having it in its Tracer field.
+// The symbols are indexes of %[1]sSymNames. The values must not be retained
+// after the call returns.
+type %[1]sTracer interface {
+	// Shift is called after shifting sym, having the value val, and
+	// entering state.
+	Shift(state, sym int, val *%[1]sSymType)
+	// Reduce is called after reducing by rule to sym, having the value
+	// val, and entering state.
+	Reduce(rule, state, sym int, val *%[1]sSymType)
+	// ErrorRecovery is called when the error recovery shifts the error
+	// token and enters state, sym is the lookahead symbol.
+	ErrorRecovery(state, sym int)
+	// Accept is called when the input is accepted, val is the value of
+	// the start symbol.
+	Accept(state int, val *%[1]sSymType)
+}
+
+// %[1]sReduceListener is called after each reduction by rule of the values
+// rhs to lhs, by a parser having it in its ReduceListener field. The values
+// must not be retained after the call returns.
+type %[1]sReduceListener func(rule int, rhs []%[3]s, lhs *%[1]sSymType)
+`, g.Prefix, tbits, stackElem, fromState)
+
+	var guardDecl, guardLex, guardShift string
+	if n := g.LexGuard; n > 0 {
+		guardDecl = fmt.Sprintf(`
+	yyGuard, _ := %[2]s.(%[1]sLexerPos)
+	yyStallTok, yyStallPos, yyStall := -1, -1, 0 // Token and position returned since the last shift, number of repetitions.`, g.Prefix, lexer)
+		guardLex = fmt.Sprintf(`
+		yyPos := -1
+		if yyGuard != nil {
+			yyPos = yyGuard.Pos()
+		}
+		if yychar != yyStallTok || yyPos != yyStallPos {
+			yyStallTok, yyStallPos, yyStall = yychar, yyPos, 0
+		}
+		if yyStall++; yyStall >= %[2]d {
+			msg := __yyfmt__.Sprintf("lexer makes no progress, returned %%d tokens, last %%s", yyStall, %[1]sSymName(yychar))
+			yyreport(msg, -1)
+			goto ret1
+		}`, g.Prefix, n)
+		guardShift = `
+		yyStallTok = -1`
+	}
+
+	var errorDetail string
+	if detailed {
+		errorDetail = fmt.Sprintf(`
+			if !ok {
+				var a []string
+				for x, v := range row {
+					if tok := %[1]sXSymTokens[x]; v != 0 && tok >= 0 {
+						s := %[1]sTokenLiteralStrings[tok]
+						if s == "" {
+							s = %[1]sSymNames[x]
+						}
+						a = append(a, s)
+					}
+				}
+				switch n := len(a); {
+				case n == 1:
+					msg = "expecting " + a[0]
+				case n > 1:
+					msg = "expecting " + __yystrings__.Join(a[:n-1], ", ") + " or " + a[n-1]
+				}
+			}`, g.Prefix)
+	}
+
+	funcs += fmt.Sprintf(`
+// %[1]sExpectedTokens returns the tokens having an action in the parser
+// state, eg. for completion suggestions. A character range is represented by
+// its first character.
+func %[1]sExpectedTokens(state int) []int {
+	var r []int
+	for xsym, v := range %[1]sParseTab[state] {
+		if v != 0 && %[1]sXSymTokens[xsym] >= 0 {
+			r = append(r, %[1]sXSymTokens[xsym])
+		}
+	}
+	return r
+}
+
+// %[1]sExpectedNames returns the names of the tokens having an action in the
+// parser state, preferring their literal strings, eg. for diagnostics.
+func %[1]sExpectedNames(state int) []string {
+	var r []string
+	for xsym, v := range %[1]sParseTab[state] {
+		if tok := %[1]sXSymTokens[xsym]; v != 0 && tok >= 0 {
+			s := %[1]sTokenLiteralStrings[tok]
+			if s == "" {
+				s = %[1]sSymNames[xsym]
+			}
+			r = append(r, s)
+		}
+	}
+	return r
+}
+`, g.Prefix)
+
+	xlatChar := xlatOf("yychar")
+
+	var feedbackDecl, feedbackCall string
+	if pp.settings["%lexer-feedback"] != nil {
+		xlatTok := xlatOf("tok")
+		funcs += fmt.Sprintf(`
+// %[1]sLexerFeedback is optionally implemented by the lexer. The parser calls
+// ParserState with its current state before asking the lexer for the next
+// token, so the lexer can use %[1]sExpectedTokens or %[1]sExpects to decide
+// which token to return, like a typedef name or an identifier.
+type %[1]sLexerFeedback interface {
+	ParserState(state int)
+}
+
+// %[1]sExpects reports whether tok has an action in the parser state.
+func %[1]sExpects(state, tok int) bool {
+	x, ok := %[2]s
+	row := %[1]sParseTab[state]
+	return ok && x < len(row) && row[x] != 0
+}
+`, g.Prefix, xlatTok)
+		feedbackDecl = fmt.Sprintf(`
+	yyFeedback, _ := %[2]s.(%[1]sLexerFeedback)`, g.Prefix, lexer)
+		feedbackCall = `		if yyFeedback != nil {
+			yyFeedback.ParserState(yystate)
+		}
+`
+	}
+
+	// The parse function is the method parse of yyParser, wrapped by the
+	// exported API.
+	checkpoint := pp.settings["%checkpoint"] != nil
+	var cpParam, cpArg string
+	if checkpoint {
+		cpParam, cpArg = fmt.Sprintf(", yycp *%sCheckpoint", g.Prefix), ", nil"
+	}
+	fields := fmt.Sprintf(`
+	MaxDepth  int        // Parser stack depth limit, 0 for the -maxdepth default.
+	MaxErrors int        // Syntax errors limit, 0 for the -maxerrors default.
+	MaxSteps  int        // Shifts and reductions limit, 0 for the -maxsteps default.
+	Tracer    %[1]sTracer // Receives the parser events, if not nil.
+	ReduceListener %[1]sReduceListener // Called after each reduction, if not nil.`, g.Prefix)
+	if len(pp.entries) != 0 {
+		fields += "\n\tEntry int // The %entry token of the nonterminal to parse, 0 for the start symbol."
+	}
+	parseDecl := fmt.Sprintf(`
+	yyTr := yyrcvr.Tracer
+	yyRL := yyrcvr.ReduceListener
+	yymaxDepth := yyrcvr.MaxDepth
+	if yymaxDepth == 0 {
+		yymaxDepth = %[1]sMaxDepth
+	}
+	yymaxErrors := yyrcvr.MaxErrors
+	if yymaxErrors == 0 {
+		yymaxErrors = %[1]sMaxErrors
+	}
+	yymaxSteps := yyrcvr.MaxSteps
+	if yymaxSteps == 0 {
+		yymaxSteps = %[2]d
+	}
+	yyops := 0 // Shifts and reductions.`, g.Prefix, g.MaxSteps)
+	var debugDecl, lex1Param, lex1Arg, saveStack string
+	// With -debugtag, yyDebug or yydebugLevel are declared by the files
+	// written by writeDebugTag.
+	debugLevel, debugVar := "%s", fmt.Sprintf("var %sDebug = 0\n\n", g.Prefix)
+	if g.DebugTag != "" {
+		debugLevel, debugVar = g.Prefix+"debugLevel(%s)", ""
+	}
+	fields += fmt.Sprintf("\n\tlval, val %s // The lookahead and reduction values.", stackElem)
+	fields += fmt.Sprintf("\n\tspans     []%sSpan // Reused by the next parse.", g.Prefix)
+	saveStack = "\n\tyyrcvr.spans = yyspans"
+	reset := fmt.Sprintf(`
+	var v %[1]sSymType
+	yyrcvr.lval, yyrcvr.val = v, v
+`, g.Prefix)
+	clear := "yyrcvr.stack[i] = v"
+	if g.PtrStack {
+		reset = fmt.Sprintf(`
+	var v %[1]sSymType
+	if yyrcvr.lval != nil {
+		*yyrcvr.lval, *yyrcvr.val = v, v
+	}
+`, g.Prefix)
+		clear = "*yyrcvr.stack[i] = v"
+		saveStack += "\n\tyyrcvr.lval, yyrcvr.val = yylval, yyVAL"
+	}
+	if !g.Pool {
+		fields += fmt.Sprintf("\n\tstack    []%s // Reused by the next parse.", stackElem)
+		makeYYS = fmt.Sprintf(`yyS := yyrcvr.stack
+	if len(yyS) == 0 {
+		yyS = %s
+	}
+`, newStack)
+		saveStack += "\n\tyyrcvr.stack = yyS"
+		reset += fmt.Sprintf(`	for i := range yyrcvr.stack {
+		%s
+	}
+`, clear)
+	}
+	if pure {
+		fields = "\n\tDebug       int             // Debug level, 0 to 4.\n\tDebugWriter __yyio__.Writer // Debug output, os.Stderr if nil." + fields
+		if len(overlay) != 0 {
+			fields += fmt.Sprintf(`
+	tab       *[%[2]d][]uint%[3]d // Parse table with the enabled overlays, if any.
+	overlayOn map[string]bool`, g.Prefix, len(p.Table), tbits)
+		}
+		parseDecl += fmt.Sprintf(`
+	%[1]sDebug, %[1]sDebugWriter := %[2]s, yyrcvr.DebugWriter
+	if %[1]sDebugWriter == nil {
+		%[1]sDebugWriter = __yyos__.Stderr
+	}`, g.Prefix, fmt.Sprintf(debugLevel, "yyrcvr.Debug"))
+		if len(overlay) != 0 {
+			parseDecl += fmt.Sprintf(`
+	%[1]sParseTab := &%[1]sParseTab
+	if yyrcvr.tab != nil {
+		%[1]sParseTab = yyrcvr.tab
+	}`, g.Prefix)
+		}
+	} else {
+		fields = fmt.Sprintf(`
+	Debug       int             // Debug level, 0 to 4, 0 for %[1]sDebug.
+	DebugWriter __yyio__.Writer // Debug output, %[1]sDebugWriter if nil.`, g.Prefix) + fields
+		parseDecl += fmt.Sprintf("\n\t%[1]sDebug, %[1]sDebugWriter := yyrcvr.debug()", g.Prefix)
+		debugDecl = fmt.Sprintf(`%[2]s// %[1]sDebugWriter receives the debug output enabled by %[1]sDebug.
+var %[1]sDebugWriter __yyio__.Writer = __yyos__.Stderr
+
+// debug returns the debug level and output of the parser, %[1]sDebug and
+// %[1]sDebugWriter unless set by its fields.
+func (yyrcvr *%[1]sParser) debug() (int, __yyio__.Writer) {
+	n, w := yyrcvr.Debug, yyrcvr.DebugWriter
+	if n == 0 {
+		n = %[1]sDebug
+	}
+	if w == nil {
+		w = %[1]sDebugWriter
+	}
+	return %[3]s, w
+}
+
+`, g.Prefix, debugVar, fmt.Sprintf(debugLevel, "n"))
+	}
+	lex1Param = fmt.Sprintf(", %[1]sDebug int, %[1]sDebugWriter __yyio__.Writer", g.Prefix)
+	lex1Arg = fmt.Sprintf(", %[1]sDebug, %[1]sDebugWriter", g.Prefix)
+	var actionEnter, actionLeave string
+	if g.ActionPanic {
+		funcs += fmt.Sprintf(`
+// %[1]sActionPanic is the panic value of a panicking rule action.
+type %[1]sActionPanic struct {
+	Rule  int         // The rule number.
+	Text  string      // The rule, like "a: b c".
+	Pos   string      // The grammar position of the action, like "parser.y:42", if known.
+	Value interface{} // The recovered panic value.
+}
+
+func (e *%[1]sActionPanic) Error() string {
+	return __yyfmt__.Sprintf("%%s: panic in the action of rule %%d, %%s: %%v", e.Pos, e.Rule, e.Text, e.Value)
+}
+
+// Unwrap returns the recovered panic value if it is an error.
+func (e *%[1]sActionPanic) Unwrap() error {
+	err, _ := e.Value.(error)
+	return err
+}
+`, g.Prefix)
+		parseDecl += fmt.Sprintf(`
+	yyrule := -1 // The rule of the running action, if not negative.
+	defer func() {
+		if yyrule >= 0 {
+			if e := recover(); e != nil {
+				r := %[1]sActionRules[yyrule]
+				panic(&%[1]sActionPanic{yyrule, r.text, r.pos, e})
+			}
+		}
+	}()`, g.Prefix)
+		actionEnter = "\tyyrule = r\n"
+		actionLeave = "\tyyrule = -1\n"
+	}
+
+	var repairCheck string
+	if g.Repair {
+		funcs += fmt.Sprintf(`
+// %[1]sshifts simulates the parser, having the state stack states, reading the
+// symbol xsym. It reports whether xsym is shifted, or the input accepted, and
+// returns the resulting state stack.
+func %[1]sshifts(tab [][]uint%[2]d, states []int, xsym int) ([]int, bool) {
+	states = append([]int(nil), states...)
+	for {
+		top := states[len(states)-1]
+		row := tab[top]
+		n := 0
+		if xsym < len(row) {
+			if n = int(row[xsym]); n != 0 {
+				n += %[1]sTabOfs
+			}
+		}
+		switch {
+		case n > 0:
+			return append(states, n), true
+		case n == 0:
+			return states, top == 1 && %[1]sXSymTokens[xsym] == %[1]sEofCode
+		}
+
+		r := %[1]sReductions[-n]
+		states = states[:len(states)-r.components]
+		states = append(states, int(tab[states[len(states)-1]][r.xsym])+%[1]sTabOfs)
+	}
+}
+
+// %[1]sinsertion returns the token which, inserted before the symbol xsym,
+// lets the parser having the state stack states shift xsym, or -1 if there
+// is none.
+func %[1]sinsertion(tab [][]uint%[2]d, states []int, xsym int) int {
+	for x, v := range tab[states[len(states)-1]] {
+		tok := %[1]sXSymTokens[x]
+		if v == 0 || tok < 0 || x == %[3]d || tok == %[1]sEofCode {
+			continue
+		}
+
+		if s, ok := %[1]sshifts(tab, states, x); ok {
+			if _, ok := %[1]sshifts(tab, s, xsym); ok {
+				return tok
+			}
+		}
+	}
+	return -1
+}
+`, g.Prefix, tbits, errSym)
+		repairCheck = fmt.Sprintf(`
+			yystates := make([]int, 0, yyp+1)
+			for _, v := range yyS[:yyp+1] {
+				yystates = append(yystates, %[2]s)
+			}
+			if tok := %[1]sinsertion(%[1]sParseTab[:], yystates, yyxchar); tok >= 0 {
+				msg = __yyfmt__.Sprintf("%%s, missing %%s before %%s?", msg, %[1]sSymName(tok), %[1]sSymName(yychar))
+			} else if yychar != %[1]sEofCode && yypend < 0 {
+				yypend = %[1]slex1(yylex, &yypendlval%[3]s)
+				if yySpanLex != nil {
+					yypendspan.Start, yypendspan.End = yySpanLex.Span()
+				}
+				if x, ok := %[4]s; ok {
+					if _, ok := %[1]sshifts(%[1]sParseTab[:], yystates, x); ok {
+						msg = __yyfmt__.Sprintf("%%s, extra %%s?", msg, %[1]sSymName(yychar))
+					}
+				}
+			}`, g.Prefix, fromState, lex1Arg, xlatOf("yypend"))
+	}
+
+	var traceShift, traceReduce, traceAccept, traceError, traceRecover, traceDiscard string
+	if g.JSONTrace {
+		funcs += fmt.Sprintf(`
+// %[1]sTraceEvent is a parser action written as a JSON object by the JSON
+// trace.
+type %[1]sTraceEvent struct {
+	Action    string `+"`json:\"action\"`"+`              // accept, discard, error, recover, reduce or shift.
+	State     int    `+"`json:\"state\"`"+`               // The parser state.
+	Lookahead string `+"`json:\"lookahead,omitempty\"`"+` // The lookahead token, if any.
+	Depth     int    `+"`json:\"depth\"`"+`               // The parser stack depth.
+	Rule      int    `+"`json:\"rule,omitempty\"`"+`      // The rule of a reduce action.
+	Goto      int    `+"`json:\"goto,omitempty\"`"+`      // The next state of a shift, reduce or recover action.
+}
+
+func %[1]straceJSON(w __yyio__.Writer, action string, state, char, depth, rule, next int) {
+	e := %[1]sTraceEvent{Action: action, State: state, Depth: depth, Rule: rule, Goto: next}
+	if char >= 0 {
+		e.Lookahead = %[1]sSymName(char)
+	}
+	b, err := __yyjson__.Marshal(&e)
+	if err != nil {
+		panic(err)
+	}
+
+	w.Write(append(b, '\n'))
+}
+`, g.Prefix)
+		if pure {
+			fields = "\n\tTraceJSON __yyio__.Writer // Receives the JSON trace, if not nil." + fields
+			parseDecl += fmt.Sprintf("\n\t%sTraceJSON := yyrcvr.TraceJSON", g.Prefix)
+		} else {
+			debugDecl += fmt.Sprintf(`// %[1]sTraceJSON, if not nil, receives the JSON trace of the parser actions,
+// one %[1]sTraceEvent per line.
+var %[1]sTraceJSON __yyio__.Writer
+
+`, g.Prefix)
+		}
+		trace := func(indent, action, state, depth, rule, next string) string {
+			return fmt.Sprintf(`%[1]sif %[2]sTraceJSON != nil {
+%[1]s	%[2]straceJSON(%[2]sTraceJSON, %[3]q, %[4]s, yychar, %[5]s, %[6]s, %[7]s)
+%[1]s}
+`, indent, g.Prefix, action, state, depth, rule, next)
+		}
+		traceShift = trace("\t\t", "shift", "yystate", "yyp+1", "0", "yyn")
+		traceReduce = trace("\t", "reduce", "exState", "yypt+1", "r", "yystate")
+		traceAccept = trace("\t\t", "accept", "yystate", "yyp+1", "0", "0")
+		traceError = trace("\t\t\t", "error", "yystate", "yyp+1", "0", "0")
+		traceRecover = trace("\t\t\t\t\t\t", "recover", "yyS[yyp].yys", "yyp+1", "0", "yyn")
+		traceDiscard = trace("\t\t\t", "discard", "yystate", "yyp+1", "0", "0")
+	}
+
+	if g.RaceGuard {
+		fields += "\n\tbusy int32 // Non zero while parsing."
+		parseDecl = fmt.Sprintf(`
+	if !__yyatomic__.CompareAndSwapInt32(&yyrcvr.busy, 0, 1) {
+		panic("%[1]sParser: used by more than one goroutine at a time")
+	}
+	defer __yyatomic__.StoreInt32(&yyrcvr.busy, 0)
+`, g.Prefix) + parseDecl
+	}
+
+	var coverReduce string
+	if g.Cover {
+		var decl, field string
+		decl, field, coverReduce = g.coverage(p.Rules, pure)
+		funcs += decl
+		fields += field
+	}
+
+	fields += fmt.Sprintf("\n\tresult *%sSymType // Of ParseResult.", g.Prefix)
+	if push {
+		fields += fmt.Sprintf("\n\tpush   *%sPushParser // Of Push.", g.Prefix)
+	}
+	if g.Cancel > 0 {
+		fields += `
+	ctx    __yycontext__.Context // Of ParseContext.
+	ctxErr error                 // Set when ctx is done.`
+	}
+	debugDecl += fmt.Sprintf(`// %[1]sParser is a parser instance. The zero value is ready to use. A parser
+// must not be used by more than one goroutine at a time, distinct parsers can
+// parse concurrently. Reusing a parser for many parses avoids allocating a
+// new parser stack for every parse.
+type %[1]sParser struct {%[2]s
+}
+
+// New%[4]sParser returns a new parser instance.
+func New%[4]sParser() *%[1]sParser {
+	return &%[1]sParser{}
+}
+
+// Reset releases the semantic values referenced by the parser stack, keeping
+// its capacity for the next parse.
+func (yyrcvr *%[1]sParser) Reset() {%[5]s}
+
+// %[1]sParse parses the input of yylex using a new parser.
+func %[1]sParse(yylex %[1]sLexer) int {
+	var p %[1]sParser
+	return p.Parse(yylex)
+}
+
+// %[1]sParseErr parses the input of yylex using a new parser.
+func %[1]sParseErr(yylex %[1]sLexer) error {
+	var p %[1]sParser
+	return p.ParseErr(yylex)
+}
+
+// Parse parses the input of yylex. It returns 0 on success, 1 on failure and
+// -1 if the Reduced method of a lexer implementing %[1]sLexerEx stopped the
+// parse.
+func (yyrcvr *%[1]sParser) Parse(yylex %[1]sLexer) int {
+	return yyrcvr.parse(yylex%[3]s, nil)
+}
+
+// ParseErr is like Parse but returns the first syntax error, if any, even if
+// an error rule recovered from it. A parse stopped by %[1]sLexerEx.Reduced
+// returns the error "parse stopped by Reduced".
+func (yyrcvr *%[1]sParser) ParseErr(yylex %[1]sLexer) error {
+	var errs []*%[1]sSyntaxError
+	yyrcvr.parse(yylex%[3]s, &errs)
+	if len(errs) != 0 {
+		return errs[0]
+	}
+
+	return nil
+}
+
+// %[1]sParseResult parses the input of yylex using a new parser.
+func %[1]sParseResult(yylex %[1]sLexer) (%[1]sSymType, error) {
+	var p %[1]sParser
+	return p.ParseResult(yylex)
+}
+
+// ParseResult is like ParseErr but returns the semantic value of the start
+// symbol too.
+func (yyrcvr *%[1]sParser) ParseResult(yylex %[1]sLexer) (%[1]sSymType, error) {
+	var v %[1]sSymType
+	yyrcvr.result = &v
+	defer func() { yyrcvr.result = nil }()
+	err := yyrcvr.ParseErr(yylex)
+	return v, err
+}
+
+// %[1]sParseErrors parses the input of yylex using a new parser.
+func %[1]sParseErrors(yylex %[1]sLexer) []*%[1]sSyntaxError {
+	var p %[1]sParser
+	return p.ParseErrors(yylex)
+}
+
+// ParseErrors parses the input of yylex, continuing after the recovered
+// syntax errors, and returns all of them, if any. The parse is aborted after
+// MaxErrors errors unless MaxErrors is zero.
+func (yyrcvr *%[1]sParser) ParseErrors(yylex %[1]sLexer) []*%[1]sSyntaxError {
+	var errs []*%[1]sSyntaxError
+	yyrcvr.parse(yylex%[3]s, &errs)
+	return errs
+}`, g.Prefix, fields, cpArg, strings.ToUpper(g.Prefix), reset)
+	parseFunc := fmt.Sprintf("func (yyrcvr *%[1]sParser) parse(yylex %[1]sLexer%[2]s, yyerrs *[]*%[1]sSyntaxError) int {", g.Prefix, cpParam)
+	var cancelCheck string
+	if n := g.Cancel; n > 0 {
+		debugDecl += fmt.Sprintf(`
+
+// %[1]sParseContext parses the input of yylex using a new parser.
+func %[1]sParseContext(ctx __yycontext__.Context, yylex %[1]sLexer) error {
+	var p %[1]sParser
+	return p.ParseContext(ctx, yylex)
+}
+
+// ParseContext is like ParseErr but aborts the parse when ctx is done,
+// returning ctx.Err().
+func (yyrcvr *%[1]sParser) ParseContext(ctx __yycontext__.Context, yylex %[1]sLexer) error {
+	yyrcvr.ctx, yyrcvr.ctxErr = ctx, nil
+	defer func() { yyrcvr.ctx, yyrcvr.ctxErr = nil, nil }()
+	var errs []*%[1]sSyntaxError
+	yyrcvr.parse(yylex%[2]s, &errs)
+	if yyrcvr.ctxErr != nil {
+		return yyrcvr.ctxErr
+	}
+
+	if len(errs) != 0 {
+		return errs[0]
+	}
+
+	return nil
+}`, g.Prefix, cpArg)
+		parseDecl += "\n\tyyCtx, yySteps := yyrcvr.ctx, 0"
+		cancelCheck = fmt.Sprintf(`	if yyCtx != nil {
+		if yySteps++; yySteps >= %d {
+			yySteps = 0
+			if err := yyCtx.Err(); err != nil {
+				yyrcvr.ctxErr = err
+				goto ret1
+			}
+		}
+	}
+`, n)
+	}
+
+	var entryStart string
+	if len(pp.entries) != 0 {
+		entryStart = fmt.Sprintf(`
+	if yyrcvr.Entry != 0 {
+		yychar = yyrcvr.Entry
+		var ok bool
+		if yyxchar, ok = %[2]s; !ok {
+			yyxchar = len(%[1]sSymNames) // > tab width
+		}
+	}`, g.Prefix, xlatChar)
+	}
+
+	var pushResume, pushSuspend string
+	if push {
+		var stallField, stallSave, stallResume string
+		if g.LexGuard > 0 {
+			stallField = "\n\tstallTok, stallPos, stall int"
+			stallSave = "\n\t\t\tyyPush.stallTok, yyPush.stallPos, yyPush.stall = yyStallTok, yyStallPos, yyStall"
+			stallResume = "\n\t\tyyStallTok, yyStallPos, yyStall = yyPush.stallTok, yyPush.stallPos, yyPush.stall"
+		}
+		funcs += fmt.Sprintf(`
+// The results of %[1]sPushParser.Push.
+const (
+	%[1]sPushMore     = iota // The parser needs the next token.
+	%[1]sPushAccepted        // The input is accepted.
+	%[1]sPushError           // The parser aborted on a syntax error.
+)
+
+// %[1]sPushParser is a parser fed by its Push method with one token at a time.
+// Push runs the parser until it needs the next token, keeping its state for
+// the next call, so an abandoned parser holds no resources but its memory.
+// The fields of the embedded %[1]sParser, like MaxDepth, Tracer or Debug,
+// apply to the parse. The zero value is ready to use.
+type %[1]sPushParser struct {
+	%[1]sParser
+	Errs []string // The syntax errors reported so far.
+
+	tok    int        // The pushed token,
+	lval   %[1]sSymType // and its value,
+	pushed bool       // not yet read by the parser.
+	result int        // Of Push.
+
+	// The parser state saved when waiting for the next token.
+	started                              bool
+	p, state, shift, nerrs, errflag, ops int
+	semantic                             bool%[3]s
+}
+
+// %[1]sNewParser returns a new push parser.
+func %[1]sNewParser() *%[1]sPushParser {
+	return &%[1]sPushParser{}
+}
+
+// Push passes the next token and its semantic value, if any, to the parser.
+// It returns %[1]sPushMore if the parser needs the next token, otherwise the
+// result of the parse, which is also returned by any later call. A token <= 0
+// is the end of input. A panic of a rule action propagates to the caller
+// and aborts the parse.
+func (p *%[1]sPushParser) Push(tok int, lval *%[1]sSymType) int {
+	if p.result != %[1]sPushMore {
+		return p.result
+	}
+
+	p.tok, p.lval, p.pushed = tok, %[1]sSymType{}, true
+	if lval != nil {
+		p.lval = *lval
+	}
+	p.push = p
+	defer func() { p.push = nil }()
+	p.result = %[1]sPushError // Unless the parse returns normally.
+	switch p.parse((*%[1]sPushLexer)(p)%[2]s, nil) {
+	case 0:
+		p.result = %[1]sPushAccepted
+	case 2: // Waiting for the next token.
+		p.result = %[1]sPushMore
+	}
+	return p.result
+}
+
+// %[1]sPushLexer passes the pushed token to the parser.
+type %[1]sPushLexer %[1]sPushParser
+
+func (l *%[1]sPushLexer) Lex(lval *%[1]sSymType) int {
+	yys := lval.yys
+	*lval = l.lval
+	lval.yys = yys
+	l.pushed = false
+	return l.tok
+}
+
+func (l *%[1]sPushLexer) Error(s string) { l.Errs = append(l.Errs, s) }
+`, g.Prefix, cpArg, stallField)
+		parseDecl += "\n\tyyPush := yyrcvr.push"
+		pushResume = fmt.Sprintf(`
+	if yyPush != nil && yyPush.started {
+		yyp, yystate, yyshift = yyPush.p, yyPush.state, yyPush.shift
+		Nerrs, Errflag, yyops, yysemantic = yyPush.nerrs, yyPush.errflag, yyPush.ops, yyPush.semantic%[1]s
+		yyspans = yyrcvr.spans
+		goto yynewstate
+	}`, stallResume)
+		pushSuspend = fmt.Sprintf(`		if yyPush != nil && !yyPush.pushed {
+			yyPush.p, yyPush.state, yyPush.shift = yyp, yystate, yyshift
+			yyPush.nerrs, yyPush.errflag, yyPush.ops, yyPush.semantic = Nerrs, Errflag, yyops, yysemantic%[1]s
+			yyPush.started = true%[2]s
+			return 2
+		}
+`, stallSave, strings.Replace(saveStack, "\n\t", "\n\t\t\t", -1))
+	}
+
+	var checkpointDecl, checkpointResume, checkpointCall string
+	if checkpoint {
+		funcs += fmt.Sprintf(`
+// %[1]sCheckpoint is the parser state saved before reading a token.
+type %[1]sCheckpoint struct {
+	stack []%[1]sSymType
+	state int
+	spans []%[1]sSpan
+}
+
+// %[1]sCheckpointer is optionally implemented by the lexer. Before reading
+// a token, unless recovering from a syntax error, the parser calls
+// WantCheckpoint with the depth of its stack and, if it returns true,
+// Checkpoint with the parser state. Resuming from the checkpoint with the
+// lexer positioned at the token reparses the input following it, like the
+// edited suffix of a file. Checkpoints are cheap at shallow stack depths, eg.
+// between top level declarations.
+type %[1]sCheckpointer interface {
+	WantCheckpoint(depth int) bool
+	Checkpoint(cp *%[1]sCheckpoint)
+}
+`, g.Prefix)
+		if pure {
+			debugDecl += fmt.Sprintf(`
+
+// Resume parses the input of yylex starting from yycp, or from the start if
+// yycp is nil.
+func (yyrcvr *%[1]sParser) Resume(yylex %[1]sLexer, yycp *%[1]sCheckpoint) int {
+	return yyrcvr.parse(yylex, yycp, nil)
+}`, g.Prefix)
+		} else {
+			debugDecl += fmt.Sprintf(`
+
+// %[1]sResume parses the input of yylex starting from yycp, or from the
+// start if yycp is nil, using a new parser.
+func %[1]sResume(yylex %[1]sLexer, yycp *%[1]sCheckpoint) int {
+	var p %[1]sParser
+	return p.parse(yylex, yycp, nil)
+}`, g.Prefix)
+		}
+		checkpointDecl = fmt.Sprintf(`
+	yyCp, _ := %[2]s.(%[1]sCheckpointer)`, g.Prefix, lexer)
+		checkpointResume = fmt.Sprintf(`
+	if yycp != nil {
+		if len(yycp.stack) > len(yyS) {
+			yyS = make([]%[1]sSymType, 2*len(yycp.stack))
+		}
+		yyp = copy(yyS, yycp.stack) - 1
+		yystate = yycp.state
+		yyspans = append(yyspans[:0], yycp.spans...)
+		for len(yyspans) < len(yycp.stack) {
+			yyspans = append(yyspans, %[1]sSpan{})
+		}
+		goto yynewstate
+	}
+`, g.Prefix)
+		checkpointCall = fmt.Sprintf(`		if yyCp != nil && Errflag == 0 && yyCp.WantCheckpoint(yyp+1) {
+			yyCp.Checkpoint(&%[1]sCheckpoint{append([]%[1]sSymType(nil), yyS[:yyp+1]...), yystate, append([]%[1]sSpan(nil), yyspans...)})
+		}
+`, g.Prefix)
+		if g.PtrStack {
+			checkpointResume = fmt.Sprintf(`
+	if yycp != nil {
+		yyS = %[1]sgrowStack(yyS, 2*len(yycp.stack))
+		for i, v := range yycp.stack {
+			*yyS[i] = v
+		}
+		yyp = len(yycp.stack) - 1
+		yystate = yycp.state
+		yyspans = append(yyspans[:0], yycp.spans...)
+		for len(yyspans) < len(yycp.stack) {
+			yyspans = append(yyspans, %[1]sSpan{})
+		}
+		goto yynewstate
+	}
+`, g.Prefix)
+			checkpointCall = fmt.Sprintf(`		if yyCp != nil && Errflag == 0 && yyCp.WantCheckpoint(yyp+1) {
+			yycps := make([]%[1]sSymType, yyp+1)
+			for i, v := range yyS[:yyp+1] {
+				yycps[i] = *v
+			}
+			yyCp.Checkpoint(&%[1]sCheckpoint{yycps, yystate, append([]%[1]sSpan(nil), yyspans...)})
+		}
+`, g.Prefix)
+		}
+	}
+
+	f.Format(`%u)
+
+%[15]s
+
+%[10]s
+
+// %[1]sSymName returns the name of the token c, preferring its string alias,
+// if any.
+func %[1]sSymName(c int) (s string) {
+	if s := %[1]sTokenLiteralStrings[c]; s != "" {
+		return s
+	}
+
+	x, ok := %[1]sxlat(c)
+	if ok {
+		return %[1]sSymNames[x]
+	}
+
+	if c < 0x7f {
+		return __yyfmt__.Sprintf("%%q", c)
+	}
+
+	return __yyfmt__.Sprintf("%%d", c)
+}
+%[8]s
+func %[1]slex1(yylex %[1]sLexer, lval *%[1]sSymType%[17]s) (n int) {
+	n = yylex.Lex(lval)
+	if n <= 0 {
+		n = %[1]sEofCode
+	}
+	if %[1]sDebug >= 3 {
+		__yyfmt__.Fprintf(%[1]sDebugWriter, "\nlex %%s(%%#x %%d), %[4]s: %[3]s\n", %[1]sSymName(n), n, n, %[4]s)
+	}
+	return n
+}
+	
+%[16]s
+	const yyError = %[2]d%[18]s
+
+	yyEx, _ := %[11]s.(%[1]sLexerEx)
+	yyRec, _ := %[11]s.(%[1]sRecoverer)
+	yyPart, _ := %[11]s.(%[1]sPartialer)
+	yySpanLex, _ := %[11]s.(%[1]sLexerSpan)
+	yyErrEx, _ := %[11]s.(%[1]sLexerErrorEx)%[12]s%[20]s%[23]s
+	var yyn int
+	%[36]s
+	*yylval, *yyVAL = %[1]sSymType{}, %[1]sSymType{}
+	%[5]s
+
+	Nerrs := 0   /* number of errors */
+	Errflag := 0 /* error recovery flag */
+	yyerrok := func() { 
+		if %[1]sDebug >= 2 {
+			__yyfmt__.Fprintf(%[1]sDebugWriter, "yyerrok()\n")
+		}
+		Errflag = 0
+	}
+	_ = yyerrok
+	yystate := 0
+	yychar := -1
+	var yyxchar int
+	var yyshift int
+	yypend := -1 // Token pushed back by yybackup, or read ahead, if not negative.
+	var yypendlval %[1]sSymType
+	var yylspan, yyvalspan, yypendspan %[1]sSpan // Of yylval, yyVAL and yypendlval.
+	yyspans := yyrcvr.spans[:0]                  // The spans of the stack symbols, if tracked.
+	yyclearin := func() {
+		if %[1]sDebug >= 2 {
+			__yyfmt__.Fprintf(%[1]sDebugWriter, "yyclearin()\n")
+		}
+		yychar = -1
+	}
+	_ = yyclearin
+	yybackup := func(tok int, lval %[1]sSymType) bool {
+		if yypend >= 0 {
+			return false
+		}
+
+		if tok <= 0 {
+			tok = %[1]sEofCode
+		}
+		if %[1]sDebug >= 2 {
+			__yyfmt__.Fprintf(%[1]sDebugWriter, "yybackup(%%s)\n", %[1]sSymName(tok))
+		}
+		if yychar >= 0 {
+			yypend, yypendlval, yypendspan = yychar, *yylval, yylspan
+		}
+		yychar, *yylval = tok, lval
+		var ok bool
+		if yyxchar, ok = %[9]s; !ok {
+			yyxchar = len(%[1]sSymNames) // > tab width
+		}
+		return true
+	}
+	_ = yybackup
+	yyjump := 0 // Set by yyaccept, yyabort and yyerror.
+	var yyjumpMsg string
+	yyaccept := func() { yyjump = 1 }
+	yyabort := func() { yyjump = 2 }
+	yyerror := func(msg string) { yyjump, yyjumpMsg = 3, msg }
+	_, _, _ = yyaccept, yyabort, yyerror
+	yyp := -1
+	yysemantic := false // Set by yySemanticError, failing the parse.
+	// yyreport reports the error msg at pos, if not negative, and records it.
+	yyreport := func(msg string, pos int) {
+		var e *%[1]sSyntaxError
+		if yyErrEx != nil || yyerrs != nil {
+			e = %[1]snewSyntaxError(%[11]s, %[1]sParseTab[yystate], yyS[:yyp+1], yystate, yychar, yylspan, msg)
+			if pos >= 0 {
+				e.Pos = pos
+			}
+		}
+		switch {
+		case yyErrEx != nil:
+			yyErrEx.ErrorEx(e)
+		default:
+			yylex.Error(msg)
+		}
+		if yyerrs != nil {
+			*yyerrs = append(*yyerrs, e)
+		}
+	}
+	yySemanticError := func(pos int, msg string) {
+		yysemantic = true
+		if yymaxErrors > 0 && Nerrs >= yymaxErrors {
+			msg, yyjump = "too many errors", 2
+		}
+		yyreport(msg, pos)
+		Nerrs++
+	}
+	_ = yySemanticError
+	yyspan := func(i int) %[1]sSpan { // In an action, the span of $i.
+		if i == 0 {
+			return yyvalspan
+		}
+
+		return yyspans[yyp+i]
+	}
+	_ = yyspan%[24]s%[45]s%[43]s
+	goto yystack
+
+ret0:
+	if yysemantic {
+		goto ret1
+	}%[26]s
+	return 0
+
+ret1:
+	if yyPart != nil && yyp >= 0 {
+		yyPart.Partial(yyS[:yyp+1])
+	}
+	if yyerrs != nil && len(*yyerrs) == 0 {
+		*yyerrs = append(*yyerrs, %[1]snewSyntaxError(%[11]s, %[1]sParseTab[yystate], yyS[:yyp+1], yystate, yychar, yylspan, "parse aborted"))
+	}%[26]s
+	return 1
+
+yystack:
+	/* put a state and value onto the stack */
+	if yymaxDepth > 0 && yyp+1 >= yymaxDepth {
+		yyreport("stack overflow", -1)
+		goto ret1
+	}
+	if yymaxSteps > 0 {
+		if yyops++; yyops > yymaxSteps {
+			yyreport("parse limit exceeded", -1)
+			goto ret1
+		}
+	}
+	yyp++
+	if yyp >= len(yyS) {
+		%[37]s
+	}
+	%[38]s
+	yyS[yyp].yys = %[6]s
+	if yySpanLex != nil {
+		yyspans = append(yyspans[:yyp], yyvalspan)
+	}
+
+yynewstate:
+%[27]s	if yychar < 0 && yypend >= 0 {
+		yychar, *yylval, yypend = yypend, yypendlval, -1
+		yylspan = yypendspan
+		yylval.yys = %[6]s
+		var ok bool
+		if yyxchar, ok = %[9]s; !ok {
+			yyxchar = len(%[1]sSymNames) // > tab width
+		}
+	}
+	if yychar < 0 {
+		yylval.yys = %[6]s
+%[46]s%[25]s%[21]s		yychar = %[1]slex1(yylex, yylval%[19]s)
+		if yySpanLex != nil {
+			yylspan.Start, yylspan.End = yySpanLex.Span()
+		}%[13]s
+		var ok bool
+		if yyxchar, ok = %[9]s; !ok {
+			yyxchar = len(%[1]sSymNames) // > tab width
+		}
+	}
+	if %[1]sDebug >= 4 {
+		var a []int
+		for _, v := range yyS[:yyp+1] {
+			a = append(a, %[7]s)
+		}
+		__yyfmt__.Fprintf(%[1]sDebugWriter, "state stack %%v\n", a)
+		__yyfmt__.Fprintf(%[1]sDebugWriter, "symbol stack [%%s]\n", %[1]sStackString(yyS[:yyp+1]))
+	}
+	row := %[1]sParseTab[yystate]
+	yyn = 0
+	if yyxchar < len(row) {
+		if yyn = int(row[yyxchar]); yyn != 0 {
+			yyn += %[1]sTabOfs
+		}
+	}
+	switch {
+	case yyn > 0: // shift
+%[28]s		yychar = -1
+		%[39]s
+		yyvalspan = yylspan
+		yystate = yyn
+		yyshift = yyn%[14]s
+		if %[1]sDebug >= 2 {
+			__yyfmt__.Fprintf(%[1]sDebugWriter, "shift, and goto state %%d\n", yystate)
+		}
+		if yyTr != nil {
+			yyTr.Shift(yystate, yyxchar, yyVAL)
+		}
+		if Errflag > 0 {
+			Errflag--
+		}
+		goto yystack
+	case yyn < 0: // reduce
+	case yystate == 1: // accept
+		if %[1]sDebug >= 2 {
+			__yyfmt__.Fprintln(%[1]sDebugWriter, "accept")
+		}
+%[30]s		if yyTr != nil {
+			yyTr.Accept(yystate, %[41]s)
+		}
+		if yyrcvr.result != nil {
+			*yyrcvr.result = %[42]s
+		}
+		goto ret0
+	}
+
+yyerrlab:
+	if yyn == 0 {
+		/* error ... attempt to resume parsing */
+		switch Errflag {
+		case 0: /* brand new error */
+			if %[1]sDebug >= 1 {
+				__yyfmt__.Fprintf(%[1]sDebugWriter, "no action for %%s in state %%d, stack [%%s]\n", %[1]sSymName(yychar), yystate, %[1]sStackString(yyS[:yyp+1]))
+			}
+%[31]s			if yymaxErrors > 0 && Nerrs >= yymaxErrors {
+				yyreport("too many errors", -1)
+				goto ret1
+			}
+
+			msg, ok := %[1]sXErrors[%[1]sXError{yystate, yyxchar}]
+			if !ok {
+				msg, ok = %[1]sXErrors[%[1]sXError{yystate, -1}]
+			}
+			if !ok && yyshift != 0 {
+				msg, ok = %[1]sXErrors[%[1]sXError{yyshift, yyxchar}]
+			}
+			if !ok {
+				msg, ok = %[1]sXErrors[%[1]sXError{yyshift, -1}]
+			}%[22]s
+			if yychar > 0 {
+				if ls := %[1]sSymName(yychar); ls != "" {
+					switch {
+					case msg == "":
+						msg = __yyfmt__.Sprintf("unexpected %%s", ls)
+					default:
+						msg = __yyfmt__.Sprintf("unexpected %%s, %%s", ls, msg)
+					}
+				}
+			}
+			if msg == "" {
+				msg = "syntax error"
+			}%[34]s
+			yyreport(msg, -1)
+			Nerrs++
+			if yyRec != nil {
+				yystates := make([]int, 0, yyp+1)
+				for _, v := range yyS[:yyp+1] {
+					yystates = append(yystates, %[7]s)
+				}
+				if tok, ok := yyRec.Recover(yystates, yychar, yylval); ok {
+					if tok <= 0 {
+						tok = %[1]sEofCode
+					}
+					if %[1]sDebug >= 2 {
+						__yyfmt__.Fprintf(%[1]sDebugWriter, "error recovery replaces %%s by %%s\n", %[1]sSymName(yychar), %[1]sSymName(tok))
+					}
+					yychar = tok
+					if yySpanLex != nil {
+						yylspan.Start, yylspan.End = yySpanLex.Span()
+					}
+					var ok bool
+					if yyxchar, ok = %[9]s; !ok {
+						yyxchar = len(%[1]sSymNames) // > tab width
+					}
+					Errflag = 3
+					goto yynewstate
+				}
+			}
+			fallthrough
+
+		case 1, 2: /* incompletely recovered error ... try again */
+			Errflag = 3
+
+			/* find a state where "error" is a legal shift action */
+			yytop := yyp // Restored for yyPart when the recovery fails.
+			for yyp >= 0 {
+				row := %[1]sParseTab[yyS[yyp].yys]
+				if yyError < len(row) {
+					yyn = int(row[yyError])+%[1]sTabOfs
+					if yyn > 0 { // hit
+						if %[1]sDebug >= 2 {
+							__yyfmt__.Fprintf(%[1]sDebugWriter, "error recovery found error shift in state %%d\n", yyS[yyp].yys)
+						}
+%[32]s						yystate = yyn /* simulate a shift of "error" */
+						yyvalspan = yylspan
+						if yyTr != nil {
+							yyTr.ErrorRecovery(yystate, yyxchar)
+						}
+						goto yystack
+					}
+				}
+
+				/* the current p has no shift on "error", pop stack */
+				if %[1]sDebug >= 2 {
+					__yyfmt__.Fprintf(%[1]sDebugWriter, "error recovery pops state %%d\n", yyS[yyp].yys)
+				}
+				yyp--
+			}
+			/* there is no state on the stack with an error shift ... abort */
+			if %[1]sDebug >= 2 {
+				__yyfmt__.Fprintf(%[1]sDebugWriter, "error recovery failed\n")
+			}
+			yyp = yytop
+			goto ret1
+
+		case 3: /* no shift yet; clobber input char */
+			if %[1]sDebug >= 2 {
+				__yyfmt__.Fprintf(%[1]sDebugWriter, "error recovery discards %%s\n", %[1]sSymName(yychar))
+			}
+%[33]s			if yychar == %[1]sEofCode {
+				goto ret1
+			}
+
+			yychar = -1
+			goto yynewstate /* try again in the same state */
+		}
+	}
+
+	r := -yyn
+	x0 := %[1]sReductions[r]
+	x, n := x0.xsym, x0.components
+	yypt := yyp
+	_ = yypt // guard against "declared and not used"
+
+	yyp -= n
+	if yyp+1 >= len(yyS) {
+		%[37]s
+	}
+	%[40]s
+	if yySpanLex != nil {
+		yyvalspan = %[1]sSpan{yyspans[yyp].End, yyspans[yyp].End}
+		if n != 0 {
+			yyvalspan = %[1]sSpan{yyspans[yyp+1].Start, yyspans[yypt].End}
+		}
+	}
+
+	/* consult goto table to find next state */
+	exState := yystate
+	yystate = int(%[1]sParseTab[yyS[yyp].yys][x])+%[1]sTabOfs
+	/* reduction by production r */
+	if %[1]sDebug >= 2 {
+		__yyfmt__.Fprintf(%[1]sDebugWriter, "reduce using rule %%v (%%s), and goto state %%d\n", r, %[1]sSymNames[x], yystate)
+	}
+%[44]s%[29]s%[35]s
+	switch r {%i
+`,
+		g.Prefix, errSym, g.Dlvalf, g.Dlval, makeYYS, toState, fromState, funcs, xlatChar, lexerDecl, lexer,
+		guardDecl, guardLex, guardShift, debugDecl, parseFunc, lex1Param, parseDecl, lex1Arg,
+		feedbackDecl, feedbackCall, errorDetail, checkpointDecl, checkpointResume, checkpointCall, saveStack, cancelCheck,
+		traceShift, traceReduce, traceAccept, traceError, traceRecover, traceDiscard, repairCheck,
+		actionEnter, valsDecl, growStack, pushVal, shiftVal, reduceVal, topPtr, topVal, entryStart, coverReduce,
+		pushResume, pushSuspend)
+	emitAction := actionEmitter(fset, p, valueType, lineFile)
+	var actions []int // Rules of the action functions.
+	var acted []int   // Rules having an action.
+	for r, rule := range p.Rules {
+		if rule.Action == nil {
+			continue
+		}
+
+		action := rule.Action.Values
+		if len(action) == 0 {
+			continue
+		}
+
+		if len(action) == 1 {
+			part := action[0]
+			if part.Type == parser.ActionValueGo {
+				src := part.Src
+				src = src[1 : len(src)-1] // Remove lead '{' and trail '}'
+				if strings.TrimSpace(src) == "" {
+					continue
+				}
+			}
+		}
+
+		acted = append(acted, r)
+		if g.ActionFuncs {
+			f.Format("case %d:\n%i%[2]sAction%[1]d(yylex, yyVAL, yyS, yypt)%u\n", r, g.Prefix)
+			actions = append(actions, r)
+			continue
+		}
+
+		f.Format("case %d: ", r)
+		emitAction(f, r)
+		f.Format("\n")
+	}
+	f.Format(`%u
+	}
+%[2]s
+	switch yyjump {
+	case 1:
+		if yyrcvr.result != nil {
+			*yyrcvr.result = *yyVAL
+		}
+		goto ret0
+	case 2:
+		goto ret1
+	case 3:
+		yyjump = 0
+		yystate = int(yyS[yyp].yys)
+		yyreport(yyjumpMsg, -1)
+		Nerrs++
+		yyn, Errflag = 0, 1 // Recover without reporting again.
+		goto yyerrlab
+	}
+
+	if yyTr != nil {
+		yyTr.Reduce(r, yystate, x, yyVAL)
+	}
+	if yyRL != nil {
+		yyRL(r, yyS[yyp+1:yypt+1], yyVAL)
+	}
+	if yyEx != nil && yyEx.Reduced(r, exState, yyVAL) {
+		if yyerrs != nil && len(*yyerrs) == 0 {
+			*yyerrs = append(*yyerrs, %[1]snewSyntaxError(%[3]s, %[1]sParseTab[yystate], yyS[:yyp+1], yystate, yychar, yylspan, "parse stopped by Reduced"))
+		}
+		return -1
+	}
+	goto yystack /* stack new state and value */
+}
+`, g.Prefix, actionLeave, lexer)
+	for _, r := range actions {
+		rule := p.Rules[r]
+		f.Format("\n// %sAction%d is the action of rule %[2]d, %s.\n", g.Prefix, r, ruleText(rule))
+		f.Format("func %[1]sAction%[2]d(yylex %[1]sLexer, yyVAL *%[1]sSymType, yyS []%[3]s, yypt int) {%i\n", g.Prefix, r, stackElem)
+		emitAction(f, r)
+		f.Format("%u\n}\n")
+	}
+	if g.ActionPanic {
+		posFile := inName
+		if posFile == "" {
+			posFile = filepath.ToSlash(in)
+		}
+		f.Format("\n// %sActionRules describes the rules having an action.\n", g.Prefix)
+		f.Format("var %sActionRules = map[int]struct{ text, pos string }{%i\n", g.Prefix)
+		for _, r := range acted {
+			var pos string
+			if line := actionLine(fset, p.Rules[r].Action.Values); line > 0 {
+				pos = fmt.Sprintf("%s:%d", posFile, line)
+			}
+			f.Format("%d: {%q, %q},\n", r, ruleText(p.Rules[r]), pos)
+		}
+		f.Format("%u}\n")
+	}
+	if pp.lex != nil {
+		f.Format("%s", g.lexerSource(pp.lex))
+	}
+	f.Format(`
+%[1]s
+`, p.Tail)
+	buf, ok := out.(*bytes.Buffer)
+	if ok && pure {
+		if err := g.checkPure(outName, buf.Bytes()); err != nil {
+			return err
+		}
+	}
+
+	if outPath == "" {
+		return nil
+	}
+
+	if ok && g.DebugTag != "" {
+		if err := g.writeDebugTag(outPath, buf.Bytes(), g.buildConstraint(pp), pure); err != nil {
+			return err
+		}
+	}
+
+	if ok && g.Bench {
+		if err := g.writeBench(outPath, buf.Bytes(), p, xerrors); err != nil {
+			return err
+		}
+	}
+
+	if ok && g.PoolBench {
+		return g.writePoolBench(outPath, buf.Bytes(), stackElem, newStack)
+	}
+
+	return nil
+}
+
+// packRows returns rows packed into data and the offsets of the rows in
+// data. If share is true, a row already present in data, or overlapping its
+// end, reuses it.
+func packRows(rows [][]int, share bool) (data, offs []int) {
+	offs = make([]int, len(rows))
+	order := make([]int, len(rows))
+	for i := range order {
+		order[i] = i
+	}
+	if !share {
+		for _, i := range order {
+			offs[i] = len(data)
+			data = append(data, rows[i]...)
+		}
+		return data, offs
+	}
+
+	// Longest rows first, so the shorter ones can be found in them.
+	sort.SliceStable(order, func(i, j int) bool { return len(rows[order[i]]) > len(rows[order[j]]) })
+	var b []byte // data, 4 bytes per value.
+	enc := func(a []int) []byte {
+		r := make([]byte, 4*len(a))
+		for i, v := range a {
+			binary.LittleEndian.PutUint32(r[4*i:], uint32(v))
+		}
+		return r
+	}
+	for _, i := range order {
+		row := enc(rows[i])
+		if j := alignedIndex(b, row); j >= 0 {
+			offs[i] = j / 4
+			continue
+		}
+
+		k := len(row) - 4
+		for ; k > 0 && !bytes.HasSuffix(b, row[:k]); k -= 4 {
+		}
+		offs[i] = (len(b) - k) / 4
+		b = append(b, row[k:]...)
+		data = append(data, rows[i][k/4:]...)
+	}
+	return data, offs
+}
+
+// alignedIndex returns the index of the first occurrence of sep in s at a
+// multiple of 4, or -1.
+func alignedIndex(s, sep []byte) int {
+	for i := 0; i <= len(s)-len(sep); {
+		j := bytes.Index(s[i:], sep)
+		if j < 0 {
+			return -1
+		}
+
+		if i += j; i%4 == 0 {
+			return i
+		}
+
+		i++
+	}
+	return -1
+}
+
+// xlatSegment is a range of token values, lo to hi, translated by the
+// entries of the dense yyXLAT starting at base.
+type xlatSegment struct {
+	lo, hi, base int
+}
+
+type xlatSegments []xlatSegment
+
+// segmentXLAT returns the segments of the sorted token values vals, a new
+// segment starting at a gap longer than 64 values, or nil if the segments are
+// too many or too sparse for a dense yyXLAT.
+func segmentXLAT(vals []int) xlatSegments {
+	var a xlatSegments
+	n := 0 // Entries.
+	for _, c := range vals {
+		if k := len(a); k != 0 && c-a[k-1].hi <= 64 {
+			n += c - a[k-1].hi
+			a[k-1].hi = c
+			continue
+		}
+
+		a = append(a, xlatSegment{c, c, n})
+		n++
+	}
+	if len(a) > 8 || n > 4*len(vals)+256 {
+		return nil
+	}
+
+	return a
+}
+
+// index returns the dense yyXLAT index of the token value c.
+func (a xlatSegments) index(c int) int {
+	for _, v := range a {
+		if c >= v.lo && c <= v.hi {
+			return c - v.lo + v.base
+		}
+	}
+	panic("internal error 006")
+}
+
+// ruleText returns the text of rule like in "a: b c".
+func ruleText(rule *y.Rule) string {
+	nm := rule.Sym.Name
+	if len(rule.Components) == 0 {
+		return nm + ":"
+	}
+
+	return nm + ": " + strings.Join(rule.Components, " ")
+}
+
+// lineReset is the line directive following an action. resetLines sets its
+// line number and file name to the parser output.
+const lineReset = "//line yyreset:1"
+
+// lineFileName returns the name of the grammar file in for the line directives
+// of the parser output out, relative to the directory of out if possible.
+func lineFileName(in, out string) string {
+	if a, err := filepath.Abs(in); err == nil {
+		if b, err := filepath.Abs(out); err == nil {
+			if rel, err := filepath.Rel(filepath.Dir(b), a); err == nil {
+				in = rel
+			}
+		}
+	}
+	return filepath.ToSlash(in)
+}
+
+// actionLine returns the grammar line of the first line of action or 0 if
+// unknown.
+func actionLine(fset *token.FileSet, action []*parser.ActionValue) int {
+	lines := 0
+	for _, v := range action {
+		if v.Pos.IsValid() {
+			return fset.Position(v.Pos).Line - lines
+		}
+
+		lines += strings.Count(v.Src, "\n")
+	}
+	return 0
+}
+
+// resetLines moves the line directives in src to the start of their lines,
+// where the compiler recognizes them, and replaces the lineReset directives
+// by directives pointing back to the parser output name.
+func resetLines(src []byte, name string) []byte {
+	a := bytes.Split(src, []byte("\n"))
+	for i, v := range a {
+		switch t := bytes.TrimLeft(v, " \t"); {
+		case string(t) == lineReset:
+			a[i] = []byte(fmt.Sprintf("//line %s:%d", name, i+2))
+		case bytes.HasPrefix(t, []byte("//line ")):
+			a[i] = t
+		}
+	}
+	return bytes.Join(a, []byte("\n"))
+}
+
+// actionEmitter returns a function writing the action of rule r to f. If
+// lineFile is not empty, the action is enclosed in line directives mapping it
+// to lineFile.
+func actionEmitter(fset *token.FileSet, p *y.Parser, valueType, lineFile string) func(f strutil.Formatter, r int) {
+	return func(f strutil.Formatter, r int) {
+		rule := p.Rules[r]
+		action := rule.Action.Values
+		if lineFile != "" {
+			if line := actionLine(fset, action); line > 0 {
+				f.Format("\n//line %s:%d\n", lineFile, line)
+				defer f.Format("\n%s", lineReset)
+			}
+		}
+		components := rule.Components
+		typ := rule.Sym.Type
+		max := len(components)
+		if p := rule.Parent; p != nil {
+			max = rule.MaxParentDlr
+			components = p.Components
+		}
+		for _, part := range action {
+			num := part.Num
+			switch part.Type {
+			case parser.ActionValueGo:
+				f.Format("%s", part.Src)
+			case parser.ActionValueDlrDlr:
+				if valueType != "" {
+					f.Format("yyVAL.value")
+					break
+				}
+
+				f.Format("yyVAL.%s", typ)
+				if typ == "" {
+					panic("internal error 002")
+				}
+			case parser.ActionValueDlrNum:
+				typ := p.Syms[components[num-1]].Type
+				if valueType != "" {
+					f.Format("yyS[yypt-%d].value%s", max-num, typeAssertion(typ, valueType))
+					break
+				}
+
+				if typ == "" {
+					panic("internal error 003")
+				}
+				f.Format("yyS[yypt-%d].%s", max-num, typ)
+			case parser.ActionValueDlrTagDlr:
+				if valueType != "" {
+					f.Format("yyVAL.value")
+					break
+				}
+
+				f.Format("yyVAL.%s", part.Tag)
+			case parser.ActionValueDlrTagNum:
+				if valueType != "" {
+					f.Format("yyS[yypt-%d].value%s", max-num, typeAssertion(part.Tag, valueType))
+					break
+				}
+
+				f.Format("yyS[yypt-%d].%s", max-num, part.Tag)
+			}
+		}
+	}
+}
+
+// outputNames returns the names of the parser output and the report file. The
+// -o and -v options take precedence over the %output and %file-prefix
+// directives. With %file-prefix "name" the defaults are name.go and
+// name.output, the report name for %output "name.go" is name.output.
+func (g *generator) outputNames(pp *preprocessed) (out, report string) {
+	out, report = g.Out, g.Report
+	var base string
+	if d := pp.settings["%file-prefix"]; d != nil {
+		base = d.val
+		if !g.Set["o"] {
+			out = base + ".go"
+		}
+	}
+	if d := pp.settings["%output"]; d != nil && !g.Set["o"] {
+		out = d.val
+		if base == "" {
+			base = strings.TrimSuffix(out, filepath.Ext(out))
+		}
+	}
+	if base != "" && !g.Set["v"] {
+		report = base + ".output"
+	}
+	if !g.Set["v"] {
+		report = strings.TrimSuffix(report, ".output") + reportExts[g.ReportFormat]
+	}
+	return out, report
+}
+
+// reportExts are the -report formats and the extensions of their default
+// report names.
+var reportExts = map[string]string{
+	"html":     ".html",
+	"json":     ".json",
+	"markdown": ".md",
+	"text":     ".output",
+}
+
+// stdoutName is the name of the parser output written to standard output by
+// -o -, in the line directives.
+const stdoutName = "<standard output>"
+
+// checkStdout returns an error if an option writing to standard output or
+// next to the parser output file is used with -o -.
+func (g *generator) checkStdout() error {
+	for _, v := range []struct {
+		set  bool
+		name string
+	}{
+		{g.Bench, "-bench"},
+		{g.Check, "-check"},
+		{g.Conflicts != "", "-conflicts"},
+		{g.DebugTag != "", "-debugtag"},
+		{g.GitAttributes, "-gitattributes"},
+		{g.OutDir != "", "-outdir"},
+		{g.PoolBench, "-poolbench"},
+	} {
+		if v.set {
+			return fmt.Errorf("%s cannot be used with -o -", v.name)
+		}
+	}
+	return nil
+}
+
+// printConflicts writes the numbers of conflicts of p, if any, to os.Stderr
+// and records them in conflicts.
+func (g *generator) printConflicts(p *y.Parser) {
+	g.conflicts = [2]int{p.ConflictsSR, p.ConflictsRR}
+	if n := p.ConflictsSR; n != 0 {
+		fmt.Fprintf(os.Stderr, "conflicts: %d shift/reduce\n", n)
+	}
+	if n := p.ConflictsRR; n != 0 {
+		fmt.Fprintf(os.Stderr, "conflicts: %d reduce/reduce\n", n)
+	}
+}
+
+// buildConstraint returns the expression of the //go:build line of the parser
+// output combining %build-tags and -tags, if any.
+func (g *generator) buildConstraint(pp *preprocessed) string {
+	var exprs []constraint.Expr
+	if d := pp.settings["%build-tags"]; d != nil {
+		x, _ := constraint.Parse("//go:build " + d.val)
+		exprs = append(exprs, x)
+	}
+	if s := g.Tags; s != "" {
+		x, _ := constraint.Parse("//go:build " + s)
+		exprs = append(exprs, x)
+	}
+	switch len(exprs) {
+	case 0:
+		return ""
+	case 1:
+		return exprs[0].String()
+	default:
+		return (&constraint.AndExpr{X: exprs[0], Y: exprs[1]}).String()
+	}
+}
+
+// setEOF applies -eof or %eof to p. It returns the name of the end of input
+// token constant.
+func (g *generator) setEOF(p *y.Parser, pp *preprocessed) (string, error) {
+	spec, what := g.EOF, "-eof"
+	if d := pp.settings["%eof"]; d != nil && spec == "" {
+		spec, what = d.val, fmt.Sprintf("%s: %%eof", d.pos)
+	}
+	if spec == "" {
+		return g.Prefix + "EofCode", nil
+	}
+
+	nm, v, err := eofSpec(spec)
+	if err != nil {
+		return "", fmt.Errorf("%s: %v", what, err)
+	}
+
+	if p.Syms[nm] != nil {
+		return "", fmt.Errorf("%s: %s is a grammar symbol", what, nm)
+	}
+
+	if v < 0 {
+		return nm, nil
+	}
+
+	for _, sym := range p.Syms {
+		if sym.Name != "$end" && sym.Value == v {
+			return "", fmt.Errorf("%s: value %d is the value of %s", what, v, sym.Name)
+		}
+	}
+	for _, r := range pp.ranges {
+		if rune(v) >= r.lo && rune(v) <= r.hi {
+			return "", fmt.Errorf("%s: value %d is in the range %s", what, v, r)
+		}
+	}
+	p.Syms["$end"].Value = v
+	return nm, nil
+}
+
+// generatedNames are the names, less the prefix, of the package level
+// identifiers declared by the generated code.
+var generatedNames = map[string]bool{
+	"ActionPanic": true, "ActionRules": true, "Checkpoint": true,
+	"Checkpointer": true, "CoverCounts": true, "Coverage": true,
+	"CoverRules": true, "Debug": true, "debugLevel": true,
+	"DebugWriter": true, "Default": true, "EofCode": true, "ErrCode": true,
+	"ExpectedNames": true, "ExpectedTokens": true, "Expects": true,
+	"Follow": true, "growStack": true, "insertion": true, "Keyword": true,
+	"Keywords": true, "lex1": true, "LexAccept": true, "Lexer": true,
+	"LexerErrorEx": true, "LexerEx": true, "LexerFeedback": true,
+	"LexerPos": true, "LexerSpan": true, "LexRange": true, "LexTrans": true,
+	"MaxDepth": true, "MaxErrors": true, "NewParser": true,
+	"NewScanner": true, "newSyntaxError": true, "Overlay": true,
+	"OverlayCell": true, "OverlayOn": true, "Overlays": true, "Parse": true,
+	"parse": true, "ParseContext": true, "ParseData": true,
+	"ParseErr": true, "ParseErrors": true, "Parser": true,
+	"ParseResult": true, "ParseTab": true, "Partialer": true, "Pool": true,
+	"Prec": true, "PushAccepted": true, "PushError": true,
+	"PushLexer": true, "PushMore": true, "PushParser": true,
+	"PushToken": true, "Recoverer": true, "ReduceListener": true,
+	"Reductions": true, "Resume": true, "Scanner": true, "shifts": true,
+	"Span": true, "StackString": true, "StateSyms": true, "SymName": true,
+	"SymNames": true, "SymType": true, "SyntaxError": true, "TabOfs": true,
+	"TokenInfo": true, "TokenLiteralStrings": true, "Tokens": true,
+	"TokenTable": true, "TraceEvent": true, "TraceJSON": true,
+	"traceJSON": true, "Tracer": true, "WriteCoverage": true,
+	"writeCoverage": true, "XError": true, "XErrors": true, "XLAT": true, "xlat": true, "XLATRanges": true, "XSymTokens": true,
+}
+
+// checkPrefix verifies that the token names, declared as constants by the
+// generated code, do not collide with the identifiers having the name
+// prefix of the generated code.
+func (g *generator) checkPrefix(fset *token.FileSet, p *y.Parser, pp *preprocessed) error {
+	ranges := map[string]bool{} // And the %entry tokens.
+	for _, v := range pp.ranges {
+		ranges[v.name] = true
+	}
+	for _, v := range pp.entries {
+		ranges[pp.prefix+"Entry_"+v] = true
+	}
+	var errs scanner.ErrorList
+	for nm, sym := range p.Syms {
+		if !sym.IsTerminal || ranges[nm] || !token.IsIdentifier(nm) {
+			continue
+		}
+
+		for _, pref := range []string{g.Prefix, g.exportedPrefix()} {
+			if !strings.HasPrefix(nm, pref) {
+				continue
+			}
+
+			if s := nm[len(pref):]; generatedNames[s] || strings.HasPrefix(s, "Range_") || strings.HasPrefix(s, "Entry_") || isActionName(s) {
+				errs.Add(fset.Position(sym.Pos), fmt.Sprintf("token %s collides with a name of the generated code having the prefix %s", nm, pref))
+				break
+			}
+		}
+	}
+	errs.Sort()
+	return errs.Err()
+}
+
+// isActionName reports whether s, less the prefix, is the name of a rule
+// action function, eg. Action42.
+func isActionName(s string) bool {
+	n := strings.TrimPrefix(s, "Action")
+	return n != s && n != "" && strings.Trim(n, "0123456789") == ""
+}
+
+// exportedPrefix returns the -p prefix with the first letter upper cased.
+func (g *generator) exportedPrefix() string {
+	s := g.Prefix
+	if s == "" {
+		return ""
+	}
+
+	return strings.ToUpper(s[:1]) + s[1:]
+}
+
+// typeAssertion returns the type assertion of a semantic value of type
+// valueType to typ, if any.
+func typeAssertion(typ, valueType string) string {
+	if typ == "" || typ == valueType {
+		return ""
+	}
+
+	return fmt.Sprintf(".(%s)", typ)
+}
+
+var (
+	// yysField matches the state field of the %union struct.
+	yysField = regexp.MustCompile(`(?m)^(\s*yys\s+)int\b`)
+
+	// intTypeMax is the maximum value supported by the types allowed in
+	// %define api.state.type. The size of int and uint is assumed to be 32
+	// bits.
+	intTypeMax = map[string]uint64{
+		"byte":   math.MaxUint8,
+		"int":    math.MaxInt32,
+		"int16":  math.MaxInt16,
+		"int32":  math.MaxInt32,
+		"int64":  math.MaxInt64,
+		"int8":   math.MaxInt8,
+		"uint":   math.MaxUint32,
+		"uint16": math.MaxUint16,
+		"uint32": math.MaxUint32,
+		"uint64": math.MaxUint64,
+		"uint8":  math.MaxUint8,
+	}
+)
+
+// freezeTokens checks the token values in toks against the token values
+// recorded in the file fn, if it exists. It is an error if a token changed
+// its value or if a value is used by another token than before. The new
+// tokens are then added to the file. Tokens no longer in the grammar are kept
+// in the file, so their values are not reused.
+func freezeTokens(fn string, toks map[string]int) error {
+	b, err := ioutil.ReadFile(fn)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	frozen := map[string]int{}
+	byValue := map[int]string{}
+	for i, line := range strings.Split(string(b), "\n") {
+		a := strings.Fields(line)
+		if len(a) == 0 || strings.HasPrefix(a[0], "#") {
+			continue
+		}
+
+		var v int
+		if len(a) == 2 {
+			v, err = strconv.Atoi(a[1])
+		}
+		if len(a) != 2 || err != nil {
+			return fmt.Errorf("%s:%d: expected token name and value", fn, i+1)
+		}
+
+		frozen[a[0]], byValue[v] = v, a[0]
+	}
+
+	var errs []string
+	var added []string
+	for nm, v := range toks {
+		if w, ok := frozen[nm]; ok {
+			if v != w {
+				errs = append(errs, fmt.Sprintf("%s: token %s renumbered from %d to %d, declare it as %s = %d to keep its value", fn, nm, w, v, nm, w))
+			}
+			continue
+		}
+
+		if w, ok := byValue[v]; ok {
+			errs = append(errs, fmt.Sprintf("%s: token %s uses the value %d of token %s", fn, nm, v, w))
+			continue
+		}
+
+		added = append(added, nm)
+	}
+	if len(errs) != 0 {
+		sort.Strings(errs)
+		return fmt.Errorf("%s", strings.Join(errs, "\n"))
+	}
+
+	if len(added) == 0 && b != nil {
+		return nil
+	}
+
+	for _, nm := range added {
+		frozen[nm] = toks[nm]
+	}
+	a := make([]string, 0, len(frozen))
+	for nm := range frozen {
+		a = append(a, nm)
+	}
+	sort.Slice(a, func(i, j int) bool { return frozen[a[i]] < frozen[a[j]] })
+	var buf bytes.Buffer
+	buf.WriteString("# Token values frozen by goyacc -freeze. Do not edit existing lines.\n")
+	for _, nm := range a {
+		fmt.Fprintf(&buf, "%s %d\n", nm, frozen[nm])
+	}
+	return ioutil.WriteFile(fn, buf.Bytes(), 0666)
+}
+
+// gitAttributes adds the generated file out to the .gitattributes file in its
+// directory, if not already present, marking it linguist-generated so code
+// review tools collapse it.
+func gitAttributes(out string) error {
+	fn := filepath.Join(filepath.Dir(out), ".gitattributes")
+	b, err := ioutil.ReadFile(fn)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	pat := "/" + filepath.Base(out)
+	for _, line := range strings.Split(string(b), "\n") {
+		if a := strings.Fields(line); len(a) != 0 && (a[0] == pat || a[0] == pat[1:]) {
+			return nil
+		}
+	}
+
+	if len(b) != 0 && !bytes.HasSuffix(b, []byte{'\n'}) {
+		b = append(b, '\n')
+	}
+	b = append(b, pat+" linguist-generated=true\n"...)
+	return ioutil.WriteFile(fn, b, 0666)
+}
+
+// setPackage returns src with the name of its package clause replaced by pkg
+// or, if src has no package clause, with the package clause added.
+func setPackage(src, pkg string) string {
+	fset := token.NewFileSet()
+	file := fset.AddFile("", -1, len(src))
+	var s scanner.Scanner
+	s.Init(file, []byte(src), nil, scanner.ScanComments)
+	for {
+		switch _, tok, _ := s.Scan(); tok {
+		case token.EOF:
+			return "package " + pkg + "\n" + src
+		case token.PACKAGE:
+			pos, _, lit := s.Scan()
+			ofs := file.Offset(pos)
+			return src[:ofs] + pkg + src[ofs+len(lit):]
+		}
+	}
+}
+
+// outDirPackage returns the package name implied by -outdir, if any.
+func (g *generator) outDirPackage() string {
+	dir := g.OutDir
+	if dir == "" {
+		return ""
+	}
+
+	if abs, err := filepath.Abs(dir); err == nil {
+		dir = abs
+	}
+	if nm := filepath.Base(dir); token.IsIdentifier(nm) {
+		return nm
+	}
+
+	return ""
+}
@@ -0,0 +1,1812 @@
+// Copyright 2014 The goyacc Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gen
+
+import (
+	"bytes"
+	"fmt"
+	"go/build/constraint"
+	"go/parser"
+	"go/scanner"
+	"go/token"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/cznic/y"
+)
+
+// Grammar source sections.
+const (
+	sectDefs = iota
+	sectRules
+)
+
+// gtok is a top level token of the grammar source. Directives are merged
+// into a single token.REM token with lit "%name", the section marks have lit
+// "%%". Prologue blocks (%{ ... %}) and brace enclosed blocks are returned as
+// a single token.LBRACE token with lit "%{" or "{" respectively.
+type gtok struct {
+	tok  token.Token
+	lit  string
+	off  int // Offset of the first byte.
+	end  int // Offset after the last byte.
+	sect int
+}
+
+// grammar is the result of scanning a grammar source.
+type grammar struct {
+	comments []gtok // Top level comments.
+	file     *token.File
+	src      []byte
+	tail     int // Offset of the second %%, if any, or len(src).
+	toks     []gtok
+}
+
+// scanGrammar tokenizes src using go/scanner. Everything after the second %%
+// is not tokenized.
+func scanGrammar(fset *token.FileSet, name string, src []byte) *grammar {
+	g := &grammar{file: fset.AddFile(name, -1, len(src)), src: src, tail: len(src)}
+	var s scanner.Scanner
+	s.Init(g.file, src, nil, scanner.ScanComments)
+	var la []gtok
+	next := func() gtok {
+		if n := len(la); n != 0 {
+			t := la[n-1]
+			la = la[:n-1]
+			return t
+		}
+
+		for {
+			pos, tok, lit := s.Scan()
+			if tok == token.SEMICOLON && lit == "\n" {
+				continue
+			}
+
+			if tok.IsKeyword() { // eg. %type
+				tok = token.IDENT
+			}
+			if lit == "" {
+				lit = tok.String()
+			}
+			off := g.file.Offset(pos)
+			return gtok{tok: tok, lit: lit, off: off, end: off + len(lit)}
+		}
+	}
+	peek := func() gtok {
+		t := next()
+		la = append(la, t)
+		return t
+	}
+	// block consumes tokens up to and including the token closing a block
+	// and returns the offset after it.
+	block := func(prologue bool) int {
+		depth := 1
+		var prev gtok
+		for {
+			t := next()
+			switch {
+			case t.tok == token.EOF:
+				return t.off
+			case prologue:
+				if t.tok == token.RBRACE && prev.tok == token.REM && prev.end == t.off {
+					return t.end
+				}
+			case t.tok == token.LBRACE:
+				depth++
+			case t.tok == token.RBRACE:
+				if depth--; depth == 0 {
+					return t.end
+				}
+			}
+			prev = t
+		}
+	}
+	sect := sectDefs
+	for {
+		t := next()
+		t.sect = sect
+		switch t.tok {
+		case token.EOF:
+			return g
+		case token.COMMENT:
+			g.comments = append(g.comments, t)
+			continue
+		case token.LBRACE:
+			t.end = block(false)
+		case token.REM:
+			switch u := peek(); {
+			case u.off != t.end:
+				// nop
+			case u.tok == token.REM:
+				next()
+				if sect == sectRules {
+					g.tail = t.off
+					return g
+				}
+
+				t.lit, t.end = "%%", u.end
+				sect = sectRules
+			case u.tok == token.LBRACE:
+				next()
+				t.tok, t.lit = token.LBRACE, "%{"
+				t.end = block(true)
+			case u.tok == token.IDENT:
+				next()
+				t.lit, t.end = "%"+u.lit, u.end
+				for {
+					v := next()
+					if v.tok != token.SUB || v.off != t.end {
+						la = append(la, v)
+						break
+					}
+
+					w := next()
+					if w.tok != token.IDENT || w.off != v.end {
+						la = append(la, w, v)
+						break
+					}
+
+					t.lit, t.end = t.lit+"-"+w.lit, w.end
+				}
+			}
+		}
+		g.toks = append(g.toks, t)
+	}
+}
+
+// directive returns the index of the first token after the directive at
+// index i, ie. the directive arguments are g.toks[i+1:directive(i)].
+func (g *grammar) directive(i int) int {
+	for i++; i < len(g.toks); i++ {
+		if t := g.toks[i]; t.tok == token.REM || t.lit == "%{" || t.sect != sectDefs {
+			break
+		}
+	}
+	return i
+}
+
+// line returns the line number of off.
+func (g *grammar) line(off int) int { return g.file.Line(g.file.Pos(off)) }
+
+// doc returns the comments immediately preceding the token t, if any.
+func (g *grammar) doc(t gtok) (r []string) {
+	i := sort.Search(len(g.comments), func(i int) bool { return g.comments[i].off >= t.off }) - 1
+	prev := 0 // End of the token preceding t.
+	if j := sort.Search(len(g.toks), func(i int) bool { return g.toks[i].off >= t.off }); j > 0 {
+		prev = g.toks[j-1].end
+	}
+	for line := g.line(t.off); i >= 0; i-- {
+		c := g.comments[i]
+		if c.off < prev || g.line(c.end-1) != line-1 || prev != 0 && g.line(prev-1) == g.line(c.off) {
+			break
+		}
+
+		r = append([]string{c.lit}, r...)
+		line = g.line(c.off)
+	}
+	return r
+}
+
+// comment returns the comment on the same line following the token at index
+// i and any non identifier tokens after it, if any.
+func (g *grammar) comment(i int) string {
+	t := g.toks[i]
+	j := sort.Search(len(g.comments), func(j int) bool { return g.comments[j].off >= t.end })
+	if j == len(g.comments) {
+		return ""
+	}
+
+	c := g.comments[j]
+	if g.line(c.off) != g.line(t.off) {
+		return ""
+	}
+
+	for i++; i < len(g.toks) && g.toks[i].off < c.off; i++ {
+		if g.toks[i].tok == token.IDENT || g.toks[i].tok == token.REM {
+			return ""
+		}
+	}
+	return c.lit
+}
+
+// define is the value of a %define directive.
+type define struct {
+	off int // Offset of the directive.
+	pos token.Position
+	tok token.Token // token.LBRACE for {value}, token.STRING for "value", token.ILLEGAL if there's no value.
+	val string      // Without the braces or quotes.
+}
+
+// tokenGroup lists the named terminals first declared by a %token, %left,
+// %right, %nonassoc or %precedence directive.
+type tokenGroup struct {
+	comments map[string]string // Name: comment following the name on the same line.
+	doc      []string          // Comments preceding the directive.
+	names    []string          // In declaration order.
+}
+
+// expectation is a %expect and/or %expect-rr declaration.
+type expectation struct {
+	pos    token.Position
+	rr, sr int    // Expected number of conflicts, -1 if not declared.
+	what   string // Annotated precedence declaration or rule, if any.
+}
+
+func newExpectation(pos token.Position, what string) *expectation {
+	return &expectation{pos: pos, rr: -1, sr: -1, what: what}
+}
+
+// srcRule is a rule alternative of the grammar source.
+type srcRule struct {
+	comps   []string // Components, mid-rule actions are "{}".
+	empty   bool     // Marked %empty.
+	expect  *expectation
+	lhs     string
+	pos     token.Position
+	prec    string // Terminal of the %prec annotation, if any.
+	precPos token.Position
+}
+
+// charRange is a terminal matching the characters lo through hi.
+type charRange struct {
+	lo, hi rune
+	name   string // Name of the synthesized token.
+	off    int    // Of the first occurrence.
+}
+
+func (c *charRange) String() string { return fmt.Sprintf("%q..%q", c.lo, c.hi) }
+
+// unionDecl is a %union declaration.
+type unionDecl struct {
+	doc []string // Comments preceding the declaration.
+	src string   // The struct body, including the braces, as written.
+}
+
+// preprocessed is the result of preprocess.
+type preprocessed struct {
+	define     map[string]*define        // %define name value
+	entries    []string                  // The %entry nonterminals, if any.
+	expect     *expectation              // Global %expect and/or %expect-rr, if any.
+	precExpect map[string]*expectation   // Terminal: %expect of its precedence declaration.
+	keywords   map[string]string         // Lower cased keyword: token name.
+	lex        []*lexRule                // The %lex rules, if any.
+	precPos    map[string]token.Position // Terminal: position in its precedence declaration.
+	prefix     string                    // Name prefix of the generated code.
+	ranges     []*charRange              // Sorted by lo.
+	settings   map[string]*define        // Directive, eg. "%output": its value.
+	rules      []*srcRule                // In source order.
+	src        []byte                    // The rewritten source.
+	tokens     []tokenGroup              // In declaration order.
+	union      *unionDecl                // The %union declaration, if any.
+	warnings   warnings
+}
+
+// directiveHandlers process the goyacc specific directives. The directive and
+// its arguments are removed from the grammar passed to package y.
+var directiveHandlers = map[string]func(r *rewriter, t gtok, args []gtok){
+	"%build-tags":     (*rewriter).buildTags,
+	"%checkpoint":     (*rewriter).toggle,
+	"%define":         (*rewriter).define,
+	"%eof":            (*rewriter).eof,
+	"%expect":         (*rewriter).expect,
+	"%expect-rr":      (*rewriter).expect,
+	"%file-prefix":    (*rewriter).setting,
+	"%lex":            (*rewriter).lexSpec,
+	"%lexer-feedback": (*rewriter).toggle,
+	"%output":         (*rewriter).setting,
+	"%package":        (*rewriter).pkg,
+	"%pure":           (*rewriter).toggle,
+	"%token-table":    (*rewriter).toggle,
+}
+
+// rewriter collects replacements of source ranges.
+type rewriter struct {
+	alias map[string]string // Unquoted alias: token name.
+	d     *preprocessed
+	errs  scanner.ErrorList
+	g     *grammar
+	last  int      // Index of the directive preceding the one being handled, -1 if none.
+	o     *Options // Of the generation.
+	repl  []gtok   // Replacement text in lit.
+}
+
+func (r *rewriter) position(off int) token.Position {
+	return r.g.file.Position(r.g.file.Pos(off))
+}
+
+func (r *rewriter) err(off int, msg string, args ...interface{}) {
+	r.errs.Add(r.position(off), fmt.Sprintf(msg, args...))
+}
+
+func (r *rewriter) warn(category string, off int, msg string, args ...interface{}) {
+	r.d.warnings.add(category, r.position(off), fmt.Sprintf(msg, args...))
+}
+
+func (r *rewriter) replace(off, end int, s string) {
+	r.repl = append(r.repl, gtok{lit: s, off: off, end: end})
+}
+
+// remove replaces a source range by white space, preserving line numbers.
+func (r *rewriter) remove(off, end int) {
+	r.replace(off, end, strings.Repeat("\n", bytes.Count(r.g.src[off:end], []byte{'\n'})))
+}
+
+// text returns the source text of toks.
+func (r *rewriter) text(toks []gtok) string {
+	if len(toks) == 0 {
+		return ""
+	}
+
+	return string(r.g.src[toks[0].off:toks[len(toks)-1].end])
+}
+
+// bytes returns the rewritten source. Replacements must not overlap.
+func (r *rewriter) bytes() []byte {
+	if len(r.repl) == 0 {
+		return r.g.src
+	}
+
+	sort.Slice(r.repl, func(i, j int) bool { return r.repl[i].off < r.repl[j].off })
+	var buf bytes.Buffer
+	off := 0
+	for _, v := range r.repl {
+		buf.Write(r.g.src[off:v.off])
+		buf.WriteString(v.lit)
+		off = v.end
+	}
+	buf.Write(r.g.src[off:])
+	return buf.Bytes()
+}
+
+// preprocess rewrites the goyacc extensions of the grammar in src to the
+// grammar accepted by package y. The rewriting preserves line numbers.
+func (g *generator) preprocess(fset *token.FileSet, name string, src []byte) (*preprocessed, error) {
+	return g.preprocessDefines(fset, name, src, g.Defines)
+}
+
+// preprocessDefines is like preprocess but evaluates the conditionals of src
+// using d instead of the -D options.
+func (g *generator) preprocessDefines(fset *token.FileSet, name string, src []byte, d Defines) (*preprocessed, error) {
+	src, errs := conditionals(name, src, d)
+	if len(errs) != 0 {
+		return nil, errs
+	}
+
+	r := &rewriter{g: scanGrammar(fset, name, src), o: &g.Options, d: &preprocessed{define: map[string]*define{}, keywords: map[string]string{}, settings: map[string]*define{}, precPos: map[string]token.Position{}, precExpect: map[string]*expectation{}}, alias: map[string]string{}, last: -1}
+	r.tokenValues()
+	r.caseless()
+	r.aliasMap()
+	r.directives()
+	r.prefix()
+	r.entries()
+	r.valueType()
+	r.union()
+	r.stateType()
+	r.parseError()
+	r.pushPull()
+	r.aliases()
+	r.ranges()
+	r.duplicates()
+	r.midRules()
+	r.alternatives()
+	r.tokenGroups()
+	r.types()
+	if len(r.errs) != 0 {
+		r.errs.Sort()
+		return nil, r.errs
+	}
+
+	r.d.src = r.bytes()
+	r.d.warnings.sort()
+	return r.d, nil
+}
+
+// directives processes and removes the directives having a handler.
+func (r *rewriter) directives() {
+	g := r.g
+	var toks []gtok
+	for i := 0; i < len(g.toks); i++ {
+		t := g.toks[i]
+		h := directiveHandlers[t.lit]
+		if t.tok != token.REM || t.sect != sectDefs || h == nil {
+			if t.tok == token.REM && t.sect == sectDefs {
+				r.last = i
+			}
+			toks = append(toks, t)
+			continue
+		}
+
+		n := g.directive(i)
+		args := g.toks[i+1 : n]
+		h(r, t, args)
+		r.last = i
+		end := t.end
+		if len(args) != 0 {
+			end = args[len(args)-1].end
+		}
+		r.remove(t.off, end)
+		i = n - 1
+	}
+	g.toks = toks
+}
+
+// define handles
+//
+//	%define name
+//	%define name value
+//	%define name "value"
+//	%define name {value}
+func (r *rewriter) define(t gtok, args []gtok) {
+	if len(args) == 0 || args[0].tok != token.IDENT {
+		r.err(t.off, "%%define: expected name")
+		return
+	}
+
+	// The name may contain dots and dashes, eg. api.value.type.
+	i := 1
+	for ; i < len(args); i++ {
+		if a := args[i]; a.off != args[i-1].end || a.tok != token.IDENT && a.tok != token.PERIOD && a.tok != token.SUB {
+			break
+		}
+	}
+	nm := r.text(args[:i])
+	if ex, ok := r.d.define[nm]; ok {
+		r.err(t.off, "%%define %s redefined, previous definition at %s", nm, r.position(ex.off))
+		return
+	}
+
+	d := &define{off: t.off, pos: r.position(t.off), tok: token.ILLEGAL}
+	switch v := args[i:]; {
+	case len(v) == 0:
+		// nop
+	case len(v) == 1 && v[0].tok == token.LBRACE:
+		d.tok, d.val = token.LBRACE, strings.TrimSpace(r.text(v)[1:len(r.text(v))-1])
+	case len(v) == 1 && v[0].tok == token.STRING:
+		s, err := strconv.Unquote(v[0].lit)
+		if err != nil {
+			r.err(v[0].off, "invalid string literal %s", v[0].lit)
+			return
+		}
+
+		d.tok, d.val = token.STRING, s
+	default:
+		d.tok, d.val = token.IDENT, r.text(v)
+	}
+	r.d.define[nm] = d
+}
+
+// setting handles directives having a single string argument, like
+//
+//	%output "parser.go"
+func (r *rewriter) setting(t gtok, args []gtok) {
+	if len(args) != 1 || args[0].tok != token.STRING {
+		r.err(t.off, "%s: expected string literal", t.lit)
+		return
+	}
+
+	if ex, ok := r.d.settings[t.lit]; ok {
+		r.err(t.off, "%s redeclared, previous declaration at %s", t.lit, ex.pos)
+		return
+	}
+
+	v, err := strconv.Unquote(args[0].lit)
+	if err != nil || v == "" {
+		r.err(args[0].off, "%s: invalid value %s", t.lit, args[0].lit)
+		return
+	}
+
+	r.d.settings[t.lit] = &define{off: t.off, pos: r.position(t.off), tok: token.STRING, val: v}
+}
+
+// buildTags handles
+//
+//	%build-tags "expr"
+//
+// which adds the build constraint //go:build expr to the parser output.
+func (r *rewriter) buildTags(t gtok, args []gtok) {
+	r.setting(t, args)
+	d := r.d.settings[t.lit]
+	if d == nil || d.off != t.off {
+		return
+	}
+
+	if _, err := constraint.Parse("//go:build " + d.val); err != nil {
+		r.err(args[0].off, "%s: %v", t.lit, err)
+	}
+}
+
+// toggle handles the directives without arguments
+//
+//	%checkpoint
+//	%lexer-feedback
+//	%pure
+//	%token-table
+//
+// %checkpoint adds saving and resuming the parser state.
+// %lexer-feedback passes the parser state to the lexer.
+// %pure selects the parser without package level mutable state, like -pure.
+// %token-table adds the token metadata table to the parser output.
+func (r *rewriter) toggle(t gtok, args []gtok) {
+	if len(args) != 0 {
+		r.err(args[0].off, "%s: unexpected %s", t.lit, args[0].lit)
+		return
+	}
+
+	if ex, ok := r.d.settings[t.lit]; ok {
+		r.err(t.off, "%s redeclared, previous declaration at %s", t.lit, ex.pos)
+		return
+	}
+
+	r.d.settings[t.lit] = &define{off: t.off, pos: r.position(t.off), tok: token.ILLEGAL}
+}
+
+// pkg handles
+//
+//	%package name
+//
+// which sets the package name of the parser output.
+func (r *rewriter) pkg(t gtok, args []gtok) {
+	if len(args) != 1 || args[0].tok != token.IDENT || args[0].lit == "_" {
+		r.err(t.off, "%s: expected package name", t.lit)
+		return
+	}
+
+	if ex, ok := r.d.settings[t.lit]; ok {
+		r.err(t.off, "%s redeclared, previous declaration at %s", t.lit, ex.pos)
+		return
+	}
+
+	r.d.settings[t.lit] = &define{off: t.off, pos: r.position(t.off), tok: token.IDENT, val: args[0].lit}
+}
+
+// eof handles
+//
+//	%eof NAME
+//	%eof NAME N
+//
+// which renames, and optionally renumbers, the end of input token.
+func (r *rewriter) eof(t gtok, args []gtok) {
+	if len(args) == 0 || len(args) > 2 || args[0].tok != token.IDENT || len(args) == 2 && args[1].tok != token.INT {
+		r.err(t.off, "%s: expected token name and optional value", t.lit)
+		return
+	}
+
+	if ex, ok := r.d.settings[t.lit]; ok {
+		r.err(t.off, "%s redeclared, previous declaration at %s", t.lit, ex.pos)
+		return
+	}
+
+	val := args[0].lit
+	if len(args) == 2 {
+		val += "=" + args[1].lit
+	}
+	if _, _, err := eofSpec(val); err != nil {
+		r.err(t.off, "%s: %v", t.lit, err)
+		return
+	}
+
+	r.d.settings[t.lit] = &define{off: t.off, pos: r.position(t.off), tok: token.IDENT, val: val}
+}
+
+// eofSpec parses name[=value] of %eof and -eof. The value is -1 if not
+// specified.
+func eofSpec(s string) (name string, value int, err error) {
+	name, value = s, -1
+	if i := strings.IndexByte(s, '='); i >= 0 {
+		n, err := strconv.ParseInt(s[i+1:], 0, 32)
+		if err != nil || n < 0 {
+			return "", 0, fmt.Errorf("invalid token value %q", s[i+1:])
+		}
+
+		name, value = s[:i], int(n)
+	}
+	if !token.IsIdentifier(name) || name == "_" {
+		return "", 0, fmt.Errorf("invalid token name %q", name)
+	}
+
+	return name, value, nil
+}
+
+// expect handles %expect N and %expect-rr N in the definitions section. On
+// the same line as, and following, a precedence declaration it applies to the
+// conflicts on the declared tokens, otherwise it is the global expectation.
+func (r *rewriter) expect(t gtok, args []gtok) {
+	if len(args) != 1 || args[0].tok != token.INT {
+		r.err(t.off, "%s: expected number", t.lit)
+		return
+	}
+
+	n, err := strconv.Atoi(args[0].lit)
+	if err != nil {
+		r.err(args[0].off, "%s: %v", t.lit, err)
+		return
+	}
+
+	g := r.g
+	var e *expectation
+	if i := r.last; i >= 0 && g.line(g.toks[i].off) == g.line(t.off) {
+		switch decl := g.toks[i]; decl.lit {
+		case "%left", "%right", "%nonassoc", "%precedence":
+			args := g.toks[i+1 : g.directive(i)]
+			var names []string
+			for j := 0; j < len(args); j++ {
+				switch a := args[j]; a.tok {
+				case token.LSS: // <tag>
+					for j < len(args) && args[j].tok != token.GTR {
+						j++
+					}
+				case token.IDENT, token.CHAR:
+					names = append(names, a.lit)
+				case token.STRING:
+					if s, err := strconv.Unquote(a.lit); err == nil && r.alias[s] != "" {
+						names = append(names, r.alias[s])
+					}
+				}
+			}
+			what := decl.lit + " " + r.text(args)
+			for _, nm := range names {
+				if e = r.d.precExpect[nm]; e != nil {
+					break
+				}
+			}
+			if e == nil {
+				e = newExpectation(r.position(decl.off), what)
+			}
+			for _, nm := range names {
+				r.d.precExpect[nm] = e
+			}
+		}
+	}
+	if e == nil {
+		if e = r.d.expect; e == nil {
+			e = newExpectation(r.position(t.off), "")
+			r.d.expect = e
+		}
+	}
+	r.setExpect(e, t, n)
+}
+
+func (r *rewriter) setExpect(e *expectation, t gtok, n int) {
+	p := &e.sr
+	if t.lit == "%expect-rr" {
+		p = &e.rr
+	}
+	if *p >= 0 {
+		r.err(t.off, "%s redeclared", t.lit)
+		return
+	}
+
+	*p = n
+}
+
+// valueType checks
+//
+//	%define api.value.type {T}
+//
+// which declares the semantic value to be of the single Go type T instead of
+// the %union struct. The default value union-directive is accepted.
+func (r *rewriter) valueType() {
+	d := r.d.define["api.value.type"]
+	if d == nil {
+		return
+	}
+
+	if d.tok != token.LBRACE {
+		if d.val != "union-directive" {
+			r.err(d.off, "%%define api.value.type: unsupported value %q, expected {type} or union-directive", d.val)
+		}
+		delete(r.d.define, "api.value.type")
+		return
+	}
+
+	if _, err := parser.ParseExpr(d.val); err != nil || d.val == "" {
+		r.err(d.off, "%%define api.value.type: invalid Go type %q", d.val)
+		return
+	}
+
+	for _, t := range r.g.toks {
+		if t.tok == token.REM && t.lit == "%union" {
+			r.err(t.off, "%%union cannot be used together with %%define api.value.type")
+		}
+	}
+}
+
+// tokenValues handles explicit token values written like in
+//
+//	%token NAME = 300
+//
+// by removing the equal sign.
+func (r *rewriter) tokenValues() {
+	g := r.g
+	var toks []gtok
+	for i, t := range g.toks {
+		if t.tok == token.ASSIGN && t.sect == sectDefs && i > 0 && i+1 < len(g.toks) && g.toks[i-1].tok == token.IDENT && g.toks[i+1].tok == token.INT {
+			r.remove(t.off, t.end)
+			continue
+		}
+
+		toks = append(toks, t)
+	}
+	g.toks = toks
+}
+
+// caseless handles %token-caseless, which declares tokens like %token and
+// records them as case-insensitive keywords, like in
+//
+//	%token-caseless SELECT FROM ORDER_BY "order by"
+//
+// The keyword is the token alias, if any, otherwise the token name. The
+// directive is rewritten to %token.
+func (r *rewriter) caseless() {
+	g := r.g
+	for i := 0; i < len(g.toks); i++ {
+		t := g.toks[i]
+		if t.tok != token.REM || t.sect != sectDefs || t.lit != "%token-caseless" {
+			continue
+		}
+
+		g.toks[i].lit = "%token"
+		r.replace(t.off, t.end, "%token")
+		n := g.directive(i)
+		for j := i + 1; j < n; j++ {
+			a := g.toks[j]
+			if a.tok == token.LSS { // <tag>
+				for j < n && g.toks[j].tok != token.GTR {
+					j++
+				}
+				continue
+			}
+
+			if a.tok != token.IDENT {
+				continue
+			}
+
+			kw := a.lit
+			k := j + 1
+			if k < n && g.toks[k].tok == token.INT {
+				k++
+			}
+			if k < n && g.toks[k].tok == token.STRING {
+				s, err := strconv.Unquote(g.toks[k].lit)
+				if err != nil {
+					r.err(g.toks[k].off, "invalid string literal %s", g.toks[k].lit)
+					continue
+				}
+
+				kw = s
+			}
+			kw = strings.ToLower(kw)
+			if ex, ok := r.d.keywords[kw]; ok && ex != a.lit {
+				r.err(a.off, "case-insensitive keyword %q already declared by %s", kw, ex)
+				continue
+			}
+
+			r.d.keywords[kw] = a.lit
+		}
+		i = n - 1
+	}
+}
+
+// aliasMap collects the string literal token aliases declared like in
+//
+//	%token PLUS "+"
+func (r *rewriter) aliasMap() {
+	g := r.g
+	m := r.alias
+	for i := 0; i < len(g.toks); i++ {
+		if t := g.toks[i]; t.tok != token.REM || t.lit != "%token" {
+			continue
+		}
+
+		n := g.directive(i)
+		for j := i + 1; j < n; j++ {
+			t := g.toks[j]
+			if t.tok != token.STRING {
+				continue
+			}
+
+			k := j - 1
+			if g.toks[k].tok == token.INT {
+				k--
+			}
+			if k <= i || g.toks[k].tok != token.IDENT {
+				continue
+			}
+
+			s, err := strconv.Unquote(t.lit)
+			if err != nil {
+				r.err(t.off, "invalid string literal %s", t.lit)
+				continue
+			}
+
+			nm := g.toks[k].lit
+			if ex, ok := m[s]; ok && ex != nm {
+				r.err(t.off, "string literal %s already declared as an alias of %s", t.lit, ex)
+				continue
+			}
+
+			m[s] = nm
+		}
+		i = n - 1
+	}
+}
+
+// aliases replaces uses of string literal token aliases, declared like in
+//
+//	%token PLUS "+"
+//
+// by the respective token name in precedence declarations and rule bodies.
+func (r *rewriter) aliases() {
+	m := r.alias
+	inToken := false
+	for _, t := range r.g.toks {
+		switch t.tok {
+		case token.REM:
+			inToken = t.lit == "%token"
+			if t.sect == sectRules {
+				inToken = false
+			}
+		case token.STRING:
+			if inToken {
+				break
+			}
+
+			s, err := strconv.Unquote(t.lit)
+			if err != nil {
+				r.err(t.off, "invalid string literal %s", t.lit)
+				break
+			}
+
+			nm, ok := m[s]
+			if !ok {
+				r.err(t.off, "undefined token alias %s", t.lit)
+				break
+			}
+
+			r.replace(t.off, t.end, nm)
+		}
+	}
+}
+
+// ranges replaces character ranges, like in
+//
+//	ident: 'a'..'z' | ident 'a'..'z'
+//
+// by the name of a synthesized terminal, one per distinct range. Ranges not
+// declared by a %token directive are declared before the first %%. Ranges must
+// not overlap each other or character literals of the grammar.
+func (r *rewriter) ranges() {
+	g := r.g
+	m := map[[2]rune]*charRange{}
+	declared := map[string]bool{}
+	var chars []gtok
+	var toks []gtok
+	var dir string // The directive of a defs section token.
+	for i := 0; i < len(g.toks); i++ {
+		t := g.toks[i]
+		if t.tok == token.REM && t.sect == sectDefs {
+			dir = t.lit
+		}
+		if t.tok != token.CHAR {
+			toks = append(toks, t)
+			continue
+		}
+
+		if i+3 >= len(g.toks) || g.toks[i+1].tok != token.PERIOD || g.toks[i+2].tok != token.PERIOD || g.toks[i+3].tok != token.CHAR ||
+			g.toks[i+1].off != t.end || g.toks[i+2].off != g.toks[i+1].end || g.toks[i+3].off != g.toks[i+2].end {
+			chars = append(chars, t)
+			toks = append(toks, t)
+			continue
+		}
+
+		u := g.toks[i+3]
+		lo, err := unquoteChar(t.lit)
+		if err != nil {
+			r.err(t.off, "invalid character literal %s", t.lit)
+		}
+		hi, err := unquoteChar(u.lit)
+		if err != nil {
+			r.err(u.off, "invalid character literal %s", u.lit)
+		}
+		if lo > hi {
+			r.err(t.off, "invalid character range %s..%s", t.lit, u.lit)
+		}
+		k := [2]rune{lo, hi}
+		c := m[k]
+		if c == nil {
+			c = &charRange{lo: lo, hi: hi, name: fmt.Sprintf("%sRange_%x_%x", r.d.prefix, lo, hi), off: t.off}
+			m[k] = c
+			r.d.ranges = append(r.d.ranges, c)
+		}
+		if t.sect == sectDefs && dir == "%token" {
+			declared[c.name] = true
+		}
+		r.replace(t.off, u.end, c.name)
+		toks = append(toks, gtok{tok: token.IDENT, lit: c.name, off: t.off, end: u.end, sect: t.sect})
+		i += 3
+	}
+	g.toks = toks
+	if len(r.d.ranges) == 0 {
+		return
+	}
+
+	a := r.d.ranges
+	sort.Slice(a, func(i, j int) bool { return a[i].lo < a[j].lo || a[i].lo == a[j].lo && a[i].hi < a[j].hi })
+	for i := 1; i < len(a); i++ {
+		if a[i].lo <= a[i-1].hi {
+			r.err(a[i].off, "character range %v overlaps %v", a[i], a[i-1])
+		}
+	}
+	for _, t := range chars {
+		c, err := unquoteChar(t.lit)
+		if err != nil {
+			continue
+		}
+
+		if i := sort.Search(len(a), func(i int) bool { return a[i].hi >= c }); i < len(a) && a[i].lo <= c {
+			r.err(t.off, "character literal %s is in the range %v", t.lit, a[i])
+		}
+	}
+	var names []string
+	for _, c := range a {
+		if !declared[c.name] {
+			names = append(names, c.name)
+		}
+	}
+	if len(names) == 0 {
+		return
+	}
+
+	for _, t := range g.toks {
+		if t.lit == "%%" {
+			r.replace(t.off, t.off, "%token "+strings.Join(names, " ")+" ")
+			return
+		}
+	}
+}
+
+func unquoteChar(lit string) (rune, error) {
+	s, err := strconv.Unquote(lit)
+	if err != nil {
+		return 0, err
+	}
+
+	a := []rune(s)
+	if len(a) != 1 {
+		return 0, fmt.Errorf("invalid character literal %s", lit)
+	}
+
+	return a[0], nil
+}
+
+// duplicates reports nonterminals having rules at more than one place in the
+// rules section. Package y merges the alternatives in the order of
+// appearance. With -nodups the duplicates are errors.
+func (r *rewriter) duplicates() {
+	g := r.g
+	m := map[string][]int{} // nonterminal -> offsets of its definitions
+	var a []string
+	for i, t := range g.toks {
+		if t.sect != sectRules || t.tok != token.IDENT || i+1 == len(g.toks) || g.toks[i+1].tok != token.COLON {
+			continue
+		}
+
+		if _, ok := m[t.lit]; !ok {
+			a = append(a, t.lit)
+		}
+		m[t.lit] = append(m[t.lit], t.off)
+	}
+	for _, nm := range a {
+		offs := m[nm]
+		if len(offs) < 2 {
+			continue
+		}
+
+		var sites []string
+		for _, off := range offs {
+			sites = append(sites, r.position(off).String())
+		}
+		msg := fmt.Sprintf("nonterminal %s defined %d times, alternatives merged in this order: %s", nm, len(offs), strings.Join(sites, ", "))
+		if r.o.NoDups {
+			r.err(offs[1], "%s", msg)
+			continue
+		}
+
+		r.warn("duplicate", offs[1], "%s", msg)
+	}
+}
+
+// tokenGroups collects the declarations of named terminals and the positions
+// of the terminals in precedence declarations.
+func (r *rewriter) tokenGroups() {
+	g := r.g
+	seen := map[string]bool{}
+	for i := 0; i < len(g.toks); i++ {
+		t := g.toks[i]
+		if t.tok != token.REM || t.sect != sectDefs {
+			continue
+		}
+
+		switch t.lit {
+		case "%token", "%left", "%right", "%nonassoc", "%precedence":
+			// ok
+		default:
+			continue
+		}
+
+		n := g.directive(i)
+		if t.lit != "%token" {
+			for j := i + 1; j < n; j++ {
+				switch a := g.toks[j]; a.tok {
+				case token.LSS: // <tag>
+					for j < n && g.toks[j].tok != token.GTR {
+						j++
+					}
+				case token.IDENT, token.CHAR, token.STRING:
+					nm := a.lit
+					if a.tok == token.STRING {
+						s, _ := strconv.Unquote(a.lit)
+						nm = r.alias[s]
+					}
+					if _, ok := r.d.precPos[nm]; !ok {
+						r.d.precPos[nm] = r.position(a.off)
+					}
+				}
+			}
+		}
+		grp := tokenGroup{comments: map[string]string{}, doc: g.doc(t)}
+		for j := i + 1; j < n; j++ {
+			a := g.toks[j]
+			if a.tok == token.LSS { // <tag>
+				for j < n && g.toks[j].tok != token.GTR {
+					j++
+				}
+				continue
+			}
+
+			if a.tok != token.IDENT || seen[a.lit] {
+				continue
+			}
+
+			seen[a.lit] = true
+			grp.names = append(grp.names, a.lit)
+			if c := g.comment(j); c != "" {
+				grp.comments[a.lit] = c
+			}
+		}
+		if len(grp.names) != 0 {
+			r.d.tokens = append(r.d.tokens, grp)
+		}
+		i = n - 1
+	}
+}
+
+// types warns about the symbols declared with different <tag> types by the
+// %token, %type and precedence directives.
+func (r *rewriter) types() {
+	g := r.g
+	type decl struct {
+		pos token.Position
+		typ string
+	}
+	m := map[string]decl{}
+	for i := 0; i < len(g.toks); i++ {
+		t := g.toks[i]
+		if t.tok != token.REM || t.sect != sectDefs {
+			continue
+		}
+
+		switch t.lit {
+		case "%token", "%type", "%left", "%right", "%nonassoc", "%precedence":
+			// ok
+		default:
+			continue
+		}
+
+		n := g.directive(i)
+		var typ string
+		for j := i + 1; j < n; j++ {
+			a := g.toks[j]
+			switch a.tok {
+			case token.LSS: // <tag>
+				k := j
+				for k < n && g.toks[k].tok != token.GTR {
+					k++
+				}
+				if k < n {
+					typ = strings.TrimSpace(string(g.src[a.end:g.toks[k].off]))
+				}
+				j = k
+				continue
+			case token.IDENT, token.CHAR, token.STRING:
+				// ok
+			default:
+				continue
+			}
+
+			nm := a.lit
+			if a.tok == token.STRING {
+				s, _ := strconv.Unquote(a.lit)
+				if nm = r.alias[s]; nm == "" {
+					continue
+				}
+			}
+			if typ == "" {
+				continue
+			}
+
+			switch d, ok := m[nm]; {
+			case !ok:
+				m[nm] = decl{r.position(a.off), typ}
+			case d.typ != typ:
+				r.warn("type", a.off, "conflicting types <%s> and <%s> of %s, first declared at %s", d.typ, typ, nm, d.pos)
+			}
+		}
+		i = n - 1
+	}
+}
+
+// union records the %union declaration, so the comments and struct tags of
+// its fields can be carried over to the generated yySymType.
+func (r *rewriter) union() {
+	g := r.g
+	for i, t := range g.toks {
+		if t.tok != token.REM || t.sect != sectDefs || t.lit != "%union" {
+			continue
+		}
+
+		if i+1 == len(g.toks) || g.toks[i+1].tok != token.LBRACE || g.toks[i+1].lit != "{" {
+			r.err(t.off, "%%union: expected struct body")
+			return
+		}
+
+		src := r.text(g.toks[i+1 : i+2])
+		if _, err := parser.ParseExpr("struct" + src); err != nil {
+			r.err(g.toks[i+1].off, "%%union: %v", err)
+			return
+		}
+
+		r.d.union = &unionDecl{doc: g.doc(t), src: src}
+		return
+	}
+}
+
+// prefix handles
+//
+//	%define api.prefix {name}
+//
+// which sets the name prefix of the generated code unless -p is given.
+func (r *rewriter) prefix() {
+	r.d.prefix = r.o.Prefix
+	d := r.d.define["api.prefix"]
+	if d == nil {
+		return
+	}
+
+	if d.tok != token.LBRACE && d.tok != token.IDENT || !validPrefix(d.val) {
+		r.err(d.off, "%%define api.prefix: invalid prefix %q", d.val)
+		return
+	}
+
+	if !r.o.Set["p"] {
+		r.d.prefix = d.val
+	}
+}
+
+// entries handles
+//
+//	%entry name...
+//
+// declaring the nonterminals a parse can start with. The directive is
+// rewritten to declare the token yyEntry_name for every name and the new
+// start symbol yyEntry derives the original start symbol or a yyEntry_name
+// token followed by name, which the parser injects before the input.
+func (r *rewriter) entries() {
+	g := r.g
+	var toks []gtok
+	var tokens []string
+	seen := map[string]bool{}
+	start, rules := -1, -1 // Index of the %start argument, index of %%.
+	for i := 0; i < len(g.toks); i++ {
+		t := g.toks[i]
+		switch {
+		case t.lit == "%%" && rules < 0:
+			rules = len(toks)
+		case t.tok == token.REM && t.sect == sectDefs && t.lit == "%start":
+			start = len(toks) + 1
+		}
+		if t.tok != token.REM || t.sect != sectDefs || t.lit != "%entry" {
+			toks = append(toks, t)
+			continue
+		}
+
+		n := g.directive(i)
+		args := g.toks[i+1 : n]
+		if len(args) == 0 {
+			r.err(t.off, "%%entry: expected nonterminal names")
+		}
+		var a []string
+		for _, v := range args {
+			switch {
+			case v.tok != token.IDENT || !token.IsIdentifier(v.lit):
+				r.err(v.off, "%%entry: invalid nonterminal name %s", v.lit)
+				continue
+			case seen[v.lit]:
+				r.err(v.off, "%%entry: %s redeclared", v.lit)
+				continue
+			}
+
+			seen[v.lit] = true
+			r.d.entries = append(r.d.entries, v.lit)
+			a = append(a, r.d.prefix+"Entry_"+v.lit)
+		}
+		tokens = append(tokens, a...)
+		end := t.end
+		if len(args) != 0 {
+			end = args[len(args)-1].end
+		}
+		r.replace(t.off, end, "%token "+strings.Join(a, " ")+strings.Repeat("\n", bytes.Count(g.src[t.off:end], []byte{'\n'})))
+		i = n - 1
+	}
+	g.toks = toks
+	if len(tokens) == 0 || rules < 0 {
+		return
+	}
+
+	nm := r.d.prefix + "Entry"
+	var orig string
+	switch {
+	case start >= 0 && start < len(toks) && toks[start].tok == token.IDENT:
+		orig = toks[start].lit
+		r.replace(toks[start].off, toks[start].end, nm)
+	case rules >= 0 && rules+1 < len(toks) && toks[rules+1].tok == token.IDENT:
+		orig = toks[rules+1].lit
+	default:
+		r.err(toks[rules].off, "%%entry: no start symbol")
+		return
+	}
+
+	// The actions copy the value of the derived symbol, which needs no type.
+	val := "yyS[yypt]"
+	if r.o.PtrStack {
+		val = "*" + val
+	}
+	rule := fmt.Sprintf(" %s: %s { *yyVAL = %s }", nm, orig, val)
+	for i, v := range r.d.entries {
+		rule += fmt.Sprintf(" | %s %s { *yyVAL = %s }", tokens[i], v, val)
+	}
+	r.replace(toks[rules].end, toks[rules].end, rule+" ;")
+}
+
+// validPrefix reports whether s is usable as the prefix of Go identifiers.
+func validPrefix(s string) bool {
+	return token.IsIdentifier(s + "0")
+}
+
+// stateType checks
+//
+//	%define api.state.type {T}
+//
+// which declares the integer type of the yys field of the parser stack
+// entries.
+func (r *rewriter) stateType() {
+	d := r.d.define["api.state.type"]
+	if d == nil {
+		return
+	}
+
+	if _, ok := intTypeMax[d.val]; !ok || d.tok != token.LBRACE && d.tok != token.IDENT {
+		r.err(d.off, "%%define api.state.type: unsupported type %q", d.val)
+	}
+}
+
+// parseError checks
+//
+//	%define parse.error simple
+//	%define parse.error detailed
+//
+// which selects the syntax error messages of the parser.
+func (r *rewriter) parseError() {
+	d := r.d.define["parse.error"]
+	if d == nil {
+		return
+	}
+
+	if d.val != "simple" && d.val != "detailed" || d.tok != token.LBRACE && d.tok != token.IDENT {
+		r.err(d.off, "%%define parse.error: unsupported value %q", d.val)
+	}
+}
+
+// pushPull checks
+//
+//	%define api.push-pull pull
+//	%define api.push-pull push
+//
+// where push adds the push parser API.
+func (r *rewriter) pushPull() {
+	d := r.d.define["api.push-pull"]
+	if d == nil {
+		return
+	}
+
+	if d.val != "pull" && d.val != "push" || d.tok != token.LBRACE && d.tok != token.IDENT {
+		r.err(d.off, "%%define api.push-pull: unsupported value %q", d.val)
+	}
+}
+
+// endOfAlternative reports whether the token at index i ends a rule
+// alternative.
+func (g *grammar) endOfAlternative(i int) bool {
+	if i >= len(g.toks) {
+		return true
+	}
+
+	switch t := g.toks[i]; t.tok {
+	case token.OR, token.SEMICOLON:
+		return true
+	case token.IDENT:
+		return i+1 < len(g.toks) && g.toks[i+1].tok == token.COLON
+	case token.REM:
+		return t.lit != "%prec"
+	}
+	return false
+}
+
+// midRules handles typed mid-rule actions
+//
+//	a: b <T>{ $$ = f($1) } c { use($2) }
+//
+// by removing the <T> and rewriting $$ in the mid-rule action to $<T>$ and
+// references to the mid-rule action value in the following actions of the
+// same alternative, like $2 above, to $<T>2.
+func (r *rewriter) midRules() {
+	g := r.g
+	var n int                // Components of the current alternative so far.
+	mids := map[int]string{} // Component number: type of the typed mid-rule action.
+	for i := 0; i < len(g.toks); i++ {
+		t := g.toks[i]
+		if t.sect != sectRules {
+			continue
+		}
+
+		switch t.tok {
+		case token.IDENT:
+			if i+1 < len(g.toks) && g.toks[i+1].tok == token.COLON {
+				n, mids = 0, map[int]string{}
+				i++
+				break
+			}
+
+			n++
+		case token.OR, token.SEMICOLON:
+			n, mids = 0, map[int]string{}
+		case token.CHAR, token.STRING:
+			n++
+		case token.REM:
+			if t.lit == "%prec" {
+				i++
+			}
+		case token.LBRACE:
+			r.dollars(t, "", mids)
+			n++
+		case token.LSS:
+			j := i + 1
+			for j < len(g.toks) && g.toks[j].tok != token.GTR {
+				j++
+			}
+			if j+1 >= len(g.toks) || g.toks[j+1].tok != token.LBRACE || j == i+1 {
+				r.err(t.off, "expected <type>{action}")
+				i = j
+				break
+			}
+
+			typ := r.text(g.toks[i+1 : j])
+			act := g.toks[j+1]
+			i = j + 1
+			if g.endOfAlternative(i + 1) {
+				r.err(t.off, "typed action <%s>{...} must be a mid-rule action", typ)
+				break
+			}
+
+			r.remove(t.off, g.toks[j].end)
+			r.dollars(act, typ, mids)
+			n++
+			mids[n] = typ
+		}
+	}
+}
+
+// dollars rewrites, in action t, $$ to $<typ>$ if typ is not empty and $N to
+// $<mids[N]>N for the typed mid-rule actions in mids.
+func (r *rewriter) dollars(t gtok, typ string, mids map[int]string) {
+	if typ == "" && len(mids) == 0 {
+		return
+	}
+
+	src := r.g.src[t.off:t.end]
+	file := token.NewFileSet().AddFile("", -1, len(src))
+	var s scanner.Scanner
+	s.Init(file, src, nil, 0)
+	var prev gtok
+	for {
+		pos, tok, lit := s.Scan()
+		if tok == token.EOF {
+			return
+		}
+
+		off := file.Offset(pos)
+		if prev.tok == token.ILLEGAL && prev.lit == "$" && prev.end == off {
+			switch {
+			case tok == token.ILLEGAL && lit == "$" && typ != "":
+				r.replace(t.off+prev.off, t.off+off+1, fmt.Sprintf("$<%s>$", typ))
+				tok = token.EOF // Not a $ starting another reference.
+			case tok == token.INT:
+				if n, err := strconv.Atoi(lit); err == nil && mids[n] != "" {
+					r.replace(t.off+prev.off, t.off+off+len(lit), fmt.Sprintf("$<%s>%s", mids[n], lit))
+				}
+			}
+		}
+		prev = gtok{tok: tok, lit: lit, off: off, end: off + len(lit)}
+	}
+}
+
+// Defines are the names defined by the -D or -overlay name[=value] options.
+// It implements flag.Value.
+type Defines map[string]string
+
+func (d Defines) String() string {
+	var a []string
+	for k, v := range d {
+		a = append(a, k+"="+v)
+	}
+	sort.Strings(a)
+	return strings.Join(a, " ")
+}
+
+func (d Defines) Set(s string) error {
+	nm, val := s, "1"
+	if i := strings.IndexByte(s, '='); i >= 0 {
+		nm, val = s[:i], s[i+1:]
+	}
+	if !token.IsIdentifier(nm) {
+		return fmt.Errorf("invalid name %q", nm)
+	}
+
+	d[nm] = val
+	return nil
+}
+
+// conditional is an open %if, %ifdef or %ifndef.
+type conditional struct {
+	line   int
+	active bool // The enclosing lines are included.
+	taken  bool // A branch was already included.
+	on     bool // The current branch is included.
+	dflt   bool // Seen %else.
+}
+
+// conditionals includes or excludes the lines of src enclosed in
+//
+//	%ifdef NAME
+//	%ifndef NAME
+//	%if NAME
+//	%if !NAME
+//	%if NAME == value
+//	%if NAME != value
+//	%elif ...
+//	%else
+//	%endif
+//
+// per the -D name[=value] options in d. A name without a value has the value
+// 1. %if NAME is true if NAME is defined and its value is not empty, 0 or
+// false. The directive lines and the excluded lines are replaced by empty
+// lines.
+func conditionals(name string, src []byte, d Defines) ([]byte, scanner.ErrorList) {
+	var errs scanner.ErrorList
+	err := func(line int, msg string, args ...interface{}) {
+		errs.Add(token.Position{Filename: name, Line: line, Column: 1}, fmt.Sprintf(msg, args...))
+	}
+	lines := bytes.SplitAfter(src, []byte{'\n'})
+	var stack []*conditional
+	on := func() bool { return len(stack) == 0 || stack[len(stack)-1].on }
+	changed := false
+	for i, b := range lines {
+		line := i + 1
+		dir, arg := conditionalDirective(b)
+		var top *conditional
+		if n := len(stack); n != 0 {
+			top = stack[n-1]
+		}
+		switch dir {
+		case "":
+			if !on() {
+				lines[i] = blankLine(b)
+				changed = true
+			}
+			continue
+		case "%ifdef", "%ifndef", "%if":
+			c := &conditional{line: line, active: on()}
+			v, e := d.eval(dir, arg)
+			if e != nil {
+				err(line, "%s: %v", dir, e)
+			}
+			c.on = c.active && v
+			c.taken = c.on
+			stack = append(stack, c)
+		case "%elif":
+			if top == nil || top.dflt {
+				err(line, "%%elif without %%if")
+				break
+			}
+
+			v, e := d.eval("%if", arg)
+			if e != nil {
+				err(line, "%s: %v", dir, e)
+			}
+			top.on = top.active && !top.taken && v
+			top.taken = top.taken || top.on
+		case "%else":
+			if top == nil || top.dflt {
+				err(line, "%%else without %%if")
+				break
+			}
+
+			top.dflt = true
+			top.on = top.active && !top.taken
+		case "%endif":
+			if top == nil {
+				err(line, "%%endif without %%if")
+				break
+			}
+
+			stack = stack[:len(stack)-1]
+		}
+		lines[i] = blankLine(b)
+		changed = true
+	}
+	for _, v := range stack {
+		err(v.line, "missing %%endif")
+	}
+	if !changed || len(errs) != 0 {
+		return src, errs
+	}
+
+	return bytes.Join(lines, nil), nil
+}
+
+// conditionalDirective returns the conditional directive and its argument if
+// b is a conditional directive line.
+func conditionalDirective(b []byte) (dir, arg string) {
+	s := strings.TrimSpace(string(b))
+	if !strings.HasPrefix(s, "%") {
+		return "", ""
+	}
+
+	i := 1
+	for i < len(s) && s[i] >= 'a' && s[i] <= 'z' {
+		i++
+	}
+	switch dir = s[:i]; dir {
+	case "%ifdef", "%ifndef", "%if", "%elif", "%else", "%endif":
+		return dir, strings.TrimSpace(s[i:])
+	}
+
+	return "", ""
+}
+
+// blankLine returns the line terminator of b, if any.
+func blankLine(b []byte) []byte {
+	if bytes.HasSuffix(b, []byte{'\n'}) {
+		return []byte{'\n'}
+	}
+
+	return nil
+}
+
+// eval evaluates the condition of a conditional directive.
+func (d Defines) eval(dir, arg string) (bool, error) {
+	src := []byte(arg)
+	file := token.NewFileSet().AddFile("", -1, len(src))
+	var s scanner.Scanner
+	var errs scanner.ErrorList
+	s.Init(file, src, func(pos token.Position, msg string) { errs.Add(pos, msg) }, 0)
+	var toks []token.Token
+	var lits []string
+	for {
+		_, tok, lit := s.Scan()
+		if tok == token.EOF || tok == token.SEMICOLON && lit == "\n" {
+			break
+		}
+
+		toks, lits = append(toks, tok), append(lits, lit)
+	}
+	if len(errs) != 0 {
+		return false, errs[0]
+	}
+
+	switch dir {
+	case "%ifdef", "%ifndef":
+		if len(toks) != 1 || toks[0] != token.IDENT {
+			return false, fmt.Errorf("expected name")
+		}
+
+		_, ok := d[lits[0]]
+		return ok == (dir == "%ifdef"), nil
+	}
+
+	switch {
+	case len(toks) == 1 && toks[0] == token.IDENT:
+		switch v, ok := d[lits[0]]; {
+		case !ok, v == "", v == "0", v == "false":
+			return false, nil
+		}
+
+		return true, nil
+	case len(toks) == 2 && toks[0] == token.NOT && toks[1] == token.IDENT:
+		v, err := d.eval(dir, lits[1])
+		return !v, err
+	case len(toks) == 3 && toks[0] == token.IDENT && (toks[1] == token.EQL || toks[1] == token.NEQ):
+		val := lits[2]
+		switch toks[2] {
+		case token.STRING:
+			var err error
+			if val, err = strconv.Unquote(val); err != nil {
+				return false, err
+			}
+		case token.IDENT, token.INT:
+			// ok
+		default:
+			return false, fmt.Errorf("expected value")
+		}
+
+		v, ok := d[lits[0]]
+		return (ok && v == val) == (toks[1] == token.EQL), nil
+	}
+
+	return false, fmt.Errorf("expected NAME, !NAME, NAME == value or NAME != value")
+}
+
+// alternatives collects the rule alternatives and handles the %expect N and
+// %expect-rr N annotations of rules.
+func (r *rewriter) alternatives() {
+	g := r.g
+	var lhs string
+	var cur *srcRule
+	start := func(off int) {
+		cur = &srcRule{lhs: lhs, pos: r.position(off)}
+		r.d.rules = append(r.d.rules, cur)
+	}
+	for i := 0; i < len(g.toks); i++ {
+		t := g.toks[i]
+		if t.sect != sectRules {
+			continue
+		}
+
+		if t.tok == token.IDENT && i+1 < len(g.toks) && g.toks[i+1].tok == token.COLON {
+			lhs = t.lit
+			start(t.off)
+			i++
+			continue
+		}
+
+		if cur == nil {
+			continue
+		}
+
+		switch t.tok {
+		case token.IDENT:
+			cur.comps = append(cur.comps, t.lit)
+		case token.OR:
+			start(t.off)
+		case token.SEMICOLON:
+			cur = nil
+		case token.CHAR:
+			cur.comps = append(cur.comps, t.lit)
+		case token.STRING:
+			if s, err := strconv.Unquote(t.lit); err == nil {
+				cur.comps = append(cur.comps, r.alias[s])
+			}
+		case token.LBRACE:
+			if !g.endOfAlternative(i + 1) {
+				cur.comps = append(cur.comps, "{}")
+			}
+		case token.REM:
+			switch t.lit {
+			case "%prec":
+				if i+1 == len(g.toks) {
+					break
+				}
+
+				i++
+				switch u := g.toks[i]; u.tok {
+				case token.IDENT, token.CHAR:
+					cur.prec = u.lit
+				case token.STRING:
+					if s, err := strconv.Unquote(u.lit); err == nil {
+						cur.prec = r.alias[s]
+					}
+				}
+				cur.precPos = r.position(t.off)
+			case "%empty":
+				cur.empty = true
+				r.remove(t.off, t.end)
+			case "%expect", "%expect-rr":
+				if i+1 == len(g.toks) || g.toks[i+1].tok != token.INT {
+					r.err(t.off, "%s: expected number", t.lit)
+					break
+				}
+
+				n, err := strconv.Atoi(g.toks[i+1].lit)
+				if err != nil {
+					r.err(t.off, "%s: %v", t.lit, err)
+					break
+				}
+
+				if cur.expect == nil {
+					cur.expect = newExpectation(cur.pos, "")
+				}
+				r.setExpect(cur.expect, t, n)
+				r.remove(t.off, g.toks[i+1].end)
+				i++
+			}
+		}
+	}
+	for _, v := range r.d.rules {
+		if v.expect != nil {
+			v.expect.what = "rule " + v.String()
+		}
+		switch {
+		case v.empty && len(v.comps) != 0:
+			r.errs.Add(v.pos, fmt.Sprintf("%%empty in the non-empty rule %s", v))
+		case !v.empty && len(v.comps) == 0:
+			r.d.warnings.add("empty-rule", v.pos, fmt.Sprintf("empty rule %s without %%empty", v))
+		}
+	}
+}
+
+func (r *srcRule) String() string {
+	if len(r.comps) == 0 {
+		return r.lhs + ":"
+	}
+
+	return r.lhs + ": " + strings.Join(r.comps, " ")
+}
+
+// matchRules returns the source rule alternatives of the rules of p, if
+// found. Rules are matched by their left hand side and components, in order.
+func matchRules(p *y.Parser, rules []*srcRule) map[int]*srcRule {
+	mid := map[*y.Symbol]bool{} // Synthesized symbols of mid-rule actions.
+	for _, rule := range p.Rules {
+		if rule.Parent != nil {
+			mid[rule.Sym] = true
+		}
+	}
+	byKey := map[string][]*srcRule{}
+	for _, v := range rules {
+		k := v.String()
+		byKey[k] = append(byKey[k], v)
+	}
+	m := map[int]*srcRule{}
+	for i, rule := range p.Rules {
+		if i == 0 || rule.Parent != nil {
+			continue
+		}
+
+		comps := make([]string, len(rule.Components))
+		for j, nm := range rule.Components {
+			comps[j] = nm
+			if mid[p.Syms[nm]] {
+				comps[j] = "{}"
+			}
+		}
+		k := (&srcRule{lhs: rule.Sym.Name, comps: comps}).String()
+		if a := byKey[k]; len(a) != 0 {
+			m[i] = a[0]
+			byKey[k] = a[1:]
+		}
+	}
+	return m
+}
@@ -0,0 +1,85 @@
+// Copyright 2014 The goyacc Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gen
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"text/template"
+	"unicode"
+)
+
+// generatedLine is the line marking a file as generated, see
+// https://golang.org/s/generatedcode.
+var generatedLine = regexp.MustCompile(`^// Code generated .* DO NOT EDIT\.$`)
+
+// headerData is the data of a -header template.
+type headerData struct {
+	Command string // The goyacc command line, like goyacc -o y.go y.y.
+	Grammar string // The grammar file name.
+	SHA256  string // The hexadecimal SHA-256 hash of the grammar source.
+}
+
+// header returns the comment heading the generated files of the grammar file
+// in with the source src, rendering -header, if set, each line prefixed by
+// //. It is an error if no line of the result is the generated code marker.
+func (g *generator) header(in string, src []byte) (string, error) {
+	text := g.Header
+	if text == "" {
+		return "// Code generated by goyacc. DO NOT EDIT.\n", nil
+	}
+
+	t, err := template.New("header").Parse(text)
+	if err != nil {
+		return "", fmt.Errorf("-header: %v", err)
+	}
+
+	var buf bytes.Buffer
+	if err := t.Execute(&buf, headerData{g.commandLine(), filepath.ToSlash(in), fmt.Sprintf("%x", sha256.Sum256(src))}); err != nil {
+		return "", fmt.Errorf("-header: %v", err)
+	}
+
+	var b strings.Builder
+	marked := false
+	for _, line := range strings.Split(strings.TrimRight(buf.String(), "\n"), "\n") {
+		line = strings.TrimRight("// "+line, " \t")
+		marked = marked || generatedLine.MatchString(line)
+		b.WriteString(line)
+		b.WriteByte('\n')
+	}
+	if !marked {
+		return "", fmt.Errorf("-header: no line matches \"Code generated .* DO NOT EDIT.\"")
+	}
+
+	return b.String(), nil
+}
+
+// commandLine returns Options.Command on one line, with the base name of the
+// command and the arguments quoted for the shell when necessary, or as Go
+// strings if they have control characters.
+func (g *generator) commandLine() string {
+	if len(g.Command) == 0 {
+		return "goyacc"
+	}
+
+	a := []string{filepath.Base(g.Command[0])}
+	for _, v := range g.Command[1:] {
+		switch {
+		case strings.IndexFunc(v, unicode.IsControl) >= 0: // Keep the command on one line.
+			v = strconv.Quote(v)
+		case v == "" || strings.IndexFunc(v, func(r rune) bool { return !strings.ContainsRune(shellSafe, r) }) >= 0:
+			v = "'" + strings.Replace(v, "'", `'\''`, -1) + "'"
+		}
+		a = append(a, v)
+	}
+	return strings.Join(a, " ")
+}
+
+const shellSafe = "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789%+,-./:=@_"
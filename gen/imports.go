@@ -0,0 +1,168 @@
+// Copyright 2014 The goyacc Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gen
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/scanner"
+	"go/token"
+	"path"
+	"strconv"
+)
+
+// generatedImports are the imports the generated code may use. The names
+// must not collide with the names declared by the grammar.
+var generatedImports = []struct{ name, path string }{
+	{"__sync__", "sync"},
+	{"__yyatomic__", "sync/atomic"},
+	{"__yycontext__", "context"},
+	{"__yyfmt__", "fmt"},
+	{"__yygzip__", "compress/gzip"},
+	{"__yyio__", "io"},
+	{"__yyioutil__", "io/ioutil"},
+	{"__yyjson__", "encoding/json"},
+	{"__yyos__", "os"},
+	{"__yystrings__", "strings"},
+	{"__yyutf8__", "unicode/utf8"},
+}
+
+// injectImport injects the imports of the generated code after the package
+// clause of src, into its first import declaration if that is a group. If src
+// has no package clause and pkg is not empty, the package clause "package
+// pkg" is added. If tokens is not empty, the package of that import path, the
+// -tokens package, is imported as __yytokens__. The imports already declared
+// by src are not repeated. The unused imports are removed from the parser
+// output by pruneImports.
+func injectImport(src, pkg, tokens string) string {
+	fset := token.NewFileSet()
+	file := fset.AddFile("", -1, len(src))
+	var s scanner.Scanner
+	s.Init(
+		file,
+		[]byte(src),
+		nil,
+		scanner.ScanComments,
+	)
+	ofs, group := -1, -1          // After the package clause, after the '(' of the first import group.
+	declared := map[string]bool{} // Imports of src, like "name path".
+	var name string
+	var inImport, inGroup bool
+	for done := false; !done; {
+		pos, tok, lit := s.Scan()
+		switch {
+		case tok == token.EOF:
+			done = true
+		case tok == token.COMMENT, tok == token.SEMICOLON:
+			// nop
+		case tok == token.PACKAGE:
+			s.Scan() // ident
+			pos, _, _ := s.Scan()
+			ofs = file.Offset(pos)
+		case tok == token.IMPORT:
+			inImport = true
+		case inImport && tok == token.LPAREN:
+			inGroup = true
+			if group < 0 {
+				group = file.Offset(pos) + 1
+			}
+		case inImport && tok == token.RPAREN:
+			inImport, inGroup = false, false
+		case inImport && tok == token.IDENT:
+			name = lit
+		case inImport && tok == token.PERIOD:
+			name = "."
+		case inImport && tok == token.STRING:
+			ip, _ := strconv.Unquote(lit)
+			if name == "" {
+				name = path.Base(ip)
+			}
+			declared[name+" "+ip] = true
+			name, inImport = "", inGroup
+		default:
+			done = true
+		}
+	}
+	var inj string
+	for _, v := range generatedImports {
+		if !declared[v.name+" "+v.path] {
+			inj += fmt.Sprintf("\t%s %q\n", v.name, v.path)
+		}
+	}
+	if tokens != "" && !declared["__yytokens__ "+tokens] {
+		inj += fmt.Sprintf("\t__yytokens__ %q\n", tokens)
+	}
+	switch {
+	case group >= 0:
+		src = src[:group] + "\n" + inj + src[group:]
+	case ofs >= 0:
+		src = src[:ofs] + "\n\nimport (\n" + inj + ")\n" + src[ofs:]
+	default:
+		src = "\nimport (\n" + inj + ")\n" + src
+	}
+	if ofs < 0 && pkg != "" {
+		src = "package " + pkg + "\n" + src
+	}
+	return src
+}
+
+// pruneImports removes the imports injected by injectImport and not used by
+// the parser output src. It returns src unchanged if it does not parse.
+func pruneImports(src []byte) []byte {
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "", src, 0)
+	if err != nil {
+		return src
+	}
+
+	used := map[string]bool{}
+	ast.Inspect(file, func(n ast.Node) bool {
+		if x, ok := n.(*ast.SelectorExpr); ok {
+			if id, ok := x.X.(*ast.Ident); ok {
+				used[id.Name] = true
+			}
+		}
+		return true
+	})
+	injected := map[string]bool{}
+	for _, v := range generatedImports {
+		injected[v.name] = true
+	}
+	injected["__yytokens__"] = true
+	var lines [][2]int // Offsets of the lines of the unused imports.
+	span := func(pos, end token.Pos) [2]int {
+		lo := fset.Position(pos).Offset
+		hi := fset.Position(end).Offset
+		lo = bytes.LastIndexByte(src[:lo], '\n') + 1
+		if n := bytes.IndexByte(src[hi:], '\n'); n >= 0 {
+			hi += n + 1
+		}
+		return [2]int{lo, hi}
+	}
+	for _, decl := range file.Decls {
+		d, ok := decl.(*ast.GenDecl)
+		if !ok || d.Tok != token.IMPORT {
+			continue
+		}
+
+		var unused [][2]int
+		for _, spec := range d.Specs {
+			if nm := spec.(*ast.ImportSpec).Name; nm != nil && injected[nm.Name] && !used[nm.Name] {
+				unused = append(unused, span(spec.Pos(), spec.End()))
+			}
+		}
+		if len(unused) != 0 && len(unused) == len(d.Specs) && d.Lparen.IsValid() {
+			unused = [][2]int{span(d.Pos(), d.End())} // Remove the empty group.
+		}
+		lines = append(lines, unused...)
+	}
+	for i := len(lines) - 1; i >= 0; i-- {
+		v := lines[i]
+		src = append(src[:v[0]:v[0]], src[v[1]:]...)
+	}
+	return src
+}
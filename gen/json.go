@@ -0,0 +1,228 @@
+// Copyright 2014 The goyacc Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gen
+
+import (
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/cznic/y"
+)
+
+// jsonTables is the -json document.
+type jsonTables struct {
+	Start     string         `json:"start"`
+	Symbols   []jsonSymbol   `json:"symbols"`
+	Rules     []jsonRule     `json:"rules"`
+	States    []jsonState    `json:"states"`
+	Conflicts []jsonConflict `json:"conflicts"`
+}
+
+type jsonSymbol struct {
+	Name     string `json:"name"`
+	Value    int    `json:"value"`
+	Terminal bool   `json:"terminal"`
+	Alias    string `json:"alias,omitempty"` // String alias of a token, like "number".
+	Type     string `json:"type,omitempty"`  // The %union field or the type.
+}
+
+type jsonRule struct {
+	Symbol     string   `json:"symbol"`
+	Components []string `json:"components"`
+}
+
+type jsonState struct {
+	Actions []jsonAction `json:"actions"`
+	Gotos   []jsonGoto   `json:"gotos"`
+}
+
+// jsonAction is the action of a state on a lookahead terminal, or on any
+// other terminal for $default.
+type jsonAction struct {
+	Symbol string `json:"symbol"`
+	Kind   string `json:"kind"`            // "shift", "reduce" or "accept".
+	State  int    `json:"state,omitempty"` // Shift target.
+	Rule   int    `json:"rule,omitempty"`  // Rule reduced.
+}
+
+type jsonGoto struct {
+	Symbol string `json:"symbol"`
+	State  int    `json:"state"`
+}
+
+type jsonConflict struct {
+	State      int    `json:"state"` // -1 if not in the table.
+	Lookahead  string `json:"lookahead"`
+	Shift      bool   `json:"shift"`
+	Reduces    []int  `json:"reduces"`
+	Resolution string `json:"resolution,omitempty"` // "shift", "reduce" or "error".
+	Rule       int    `json:"rule,omitempty"`       // Rule reduced by the resolution.
+	Precedence bool   `json:"precedence"`           // Resolved by precedence and/or associativity.
+
+	Derivations []jsonDerivation `json:"derivations,omitempty"` // In the report of -derivations.
+}
+
+// jsonDerivation is the derivation reaching an action of a conflict.
+type jsonDerivation struct {
+	Action string   `json:"action"` // Like shift E: E . '+' E.
+	Steps  []string `json:"steps"`  // The sentential forms derived from the start symbol, empty if not found.
+}
+
+// writeJSON writes the parse tables, symbols, rules and conflicts of p to
+// the file fn as a JSON document. The states and rules are indexed by their
+// numbers in the parse table and the report.
+func (g *generator) writeJSON(fn string, p *y.Parser) error {
+	a, err := g.analyze(p)
+	if err != nil {
+		return err
+	}
+
+	b, err := json.MarshalIndent(newJSONTables(a), "", "\t")
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(fn, append(b, '\n'), 0666)
+}
+
+// newJSONTables returns the -json document of the automaton a.
+func newJSONTables(a *automaton) *jsonTables {
+	p := a.p
+	doc := &jsonTables{Start: p.Start}
+	var syms []*y.Symbol
+	for nm, sym := range p.Syms {
+		switch nm {
+		case "", "ε", "#", "$default":
+			continue
+		}
+
+		syms = append(syms, sym)
+	}
+	sort.Slice(syms, func(i, j int) bool {
+		if a, b := syms[i].Value, syms[j].Value; a != b {
+			return a < b
+		}
+
+		return syms[i].Name < syms[j].Name
+	})
+	for _, sym := range syms {
+		alias, _ := strconv.Unquote(sym.LiteralString)
+		doc.Symbols = append(doc.Symbols, jsonSymbol{sym.Name, sym.Value, sym.IsTerminal, strings.TrimSpace(alias), sym.Type})
+	}
+	for _, rule := range p.Rules {
+		doc.Rules = append(doc.Rules, jsonRule{rule.Sym.Name, append([]string{}, rule.Components...)})
+	}
+	for _, state := range p.Table {
+		s := jsonState{Actions: []jsonAction{}, Gotos: []jsonGoto{}}
+		for _, act := range state {
+			kind, arg := act.Kind()
+			switch kind {
+			case 'a':
+				s.Actions = append(s.Actions, jsonAction{Symbol: act.Sym.Name, Kind: "accept"})
+			case 'g':
+				s.Gotos = append(s.Gotos, jsonGoto{act.Sym.Name, arg})
+			case 'r':
+				s.Actions = append(s.Actions, jsonAction{Symbol: act.Sym.Name, Kind: "reduce", Rule: arg})
+			case 's':
+				s.Actions = append(s.Actions, jsonAction{Symbol: act.Sym.Name, Kind: "shift", State: arg})
+			default:
+				panic("internal error 007")
+			}
+		}
+		doc.States = append(doc.States, s)
+	}
+	doc.Conflicts = []jsonConflict{}
+	for _, c := range a.conflicts {
+		v := jsonConflict{State: c.state.n, Lookahead: a.syms[c.sym].Name, Shift: c.shift, Reduces: c.reduces, Precedence: c.prec}
+		switch c.resolution {
+		case 'e':
+			v.Resolution = "error"
+		case 'r':
+			v.Resolution, v.Rule = "reduce", c.rule
+		case 's':
+			v.Resolution = "shift"
+		}
+		doc.Conflicts = append(doc.Conflicts, v)
+	}
+	return doc
+}
+
+// jsonReport is the grammar report of -report json, the -json document
+// having the items of the states.
+type jsonReport struct {
+	Fingerprint   string            `json:"fingerprint"`
+	GoyaccVersion string            `json:"goyaccVersion"`
+	Start         string            `json:"start"`
+	Symbols       []jsonSymbol      `json:"symbols"`
+	Rules         []jsonRule        `json:"rules"`
+	States        []jsonReportState `json:"states"`
+	Conflicts     []jsonConflict    `json:"conflicts"`
+}
+
+type jsonReportState struct {
+	State   int      `json:"state"`
+	Kernel  []string `json:"kernel"`            // The kernel items, like E: E . '+' NUM.
+	Closure []string `json:"closure,omitempty"` // The other items.
+	jsonState
+}
+
+// writeJSONReport writes the grammar report of p as a JSON document to w.
+// Only the states in keep and their conflicts are written, if not nil.
+func (g *generator) writeJSONReport(w io.Writer, p *y.Parser, keep map[int]bool, fp string) error {
+	a, err := g.analyze(p)
+	if err != nil {
+		return err
+	}
+
+	t := newJSONTables(a)
+	doc := &jsonReport{
+		Fingerprint:   fp,
+		GoyaccVersion: version(),
+		Start:         t.Start,
+		Symbols:       t.Symbols,
+		Rules:         t.Rules,
+		States:        []jsonReportState{},
+		Conflicts:     []jsonConflict{},
+	}
+	for _, s := range a.tableStates() {
+		if s == nil || keep != nil && !keep[s.n] {
+			continue
+		}
+
+		v := jsonReportState{State: s.n, Kernel: []string{}, jsonState: t.States[s.n]}
+		for i, it := range s.items {
+			switch {
+			case i < len(s.kernel):
+				v.Kernel = append(v.Kernel, a.ruleString(it.rule, it.dot))
+			default:
+				v.Closure = append(v.Closure, a.ruleString(it.rule, it.dot))
+			}
+		}
+		doc.States = append(doc.States, v)
+	}
+	for i, c := range t.Conflicts {
+		if keep != nil && !keep[c.State] {
+			continue
+		}
+
+		if g.Derivations {
+			for _, v := range a.conflictTraces(a.conflicts[i]) {
+				c.Derivations = append(c.Derivations, jsonDerivation{v.action, append([]string{}, v.steps...)})
+			}
+		}
+		doc.Conflicts = append(doc.Conflicts, c)
+	}
+	b, err := json.MarshalIndent(doc, "", "\t")
+	if err != nil {
+		return err
+	}
+
+	_, err = w.Write(append(b, '\n'))
+	return err
+}
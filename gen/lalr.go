@@ -0,0 +1,928 @@
+// Copyright 2014 The goyacc Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gen
+
+import (
+	"fmt"
+	"go/scanner"
+	"go/token"
+	"math/bits"
+	"sort"
+	"strings"
+
+	"github.com/cznic/y"
+)
+
+// symSet is a set of terminals, bit i represents automaton.syms[i].
+type symSet []uint64
+
+func (a *automaton) newSymSet() symSet { return make(symSet, (a.nterms+64)/64) }
+
+func (s symSet) add(i int) bool {
+	w, b := i/64, uint64(1)<<uint(i%64)
+	if s[w]&b != 0 {
+		return false
+	}
+
+	s[w] |= b
+	return true
+}
+
+func (s symSet) has(i int) bool { return s[i/64]&(uint64(1)<<uint(i%64)) != 0 }
+
+// union adds t to s and reports whether s changed.
+func (s symSet) union(t symSet) (changed bool) {
+	for i, v := range t {
+		if s[i]|v != s[i] {
+			s[i] |= v
+			changed = true
+		}
+	}
+	return changed
+}
+
+func (s symSet) clone() symSet { return append(symSet(nil), s...) }
+
+func (s symSet) members() (r []int) {
+	for i, v := range s {
+		for v != 0 {
+			b := bits.TrailingZeros64(v)
+			r = append(r, i*64+b)
+			v &^= 1 << uint(b)
+		}
+	}
+	return r
+}
+
+// item is an LR(0) item, ie. a rule number and the position of the dot in
+// its right hand side.
+type item struct {
+	rule, dot int
+}
+
+// lrState is a state of the LR(0) automaton.
+type lrState struct {
+	n      int    // State number in the parse table or -1 if not known.
+	kernel []item // Sorted.
+	items  []item // Kernel and closure items.
+	la     map[item]symSet
+	next   map[int]*lrState // Symbol index: target state.
+	syms   []int            // Symbols after the dot, in the order of items.
+}
+
+// conflict is a shift/reduce and/or reduce/reduce conflict in a state on a
+// lookahead terminal.
+type conflict struct {
+	state   *lrState
+	sym     int   // Lookahead terminal index.
+	shift   bool  // A shift is possible.
+	reduces []int // Rules, sorted.
+	// How the table resolved the conflict: 's' for shift, 'r' for reduce
+	// by rule, 'e' for an error action (%nonassoc) or 0 if the state is
+	// not in the table.
+	resolution int
+	rule       int  // Rule reduced if resolution is 'r'.
+	prec       bool // Resolved by precedence and/or associativity.
+}
+
+// kind returns the kind of c, shift/reduce, reduce/reduce or
+// shift/reduce/reduce.
+func (c *conflict) kind() string {
+	switch {
+	case c.shift && len(c.reduces) > 1:
+		return "shift/reduce/reduce"
+	case c.shift:
+		return "shift/reduce"
+	default:
+		return "reduce/reduce"
+	}
+}
+
+// automaton is the LALR(1) automaton reconstructed from the parse table and
+// rules produced by package y, for analyses package y does not provide.
+type automaton struct {
+	conflicts []*conflict
+	end       int               // Index of $end.
+	first     []symSet          // Nonterminal index - nterms: FIRST set.
+	index     map[*y.Symbol]int // Symbol: index.
+	nterms    int               // Number of terminals, indices [0, nterms).
+	nullable  []bool            // Nonterminal index - nterms: derives ε.
+	p         *y.Parser
+	rhs       [][]int // Rule: right hand side symbol indices.
+	rules     [][]int // Nonterminal index - nterms: rule numbers.
+	states    []*lrState
+	syms      []*y.Symbol
+	tokPrec   map[int]int // Terminal index: precedence level, 1 is the lowest.
+}
+
+// analysis is the automaton of the parser analyzed last by a generator, see
+// analyze.
+type analysis struct {
+	p   *y.Parser
+	a   *automaton
+	err error
+}
+
+// analyze returns the LALR(1) automaton of p, which must not be modified. The
+// automaton of the parser analyzed last is reused, the reports and checks of
+// a generation share it.
+func (g *generator) analyze(p *y.Parser) (*automaton, error) {
+	if g.analysis.p != p {
+		g.analysis.a, g.analysis.err = newAutomaton(p, g.prof)
+		g.analysis.p = p
+	}
+	return g.analysis.a, g.analysis.err
+}
+
+// newAutomaton returns the LALR(1) automaton of p, adding the time spent in
+// its phases to prof.
+func newAutomaton(p *y.Parser, prof *profile) (*automaton, error) {
+	defer prof.resume(prof.enter("analysis: symbols"))
+	a := &automaton{p: p, index: map[*y.Symbol]int{}, tokPrec: map[int]int{}}
+	var nms []string
+	for nm := range p.Syms {
+		nms = append(nms, nm)
+	}
+	sort.Strings(nms)
+	var nterms []*y.Symbol
+	for _, nm := range nms {
+		switch nm {
+		case "", "ε", "#", "$default":
+			continue
+		}
+
+		sym := p.Syms[nm]
+		if sym.IsTerminal {
+			a.syms = append(a.syms, sym)
+			continue
+		}
+
+		nterms = append(nterms, sym)
+	}
+	a.nterms = len(a.syms)
+	a.syms = append(a.syms, nterms...)
+	for i, sym := range a.syms {
+		a.index[sym] = i
+	}
+	end, ok := p.Syms["$end"]
+	if !ok {
+		return nil, fmt.Errorf("internal error: missing $end")
+	}
+
+	a.end = a.index[end]
+	a.rules = make([][]int, len(a.syms)-a.nterms)
+	for r, rule := range p.Rules {
+		lhs, ok := a.index[rule.Sym]
+		if !ok || lhs < a.nterms {
+			return nil, fmt.Errorf("internal error: invalid left hand side of rule %d", r)
+		}
+
+		a.rules[lhs-a.nterms] = append(a.rules[lhs-a.nterms], r)
+		var rhs []int
+		for _, nm := range rule.Components {
+			sym := p.Syms[nm]
+			i, ok := a.index[sym]
+			if sym == nil || !ok {
+				return nil, fmt.Errorf("internal error: rule %d: unknown symbol %s", r, nm)
+			}
+
+			rhs = append(rhs, i)
+		}
+		a.rhs = append(a.rhs, rhs)
+	}
+	for i, def := range p.AssocDefs {
+		for _, sym := range def.Syms {
+			if j, ok := a.index[sym]; ok && j < a.nterms {
+				a.tokPrec[j] = i + 1
+			}
+		}
+	}
+	prof.enter("analysis: FIRST sets")
+	a.firstSets()
+	prof.enter("analysis: LR(0) closures")
+	if err := a.lr0(); err != nil {
+		return nil, err
+	}
+
+	prof.enter("analysis: LALR(1) lookaheads")
+	a.lookaheads()
+	prof.enter("analysis: conflicts")
+	a.findConflicts()
+	return a, nil
+}
+
+func (a *automaton) isTerminal(i int) bool { return i < a.nterms }
+
+// firstSets computes the FIRST sets and nullability of nonterminals.
+func (a *automaton) firstSets() {
+	n := len(a.syms) - a.nterms
+	a.first = make([]symSet, n)
+	for i := range a.first {
+		a.first[i] = a.newSymSet()
+	}
+	a.nullable = make([]bool, n)
+	for changed := true; changed; {
+		changed = false
+		for r, rhs := range a.rhs {
+			lhs := a.index[a.p.Rules[r].Sym] - a.nterms
+			f := a.first[lhs]
+			nullable := true
+			for _, sym := range rhs {
+				if a.isTerminal(sym) {
+					if f.add(sym) {
+						changed = true
+					}
+					nullable = false
+					break
+				}
+
+				if f.union(a.first[sym-a.nterms]) {
+					changed = true
+				}
+				if !a.nullable[sym-a.nterms] {
+					nullable = false
+					break
+				}
+			}
+			if nullable && !a.nullable[lhs] {
+				a.nullable[lhs] = true
+				changed = true
+			}
+		}
+	}
+}
+
+// firstSeq adds FIRST(seq) to s and reports whether seq derives ε.
+func (a *automaton) firstSeq(s symSet, seq []int) (nullable bool) {
+	for _, sym := range seq {
+		if a.isTerminal(sym) {
+			s.add(sym)
+			return false
+		}
+
+		s.union(a.first[sym-a.nterms])
+		if !a.nullable[sym-a.nterms] {
+			return false
+		}
+	}
+	return true
+}
+
+// closure0 returns the LR(0) closure of kernel and the symbols after the dot
+// in order of appearance.
+func (a *automaton) closure0(kernel []item) (items []item, syms []int) {
+	items = append(items, kernel...)
+	added := map[int]bool{}
+	seen := map[int]bool{}
+	for i := 0; i < len(items); i++ {
+		it := items[i]
+		rhs := a.rhs[it.rule]
+		if it.dot == len(rhs) {
+			continue
+		}
+
+		sym := rhs[it.dot]
+		if !seen[sym] {
+			seen[sym] = true
+			syms = append(syms, sym)
+		}
+		if a.isTerminal(sym) || added[sym] {
+			continue
+		}
+
+		added[sym] = true
+		for _, r := range a.rules[sym-a.nterms] {
+			items = append(items, item{r, 0})
+		}
+	}
+	return items, syms
+}
+
+// advance returns the kernel of the state reached from s on sym.
+func (a *automaton) advance(s *lrState, sym int) (kernel []item) {
+	for _, it := range s.items {
+		if rhs := a.rhs[it.rule]; it.dot < len(rhs) && rhs[it.dot] == sym {
+			kernel = append(kernel, item{it.rule, it.dot + 1})
+		}
+	}
+	sort.Slice(kernel, func(i, j int) bool {
+		if kernel[i].rule != kernel[j].rule {
+			return kernel[i].rule < kernel[j].rule
+		}
+
+		return kernel[i].dot < kernel[j].dot
+	})
+	return kernel
+}
+
+func kernelKey(kernel []item) string {
+	var b strings.Builder
+	for _, it := range kernel {
+		fmt.Fprintf(&b, "%d.%d ", it.rule, it.dot)
+	}
+	return b.String()
+}
+
+// target returns the state number of the shift or goto action on sym in the
+// table row of state n, if any.
+func (a *automaton) target(n, sym int) int {
+	if n < 0 || n >= len(a.p.Table) {
+		return -1
+	}
+
+	for _, act := range a.p.Table[n] {
+		if act.Sym != a.syms[sym] {
+			continue
+		}
+
+		switch k, arg := act.Kind(); k {
+		case 's', 'g':
+			return arg
+		}
+	}
+	return -1
+}
+
+// lr0 reconstructs the LR(0) automaton and its state numbers. Shift actions
+// removed from the table by conflict resolution may leave states reachable
+// only by such shifts. Those are matched to the remaining table rows by their
+// actions or numbered -1 if that's not possible.
+func (a *automaton) lr0() error {
+	byKernel := map[string]*lrState{}
+	byNum := map[int]*lrState{}
+	var queue []*lrState
+	newState := func(n int, kernel []item) *lrState {
+		s := &lrState{n: n, kernel: kernel, next: map[int]*lrState{}}
+		s.items, s.syms = a.closure0(kernel)
+		byKernel[kernelKey(kernel)] = s
+		if n >= 0 {
+			byNum[n] = s
+		}
+		a.states = append(a.states, s)
+		queue = append(queue, s)
+		return s
+	}
+
+	newState(0, []item{{0, 0}})
+	for len(queue) != 0 {
+		for len(queue) != 0 {
+			s := queue[0]
+			queue = queue[1:]
+			for _, sym := range s.syms {
+				if sym == a.end {
+					continue
+				}
+
+				kernel := a.advance(s, sym)
+				key := kernelKey(kernel)
+				n := a.target(s.n, sym)
+				if n < 0 {
+					if t := byKernel[key]; t != nil {
+						s.next[sym] = t
+					}
+					continue
+				}
+
+				t := byNum[n]
+				switch {
+				case t == nil:
+					if u := byKernel[key]; u != nil && u.n < 0 {
+						u.n = n
+						byNum[n] = u
+						t = u
+						break
+					}
+
+					t = newState(n, kernel)
+				case kernelKey(t.kernel) != key:
+					return fmt.Errorf("internal error: inconsistent state %d", n)
+				}
+				s.next[sym] = t
+			}
+		}
+
+		// Transitions lost by conflict resolution.
+		for _, s := range a.states {
+			for _, sym := range s.syms {
+				if sym == a.end || s.next[sym] != nil {
+					continue
+				}
+
+				kernel := a.advance(s, sym)
+				t := byKernel[kernelKey(kernel)]
+				if t == nil {
+					t = newState(-1, kernel)
+					if n := a.matchRow(t, byNum); n >= 0 {
+						t.n = n
+						byNum[n] = t
+					}
+				}
+				s.next[sym] = t
+			}
+		}
+	}
+	return nil
+}
+
+// matchRow returns the number of the single table row not yet assigned to a
+// state that is compatible with s or -1 if there's no such row.
+func (a *automaton) matchRow(s *lrState, byNum map[int]*lrState) int {
+	r := -1
+	for n, row := range a.p.Table {
+		if byNum[n] != nil || !a.compatible(s, row) {
+			continue
+		}
+
+		if r >= 0 {
+			return -1
+		}
+
+		r = n
+	}
+	return r
+}
+
+// compatible reports whether the table row can be the row of s. Gotos must
+// match exactly, shifts may be removed by conflict resolution and reductions
+// must be by rules completed in s.
+func (a *automaton) compatible(s *lrState, row []y.Action) bool {
+	completed := map[int]bool{}
+	for _, it := range s.items {
+		if it.dot == len(a.rhs[it.rule]) {
+			completed[it.rule] = true
+		}
+	}
+	after := map[int]bool{}
+	for _, sym := range s.syms {
+		after[sym] = true
+	}
+	gotos := 0
+	for _, act := range row {
+		sym, ok := a.index[act.Sym]
+		switch k, arg := act.Kind(); k {
+		case 's':
+			if !ok || !after[sym] {
+				return false
+			}
+		case 'g':
+			if !ok || !after[sym] {
+				return false
+			}
+
+			gotos++
+		case 'r':
+			if !completed[arg] {
+				return false
+			}
+		}
+	}
+	for _, sym := range s.syms {
+		if !a.isTerminal(sym) {
+			gotos--
+		}
+	}
+	return gotos == 0
+}
+
+// closure1 returns the LR(1) closure of the items in la, which is updated in
+// place.
+func (a *automaton) closure1(la map[item]symSet, kernel []item) []item {
+	items := append([]item(nil), kernel...)
+	queue := append([]item(nil), kernel...)
+	for len(queue) != 0 {
+		it := queue[0]
+		queue = queue[1:]
+		rhs := a.rhs[it.rule]
+		if it.dot == len(rhs) || a.isTerminal(rhs[it.dot]) {
+			continue
+		}
+
+		f := a.newSymSet()
+		if a.firstSeq(f, rhs[it.dot+1:]) {
+			f.union(la[it])
+		}
+		for _, r := range a.rules[rhs[it.dot]-a.nterms] {
+			jt := item{r, 0}
+			s, ok := la[jt]
+			if !ok {
+				s = a.newSymSet()
+				la[jt] = s
+				items = append(items, jt)
+			}
+			if s.union(f) || !ok {
+				queue = append(queue, jt)
+			}
+		}
+	}
+	return items
+}
+
+// lookaheads computes the LALR(1) lookahead sets by propagation.
+func (a *automaton) lookaheads() {
+	type link struct {
+		s  *lrState
+		it item
+	}
+	hash := a.nterms // Index of the dummy lookahead '#'.
+	kla := map[*lrState]map[item]symSet{}
+	for _, s := range a.states {
+		m := map[item]symSet{}
+		for _, it := range s.kernel {
+			m[it] = a.newSymSet()
+		}
+		kla[s] = m
+	}
+	kla[a.states[0]][item{0, 0}].add(a.end)
+	props := map[link][]link{}
+	for _, s := range a.states {
+		for _, k := range s.kernel {
+			la := map[item]symSet{k: a.newSymSet()}
+			la[k].add(hash)
+			for _, it := range a.closure1(la, []item{k}) {
+				rhs := a.rhs[it.rule]
+				if it.dot == len(rhs) {
+					continue
+				}
+
+				t := s.next[rhs[it.dot]]
+				if t == nil { // $end
+					continue
+				}
+
+				jt := item{it.rule, it.dot + 1}
+				for _, sym := range la[it].members() {
+					if sym == hash {
+						from := link{s, k}
+						props[from] = append(props[from], link{t, jt})
+						continue
+					}
+
+					kla[t][jt].add(sym)
+				}
+			}
+		}
+	}
+	for changed := true; changed; {
+		changed = false
+		for from, to := range props {
+			for _, v := range to {
+				if kla[v.s][v.it].union(kla[from.s][from.it]) {
+					changed = true
+				}
+			}
+		}
+	}
+	for _, s := range a.states {
+		s.la = kla[s]
+		s.items = a.closure1(s.la, s.kernel)
+	}
+}
+
+// rulePrec returns the precedence level of rule r, 0 if it has none.
+func (a *automaton) rulePrec(r int) int {
+	if sym := a.p.Rules[r].ExplicitPrecSym; sym != nil {
+		return a.tokPrec[a.index[sym]]
+	}
+
+	rhs := a.rhs[r]
+	for i := len(rhs) - 1; i >= 0; i-- {
+		if a.isTerminal(rhs[i]) {
+			return a.tokPrec[rhs[i]]
+		}
+	}
+	return 0
+}
+
+// findConflicts collects the conflicts of all states.
+func (a *automaton) findConflicts() {
+	for _, s := range a.states {
+		reduces := map[int][]int{} // Lookahead: rules.
+		for _, it := range s.items {
+			if it.rule == 0 || it.dot != len(a.rhs[it.rule]) {
+				continue
+			}
+
+			for _, sym := range s.la[it].members() {
+				if sym < a.nterms {
+					reduces[sym] = append(reduces[sym], it.rule)
+				}
+			}
+		}
+		var syms []int
+		for sym, rules := range reduces {
+			if len(rules) > 1 || s.next[sym] != nil {
+				syms = append(syms, sym)
+			}
+		}
+		sort.Ints(syms)
+		for _, sym := range syms {
+			c := &conflict{state: s, sym: sym, shift: s.next[sym] != nil, reduces: reduces[sym]}
+			sort.Ints(c.reduces)
+			if c.shift {
+				c.prec = a.tokPrec[sym] != 0 && a.rulePrec(c.reduces[0]) != 0
+			}
+			c.resolution, c.rule = a.resolution(s.n, sym)
+			a.conflicts = append(a.conflicts, c)
+		}
+	}
+}
+
+// resolution returns the action of the table in state n on sym.
+func (a *automaton) resolution(n, sym int) (kind, rule int) {
+	if n < 0 {
+		return 0, 0
+	}
+
+	dflt := -1
+	for _, act := range a.p.Table[n] {
+		k, arg := act.Kind()
+		switch {
+		case act.Sym == a.syms[sym]:
+			return k, arg
+		case act.Sym.Name == "$default" && k == 'r':
+			dflt = arg
+		}
+	}
+	if dflt >= 0 {
+		return 'r', dflt
+	}
+
+	return 'e', 0
+}
+
+// conflictCounts returns the number of shift/reduce conflicts and
+// reduce/reduce conflicts in cs not resolved by precedence.
+func conflictCounts(cs []*conflict) (sr, rr int) {
+	for _, c := range cs {
+		if c.shift && !c.prec {
+			sr++
+		}
+		if len(c.reduces) > 1 {
+			rr++
+		}
+	}
+	return sr, rr
+}
+
+// ruleString returns the text of rule r with a dot at dot, if dot >= 0.
+func (a *automaton) ruleString(r, dot int) string {
+	var b strings.Builder
+	b.WriteString(a.p.Rules[r].Sym.Name)
+	b.WriteString(":")
+	for i, sym := range a.rhs[r] {
+		if i == dot {
+			b.WriteString(" .")
+		}
+		b.WriteString(" ")
+		b.WriteString(a.syms[sym].Name)
+	}
+	if dot == len(a.rhs[r]) {
+		b.WriteString(" .")
+	}
+	return b.String()
+}
+
+// stateName returns the state number of s as a string or "?" if the state
+// is not in the table.
+func stateName(s *lrState) string {
+	if s.n < 0 {
+		return "?"
+	}
+
+	return fmt.Sprint(s.n)
+}
+
+// checkExpect verifies the conflicts of p against the %expect and
+// %expect-rr declarations of the grammar. A conflict counts against the
+// annotation of the first annotated rule it reduces, otherwise against the
+// precedence declaration of its lookahead token, otherwise against the global
+// declaration. When any annotation exists, or if strict, the conflicts not
+// covered by one must match the global declaration, which defaults to zero.
+func (g *generator) checkExpect(fn string, p *y.Parser, pp *preprocessed, strict bool) error {
+	rules := matchRules(p, pp.rules)
+	var annotated bool
+	for _, v := range rules {
+		if v.expect != nil {
+			annotated = true
+			break
+		}
+	}
+	if !strict && !annotated && len(pp.precExpect) == 0 && pp.expect == nil {
+		return nil
+	}
+
+	a, err := g.analyze(p)
+	if err != nil {
+		return err
+	}
+
+	global := pp.expect
+	if global == nil {
+		global = newExpectation(token.Position{Filename: fn}, "")
+	}
+	sr, rr := map[*expectation]int{}, map[*expectation]int{}
+	for _, c := range a.conflicts {
+		e := global
+		for _, r := range c.reduces {
+			if v := rules[r]; v != nil && v.expect != nil {
+				e = v.expect
+				break
+			}
+		}
+		if e == global {
+			if v := pp.precExpect[a.syms[c.sym].Name]; v != nil {
+				e = v
+			}
+		}
+		if c.shift && !c.prec {
+			sr[e]++
+		}
+		if len(c.reduces) > 1 {
+			rr[e]++
+		}
+	}
+
+	es := []*expectation{global}
+	for _, v := range pp.rules {
+		if v.expect != nil {
+			es = append(es, v.expect)
+		}
+	}
+	seen := map[*expectation]bool{}
+	for _, v := range pp.precExpect {
+		if !seen[v] {
+			seen[v] = true
+			es = append(es, v)
+		}
+	}
+	var errs scanner.ErrorList
+	for _, e := range es {
+		what := e.what
+		if what == "" {
+			what = "the grammar"
+		}
+		for _, v := range []struct {
+			kind      string
+			want, got int
+		}{
+			{"shift/reduce", e.sr, sr[e]},
+			{"reduce/reduce", e.rr, rr[e]},
+		} {
+			want := v.want
+			if want < 0 {
+				want = 0
+			}
+			if v.got != want {
+				errs.Add(e.pos, fmt.Sprintf("%s: expected %d %s conflicts, found %d", what, want, v.kind, v.got))
+			}
+		}
+	}
+	errs.Sort()
+	return errs.Err()
+}
+
+// uselessPrec returns warnings about the precedence declarations of terminals
+// and the %prec annotations of rules never used to resolve a conflict.
+func (g *generator) uselessPrec(p *y.Parser, pp *preprocessed) (scanner.ErrorList, error) {
+	if len(p.AssocDefs) == 0 || !g.warningEnabled("precedence") {
+		return nil, nil
+	}
+
+	a, err := g.analyze(p)
+	if err != nil {
+		return nil, err
+	}
+
+	usedRule := map[int]bool{}
+	usedTok := map[string]bool{}
+	for _, c := range a.conflicts {
+		if !c.prec {
+			continue
+		}
+
+		usedTok[a.syms[c.sym].Name] = true
+		for _, r := range c.reduces {
+			usedRule[r] = true
+		}
+	}
+	for r := range usedRule {
+		if sym := p.Rules[r].ExplicitPrecSym; sym != nil {
+			usedTok[sym.Name] = true
+			continue
+		}
+
+		rhs := a.rhs[r]
+		for i := len(rhs) - 1; i >= 0; i-- {
+			if a.isTerminal(rhs[i]) {
+				usedTok[a.syms[rhs[i]].Name] = true
+				break
+			}
+		}
+	}
+
+	var w scanner.ErrorList
+	for _, v := range p.AssocDefs {
+		for _, sym := range v.Syms {
+			if sym.IsTerminal && !usedTok[sym.Name] {
+				w.Add(pp.precPos[sym.Name], fmt.Sprintf("useless precedence of %s", sym.Name))
+			}
+		}
+	}
+	for r, v := range matchRules(p, pp.rules) {
+		if v.prec != "" && !usedRule[r] {
+			w.Add(v.precPos, fmt.Sprintf("useless %%prec %s in rule %s", v.prec, v))
+		}
+	}
+	w.Sort()
+	return w, nil
+}
+
+// uselessRules returns warnings about the nonterminals and rules not deriving
+// a sentence of the grammar from its start symbol and the tokens used by no
+// rule.
+func (g *generator) uselessRules(fset *token.FileSet, p *y.Parser, pp *preprocessed) warnings {
+	mid := map[string]bool{}  // Synthesized symbols of mid-rule actions.
+	used := map[string]bool{} // Components of any rule.
+	for _, rule := range p.Rules {
+		if rule.Parent != nil {
+			mid[rule.Sym.Name] = true
+		}
+		for _, nm := range rule.Components {
+			used[nm] = true
+		}
+		if sym := rule.ExplicitPrecSym; sym != nil {
+			used[sym.Name] = true
+		}
+	}
+	productive := map[string]bool{}
+	isProductive := func(rule *y.Rule) bool {
+		for _, nm := range rule.Components {
+			if sym := p.Syms[nm]; sym == nil || !sym.IsTerminal && !productive[nm] {
+				return false
+			}
+		}
+		return true
+	}
+	for changed := true; changed; {
+		changed = false
+		for _, rule := range p.Rules {
+			if nm := rule.Sym.Name; !productive[nm] && isProductive(rule) {
+				productive[nm], changed = true, true
+			}
+		}
+	}
+	reachable := map[string]bool{p.Start: true}
+	for changed := true; changed; {
+		changed = false
+		for _, rule := range p.Rules {
+			if !reachable[rule.Sym.Name] || !isProductive(rule) {
+				continue
+			}
+
+			for _, nm := range rule.Components {
+				if !reachable[nm] {
+					reachable[nm], changed = true, true
+				}
+			}
+		}
+	}
+
+	pos := map[string]token.Position{} // Nonterminal: its first definition.
+	for _, v := range pp.rules {
+		if _, ok := pos[v.lhs]; !ok {
+			pos[v.lhs] = v.pos
+		}
+	}
+	var nms []string
+	for nm := range p.Syms {
+		nms = append(nms, nm)
+	}
+	sort.Strings(nms)
+	ranges := map[string]bool{}
+	for _, v := range pp.ranges {
+		ranges[v.name] = true
+	}
+	var w warnings
+	for _, nm := range nms {
+		sym := p.Syms[nm]
+		switch {
+		case nm == "" || nm[0] == '$' || nm[0] == '\'' || mid[nm] || nm == "error" || ranges[nm]:
+			// nop
+		case sym.IsTerminal:
+			if !used[nm] {
+				w.add("unused", fset.Position(sym.Pos), fmt.Sprintf("token %s used by no rule", nm))
+			}
+		case !productive[nm] || !reachable[nm]:
+			w.add("useless", pos[nm], fmt.Sprintf("nonterminal %s useless in grammar", nm))
+		}
+	}
+	for r, v := range matchRules(p, pp.rules) {
+		if rule := p.Rules[r]; productive[rule.Sym.Name] && reachable[rule.Sym.Name] && !isProductive(rule) {
+			w.add("useless", v.pos, fmt.Sprintf("rule %s useless in grammar", v))
+		}
+	}
+	w.sort()
+	return w
+}
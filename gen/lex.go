@@ -0,0 +1,466 @@
+// Copyright 2014 The goyacc Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gen
+
+import (
+	"bytes"
+	"fmt"
+	"go/scanner"
+	"go/token"
+	"regexp/syntax"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/cznic/y"
+)
+
+// lexRule is a token pattern of the %lex section.
+type lexRule struct {
+	action  string // Go code in braces, if any.
+	name    string // Token name or character literal, "_" to skip the match.
+	pattern string
+	pos     token.Position
+	prog    *syntax.Prog
+}
+
+// lexSpec handles the %lex section
+//
+//	%lex {
+//		NUM	`[0-9]+`	{ lval.n, _ = strconv.Atoi(text) }
+//		'+'	`\+`
+//		_	`[ \t\n]+`
+//	}
+//
+// Each line declares a token name, a character literal or _ for a match to
+// skip, a Go string literal with the regular expression of the token and an
+// optional action.
+func (r *rewriter) lexSpec(t gtok, args []gtok) {
+	if len(args) != 1 || args[0].tok != token.LBRACE || args[0].lit != "{" {
+		r.err(t.off, "%%lex: expected { rules }")
+		return
+	}
+
+	if r.d.lex != nil {
+		r.err(t.off, "%%lex redeclared")
+		return
+	}
+
+	r.d.lex = []*lexRule{}
+	block := args[0]
+	body := string(r.g.src[block.off+1 : block.end-1])
+	off := block.off + 1
+	for _, line := range strings.SplitAfter(body, "\n") {
+		if rule := r.lexRule(off, line); rule != nil {
+			r.d.lex = append(r.d.lex, rule)
+		}
+		off += len(line)
+	}
+	if len(r.d.lex) == 0 {
+		r.err(t.off, "%%lex: no rules")
+	}
+}
+
+// lexRule parses the line of the %lex section at offset off.
+func (r *rewriter) lexRule(off int, line string) *lexRule {
+	fset := token.NewFileSet()
+	file := fset.AddFile("", -1, len(line))
+	var s scanner.Scanner
+	var errs scanner.ErrorList
+	s.Init(file, []byte(line), func(pos token.Position, msg string) { errs.Add(pos, msg) }, scanner.ScanComments)
+	var toks []gtok
+	for {
+		pos, tok, lit := s.Scan()
+		if tok == token.EOF {
+			break
+		}
+
+		if tok == token.COMMENT || tok == token.SEMICOLON && lit == "\n" {
+			continue
+		}
+
+		if lit == "" {
+			lit = tok.String()
+		}
+		toks = append(toks, gtok{tok: tok, lit: lit, off: file.Offset(pos), end: file.Offset(pos) + len(lit)})
+	}
+	if len(toks) == 0 {
+		return nil
+	}
+
+	if len(errs) != 0 {
+		r.err(off+errs[0].Pos.Offset, "%%lex: %s", errs[0].Msg)
+		return nil
+	}
+
+	rule := &lexRule{pos: r.position(off + toks[0].off)}
+	if len(toks) < 2 || toks[0].tok != token.IDENT && toks[0].tok != token.CHAR || toks[1].tok != token.STRING {
+		r.err(off+toks[0].off, "%%lex: expected token name, pattern and optional action")
+		return nil
+	}
+
+	rule.name = toks[0].lit
+	pattern, err := strconv.Unquote(toks[1].lit)
+	if err != nil {
+		r.err(off+toks[1].off, "%%lex: invalid string literal %s", toks[1].lit)
+		return nil
+	}
+
+	rule.pattern = pattern
+	if rest := toks[2:]; len(rest) != 0 {
+		last := rest[len(rest)-1]
+		if rest[0].tok != token.LBRACE || last.tok != token.RBRACE {
+			r.err(off+rest[0].off, "%%lex: expected action in braces")
+			return nil
+		}
+
+		if rule.name == "_" {
+			r.err(off+rest[0].off, "%%lex: skipped matches cannot have an action")
+			return nil
+		}
+
+		rule.action = line[rest[0].off:last.end]
+	}
+	re, err := syntax.Parse(pattern, syntax.Perl)
+	if err != nil {
+		r.err(off+toks[1].off, "%%lex: %v", err)
+		return nil
+	}
+
+	prog, err := syntax.Compile(re.Simplify())
+	if err != nil {
+		r.err(off+toks[1].off, "%%lex: %v", err)
+		return nil
+	}
+
+	for _, inst := range prog.Inst {
+		if inst.Op == syntax.InstEmptyWidth {
+			r.err(off+toks[1].off, "%%lex: anchors and word boundaries are not supported: %s", pattern)
+			return nil
+		}
+	}
+	rule.prog = prog
+	return rule
+}
+
+// nfaState is an instruction of the program of a lexRule.
+type nfaState struct {
+	rule, pc int
+}
+
+// dfaRange is a transition on the runes lo through hi.
+type dfaRange struct {
+	lo, hi rune
+	next   int
+}
+
+// dfaState is a state of the lexer DFA.
+type dfaState struct {
+	accept int // Rule matched, -1 if none.
+	trans  []dfaRange
+}
+
+// lexDFA returns the DFA recognizing the longest match of rules. Of rules
+// matching the same text, the first one wins.
+func lexDFA(rules []*lexRule) []*dfaState {
+	closure := func(set []nfaState) []nfaState {
+		seen := map[nfaState]bool{}
+		var r []nfaState
+		var add func(s nfaState)
+		add = func(s nfaState) {
+			if seen[s] {
+				return
+			}
+
+			seen[s] = true
+			switch inst := &rules[s.rule].prog.Inst[s.pc]; inst.Op {
+			case syntax.InstAlt, syntax.InstAltMatch:
+				add(nfaState{s.rule, int(inst.Out)})
+				add(nfaState{s.rule, int(inst.Arg)})
+			case syntax.InstCapture, syntax.InstNop:
+				add(nfaState{s.rule, int(inst.Out)})
+			case syntax.InstFail:
+				// nop
+			default:
+				r = append(r, s)
+			}
+		}
+		for _, s := range set {
+			add(s)
+		}
+		sort.Slice(r, func(i, j int) bool { return r[i].rule < r[j].rule || r[i].rule == r[j].rule && r[i].pc < r[j].pc })
+		return r
+	}
+	key := func(set []nfaState) string {
+		var b strings.Builder
+		for _, s := range set {
+			fmt.Fprintf(&b, "%d.%d,", s.rule, s.pc)
+		}
+		return b.String()
+	}
+
+	var start []nfaState
+	for i, v := range rules {
+		start = append(start, nfaState{i, v.prog.Start})
+	}
+	var dfa []*dfaState
+	var sets [][]nfaState
+	index := map[string]int{}
+	state := func(set []nfaState) int {
+		k := key(set)
+		if n, ok := index[k]; ok {
+			return n
+		}
+
+		n := len(dfa)
+		index[k] = n
+		accept := -1
+		for _, s := range set {
+			if rules[s.rule].prog.Inst[s.pc].Op == syntax.InstMatch {
+				accept = s.rule
+				break
+			}
+		}
+		dfa = append(dfa, &dfaState{accept: accept})
+		sets = append(sets, set)
+		return n
+	}
+	state(closure(start))
+	for n := 0; n < len(dfa); n++ {
+		set := sets[n]
+		var bounds []rune // Starts of the elementary intervals.
+		ranges := make([][]rune, len(set))
+		for i, s := range set {
+			ranges[i] = instRanges(&rules[s.rule].prog.Inst[s.pc])
+			for j := 0; j < len(ranges[i]); j += 2 {
+				bounds = append(bounds, ranges[i][j], ranges[i][j+1]+1)
+			}
+		}
+		sort.Slice(bounds, func(i, j int) bool { return bounds[i] < bounds[j] })
+		for i := 0; i+1 < len(bounds); i++ {
+			lo, hi := bounds[i], bounds[i+1]-1
+			if lo > hi {
+				continue
+			}
+
+			var next []nfaState
+			for j, s := range set {
+				if inRanges(ranges[j], lo) {
+					next = append(next, nfaState{s.rule, int(rules[s.rule].prog.Inst[s.pc].Out)})
+				}
+			}
+			if len(next) == 0 {
+				continue
+			}
+
+			m := state(closure(next))
+			tr := dfa[n].trans
+			if k := len(tr) - 1; k >= 0 && tr[k].next == m && tr[k].hi+1 == lo {
+				tr[k].hi = hi
+				continue
+			}
+
+			dfa[n].trans = append(tr, dfaRange{lo, hi, m})
+		}
+	}
+	return dfa
+}
+
+// instRanges returns the sorted rune ranges, as lo, hi pairs, matched by the
+// rune consuming instruction inst.
+func instRanges(inst *syntax.Inst) (r []rune) {
+	switch inst.Op {
+	case syntax.InstRuneAny:
+		return []rune{0, unicode.MaxRune}
+	case syntax.InstRuneAnyNotNL:
+		return []rune{0, '\n' - 1, '\n' + 1, unicode.MaxRune}
+	case syntax.InstRune1:
+		r = []rune{inst.Rune[0], inst.Rune[0]}
+	case syntax.InstRune:
+		r = append(r, inst.Rune...)
+		if len(r) == 1 {
+			r = append(r, r[0])
+		}
+	default:
+		return nil
+	}
+
+	if syntax.Flags(inst.Arg)&syntax.FoldCase != 0 {
+		for i, n := 0, len(r); i < n; i += 2 {
+			for c := r[i]; c <= r[i+1]; c++ {
+				for f := unicode.SimpleFold(c); f != c; f = unicode.SimpleFold(f) {
+					r = append(r, f, f)
+				}
+			}
+		}
+	}
+	return normalizeRanges(r)
+}
+
+// normalizeRanges sorts and merges the lo, hi pairs in r.
+func normalizeRanges(r []rune) []rune {
+	type pair struct{ lo, hi rune }
+	a := make([]pair, 0, len(r)/2)
+	for i := 0; i < len(r); i += 2 {
+		a = append(a, pair{r[i], r[i+1]})
+	}
+	sort.Slice(a, func(i, j int) bool { return a[i].lo < a[j].lo })
+	var out []rune
+	for _, v := range a {
+		if n := len(out); n != 0 && v.lo <= out[n-1]+1 {
+			if v.hi > out[n-1] {
+				out[n-1] = v.hi
+			}
+			continue
+		}
+
+		out = append(out, v.lo, v.hi)
+	}
+	return out
+}
+
+func inRanges(r []rune, c rune) bool {
+	for i := 0; i < len(r); i += 2 {
+		if r[i] <= c && c <= r[i+1] {
+			return true
+		}
+	}
+	return false
+}
+
+// lexerSource returns the source of the lexer generated from rules.
+func (g *generator) lexerSource(rules []*lexRule) string {
+	dfa := lexDFA(rules)
+	var buf bytes.Buffer
+	f := func(s string, args ...interface{}) { fmt.Fprintf(&buf, s, args...) }
+	f(`
+// %[1]sLexRange is a transition of the lexer DFA on the runes lo through hi.
+type %[1]sLexRange struct {
+	lo, hi rune
+	next   int32
+}
+
+var (
+	// %[1]sLexTrans are the transitions of the lexer DFA states, sorted.
+	%[1]sLexTrans = [][]%[1]sLexRange{
+`, g.Prefix)
+	for i, s := range dfa {
+		f("\t\t{ // %d\n", i)
+		for _, t := range s.trans {
+			f("\t\t\t{%d, %d, %d},\n", t.lo, t.hi, t.next)
+		}
+		f("\t\t},\n")
+	}
+	f("\t}\n\n\t// %[1]sLexAccept are the rules accepted by the lexer DFA states, -1 if none.\n\t%[1]sLexAccept = []int{", g.Prefix)
+	for i, s := range dfa {
+		if i%16 == 0 {
+			f("\n\t\t")
+		}
+		f("%d, ", s.accept)
+	}
+	f(`
+	}
+)
+
+// %[1]sScanner is the lexer generated from the %%lex section.
+type %[1]sScanner struct {
+	Errs  []string // Errors reported by the parser.
+	Src   []byte
+	off   int // Offset of the next token.
+	start int // Offset of the last token.
+}
+
+// %[1]sNewScanner returns a lexer of src.
+func %[1]sNewScanner(src []byte) *%[1]sScanner { return &%[1]sScanner{Src: src} }
+
+// Error implements %[1]sLexer.
+func (s *%[1]sScanner) Error(msg string) {
+	s.Errs = append(s.Errs, __yyfmt__.Sprintf("%%d: %%s", s.start, msg))
+}
+
+// Pos returns the offset of the last token.
+func (s *%[1]sScanner) Pos() int { return s.start }
+
+// Text returns the text of the last token.
+func (s *%[1]sScanner) Text() string { return string(s.Src[s.start:s.off]) }
+
+// Lex implements %[1]sLexer. It returns the longest match of the %%lex rules,
+// preferring the first rule listed, or the next rune if there is no match.
+func (s *%[1]sScanner) Lex(lval *%[1]sSymType) int {
+	for {
+		s.start = s.off
+		if s.off >= len(s.Src) {
+			return 0
+		}
+
+		state, accept, end := 0, -1, s.off
+		for i := s.off; ; {
+			if a := %[1]sLexAccept[state]; a >= 0 {
+				accept, end = a, i
+			}
+			if i >= len(s.Src) {
+				break
+			}
+
+			c, n := __yyutf8__.DecodeRune(s.Src[i:])
+			tr := %[1]sLexTrans[state]
+			lo, hi := 0, len(tr)
+			for lo < hi {
+				m := int(uint(lo+hi) >> 1)
+				if tr[m].hi < c {
+					lo = m + 1
+				} else {
+					hi = m
+				}
+			}
+			if lo == len(tr) || tr[lo].lo > c {
+				break
+			}
+
+			state = int(tr[lo].next)
+			i += n
+		}
+		if accept < 0 || end == s.off {
+			c, n := __yyutf8__.DecodeRune(s.Src[s.off:])
+			s.off += n
+			return int(c)
+		}
+
+		s.off = end
+		text := string(s.Src[s.start:end])
+		_ = text
+		switch accept {
+`, g.Prefix)
+	for i, v := range rules {
+		f("\t\tcase %d: // %s %q\n", i, v.name, v.pattern)
+		if v.name == "_" {
+			f("\t\t\tcontinue\n")
+			continue
+		}
+
+		if v.action != "" {
+			f("\t\t\t%s\n", v.action)
+		}
+		f("\t\t\treturn %s\n", v.name)
+	}
+	f("\t\t}\n\t}\n}\n")
+	return buf.String()
+}
+
+// checkLexTokens verifies that the %lex rules name terminals of p.
+func checkLexTokens(p *y.Parser, pp *preprocessed) error {
+	var errs scanner.ErrorList
+	for _, v := range pp.lex {
+		if v.name == "_" || v.name[0] == '\'' {
+			continue
+		}
+
+		if sym := p.Syms[v.name]; sym == nil || !sym.IsTerminal {
+			errs.Add(v.pos, fmt.Sprintf("%%lex: %s is not a token", v.name))
+		}
+	}
+	return errs.Err()
+}
@@ -0,0 +1,225 @@
+// Copyright 2014 The goyacc Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gen
+
+import (
+	"fmt"
+	"go/token"
+	"sort"
+	"strings"
+
+	"github.com/cznic/y"
+)
+
+// overlayCell is a parse table entry enabled by overlays.
+type overlayCell struct {
+	state int
+	sym   *y.Symbol
+	names []string // The overlays enabling the entry, sorted.
+}
+
+// overlayKey is a parse table entry.
+type overlayKey struct {
+	state int
+	sym   string
+}
+
+// overlayNames returns the -overlay names, sorted.
+func (g *generator) overlayNames() []string {
+	var a []string
+	for nm := range g.Overlays {
+		a = append(a, nm)
+	}
+	sort.Strings(a)
+	return a
+}
+
+// overlayDefines returns the -D defines with the -overlay names defined only
+// if listed in on.
+func (g *generator) overlayDefines(on ...string) Defines {
+	d := Defines{}
+	for k, v := range g.Defines {
+		d[k] = v
+	}
+	for k := range g.Overlays {
+		delete(d, k)
+	}
+	for _, k := range on {
+		d[k] = g.Overlays[k]
+	}
+	return d
+}
+
+// overlays returns the entries of the parse table of full, the grammar in src
+// with all the -overlay names defined, which are enabled by the overlays. The
+// remaining entries form the parse table of the grammar with no overlay
+// defined. Every overlay is verified on its own: the automaton of the grammar
+// having only that overlay defined must be the automaton of full restricted
+// to the cells of the base table and of the overlay.
+func (g *generator) overlays(fset *token.FileSet, name string, src []byte, full *y.Parser) ([]*overlayCell, error) {
+	names := g.overlayNames()
+	base, err := g.overlayParser(fset, name, src)
+	if err != nil {
+		return nil, fmt.Errorf("-overlay %s: %v", strings.Join(names, ", "), err)
+	}
+
+	used, paired, err := embedParser(fset, base, full)
+	if err != nil {
+		return nil, fmt.Errorf("-overlay %s: the grammar without overlays %v", strings.Join(names, ", "), err)
+	}
+
+	cells := map[overlayKey]*overlayCell{}
+	cell := func(k overlayKey) *overlayCell {
+		c := cells[k]
+		if c == nil {
+			c = &overlayCell{state: k.state, sym: full.Syms[k.sym]}
+			cells[k] = c
+		}
+		return c
+	}
+	for _, nm := range names {
+		p, err := g.overlayParser(fset, name, src, nm)
+		if err != nil {
+			return nil, fmt.Errorf("-overlay %s: %v", nm, err)
+		}
+
+		u, pr, err := embedParser(fset, p, full)
+		if err != nil {
+			return nil, fmt.Errorf("-overlay %s: the grammar with only this overlay %v", nm, err)
+		}
+
+		for k := range u {
+			if !used[k] {
+				c := cell(k)
+				c.names = append(c.names, nm)
+			}
+		}
+		for s := range pr {
+			paired[s] = true
+		}
+	}
+
+	// Entries of states reachable with some overlays enabled must be enabled
+	// by an overlay of their own.
+	var r []*overlayCell
+	for s, state := range full.Table {
+		if !paired[s] {
+			continue
+		}
+
+		for _, act := range state {
+			k := overlayKey{s, act.Sym.Name}
+			if used[k] {
+				continue
+			}
+
+			c := cells[k]
+			if c == nil {
+				return nil, fmt.Errorf("-overlay %s: the action of state %d on %s needs more than one overlay enabled", strings.Join(names, ", "), s, act.Sym.Name)
+			}
+
+			r = append(r, c)
+		}
+	}
+	sort.Slice(r, func(i, j int) bool {
+		if a, b := r[i], r[j]; a.state != b.state {
+			return a.state < b.state
+		}
+
+		return r[i].sym.Value < r[j].sym.Value
+	})
+	return r, nil
+}
+
+// overlayParser returns the parser of the grammar in src having only the
+// overlays on defined.
+func (g *generator) overlayParser(fset *token.FileSet, name string, src []byte, on ...string) (*y.Parser, error) {
+	pp, err := g.preprocessDefines(fset, name, src, g.overlayDefines(on...))
+	if err != nil {
+		return nil, err
+	}
+
+	var valueType string
+	if d := pp.define["api.value.type"]; d != nil {
+		valueType = d.val
+	}
+	return y.ProcessSource(fset, name, pp.src, &y.Options{
+		AllowConflicts:  true,
+		AllowTypeErrors: valueType != "",
+	})
+}
+
+// embedParser runs the automaton of sub, a grammar variant having a subset of
+// the rules of full, in lockstep with the automaton of full. It returns the
+// table entries of full used by sub and the states of full visited. It is an
+// error if the variants take different actions, other than sub having no
+// action, in the paired states.
+func embedParser(fset *token.FileSet, sub, full *y.Parser) (used map[overlayKey]bool, paired map[int]bool, err error) {
+	used, paired = map[overlayKey]bool{}, map[int]bool{}
+	type pair struct{ s, f int }
+	seen := map[pair]bool{{0, 0}: true}
+	queue := []pair{{0, 0}}
+	for len(queue) != 0 {
+		v := queue[0]
+		queue = queue[1:]
+		paired[v.f] = true
+		acts := map[string]y.Action{}
+		for _, act := range full.Table[v.f] {
+			acts[act.Sym.Name] = act
+		}
+		for _, act := range sub.Table[v.s] {
+			nm := act.Sym.Name
+			fact, ok := acts[nm]
+			if !ok {
+				return nil, nil, fmt.Errorf("has %s in state %d on %s where the full grammar has no action", actionText(sub, act), v.s, nm)
+			}
+
+			sk, sarg := act.Kind()
+			fk, farg := fact.Kind()
+			if sk != fk || sk == 'r' && !sameRule(fset, sub.Rules[sarg], full.Rules[farg]) {
+				return nil, nil, fmt.Errorf("has %s in state %d on %s where the full grammar has %s", actionText(sub, act), v.s, nm, actionText(full, fact))
+			}
+
+			used[overlayKey{v.f, nm}] = true
+			switch sk {
+			case 's', 'g':
+				if w := (pair{sarg, farg}); !seen[w] {
+					seen[w] = true
+					queue = append(queue, w)
+				}
+			}
+		}
+	}
+	return used, paired, nil
+}
+
+// sameRule reports whether a and b are the same rule of grammar variants.
+// Variants differ only in the lines excluded by conditionals, so rules keep
+// their positions.
+func sameRule(fset *token.FileSet, a, b *y.Rule) bool {
+	if a.Sym.Name != b.Sym.Name || strings.Join(a.Components, " ") != strings.Join(b.Components, " ") {
+		return false
+	}
+
+	pa, pb := fset.Position(a.Pos), fset.Position(b.Pos)
+	return pa.Line == pb.Line && pa.Column == pb.Column
+}
+
+// actionText describes act of p.
+func actionText(p *y.Parser, act y.Action) string {
+	switch k, arg := act.Kind(); k {
+	case 'a':
+		return "accept"
+	case 'g':
+		return fmt.Sprintf("goto state %d", arg)
+	case 'r':
+		r := p.Rules[arg]
+		return fmt.Sprintf("reduce by %s: %s", r.Sym.Name, strings.Join(r.Components, " "))
+	case 's':
+		return fmt.Sprintf("shift to state %d", arg)
+	default:
+		panic("internal error 005")
+	}
+}
@@ -0,0 +1,136 @@
+// Copyright 2014 The goyacc Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gen
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"runtime"
+	"runtime/pprof"
+	"time"
+)
+
+// profile accumulates the time spent in the phases of a generation.
+type profile struct {
+	calls  map[string]int
+	phase  string // The current phase.
+	phases []string
+	start  time.Time // Of the current phase.
+	times  map[string]time.Duration
+}
+
+func newProfile() *profile {
+	return &profile{calls: map[string]int{}, times: map[string]time.Duration{}}
+}
+
+// enter ends the current phase and starts phase, returning the phase ended.
+// Like resume it does nothing if p is nil, so the phases can be marked like
+//
+//	defer g.prof.resume(g.prof.enter("phase"))
+func (p *profile) enter(phase string) (prev string) {
+	if p == nil {
+		return ""
+	}
+
+	prev = p.resume(phase)
+	p.calls[phase]++
+	return prev
+}
+
+// resume is like enter but does not count the phase as entered again.
+func (p *profile) resume(phase string) (prev string) {
+	if p == nil {
+		return ""
+	}
+
+	now := time.Now()
+	if p.phase != "" {
+		p.times[p.phase] += now.Sub(p.start)
+	}
+	if _, ok := p.times[phase]; !ok && phase != "" {
+		p.times[phase] = 0
+		p.phases = append(p.phases, phase)
+	}
+	prev = p.phase
+	p.phase, p.start = phase, now
+	return prev
+}
+
+// write ends the current phase and writes the time spent in the phases, in
+// the order they were first entered, to w.
+func (p *profile) write(w io.Writer) {
+	p.resume("")
+	var total time.Duration
+	for _, v := range p.times {
+		total += v
+	}
+	fmt.Fprintf(w, "%-36s %12s %6s %6s\n", "phase", "time", "%", "calls")
+	for _, nm := range p.phases {
+		pct := 0.0
+		if total != 0 {
+			pct = 100 * float64(p.times[nm]) / float64(total)
+		}
+		fmt.Fprintf(w, "%-36s %12v %5.1f%% %6d\n", nm, p.times[nm].Round(time.Microsecond), pct, p.calls[nm])
+	}
+	fmt.Fprintf(w, "%-36s %12v\n", "total", total.Round(time.Microsecond))
+}
+
+// startProfiles starts -profile and the -cpuprofile and -memprofile pprof
+// profiles, if set, and returns the function stopping them.
+func (g *generator) startProfiles() (stop func() error, err error) {
+	var stops []func() error
+	stop = func() (err error) {
+		for i := len(stops) - 1; i >= 0; i-- {
+			if e := stops[i](); e != nil && err == nil {
+				err = e
+			}
+		}
+		return err
+	}
+	if g.Profile {
+		g.prof = newProfile()
+		stops = append(stops, func() error {
+			g.prof.write(os.Stderr)
+			g.prof = nil
+			return nil
+		})
+	}
+	if fn := g.CPUProfile; fn != "" {
+		f, err := os.Create(fn)
+		if err != nil {
+			stop()
+			return nil, err
+		}
+
+		if err := pprof.StartCPUProfile(f); err != nil {
+			f.Close()
+			stop()
+			return nil, fmt.Errorf("-cpuprofile: %v", err)
+		}
+
+		stops = append(stops, func() error {
+			pprof.StopCPUProfile()
+			return f.Close()
+		})
+	}
+	if fn := g.MemProfile; fn != "" {
+		stops = append(stops, func() error {
+			f, err := os.Create(fn)
+			if err != nil {
+				return err
+			}
+
+			runtime.GC()
+			if err := pprof.WriteHeapProfile(f); err != nil {
+				f.Close()
+				return err
+			}
+
+			return f.Close()
+		})
+	}
+	return stop, nil
+}
@@ -0,0 +1,90 @@
+// Copyright 2014 The goyacc Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gen
+
+import (
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/scanner"
+	"go/token"
+	"strings"
+)
+
+// checkPure verifies that the functions of the parser output src, generated
+// with -pure, do not modify the package level variables declared by goyacc,
+// ie. the variables having the -p prefix in any case.
+func (g *generator) checkPure(name string, src []byte) error {
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, name, src, 0)
+	if err != nil {
+		return err
+	}
+
+	pref := strings.ToLower(g.Prefix)
+	vars := map[*ast.Object]bool{}
+	for _, d := range file.Decls {
+		if d, ok := d.(*ast.GenDecl); ok && d.Tok == token.VAR {
+			for _, spec := range d.Specs {
+				for _, nm := range spec.(*ast.ValueSpec).Names {
+					if strings.HasPrefix(strings.ToLower(nm.Name), pref) {
+						vars[nm.Obj] = true
+					}
+				}
+			}
+		}
+	}
+
+	var errs scanner.ErrorList
+	for _, d := range file.Decls {
+		fn, ok := d.(*ast.FuncDecl)
+		if !ok || fn.Body == nil {
+			continue
+		}
+
+		check := func(e ast.Expr) {
+			for {
+				switch x := e.(type) {
+				case *ast.IndexExpr:
+					e = x.X
+					continue
+				case *ast.ParenExpr:
+					e = x.X
+					continue
+				case *ast.SelectorExpr:
+					e = x.X
+					continue
+				case *ast.StarExpr:
+					e = x.X
+					continue
+				case *ast.Ident:
+					if vars[x.Obj] {
+						errs.Add(fset.Position(x.Pos()), fmt.Sprintf("-pure: %s modifies the package level variable %s", fn.Name.Name, x.Name))
+					}
+				}
+				return
+			}
+		}
+		ast.Inspect(fn.Body, func(n ast.Node) bool {
+			switch x := n.(type) {
+			case *ast.AssignStmt:
+				if x.Tok != token.DEFINE {
+					for _, v := range x.Lhs {
+						check(v)
+					}
+				}
+			case *ast.IncDecStmt:
+				check(x.X)
+			case *ast.RangeStmt:
+				if x.Tok == token.ASSIGN {
+					check(x.Key)
+					check(x.Value)
+				}
+			}
+			return true
+		})
+	}
+	return errs.Err()
+}
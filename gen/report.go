@@ -0,0 +1,499 @@
+// Copyright 2014 The goyacc Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gen
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"html"
+	"io"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/cznic/y"
+)
+
+const htmlReportStyle = `body { font-family: sans-serif; }
+pre, td { font-family: monospace; }
+a { text-decoration: none; }
+a:hover { text-decoration: underline; }
+section { border-top: 1px solid #ccc; }
+.conflict { background: #fdd; }
+.nonterminal { font-style: italic; }
+td { padding: 0 1em 0 0; vertical-align: top; }`
+
+// reportStatesList returns the state numbers of -reportstates.
+func (g *generator) reportStatesList() ([]int, error) {
+	var r []int
+	if g.ReportStates == "" {
+		return nil, nil
+	}
+
+	for _, v := range strings.Split(g.ReportStates, ",") {
+		n, err := strconv.Atoi(strings.TrimSpace(v))
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("-reportstates: invalid state %q", v)
+		}
+
+		r = append(r, n)
+	}
+	return r, nil
+}
+
+// reportFilter returns the states of the report selected by -reportstates and
+// -reportsymbols, with the states having a transition to or from them, or nil
+// to report all the states. A symbol selects the states having it in a kernel
+// item.
+func (g *generator) reportFilter(p *y.Parser) (map[int]bool, error) {
+	if g.ReportStates == "" && g.ReportSymbols == "" {
+		return nil, nil
+	}
+
+	a, err := g.analyze(p)
+	if err != nil {
+		return nil, err
+	}
+
+	selected := map[*lrState]bool{}
+	states, err := g.reportStatesList()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, n := range states {
+		if n >= len(p.Table) {
+			return nil, fmt.Errorf("-reportstates: no state %d", n)
+		}
+
+		for _, s := range a.states {
+			if s.n == n {
+				selected[s] = true
+			}
+		}
+	}
+	if g.ReportSymbols != "" {
+		for _, nm := range strings.Split(g.ReportSymbols, ",") {
+			nm = strings.TrimSpace(nm)
+			sym, ok := p.Syms[nm]
+			if !ok {
+				return nil, fmt.Errorf("-reportsymbols: unknown symbol %s", nm)
+			}
+
+			i := a.index[sym]
+			for _, s := range a.states {
+			items:
+				for _, it := range s.kernel {
+					if a.index[p.Rules[it.rule].Sym] == i {
+						selected[s] = true
+						break
+					}
+
+					for _, c := range a.rhs[it.rule] {
+						if c == i {
+							selected[s] = true
+							break items
+						}
+					}
+				}
+			}
+		}
+	}
+	keep := map[int]bool{}
+	for _, s := range a.states {
+		if s.n < 0 {
+			continue
+		}
+
+		if selected[s] {
+			keep[s.n] = true
+		}
+		for _, t := range s.next {
+			if t.n < 0 {
+				continue
+			}
+
+			switch {
+			case selected[s]:
+				keep[t.n] = true
+			case selected[t]:
+				keep[s.n] = true
+			}
+		}
+	}
+	return keep, nil
+}
+
+var reportState = regexp.MustCompile(`^state (\d+)\b`)
+
+// filterTextReport writes the text report b to w, except the states not in
+// keep, if not nil.
+func filterTextReport(w io.Writer, b []byte, keep map[int]bool) error {
+	if keep != nil {
+		var buf bytes.Buffer
+		on := true
+		for _, line := range bytes.SplitAfter(b, []byte{'\n'}) {
+			if m := reportState.FindSubmatch(line); m != nil {
+				n, _ := strconv.Atoi(string(m[1]))
+				on = keep[n]
+			}
+			if on {
+				buf.Write(line)
+			}
+		}
+		b = buf.Bytes()
+	}
+	_, err := w.Write(b)
+	return err
+}
+
+// writeHTMLReport writes the grammar report of p as a HTML document to w.
+// The rules, symbols and states are cross-linked, the closures of the states
+// are collapsible and the states having conflicts are highlighted. Only the
+// states in keep are written, if not nil. The document starts with the
+// fingerprint fp.
+func (g *generator) writeHTMLReport(w io.Writer, p *y.Parser, keep map[int]bool, fp string) error {
+	a, err := g.analyze(p)
+	if err != nil {
+		return err
+	}
+
+	b := bufio.NewWriter(w)
+	fmt.Fprintf(b, "<!DOCTYPE html>\n<html>\n<head>\n<meta charset=\"utf-8\">\n<title>Grammar report</title>\n<style>\n%s\n</style>\n</head>\n<body>\n", htmlReportStyle)
+	fmt.Fprintf(b, "<p>Fingerprint: <code>%s</code>, goyacc version <code>%s</code></p>\n", fp, html.EscapeString(version()))
+	conflicts := map[int][]*conflict{}
+	for _, c := range a.conflicts {
+		if c.state.n >= 0 {
+			conflicts[c.state.n] = append(conflicts[c.state.n], c)
+		}
+	}
+	if len(conflicts) != 0 {
+		b.WriteString("<h1>Conflicts</h1>\n<ul>\n")
+		for _, c := range a.conflicts {
+			if keep != nil && !keep[c.state.n] {
+				continue
+			}
+
+			fmt.Fprintf(b, "<li class=\"conflict\">%s</li>\n", a.conflictHTML(c))
+		}
+		b.WriteString("</ul>\n")
+	}
+
+	b.WriteString("<h1>Grammar</h1>\n<table>\n")
+	for r := range p.Rules {
+		fmt.Fprintf(b, "<tr id=\"rule-%d\"><td>%s</td></tr>\n", r, a.itemHTML(r, -1))
+	}
+	b.WriteString("</table>\n")
+
+	entered := a.enteredStates()
+	b.WriteString("<h1>Symbols</h1>\n<table>\n")
+	for i, sym := range a.syms {
+		fmt.Fprintf(b, "<tr id=\"sym-%d\"><td>%s</td><td>%d</td><td>", i, a.symHTML(i), sym.Value)
+		if !a.isTerminal(i) {
+			b.WriteString("rules")
+			for _, r := range a.rules[i-a.nterms] {
+				fmt.Fprintf(b, " <a href=\"#rule-%d\">%[1]d</a>", r)
+			}
+		}
+		b.WriteString("</td><td>")
+		if n := entered[i]; len(n) != 0 {
+			b.WriteString("enters")
+			for _, v := range n {
+				fmt.Fprintf(b, " <a href=\"#state-%d\">state %[1]d</a>", v)
+			}
+		}
+		b.WriteString("</td></tr>\n")
+	}
+	b.WriteString("</table>\n")
+
+	b.WriteString("<h1>States</h1>\n")
+	for _, s := range a.tableStates() {
+		if s == nil || keep != nil && !keep[s.n] {
+			continue
+		}
+
+		class := ""
+		if len(conflicts[s.n]) != 0 {
+			class = " class=\"conflict\""
+		}
+		fmt.Fprintf(b, "<section id=\"state-%d\"%s>\n<h2>state %[1]d</h2>\n<pre>\n", s.n, class)
+		for _, it := range s.kernel {
+			fmt.Fprintf(b, "%s\n", a.itemHTML(it.rule, it.dot))
+		}
+		b.WriteString("</pre>\n")
+		if len(s.items) > len(s.kernel) {
+			b.WriteString("<details>\n<summary>closure</summary>\n<pre>\n")
+			for _, it := range s.items[len(s.kernel):] {
+				fmt.Fprintf(b, "%s\n", a.itemHTML(it.rule, it.dot))
+			}
+			b.WriteString("</pre>\n</details>\n")
+		}
+		b.WriteString("<table>\n")
+		for _, act := range p.Table[s.n] {
+			sym := html.EscapeString(act.Sym.Name)
+			if i, ok := a.index[act.Sym]; ok {
+				sym = a.symHTML(i)
+			}
+			fmt.Fprintf(b, "<tr><td>%s</td><td>", sym)
+			switch kind, arg := act.Kind(); kind {
+			case 'a':
+				b.WriteString("accept")
+			case 'g':
+				fmt.Fprintf(b, "goto <a href=\"#state-%d\">state %[1]d</a>", arg)
+			case 'r':
+				fmt.Fprintf(b, "reduce using <a href=\"#rule-%d\">rule %[1]d</a> (%s)", arg, html.EscapeString(p.Rules[arg].Sym.Name))
+			case 's':
+				fmt.Fprintf(b, "shift, and goto <a href=\"#state-%d\">state %[1]d</a>", arg)
+			}
+			b.WriteString("</td></tr>\n")
+		}
+		b.WriteString("</table>\n")
+		for _, c := range conflicts[s.n] {
+			fmt.Fprintf(b, "<p>%s</p>\n", a.conflictHTML(c))
+			if g.Derivations {
+				var buf bytes.Buffer
+				a.writeTraces(&buf, c, "")
+				fmt.Fprintf(b, "<pre>\n%s</pre>\n", html.EscapeString(buf.String()))
+			}
+		}
+		b.WriteString("</section>\n")
+	}
+	b.WriteString("</body>\n</html>\n")
+	return b.Flush()
+}
+
+// enteredStates returns the sorted numbers of the states entered by the
+// symbols.
+func (a *automaton) enteredStates() map[int][]int {
+	m := map[int]map[int]bool{}
+	for _, s := range a.states {
+		for sym, t := range s.next {
+			if t.n < 0 {
+				continue
+			}
+
+			if m[sym] == nil {
+				m[sym] = map[int]bool{}
+			}
+			m[sym][t.n] = true
+		}
+	}
+	r := map[int][]int{}
+	for sym, set := range m {
+		for n := range set {
+			r[sym] = append(r[sym], n)
+		}
+		sort.Ints(r[sym])
+	}
+	return r
+}
+
+// tableStates returns the states of a indexed by their number in the parse
+// table, nil for a row having no state.
+func (a *automaton) tableStates() []*lrState {
+	states := make([]*lrState, len(a.p.Table))
+	for _, s := range a.states {
+		if s.n >= 0 {
+			states[s.n] = s
+		}
+	}
+	return states
+}
+
+// symHTML returns the name of symbol i linked to its entry in the symbol
+// table.
+func (a *automaton) symHTML(i int) string {
+	class := ""
+	if !a.isTerminal(i) {
+		class = " class=\"nonterminal\""
+	}
+	return fmt.Sprintf("<a href=\"#sym-%d\"%s>%s</a>", i, class, html.EscapeString(a.syms[i].Name))
+}
+
+// itemHTML is like ruleString but the rule number links to the rule and the
+// symbols link to their entries.
+func (a *automaton) itemHTML(r, dot int) string {
+	s := fmt.Sprintf("<a href=\"#rule-%d\">%4[1]d</a> %s:", r, a.symHTML(a.index[a.p.Rules[r].Sym]))
+	for i, sym := range a.rhs[r] {
+		if i == dot {
+			s += " ."
+		}
+		s += " " + a.symHTML(sym)
+	}
+	if dot == len(a.rhs[r]) {
+		s += " ."
+	}
+	return s
+}
+
+// conflictHTML describes c and its resolution.
+func (a *automaton) conflictHTML(c *conflict) string {
+	s := fmt.Sprintf("<a href=\"#state-%s\">state %[1]s</a>: conflict on %s between", stateName(c.state), a.symHTML(c.sym))
+	sep := " "
+	if c.shift {
+		s += " shift"
+		sep = " and "
+	}
+	for _, r := range c.reduces {
+		s += fmt.Sprintf("%sreduce using <a href=\"#rule-%d\">rule %[2]d</a>", sep, r)
+		sep = " and "
+	}
+	switch c.resolution {
+	case 'e':
+		s += ", resolved as an error"
+	case 'r':
+		s += fmt.Sprintf(", resolved as reduce using <a href=\"#rule-%d\">rule %[1]d</a>", c.rule)
+	case 's':
+		s += ", resolved as shift"
+	}
+	if c.prec {
+		s += " by precedence"
+	}
+	return s
+}
+
+// writeMarkdownReport writes the grammar report of p as a Markdown document
+// to w, structured like the HTML report. The closures of the states are in
+// details elements. Only the states in keep are written, if not nil. The
+// document starts with the fingerprint fp.
+func (g *generator) writeMarkdownReport(w io.Writer, p *y.Parser, keep map[int]bool, fp string) error {
+	a, err := g.analyze(p)
+	if err != nil {
+		return err
+	}
+
+	b := bufio.NewWriter(w)
+	fmt.Fprintf(b, "# Grammar report\n\nFingerprint %s, goyacc version %s.\n", mdCode(fp), mdCode(version()))
+	conflicts := map[int][]*conflict{}
+	for _, c := range a.conflicts {
+		if c.state.n >= 0 {
+			conflicts[c.state.n] = append(conflicts[c.state.n], c)
+		}
+	}
+	if len(conflicts) != 0 {
+		b.WriteString("\n## Conflicts\n\n")
+		for _, c := range a.conflicts {
+			if keep != nil && !keep[c.state.n] {
+				continue
+			}
+
+			fmt.Fprintf(b, "- %s\n", a.conflictMarkdown(c))
+		}
+	}
+
+	b.WriteString("\n## Grammar\n\n| Rule | |\n| ---: | --- |\n")
+	for r := range p.Rules {
+		fmt.Fprintf(b, "| <a name=\"rule-%d\"></a>%[1]d | %s |\n", r, mdCell(a.ruleString(r, -1)))
+	}
+
+	entered := a.enteredStates()
+	b.WriteString("\n## Symbols\n\n| Symbol | Value | Rules | Enters |\n| --- | ---: | --- | --- |\n")
+	for i, sym := range a.syms {
+		fmt.Fprintf(b, "| %s | %d |", mdCell(sym.Name), sym.Value)
+		if !a.isTerminal(i) {
+			for _, r := range a.rules[i-a.nterms] {
+				fmt.Fprintf(b, " [%d](#rule-%[1]d)", r)
+			}
+		}
+		b.WriteString(" |")
+		for _, v := range entered[i] {
+			fmt.Fprintf(b, " [state %d](#state-%[1]d)", v)
+		}
+		b.WriteString(" |\n")
+	}
+
+	b.WriteString("\n## States\n")
+	for _, s := range a.tableStates() {
+		if s == nil || keep != nil && !keep[s.n] {
+			continue
+		}
+
+		fmt.Fprintf(b, "\n### State %d\n\n```\n", s.n)
+		for _, it := range s.kernel {
+			fmt.Fprintf(b, "%4d %s\n", it.rule, a.ruleString(it.rule, it.dot))
+		}
+		b.WriteString("```\n")
+		if len(s.items) > len(s.kernel) {
+			b.WriteString("\n<details>\n<summary>closure</summary>\n\n```\n")
+			for _, it := range s.items[len(s.kernel):] {
+				fmt.Fprintf(b, "%4d %s\n", it.rule, a.ruleString(it.rule, it.dot))
+			}
+			b.WriteString("```\n\n</details>\n")
+		}
+		b.WriteString("\n| Symbol | Action |\n| --- | --- |\n")
+		for _, act := range p.Table[s.n] {
+			fmt.Fprintf(b, "| %s | ", mdCell(act.Sym.Name))
+			switch kind, arg := act.Kind(); kind {
+			case 'a':
+				b.WriteString("accept")
+			case 'g':
+				fmt.Fprintf(b, "goto [state %d](#state-%[1]d)", arg)
+			case 'r':
+				fmt.Fprintf(b, "reduce using [rule %d](#rule-%[1]d) (%s)", arg, mdCell(p.Rules[arg].Sym.Name))
+			case 's':
+				fmt.Fprintf(b, "shift, and goto [state %d](#state-%[1]d)", arg)
+			}
+			b.WriteString(" |\n")
+		}
+		for _, c := range conflicts[s.n] {
+			fmt.Fprintf(b, "\n%s\n", a.conflictMarkdown(c))
+			if g.Derivations {
+				b.WriteString("\n```\n")
+				a.writeTraces(b, c, "")
+				b.WriteString("```\n")
+			}
+		}
+	}
+	return b.Flush()
+}
+
+// mdCode returns s as a Markdown code span.
+func mdCode(s string) string {
+	if strings.Contains(s, "`") {
+		return "`` " + s + " ``"
+	}
+
+	return "`" + s + "`"
+}
+
+// mdCell is like mdCode but the result can be in a table cell.
+func mdCell(s string) string { return strings.Replace(mdCode(s), "|", `\|`, -1) }
+
+// conflictMarkdown is like conflictHTML but it returns Markdown.
+func (a *automaton) conflictMarkdown(c *conflict) string {
+	s := fmt.Sprintf("[State %s](#state-%[1]s): conflict on %s between", stateName(c.state), mdCode(a.syms[c.sym].Name))
+	sep := " "
+	if c.shift {
+		s += " shift"
+		sep = " and "
+	}
+	for _, r := range c.reduces {
+		s += fmt.Sprintf("%sreduce using [rule %d](#rule-%[2]d)", sep, r)
+		sep = " and "
+	}
+	switch c.resolution {
+	case 'e':
+		s += ", resolved as an error"
+	case 'r':
+		s += fmt.Sprintf(", resolved as reduce using [rule %d](#rule-%[1]d)", c.rule)
+	case 's':
+		s += ", resolved as shift"
+	}
+	if c.prec {
+		s += " by precedence"
+	}
+	return s
+}
+
+// Report implements the goyacc report command. It writes the grammar report
+// of the grammar file in, in the format and to the file of o, without the
+// parser output and the other files.
+func Report(in string, o *Options) error {
+	g := newGenerator(o)
+	g.NoOutput, g.report = true, true
+	return g.main1(in)
+}
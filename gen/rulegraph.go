@@ -0,0 +1,183 @@
+// Copyright 2014 The goyacc Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gen
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strings"
+
+	"github.com/cznic/y"
+)
+
+// ruleGraph is the -rulegraph document.
+type ruleGraph struct {
+	Start        string          `json:"start"`
+	Nonterminals []ruleGraphNode `json:"nonterminals"`
+	// The recursive strongly connected components, the sets of
+	// nonterminals referencing each other, directly or not, with more
+	// than one nonterminal or one referencing itself.
+	Components [][]string `json:"components"`
+}
+
+type ruleGraphNode struct {
+	Name       string   `json:"name"`
+	Rules      []int    `json:"rules"`
+	References []string `json:"references"` // The nonterminals in the right hand sides of the rules.
+	Component  int      `json:"component"`  // Index in Components, -1 if none.
+}
+
+// newRuleGraph returns the nonterminal dependency graph of a.
+func newRuleGraph(a *automaton) *ruleGraph {
+	g := &ruleGraph{Start: a.p.Start, Nonterminals: []ruleGraphNode{}, Components: [][]string{}}
+	var nodes []int // Symbol indices.
+	edges := map[int][]int{}
+	for sym := a.nterms; sym < len(a.syms); sym++ {
+		if a.syms[sym].Name == "$accept" {
+			continue
+		}
+
+		nodes = append(nodes, sym)
+		seen := map[int]bool{}
+		for _, r := range a.rules[sym-a.nterms] {
+			for _, v := range a.rhs[r] {
+				if !a.isTerminal(v) && !seen[v] {
+					seen[v] = true
+					edges[sym] = append(edges[sym], v)
+				}
+			}
+		}
+		sort.Ints(edges[sym])
+	}
+
+	// Tarjan's algorithm.
+	index := map[int]int{}
+	low := map[int]int{}
+	onStack := map[int]bool{}
+	var stack []int
+	component := map[int]int{}
+	var visit func(v int)
+	visit = func(v int) {
+		index[v], low[v] = len(index), len(index)
+		stack = append(stack, v)
+		onStack[v] = true
+		for _, w := range edges[v] {
+			if _, ok := index[w]; !ok {
+				visit(w)
+				if low[w] < low[v] {
+					low[v] = low[w]
+				}
+			} else if onStack[w] && index[w] < low[v] {
+				low[v] = index[w]
+			}
+		}
+		if low[v] != index[v] {
+			return
+		}
+
+		var scc []int
+		for {
+			w := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			onStack[w] = false
+			scc = append(scc, w)
+			if w == v {
+				break
+			}
+		}
+		if len(scc) == 1 && !hasEdge(edges[v], v) {
+			return
+		}
+
+		var names []string
+		for _, w := range scc {
+			component[w] = len(g.Components)
+			names = append(names, a.syms[w].Name)
+		}
+		sort.Strings(names)
+		g.Components = append(g.Components, names)
+	}
+	for _, v := range nodes {
+		if _, ok := index[v]; !ok {
+			visit(v)
+		}
+	}
+
+	for _, sym := range nodes {
+		n := ruleGraphNode{Name: a.syms[sym].Name, Rules: append([]int{}, a.rules[sym-a.nterms]...), References: []string{}, Component: -1}
+		for _, v := range edges[sym] {
+			n.References = append(n.References, a.syms[v].Name)
+		}
+		if c, ok := component[sym]; ok {
+			n.Component = c
+		}
+		g.Nonterminals = append(g.Nonterminals, n)
+	}
+	return g
+}
+
+func hasEdge(edges []int, v int) bool {
+	for _, w := range edges {
+		if w == v {
+			return true
+		}
+	}
+	return false
+}
+
+// writeRuleGraph writes the graph of the nonterminals of p referencing each
+// other in their rules to the file fn, as JSON if fn ends in .json,
+// otherwise as a Graphviz graph where the recursive strongly connected
+// components are red clusters and the start symbol is bold.
+func (g *generator) writeRuleGraph(fn string, p *y.Parser) error {
+	a, err := g.analyze(p)
+	if err != nil {
+		return err
+	}
+
+	rg := newRuleGraph(a)
+	if strings.HasSuffix(fn, ".json") {
+		b, err := json.MarshalIndent(rg, "", "\t")
+		if err != nil {
+			return err
+		}
+
+		return ioutil.WriteFile(fn, append(b, '\n'), 0666)
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString("digraph rules {\n\tnode [shape=box, fontname=monospace];\n")
+	for i, c := range rg.Components {
+		fmt.Fprintf(&buf, "\tsubgraph cluster_%d {\n\t\tlabel=\"recursive %d\";\n\t\tcolor=red;\n", i, i+1)
+		for _, nm := range c {
+			fmt.Fprintf(&buf, "\t\t\"%s\";\n", dotEscaper.Replace(nm))
+		}
+		buf.WriteString("\t}\n")
+	}
+	for _, n := range rg.Nonterminals {
+		var attrs []string
+		if n.Name == rg.Start {
+			attrs = append(attrs, "style=bold")
+		}
+		if n.Component >= 0 {
+			attrs = append(attrs, "color=red")
+		}
+		fmt.Fprintf(&buf, "\t\"%s\"", dotEscaper.Replace(n.Name))
+		if len(attrs) != 0 {
+			fmt.Fprintf(&buf, " [%s]", strings.Join(attrs, ", "))
+		}
+		buf.WriteString(";\n")
+	}
+	for _, n := range rg.Nonterminals {
+		for _, v := range n.References {
+			fmt.Fprintf(&buf, "\t\"%s\" -> \"%s\";\n", dotEscaper.Replace(n.Name), dotEscaper.Replace(v))
+		}
+	}
+	buf.WriteString("}\n")
+	return ioutil.WriteFile(fn, buf.Bytes(), 0666)
+}
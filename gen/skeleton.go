@@ -0,0 +1,167 @@
+// Copyright 2014 The goyacc Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gen
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+
+	"github.com/cznic/strutil"
+	"github.com/cznic/y"
+)
+
+// skeleton is the data of a -skeleton template. The symbols are referred to
+// by their index in Symbols.
+type skeleton struct {
+	BuildConstraint string // Expression of the //go:build line, if any.
+	Fingerprint     string // Hash of the grammar, the goyacc version and the options, like sha256:f00d....
+	Header          string // The comment lines heading the output, see -header.
+	Prefix          string // Name prefix of the generated code, like yy.
+	// The prologue of the grammar with the package clause and the imports of
+	// the generated code, like __yyfmt__ "fmt". The ones not used by the
+	// output are removed.
+	Prologue  string
+	Rules     []skeletonRule  // Rule 0 is $accept: start $end.
+	Start     int             // The start symbol.
+	StateType string          // Type of the state field yys of SymType.
+	States    []skeletonState // State 0 is the initial state.
+	SymType   string          // The struct type of the semantic values, including yys.
+	Symbols   []skeletonSymbol
+	Tail      string // The code following the second %%.
+	Version   string // The goyacc version, like v1.2.0 or (devel).
+}
+
+// skeletonSymbol is a symbol of the grammar.
+type skeletonSymbol struct {
+	Name     string // Like NUM, '+' or expr.
+	Value    int    // Token value of a terminal, -1 for $default.
+	Terminal bool
+	Alias    string // String alias of a token, like "number", if any.
+	Type     string // The SymType field or the type of the semantic value, if any.
+}
+
+// skeletonRule is a rule of the grammar.
+type skeletonRule struct {
+	Sym        int   // The left hand side.
+	Components []int // The right hand side.
+	// The Go code of the action including the braces, if any. It refers
+	// to $$ as yyVAL and to $n as yyS[yypt-k], where k is the number of
+	// the components following n, like the built-in parser does.
+	Action string
+	Text   string // Like expr: expr '+' term.
+}
+
+// skeletonState is a state of the LALR automaton.
+type skeletonState struct {
+	Actions []skeletonAction // On the terminals, $default is the action on the others.
+	Gotos   []skeletonGoto   // On the nonterminals.
+}
+
+// skeletonAction is a parser action on a lookahead terminal.
+type skeletonAction struct {
+	Sym  int
+	Kind string // "shift", "reduce" or "accept".
+	Arg  int    // The shift target state or the rule reduced.
+}
+
+// skeletonGoto is the state reached by reducing to a nonterminal.
+type skeletonGoto struct {
+	Sym   int
+	State int
+}
+
+// newSkeleton returns the -skeleton template data of p.
+func (g *generator) newSkeleton(p *y.Parser, pp *preprocessed, prologue, symType, stateType string, emitAction func(f strutil.Formatter, r int)) *skeleton {
+	d := &skeleton{
+		BuildConstraint: g.buildConstraint(pp),
+		Prefix:          g.Prefix,
+		Prologue:        prologue,
+		StateType:       stateType,
+		SymType:         symType,
+		Tail:            p.Tail,
+	}
+	var syms []*y.Symbol
+	for nm, sym := range p.Syms {
+		switch nm {
+		case "", "ε", "#":
+			continue
+		}
+
+		syms = append(syms, sym)
+	}
+	sort.Slice(syms, func(i, j int) bool {
+		if a, b := syms[i].Value, syms[j].Value; a != b {
+			return a < b
+		}
+
+		return syms[i].Name < syms[j].Name
+	})
+	index := map[*y.Symbol]int{}
+	for i, sym := range syms {
+		index[sym] = i
+		alias, _ := strconv.Unquote(sym.LiteralString)
+		d.Symbols = append(d.Symbols, skeletonSymbol{sym.Name, sym.Value, sym.IsTerminal, strings.TrimSpace(alias), sym.Type})
+	}
+	d.Start = index[p.Syms[p.Start]]
+	for r, rule := range p.Rules {
+		v := skeletonRule{Sym: index[rule.Sym], Components: []int{}, Text: ruleText(rule)}
+		for _, nm := range rule.Components {
+			v.Components = append(v.Components, index[p.Syms[nm]])
+		}
+		if rule.Action != nil && len(rule.Action.Values) != 0 {
+			var buf bytes.Buffer
+			emitAction(strutil.IndentFormatter(&buf, "\t"), r)
+			v.Action = buf.String()
+		}
+		d.Rules = append(d.Rules, v)
+	}
+	for _, state := range p.Table {
+		s := skeletonState{Actions: []skeletonAction{}, Gotos: []skeletonGoto{}}
+		for _, act := range state {
+			kind, arg := act.Kind()
+			switch kind {
+			case 'a':
+				s.Actions = append(s.Actions, skeletonAction{index[act.Sym], "accept", 0})
+			case 'g':
+				s.Gotos = append(s.Gotos, skeletonGoto{index[act.Sym], arg})
+			case 'r':
+				s.Actions = append(s.Actions, skeletonAction{index[act.Sym], "reduce", arg})
+			case 's':
+				s.Actions = append(s.Actions, skeletonAction{index[act.Sym], "shift", arg})
+			default:
+				panic("internal error 008")
+			}
+		}
+		d.States = append(d.States, s)
+	}
+	return d
+}
+
+// execSkeleton writes the output of the text/template file fn executed with
+// the data d to w.
+func execSkeleton(w io.Writer, fn string, d *skeleton) error {
+	b, err := ioutil.ReadFile(fn)
+	if err != nil {
+		return err
+	}
+
+	t, err := template.New(filepath.Base(fn)).Parse(string(b))
+	if err != nil {
+		return fmt.Errorf("-skeleton: %v", err)
+	}
+
+	if err := t.Execute(w, d); err != nil {
+		return fmt.Errorf("-skeleton: %v", err)
+	}
+
+	return nil
+}
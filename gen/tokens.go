@@ -0,0 +1,135 @@
+// Copyright 2014 The goyacc Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gen
+
+import (
+	"bytes"
+	"fmt"
+	"go/build"
+	"go/format"
+	"go/token"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/cznic/strutil"
+)
+
+// tokensPackage returns the package name of the -tokens file fn, which is
+// the name of its directory.
+func tokensPackage(fn string) (string, error) {
+	dir := filepath.Dir(fn)
+	if abs, err := filepath.Abs(dir); err == nil {
+		dir = abs
+	}
+	if nm := filepath.Base(dir); token.IsIdentifier(nm) && nm != "_" {
+		return nm, nil
+	}
+
+	return "", fmt.Errorf("-tokens: directory %q is not a valid package name", filepath.Dir(fn))
+}
+
+// tokensImportPath returns the import path of the package of the -tokens
+// file fn, the module path of the go.mod file found in its directory or a
+// parent joined with the path of the directory relative to the module root,
+// or else the path of the directory relative to a GOPATH src directory.
+func tokensImportPath(fn string) (string, error) {
+	dir, err := filepath.Abs(filepath.Dir(fn))
+	if err != nil {
+		return "", err
+	}
+
+	for root := dir; ; {
+		b, err := ioutil.ReadFile(filepath.Join(root, "go.mod"))
+		if err == nil {
+			mod := modulePath(b)
+			if mod == "" {
+				return "", fmt.Errorf("-tokens: %s: no module path", filepath.Join(root, "go.mod"))
+			}
+
+			rel, err := filepath.Rel(root, dir)
+			if err != nil {
+				return "", err
+			}
+
+			return path.Join(mod, filepath.ToSlash(rel)), nil
+		}
+
+		parent := filepath.Dir(root)
+		if parent == root {
+			break
+		}
+
+		root = parent
+	}
+	for _, v := range filepath.SplitList(build.Default.GOPATH) {
+		if rel, err := filepath.Rel(filepath.Join(v, "src"), dir); err == nil && rel != "." && !strings.HasPrefix(rel, "..") {
+			return filepath.ToSlash(rel), nil
+		}
+	}
+	return "", fmt.Errorf("-tokens: cannot determine the import path of %s, it is neither in a module nor in GOPATH", filepath.Dir(fn))
+}
+
+// modulePath returns the module path declared by the go.mod file contents b,
+// if any.
+func modulePath(b []byte) string {
+	for _, line := range strings.Split(string(b), "\n") {
+		if f := strings.Fields(line); len(f) >= 2 && f[0] == "module" {
+			return strings.Trim(f[1], `"`)
+		}
+	}
+	return ""
+}
+
+// writeTokens writes the token definitions file fn, creating its directory if
+// necessary, headed by the comment hdr. It declares the token constants
+// emitted by consts and the maps of the token values to their names and
+// aliases, given as Go map entries.
+func (g *generator) writeTokens(fn, hdr string, consts func(f strutil.Formatter), names, aliases []string) error {
+	pkg, err := tokensPackage(fn)
+	if err != nil {
+		return err
+	}
+
+	var buf bytes.Buffer
+	f := strutil.IndentFormatter(&buf, "\t")
+	f.Format("%s\n", hdr)
+	f.Format("package %s\n\nconst (%i\n", pkg)
+	consts(f)
+	f.Format("%u)\n\n// %sTokenNames maps the token values to their names.\n", g.exportedPrefix())
+	f.Format("var %sTokenNames = map[int]string{%i\n", g.exportedPrefix())
+	for _, v := range names {
+		f.Format("%s,\n", v)
+	}
+	f.Format("%u}\n\n// %sTokenAliases maps the token values to their string aliases, if any.\n", g.exportedPrefix())
+	f.Format("var %sTokenAliases = map[int]string{%i\n", g.exportedPrefix())
+	for _, v := range aliases {
+		f.Format("%s,\n", v)
+	}
+	f.Format("%u}\n")
+	b, err := format.Source(buf.Bytes())
+	if err != nil {
+		return fmt.Errorf("-tokens: %v", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(fn), 0775); err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(fn, b, 0666)
+}
+
+// sameDir reports whether the files a and b are in the same directory.
+func sameDir(a, b string) bool {
+	if x, err := filepath.Abs(a); err == nil {
+		a = x
+	}
+	if x, err := filepath.Abs(b); err == nil {
+		b = x
+	}
+	return filepath.Dir(a) == filepath.Dir(b)
+}
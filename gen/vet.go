@@ -0,0 +1,122 @@
+// Copyright 2014 The goyacc Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gen
+
+import (
+	"fmt"
+	"go/token"
+	"sort"
+
+	"github.com/cznic/y"
+)
+
+// Vet implements the goyacc vet command. It analyzes the grammar file in like
+// the n option does, with all the warnings enabled, unless disabled by o, and
+// returns them as errors.
+func Vet(in string, o *Options) error {
+	g := newGenerator(o)
+	g.Warnings = map[string]bool{"all": true}
+	for k, on := range o.Warnings {
+		g.Warnings[k] = on
+	}
+	g.NoOutput, g.Werror, g.vet = true, true, true
+	return g.main1(in)
+}
+
+// lint returns the warnings of the checks of p not done by package y. The
+// automaton of p is analyzed only for the never-reduced warnings.
+func (g *generator) lint(fset *token.FileSet, p *y.Parser, pp *preprocessed) (warnings, error) {
+	var w warnings
+	rules := matchRules(p, pp.rules)
+	reduced := map[int]bool{}
+	complete := map[int]bool{} // Rules completed in a state.
+	if g.warningEnabled("never-reduced") {
+		a, err := g.analyze(p)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, state := range p.Table {
+			for _, act := range state {
+				if kind, arg := act.Kind(); kind == 'r' {
+					reduced[arg] = true
+				}
+			}
+		}
+		for _, s := range a.states {
+			for _, it := range s.items {
+				if it.dot == len(a.rhs[it.rule]) {
+					complete[it.rule] = true
+				}
+			}
+		}
+	}
+	for r, rule := range p.Rules {
+		v := rules[r]
+		if r == 0 || v == nil {
+			continue
+		}
+
+		if complete[r] && !reduced[r] {
+			w.add("never-reduced", v.pos, fmt.Sprintf("rule %s never reduced, it loses all its conflicts", v))
+		}
+		if typ := rule.Sym.Type; typ != "" && rule.Action == nil {
+			switch {
+			case len(rule.Components) == 0:
+				w.add("default-action", v.pos, fmt.Sprintf("empty rule %s of <%s> %s has no action setting $$", v, typ, rule.Sym.Name))
+			default:
+				if c := p.Syms[rule.Components[0]]; c.Type != typ {
+					w.add("default-action", v.pos, fmt.Sprintf("rule %s of <%s> %s has no action and its default $$ = $1 is of %s", v, typ, rule.Sym.Name, typeName(c.Type)))
+				}
+			}
+		}
+	}
+
+	seen := map[string]*srcRule{} // Alternative: its first occurrence.
+	for _, v := range pp.rules {
+		k := v.String()
+		if first := seen[k]; first != nil {
+			w.add("identical", v.pos, fmt.Sprintf("rule %s identical to the one at %s", v, first.pos))
+			continue
+		}
+
+		seen[k] = v
+	}
+
+	if pp.lex != nil {
+		lexed := map[string]bool{}
+		for _, v := range pp.lex {
+			lexed[v.name] = true
+		}
+		for _, v := range pp.ranges {
+			lexed[v.name] = true
+		}
+		used := map[string]bool{}
+		for _, rule := range p.Rules {
+			for _, nm := range rule.Components {
+				used[nm] = true
+			}
+		}
+		var nms []string
+		for nm, sym := range p.Syms {
+			if sym.IsTerminal && used[nm] && nm[0] != '$' && nm[0] != '\'' && nm != "error" && !lexed[nm] {
+				nms = append(nms, nm)
+			}
+		}
+		sort.Strings(nms)
+		for _, nm := range nms {
+			w.add("lex", fset.Position(p.Syms[nm].Pos), fmt.Sprintf("token %s produced by no %%lex rule", nm))
+		}
+	}
+	return w, nil
+}
+
+func typeName(typ string) string {
+	if typ == "" {
+		return "no type"
+	}
+
+	return "<" + typ + ">"
+}
@@ -0,0 +1,119 @@
+// Copyright 2014 The goyacc Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gen
+
+import (
+	"fmt"
+	"go/scanner"
+	"go/token"
+	"os"
+	"sort"
+	"strings"
+)
+
+// warningCategories are the categories of the warnings and whether they are
+// enabled by default.
+var warningCategories = map[string]bool{
+	"counterexamples": false, // Derivations of the conflicts not resolved by precedence.
+	"default-action":  false, // Rule of a typed nonterminal without an action, whose $1 has another type.
+	"duplicate":       true,  // Nonterminal defined at more than one place.
+	"empty-rule":      false, // Empty rule alternative not marked %empty.
+	"identical":       false, // Rule alternative identical to another one.
+	"lex":             false, // Token produced by no %lex rule.
+	"never-reduced":   false, // Rule losing all its conflicts.
+	"precedence":      true,  // Useless precedence declaration or %prec.
+	"type":            true,  // Symbol declared with conflicting types.
+	"unused":          true,  // Token used by no rule.
+	"useless":         true,  // Nonterminal or rule not deriving a sentence of the grammar.
+}
+
+// WarningCategories returns the sorted names of the warning categories.
+func WarningCategories() []string {
+	var a []string
+	for k := range warningCategories {
+		a = append(a, k)
+	}
+	sort.Strings(a)
+	return a
+}
+
+// warningEnabled reports whether the warnings of category c are reported. A
+// category set by -Wc or -Wno-c overrides -Wall and -Wno-all, which override
+// the default.
+func (g *generator) warningEnabled(c string) bool {
+	if v, ok := g.Warnings[c]; ok {
+		return v
+	}
+
+	if v, ok := g.Warnings["all"]; ok {
+		return v
+	}
+
+	return warningCategories[c]
+}
+
+// warning is a diagnostic of a warning category.
+type warning struct {
+	*scanner.Error
+	category string
+}
+
+// warnings is a list of warnings.
+type warnings []warning
+
+func (w *warnings) add(category string, pos token.Position, msg string) {
+	*w = append(*w, warning{&scanner.Error{Pos: pos, Msg: msg}, category})
+}
+
+// addList adds the errors of l as warnings of category.
+func (w *warnings) addList(category string, l scanner.ErrorList) {
+	for _, v := range l {
+		w.add(category, v.Pos, v.Msg)
+	}
+}
+
+// sort sorts w by position, like scanner.ErrorList.Sort.
+func (w warnings) sort() {
+	sort.SliceStable(w, func(i, j int) bool {
+		a, b := w[i].Pos, w[j].Pos
+		if a.Filename != b.Filename {
+			return a.Filename < b.Filename
+		}
+
+		if a.Line != b.Line {
+			return a.Line < b.Line
+		}
+
+		if a.Column != b.Column {
+			return a.Column < b.Column
+		}
+
+		return w[i].Msg < w[j].Msg
+	})
+}
+
+// report writes the warnings of w enabled in g to os.Stderr, tagged by their
+// category. With -Werror it returns them as errors instead.
+func (w warnings) report(g *generator) error {
+	var l scanner.ErrorList
+	for _, v := range w {
+		if g.warningEnabled(v.category) {
+			msg, more := v.Msg, "" // The category follows the first line.
+			if i := strings.IndexByte(msg, '\n'); i >= 0 {
+				msg, more = msg[:i], msg[i:]
+			}
+			l.Add(v.Pos, fmt.Sprintf("%s [-W%s]%s", msg, v.category, more))
+		}
+	}
+	l.Sort()
+	if g.Werror {
+		return l.Err()
+	}
+
+	for _, v := range l {
+		fmt.Fprintf(os.Stderr, "%v\n", v)
+	}
+	return nil
+}
@@ -0,0 +1,91 @@
+// Copyright 2014 The goyacc Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gen
+
+import (
+	"fmt"
+	"go/scanner"
+	"os"
+	"time"
+)
+
+// watchInterval is the period of polling the watched files for changes.
+const watchInterval = 300 * time.Millisecond
+
+// fileStamp identifies a version of a file, the zero value is a missing file.
+type fileStamp struct {
+	mod  time.Time
+	size int64
+}
+
+// watchedFiles returns the inputs of the generation of the grammar file in.
+func (g *generator) watchedFiles(in string) []string {
+	a := []string{in}
+	for _, fn := range []string{g.Skeleton, g.XErrors} {
+		if fn != "" {
+			a = append(a, fn)
+		}
+	}
+	return a
+}
+
+func stamps(files []string) []fileStamp {
+	var a []fileStamp
+	for _, fn := range files {
+		var s fileStamp
+		if fi, err := os.Stat(fn); err == nil {
+			s = fileStamp{fi.ModTime(), fi.Size()}
+		}
+		a = append(a, s)
+	}
+	return a
+}
+
+func sameStamps(a, b []fileStamp) bool {
+	for i, v := range a {
+		if !v.mod.Equal(b[i].mod) || v.size != b[i].size {
+			return false
+		}
+	}
+	return true
+}
+
+// watch generates the parser of the grammar file in and generates it again
+// every time the grammar, the -skeleton template or the -xe examples change,
+// writing the errors and the changes of the numbers of conflicts to
+// os.Stderr. It returns only if the grammar cannot be watched.
+func (g *generator) watch(in string) error {
+	if in == os.Stdin.Name() {
+		return fmt.Errorf("-watch: cannot watch standard input")
+	}
+
+	files := g.watchedFiles(in)
+	last := [2]int{-1, -1}
+	for {
+		st := stamps(files)
+		g.conflicts = [2]int{}
+		switch err := g.main1(in); x := err.(type) {
+		case nil:
+			if last[0] >= 0 {
+				for i, kind := range []string{"shift/reduce", "reduce/reduce"} {
+					if n := g.conflicts[i]; n != last[i] {
+						fmt.Fprintf(os.Stderr, "conflicts: %d %s, was %d\n", n, kind, last[i])
+					}
+				}
+			}
+			last = g.conflicts
+			fmt.Fprintf(os.Stderr, "%s: generated, watching for changes\n", in)
+		case scanner.ErrorList:
+			for _, v := range x {
+				fmt.Fprintf(os.Stderr, "%v\n", v)
+			}
+		default:
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+		}
+		for sameStamps(st, stamps(files)) {
+			time.Sleep(watchInterval)
+		}
+	}
+}
@@ -13,20 +13,152 @@
 // Note: If no non flag arguments are given, goyacc reads standard input.
 //
 //	goyacc [options] [input]
+//	goyacc gen [options] [input]
+//	goyacc report [options] [input]
+//	goyacc lint [options] [input]
+//	goyacc vet [options] [input]
+//	goyacc diff [options] old.y new.y
+//	goyacc fmt [-l] [-w] [-sorttokens] [files]
+//	goyacc bench run [bench options]
+//	goyacc help
+//
+// The commands are
+//
+//	gen     Generate the parser, like goyacc without a command.
+//	report  Write the grammar report, like -n -v, without the parser output.
+//	lint    Report all the warnings of the grammar, the same as vet.
+//	diff    Compare the automatons of two grammars.
+//	fmt     Format grammar files.
+//	bench   Benchmark the parser of a grammar on a corpus.
+//	help    Show the commands and the options.
+//
+// A grammar file named like a command is given as ./name.
 //
 //	options and (defaults)
+//		-D name[=value]     Define name for %if and %ifdef, can be repeated. The default value is 1.
+//		-Wcategory          Enable the warnings of category, see Warnings below, or of all
+//		                    categories for -Wall.
+//		-Werror             Make the warnings errors. (false)
+//		-Wno-category       Disable the warnings of category, or of all categories for -Wno-all.
+//		-actionfuncs        Emit the rule actions as separate functions. (false)
+//		-actionpanic        Recover panics in the rule actions and re-panic with a *yyActionPanic
+//		                    having the rule number, text and grammar position. (false)
+//		-bench              Write a benchmark parsing a shortest sentence of the grammar and the
+//		                    -xe examples, if any, to the output name with the suffix
+//		                    _bench_test.go. (false)
 //		-c                  Report state closures. (false)
+//		-cancel n           Add ParseContext, checking the context for cancellation every n
+//		                    parser steps, 0 disables. (0)
+//		-check              Generate the parser output in memory and fail, summarizing the
+//		                    differences, if it differs from the existing output file. No
+//		                    files are written. (false)
+//		-conflicts json     Write the conflicts, with their states, lookahead tokens, competing
+//		                    rules and resolutions, as a JSON document to standard output, see
+//		                    Conflicts. ("")
+//		-cover              Count the reductions of each rule, reported by yyCoverage and
+//		                    yyWriteCoverage, see Coverage. (false)
+//		-cpuprofile file    Write a CPU profile of the generation to file, see runtime/pprof. ("")
 //		-cr                 Check all states are reducible. (false)
+//		-debugtag tag       Enable the parser debug code, see yyDebug, only when building with
+//		                    the build tag tag, the compiler removes it otherwise. ("")
+//		-derivations        Add to the grammar report, for each conflict, the derivations from
+//		                    the start symbol reaching its competing actions, as the sequences
+//		                    of the sentential forms derived. (false)
 //		-dlval              Debug value when runtime yyDebug >= 3. ("lval")
 //		-dlvalf             Debug format of -dlval. ("%+v")
+//		-dot file           Write the LALR automaton as a Graphviz graph to file, the states
+//		                    labeled by their kernel items. ("")
+//		-dotconflicts       Limit -dot to the states having conflicts and their predecessors.
+//		                    (false)
+//		-embed format       Store the grammar source in the parser output as the constant
+//		                    yyGrammarSource, as text or gzip compressed, with the accessor
+//		                    yyGrammar returning the text. ("")
+//		-eof name[=value]   Name and value of the end of input token, overrides %eof. ("")
 //		-ex                 Explain how were conflicts resolved. (false)
+//		-freeze file        Record the token values in file and fail if they change. ("")
 //		-fs                 Emit follow sets. (false)
-//		-l                  Disable line directives, for compatibility only - ignored. (false)
+//		-gitattributes      Mark the parser output linguist-generated in the .gitattributes file
+//		                    of its directory. (false)
+//		-header text        Head the parser output and the -tokens file by the text/template
+//		                    text, each line prefixed by //, instead of the standard marker.
+//		                    See Headers. ("")
+//		-json file          Write the parse tables, symbols, rules and conflicts as a JSON
+//		                    document to file. ("")
+//		-jsontrace          Add the JSON trace of the parser actions, see yyTraceJSON. (false)
+//		-l                  Disable the line directives mapping actions to the grammar. (false)
 //		-la                 Report all lookahead sets. (false)
-//		-o outputFile       Parser output. ("y.go")
-//		-p prefix           Name prefix to use in generated code. ("yy")
+//		-lexguard n         Abort the parse when the lexer returns the same token n times
+//		                    without progress, 0 disables. (0)
+//		-lexer type         Use the existing lexer interface or type instead of declaring
+//		                    yyLexer. ("")
+//		-maxdepth n         Abort the parse with "stack overflow" when the parser stack
+//		                    depth exceeds n, the constant yyMaxDepth, unless the parser
+//		                    MaxDepth field is set, 0 disables. (0)
+//		-maxerrors n        Abort the parse with "too many errors" after n syntax errors,
+//		                    unless the parser MaxErrors field is set, 0 disables. (0)
+//		-maxsteps n         Abort the parse with "parse limit exceeded" after n shifts and
+//		                    reductions, unless the parser MaxSteps field is set, 0 disables. (0)
+//		-memprofile file    Write a memory profile of the generation to file, see runtime/pprof. ("")
+//		-n                  Analyze the grammar, showing the conflicts, the warnings and the
+//		                    numbers of symbols, rules and states, without writing the parser
+//		                    output or any other file, except the report if -v is given. (false)
+//		-nodups             Forbid defining a nonterminal at more than one place. (false)
+//		-o outputFile       Parser output, - for standard output. ("y.go")
+//		-outdir dir         Directory of the parser output, created if necessary. ("")
+//		-overlay name[=value]
+//		                    Define name for %if and %ifdef in a parse table overlay enabled
+//		                    at runtime, can be repeated.
+//		-p prefix           Name prefix to use in generated code, overrides %define api.prefix. ("yy")
+//		-package name       Package name of the parser output, overrides %package. ("")
 //		-pool               Use sync.Pool for the parser stack
+//		-poolbench          With -pool, write benchmarks of the pooled parser stack to the
+//		                    output name with the suffix _pool_test.go. (false)
+//		-profile            Write the time spent in the phases of the generation, like the
+//		                    parse table construction, the analyses of the automaton and the
+//		                    parser emission, to standard error. (false)
+//		-ptrstack           Keep pointers to the semantic values on the parser stack, so a shift
+//		                    moves a pointer instead of copying a yySymType. (false)
+//		-pure               Generate a parser without package level mutable state, see %pure. (false)
+//		-raceguard          Make a parser instance panic when it is used by more than one
+//		                    goroutine at a time, instead of silently corrupting its stack. The
+//		                    guard costs an atomic compare and swap per parse. (false)
+//		-repair             Suggest a single token insertion or deletion repairing a syntax error
+//		                    in its message, like "missing ')' before 'then'?". Looking for a
+//		                    deletion reads the token following the offending one. (false)
+//		-report format      Format of the grammar report, text, html, json or markdown. The
+//		                    HTML report cross-links the rules, symbols and states and
+//		                    highlights the conflicts. The JSON report is the -json document
+//		                    with the items of the states. The Markdown report is like the
+//		                    HTML one. The default name ends in .html, .json or .md. ("text")
+//		-reportstates list  Limit the grammar report to the states of the comma separated
+//		                    list, like 17,42, and the states having a transition to or from
+//		                    them. ("")
+//		-reportsymbols list Limit the grammar report to the states having a symbol of the
+//		                    comma separated list in their kernel items, like expr, and the
+//		                    states having a transition to or from them. ("")
+//		-rulegraph file     Write the graph of the nonterminals referencing each other in their
+//		                    rules to file, as JSON if its name ends in .json, as a Graphviz
+//		                    graph otherwise, see Rule graphs. ("")
+//		-skeleton file      Generate the parser output by executing the text/template file
+//		                    instead of the built-in parser, see Skeletons. ("")
+//		-src-name name      Name of the grammar in the diagnostics, the line directives and the
+//		                    report, instead of the file name, or /dev/stdin when reading the
+//		                    grammar from standard input. ("")
+//		-stack n            Initial capacity of the parser stack. (200)
+//		-strict             Fail on the conflicts not expected by %expect and %expect-rr, even
+//		                    when the grammar declares none, without writing the parser
+//		                    output. (false)
+//		-tags expr          Add the line //go:build expr to the parser output, combined with %build-tags. ("")
+//		-tokens file        Write the token constants and the maps YyTokenNames and YyTokenAliases
+//		                    to file, in a package named after its directory, for lexers outside
+//		                    of the parser package. The parser imports that package, its import
+//		                    path found from go.mod or GOPATH, and defines its token constants
+//		                    as the ones of the package, like in the layout internal/token and
+//		                    internal/parser with -outdir internal/parser. ("")
 //		-v reportFile       Create grammar report. ("y.output")
+//		-watch              Generate the outputs again whenever the grammar, the -skeleton
+//		                    template or the -xe examples change, showing the errors and the
+//		                    changes of the numbers of conflicts, until interrupted. (false)
 //		-xe examplesFile    Generate error messages by examples. ("")
 //		-xegen examplesFile Generate a file suitable for -xe automatically from the grammar.
 //		                    The file must not exist. ("")
@@ -35,6 +167,887 @@
 //
 // Changelog
 //
+// 2026-10-16: The new option -raceguard makes the parse methods of yyParser
+// panic with a clear message when a parser instance is used by more than one
+// goroutine at a time.
+//
+// 2026-10-16: The new option -cover makes the parser count the reductions of
+// each rule, so tests can measure which productions their inputs exercise.
+// See Coverage.
+//
+// 2026-10-16: The new option -rulegraph file writes the graph of the
+// nonterminals referencing each other, as a Graphviz graph or as JSON if
+// file ends in .json, with the recursive strongly connected components
+// highlighted. See Rule graphs.
+//
+// 2026-10-16: The new option -derivations adds to the grammar report, for
+// each conflict, the derivations from the start symbol reaching the shift
+// and each reduction, like
+//
+//	state 4: shift/reduce conflict on '+'
+//		shift E: E . '+' E
+//			E
+//			⇒ [ E '+' E ]
+//			⇒ E '+' [ E • '+' E ]
+//		reduce E: E '+' E . on '+'
+//			E
+//			⇒ [ E '+' E ]
+//			⇒ [ E '+' E • ] '+' E
+//
+// where each line rewrites a nonterminal of the one above by the symbols in
+// brackets. The text report
+// ends with them, the HTML and Markdown reports have them in the states and
+// the JSON report in the conflicts.
+//
+// 2026-10-16: The commands gen, report, lint and help join bench, diff, fmt
+// and vet. goyacc gen is goyacc without a command, goyacc report writes only
+// the grammar report, goyacc lint is goyacc vet and goyacc help lists the
+// commands and the options. goyacc [options] [input] works as before.
+//
+// 2026-10-16: The option -report json writes the grammar report as a JSON
+// document for tools, the -json document with the fingerprint, the goyacc
+// version and the state numbers, kernel items and closures, and -report
+// markdown writes it as a Markdown document for publishing the grammar
+// documentation, with the sections of the HTML report. The default report
+// names end in .json and .md. -reportstates and -reportsymbols limit them
+// like the other formats.
+//
+// 2026-10-16: The new command
+//
+//	goyacc diff [options] old.y new.y
+//
+// compares two versions of a grammar, preprocessed with the -D defines of
+// the options, and writes the rules removed and added, the numbers of states
+// and conflicts, the conflicts removed and added and the tokens removed,
+// added and renumbered, like
+//
+//	--- old.y
+//	+++ new.y
+//	- rule expr: expr '-' term
+//	+ rule expr: expr '-' expr
+//	states: 21 -> 23
+//	conflicts: 0 -> 1 shift/reduce, 0 -> 0 reduce/reduce
+//	+ shift/reduce conflict on '-' reducing expr: expr '-' expr, resolved as shift, in state 17
+//	+ token MOD 57352
+//	token NUM: 57352 -> 57353
+//
+// The conflicts are compared by their lookahead token, rules and resolution,
+// as the state numbers change with the grammar, so a conflict moved to
+// another state is not reported.
+//
+// 2026-10-16: The new option -src-name name sets the name of the grammar in
+// the diagnostics, the line directives and the report, so editors feeding a
+// buffer to goyacc through standard input get positions in the file edited,
+// like in
+//
+//	goyacc -n -src-name parser/expr.y < buffer
+//
+// 2026-10-16: The option -o - writes the parser output to standard output,
+// for pipelines like
+//
+//	goyacc -o - expr.y | postprocess > expr.go
+//
+// The statistics, the conflicts and the warnings are written to standard
+// error, as always. The line directives name the output <standard output>.
+// The options writing files next to the parser output, -bench, -debugtag,
+// -gitattributes, -outdir and -poolbench, and the ones writing to standard
+// output or reading the output file, -conflicts and -check, cannot be used
+// with -o -.
+//
+// 2026-10-16: The new option -embed text or -embed gzip stores the grammar
+// source in the parser output as the constant yyGrammarSource, compressed by
+// gzip with -embed gzip, and declares the function yyGrammar returning it, so
+// programs can show or verify the grammar they were built from.
+//
+// 2026-10-16: The generated parser declares the constants yyFingerprint,
+// the hash of the grammar, the goyacc version and the options generating the
+// parser, and yyGoyaccVersion. The grammar report starts with them and the
+// -skeleton templates get them as the fields Fingerprint and Version. See
+// Fingerprints.
+//
+// 2026-10-16: The new option -profile shows where the generation time goes,
+// like in
+//
+//	phase                                        time      %  calls
+//	preprocess                                 1.93ms   0.4%      1
+//	parse tables (package y)                 402.51ms  78.9%      1
+//	report                                    31.02ms   6.1%      1
+//	analysis: symbols                          0.61ms   0.1%      3
+//	analysis: LR(0) closures                  25.43ms   5.0%      3
+//	...
+//
+// where calls counts the times a phase was entered. The new options
+// -cpuprofile file and -memprofile file write pprof profiles of the
+// generation.
+//
+// 2026-10-16: The new options -reportstates list and -reportsymbols list limit
+// the grammar report to the listed states, or to the states of the listed
+// symbols, and their neighbors, for reading the relevant excerpts of the
+// reports of big grammars.
+//
+// 2026-10-16: The new command goyacc vet reports all the warnings of the
+// grammar as errors, see Warnings. The new warning categories default-action,
+// identical, lex and never-reduced, disabled by default, report the rules
+// with a suspicious default action, identical rule alternatives, the tokens
+// not produced by the %lex section and the rules never reduced.
+//
+// 2026-10-16: The new command
+//
+//	goyacc fmt [-l] [-w] [-sorttokens] [files]
+//
+// formats the grammar files, or standard input, and writes the result to
+// standard output, like gofmt. With -l it lists the files whose formatting
+// differs and with -w it writes the result to the files instead. The
+// directives start a line, with their arguments separated by single spaces,
+// the rules are separated by blank lines and their alternatives are aligned
+// like in
+//
+//	expr:
+//		expr '+' term { $$ = $1 + $3 }
+//	|	term
+//
+// The comments, the conditional directives and the line breaks within the
+// directives and the alternatives are kept, the prologue, the %union, the
+// actions and the code after the second %% are not changed. With -sorttokens
+// the names of a %token directive are sorted, unless it has values, aliases
+// or comments. As the token values follow the declaration order, -sorttokens
+// changes the values of the tokens not declared with a value.
+//
+// 2026-10-16: The new option -conflicts json writes the conflicts as a JSON
+// document to standard output, see Conflicts.
+//
+// 2026-10-16: The new option -n analyzes the grammar without writing the parser
+// output, for quick checks of the conflicts and warnings of a grammar.
+//
+// 2026-10-16: The new option -watch keeps goyacc running and generates the
+// outputs again whenever the grammar changes, showing the changes of the
+// numbers of conflicts.
+//
+// 2026-10-16: The new option -header text replaces the standard comment
+// heading the generated files by the text/template text, which can render the
+// goyacc command line and the hash of the grammar, see Headers.
+//
+// 2026-10-16: The new option -skeleton file generates the parser output by
+// executing the text/template file with the symbols, rules, actions and parse
+// table of the grammar, see Skeletons.
+//
+// 2026-10-16: The new option -check generates the parser output in memory
+// and compares it to the existing output file, writing no files. goyacc fails
+// with a summary of the differences if they differ, so a CI job can verify the
+// committed parser is up to date with
+//
+//	goyacc -check -o parser.go parser.y
+//
+// 2026-10-16: The new warning category counterexamples, enabled by
+// -Wcounterexamples, shows for each conflict not resolved by precedence an
+// example sentential form reaching the conflict and the derivations of the
+// competing shift and reductions, see Warnings.
+//
+// 2026-10-16: The warnings have categories, controlled by the new options
+// -Wcategory, -Wno-category and -Werror, see Warnings. New warnings report
+// useless nonterminals and rules, tokens used by no rule, symbols declared with
+// conflicting types and, if enabled, empty rules not marked by the new %empty
+// directive.
+//
+// 2026-10-16: The new option -strict makes the conflicts not resolved by
+// precedence fail the generation unless expected by %expect and %expect-rr,
+// also when the grammar declares no expected counts at all. goyacc no longer
+// leaves an empty parser output behind when the generation fails.
+//
+// 2026-10-16: The new option -tokens file writes the token constants, the
+// token names and the token aliases to file, like the header of %defines in
+// Bison. Its package is named after the directory of file, so a hand written
+// lexer in a package other than the one of the parser can use the token values
+// without importing the parser.
+//
+// 2026-10-16: The grammar positions recorded with -actionpanic are relative
+// to the output, like the line directives, also with -l, so the output does
+// not depend on the working directory and is byte-identical across runs.
+//
+// 2026-10-16: The imports of the generated code are merged into the first
+// import group of the prologue, if any, instead of being prepended as
+// separate declarations. Imports already declared by the prologue are not
+// repeated and the ones not used by the parser output are removed.
+//
+// 2026-10-16: The parser generator moved to the importable package
+// github.com/cznic/goyacc/gen, the goyacc command is a thin wrapper setting
+// its Options from the flags. Build tools can generate parsers without
+// running the command:
+//
+//	o := gen.NewOptions()
+//	o.Prefix = "calc"
+//	err := gen.Generate("calc.y", o)
+//
+// writes the outputs like the command, while
+//
+//	r, err := gen.GenerateSource("calc.y", src, o)
+//
+// returns the parser output and the grammar report in r.Parser and r.Report.
+// The generations do not share any state, they may run concurrently.
+//
+// 2026-10-16: The new option -report html writes the grammar report as a
+// HTML document, named like y.html unless set by -v. The rules, symbols and
+// states are cross-linked, the closures of the states are collapsible and
+// the conflicts are highlighted.
+//
+// 2026-10-16: The new option -dot file writes the LALR automaton as a
+// Graphviz graph. The states are labeled by their kernel items, the edges by
+// the symbols, the states having conflicts are red. The new option
+// -dotconflicts limits the graph to the states having conflicts and their
+// predecessors.
+//
+// 2026-10-16: The new option -json file writes the automaton as a JSON
+// document having the start symbol, the symbols, the rules, the actions and
+// gotos of the states and the conflicts with their resolution, for grammar
+// visualizers, test generators and runtimes in other languages.
+//
+// 2026-10-16: The parser has the new field ReduceListener of the new type
+//
+//	type yyReduceListener func(rule int, rhs []yySymType, lhs *yySymType)
+//
+// If not nil, it is called after each reduction with the values of the rule
+// components and the value of the rule symbol, so profilers, coverage
+// trackers or concrete syntax tree builders can observe the reductions
+// without modifying the grammar actions. With -ptrstack, rhs is
+// []*yySymType.
+//
+// 2026-10-16: The new function
+//
+//	func yyStackString(stack []yySymType) string
+//
+// returns the symbols entering the states of a parser stack, like
+// "expr '+' term", using the new table yyStateSyms. The Stack field of
+// yySyntaxError and the debug output at yyDebug >= 4 and on a syntax error
+// show the stack that way.
+//
+// 2026-10-16: The new option -bench writes a benchmark of the parser, eg.
+// y_bench_test.go for the parser output y.go. It parses a shortest sentence
+// of the grammar and the token sequences of the -xe examples, if any, using
+// a lexer returning zero semantic values.
+//
+// 2026-10-16: A parse can be limited to a number of shifts and reductions,
+// set by the new MaxSteps field of the parser or, if it is zero, by the new
+// option -maxsteps n. Exceeding the limit aborts the parse with the error
+// "parse limit exceeded", bounding the work on adversarial input.
+//
+// 2026-10-16: The new directive
+//
+//	%entry name...
+//
+// declares nonterminals a parse can start with, so the productions of a
+// grammar can be tested without a whole input. The parser gets the field
+// Entry, selecting the nonterminal to parse by its new token constant
+// yyEntry_name, like in
+//
+//	p := &yyParser{Entry: yyEntry_expr}
+//	p.Parse(lexer)
+//
+// The start symbol is then yyEntry, deriving the original start symbol, the
+// default, or the yyEntry_name token, injected by the parser, followed by
+// name.
+//
+// 2026-10-16: If the lexer implements the new interface
+//
+//	type yyLexerErrorEx interface {
+//		ErrorEx(err *yySyntaxError)
+//	}
+//
+// the parser reports errors by calling ErrorEx, with the parser state, the
+// offending token, the expected tokens and the position, instead of Error.
+// A negative position passed to yySemanticError now keeps the position of a
+// lexer implementing yyLexerPos.
+//
+// 2026-10-16: If the lexer implements the new interface
+//
+//	type yyLexerSpan interface {
+//		Span() (start, end int)
+//	}
+//
+// returning the offsets of the last token returned by Lex, the parser
+// tracks the yySpan of the symbols on its stack and the new field Span of
+// yySyntaxError is the span of the offending token. In an action, yyspan(i)
+// returns the span of $i and yyspan(0) the span of $$. The actions emitted
+// with -actionfuncs cannot use yyspan.
+//
+// 2026-10-16: The parser has the Debug and DebugWriter fields also without
+// %pure, so concurrent parses can be traced independently. A zero Debug
+// field, or a nil DebugWriter field, defaults to yyDebug or yyDebugWriter.
+//
+// 2026-10-16: The new option -debugtag tag writes the files y_debug.go and
+// y_nodebug.go, for the parser output y.go, declaring yyDebug as a variable
+// with the build tag tag and as the constant zero without it, so the
+// compiler removes the debug code of production builds. The files declare
+// also yydebugLevel, returning the debug level of the parser or zero.
+//
+// 2026-10-16: The new option -ptrstack makes the parser stack a slice of
+// *yySymType. A shift then moves pointers instead of copying the values,
+// which pays off when the %union embeds big structs. The stack parameter of
+// the -actionfuncs functions and the values passed to yyPartialer.Partial
+// change to []*yySymType accordingly.
+//
+// 2026-10-16: The rows of the parse table yyParseTab are slices of the new
+// flat array yyParseData, improving cache locality. Identical rows, and rows
+// found in other rows, share their cells, unless -overlay is used, reducing
+// the size of the parser tables.
+//
+// 2026-10-16: yyReductions is a slice indexed by the rule number instead of
+// a map, avoiding a map lookup per reduction and shrinking the parser output.
+//
+// 2026-10-16: yyXLAT, translating the token values to symbols, is a dense
+// array of the symbols plus one, zero for none, looked up by the new
+// function yyxlat, unless the token values are very sparse, in which case it
+// remains a map. This removes a map lookup per token from the parser.
+//
+// 2026-10-16: A parse by a reused parser does not allocate, apart from
+// growing the parser stack. The lookahead and reduction values are kept in
+// the parser instead of escaping to the heap.
+//
+// 2026-10-16: The new option -actionpanic recovers panics in the rule actions
+// and re-panics with a *yyActionPanic having the rule number, the rule text,
+// the grammar position of the action and the recovered value, so a panic
+// deep inside an action can be attributed to its grammar rule.
+//
+// 2026-10-16: The rule actions can call
+//
+//	yySemanticError(pos int, msg string)
+//
+// to report a semantic error, like an integer literal overflow, at the input
+// position pos. It is reported like a syntax error, using the Error method of
+// the lexer and by yyParseErrors, and counts towards the errors limit, but the
+// parse continues, failing at its end.
+//
+// 2026-10-16: The rule actions can call
+//
+//	yyaccept()
+//	yyabort()
+//	yyerror(msg string)
+//
+// like YYACCEPT, YYABORT and YYERROR in classic yacc. After the action,
+// the parse succeeds, having the value of the rule as the result of
+// yyParseResult, fails, or reports the syntax error msg and starts the error
+// recovery, discarding the reduction.
+//
+// 2026-10-16: Besides yyerrok(), the rule actions can call
+//
+//	yyclearin()
+//	yybackup(tok int, lval yySymType) bool
+//
+// like in classic yacc. yyclearin discards the current lookahead token.
+// yybackup pushes back the token tok, having the value lval, making it the
+// lookahead token. The previous lookahead, if any, is read next. Only one
+// token can be pushed back, yybackup returns false if there is one already.
+//
+// 2026-10-16: The new function and method
+//
+//	func yyParseResult(yylex yyLexer) (yySymType, error)
+//	func (p *yyParser) ParseResult(yylex yyLexer) (yySymType, error)
+//
+// are like yyParseErr but return the semantic value of the start symbol too,
+// which no longer needs to be passed out through the lexer.
+//
+// 2026-10-16: If the lexer implements the new interface
+//
+//	type yyPartialer interface {
+//		Partial(values []yySymType)
+//	}
+//
+// a failed parse hands it the semantic values of the parser stack, reduced
+// so far, instead of throwing them away, so IDE-style consumers can build a
+// partial AST from a broken file.
+//
+// 2026-10-16: The new constant yyMaxErrors, set by the new option
+// -maxerrors n, limits the syntax errors of a parse by a parser having the
+// MaxErrors field zero. After as many errors, the next one aborts the parse
+// with the error "too many errors", so inputs triggering thousands of
+// cascading errors terminate early.
+//
+// 2026-10-16: The new function and method
+//
+//	func yyParseErrors(yylex yyLexer) []*yySyntaxError
+//	func (p *yyParser) ParseErrors(yylex yyLexer) []*yySyntaxError
+//
+// return all syntax errors of a parse continuing after error recovery, so a
+// compiler can show every error in one pass. The new MaxErrors field of the
+// parser, if not zero, aborts a parse after as many syntax errors.
+//
+// 2026-10-16: If the lexer implements the new interface
+//
+//	type yyRecoverer interface {
+//		Recover(states []int, tok int, lval *yySymType) (int, bool)
+//	}
+//
+// it is consulted on a syntax error before the default recovery. Recover
+// receives the parser state stack and the lookahead token and can replace
+// the lookahead, eg. by skipping to the next ';' or newline.
+//
+// 2026-10-16: The new option -repair extends the syntax error messages by
+// the first single token repair found against the parse table, like
+//
+//	unexpected 'then', missing ')' before 'then'?
+//	unexpected ')', extra ')'?
+//
+// An insertion is preferred over the deletion of the offending token.
+//
+// 2026-10-16: yySymName returns the string alias of a token, if any, like
+// "';'" for
+//
+//	%token tSEMI "';'"
+//
+// instead of its name, so the syntax errors, including those reported by the
+// lexer guard of -lexguard, and the debug output show the alias.
+//
+// 2026-10-16: The new option -jsontrace adds
+//
+//	var yyTraceJSON io.Writer
+//
+// which, if not nil, receives one JSON object per parser action, like
+//
+//	{"action":"shift","state":0,"lookahead":"NUM","depth":1,"goto":2}
+//
+// having the action, the parser state, the lookahead token, the parser stack
+// depth and, depending on the action, the rule and the next state. The
+// traces can be diffed between parser versions and replayed in external
+// tools. With %pure, the parser has the field TraceJSON instead.
+//
+// 2026-10-16: The parser has the new field Tracer of the new type
+//
+//	type yyTracer interface {
+//		Shift(state, sym int, val *yySymType)
+//		Reduce(rule, state, sym int, val *yySymType)
+//		ErrorRecovery(state, sym int)
+//		Accept(state int, val *yySymType)
+//	}
+//
+// If not nil, it receives the parser events, for building visual debuggers
+// and step-through tools on top of the generated parser.
+//
+// 2026-10-16: The debug output goes to the new variable
+//
+//	var yyDebugWriter io.Writer = os.Stderr
+//
+// instead of the standard output, so tests and logs can capture it. With
+// %pure it goes to the new DebugWriter field of the parser, os.Stderr if nil.
+//
+// 2026-10-16: With -pool, a parser stack grown during a parse is returned to
+// the pool instead of the initial one. The new option -poolbench writes
+// benchmarks comparing the pooled parser stack to allocating a new one, eg.
+// y_pool_test.go for the parser output y.go.
+//
+// 2026-10-16: The parser stack can be limited. A parse is aborted with the
+// error "stack overflow" when the stack depth exceeds the MaxDepth field of
+// the parser or, if it is zero, the value of the new option -maxdepth n. The
+// new option -stack n sets the initial stack capacity, 200 by default.
+//
+// 2026-10-16: The new option -cancel n adds
+//
+//	func yyParseContext(ctx context.Context, yylex yyLexer) error
+//	func (p *yyParser) ParseContext(ctx context.Context, yylex yyLexer) error
+//
+// which check ctx every n parser steps and abort the parse, returning
+// ctx.Err(), when ctx is done. Otherwise they are like yyParseErr.
+//
+// 2026-10-16: The parser output always declares the parser instance type
+// yyParser, formerly declared only with %pure, and
+//
+//	func NewYYParser() *yyParser
+//	func (p *yyParser) Parse(yylex yyLexer) int
+//	func (p *yyParser) ParseErr(yylex yyLexer) error
+//	func (p *yyParser) Reset()
+//
+// where YY is the -p prefix upper cased. A parser instance reuses its stack
+// across parses, unless -pool is used, avoiding an allocation per parse in
+// services parsing many small inputs. Reset releases the semantic values
+// referenced by the stack.
+//
+// 2026-10-16: The new function
+//
+//	func yyParseErr(yylex yyLexer) error
+//
+// is like yyParse but returns the first syntax error, even if an error rule
+// recovered from it, as a *yySyntaxError having the parser state, the
+// offending token, the expected tokens, the input position if the lexer
+// implements yyLexerPos, and the message passed to the Error method of the
+// lexer. With %pure, the parser has the method ParseErr too.
+//
+// 2026-10-16: The parser output always declares the functions
+//
+//	func yyExpectedTokens(state int) []int
+//	func yyExpectedNames(state int) []string
+//
+// returning the tokens, or their names, having an action in a parser state,
+// for completion suggestions and diagnostics. yyExpectedTokens replaces
+// yyExpected of %lexer-feedback.
+//
+// 2026-10-16: The new directive %checkpoint supports incremental reparsing. If
+// the lexer implements
+//
+//	type yyCheckpointer interface {
+//		WantCheckpoint(depth int) bool
+//		Checkpoint(cp *yyCheckpoint)
+//	}
+//
+// the parser offers it to save its state before reading a token, eg. at
+// shallow stack depths between top level declarations, and the new function
+// yyResume(yylex, cp), or the method Resume with %pure, continues a parse from
+// a saved state with the lexer positioned at the corresponding token. Editors
+// can then reparse only the input following the last checkpoint before an
+// edit.
+//
+// 2026-10-16: With
+//
+//	%define api.push-pull push
+//
+// the parser output adds a push parser API for applications receiving the
+// tokens incrementally, like network protocol handlers and editors.
+//
+//	p := yyNewParser()
+//	for ... {
+//		switch p.Push(tok, &lval) {
+//		case yyPushMore:
+//			// Push the next token.
+//		case yyPushAccepted, yyPushError:
+//			// Done, p.Errs has the syntax errors, if any.
+//		}
+//	}
+//
+// Push runs the parser until it needs the next token, keeping the parser
+// state and stack in p, so an abandoned parser needs no cleanup.
+// The fields of the embedded yyParser, like MaxDepth, Tracer and Debug, apply
+// to the parse. The push parser cannot be used with -lexer, -pool or -repair.
+//
+// 2026-10-16: The new directive
+//
+//	%build-tags "expr"
+//
+// adds the build constraint //go:build expr to the parser output, so variant
+// grammars can generate platform or version specific parsers. If -tags is
+// given too, the parser output requires both expressions.
+//
+// 2026-10-16: With
+//
+//	%define parse.error detailed
+//
+// a syntax error not matched by a -xe example reports the tokens having an
+// action in the parser state, like "unexpected ')', expecting IDENT or '('".
+// The default, %define parse.error simple, keeps the previous messages.
+//
+// 2026-10-16: The end of input token can be renamed and renumbered, eg. to
+// share the token values with other tools, by
+//
+//	%eof NAME
+//	%eof NAME N
+//
+// or by the -eof name[=value] option, which takes precedence. The parser
+// declares the constant NAME, yyEofCode becomes its alias. Lexers can return
+// either the value of NAME or, as before, zero or a negative value at the end
+// of the input.
+//
+// 2026-10-16: The grammar can set the name prefix of the generated code with
+//
+//	%define api.prefix {name}
+//
+// instead of the -p option, which takes precedence. The prefix must be usable
+// as the start of Go identifiers. It is an error if a token name collides with
+// an identifier declared by the generated code, eg. token yyParse.
+//
+// 2026-10-16: The new directive %lexer-feedback supports context-sensitive
+// lexing, like telling typedef names from identifiers in C. If the lexer
+// implements
+//
+//	type yyLexerFeedback interface {
+//		ParserState(state int)
+//	}
+//
+// the parser passes it its current state before asking for the next token.
+// The generated functions
+//
+//	func yyExpected(state int) []int
+//	func yyExpects(state, tok int) bool
+//
+// return the tokens having an action in a parser state and report whether a
+// token has one.
+//
+// 2026-10-16: The new directive %token-table adds the exported table
+//
+//	var YyTokenTable []YyTokenInfo
+//
+//	type YyTokenInfo struct {
+//		Name    string // Token name, like NUM.
+//		Value   int
+//		Alias   string // String alias, like "number", if any.
+//		Keyword bool   // Declared by %token-caseless or the alias is the name in any case, like SELECT "select".
+//	}
+//
+// describing the named tokens in declaration order, where Yy is the -p prefix
+// with the first letter upper cased, so tools like formatters and completion
+// engines can use the token metadata without parsing the grammar.
+//
+// 2026-10-16: The actions in the parser output are preceded by //line
+// directives pointing to the grammar file, so panics, go vet and debuggers
+// report grammar positions. The -l option, previously ignored, disables them.
+//
+// 2026-10-16: The new directive %pure, or the new option -pure, generates a
+// parser without package level mutable state. The parser configuration moves
+// to the parser instance
+//
+//	type yyParser struct {
+//		Debug int // Replaces yyDebug.
+//	}
+//
+//	func (p *yyParser) Parse(yylex yyLexer) int
+//	func (p *yyParser) Overlay(name string, on bool) bool // With -overlay, replaces yyOverlay.
+//
+// so goroutines can parse concurrently using distinct parsers having
+// different settings. yyParse(yylex) parses using a new parser. goyacc
+// verifies that no function of the parser output modifies a package level
+// variable declared by the generated code.
+//
+// 2026-10-16: The new optional %lex section of the definitions section
+// declares the token patterns as regular expressions, like in
+//
+//	%lex {
+//		NUM	`[0-9]+`	{ lval.n, _ = strconv.Atoi(text) }
+//		'+'	`\+`
+//		_	`[ \t\n]+`
+//	}
+//
+// Each line has a token name, a character literal or _ for text to skip, the
+// pattern in the regexp/syntax format as a Go string literal and an optional
+// action, which can use lval and text, the matched text. Anchors and word
+// boundaries are not supported. goyacc then emits a DFA based lexer,
+//
+//	func yyNewScanner(src []byte) *yyScanner
+//
+// implementing yyLexer. The lexer returns the longest match, preferring the
+// rule listed first, or the next rune if no rule matches. Errors reported by
+// the parser are collected in its Errs field.
+//
+// 2026-10-16: The %union struct body is carried over to yySymType as written,
+// including the comments and struct tags of its fields, like in
+//
+//	// Semantic value.
+//	%union {
+//		// Node is the AST node.
+//		node Node `json:"node"`
+//		n    int  `json:"n,omitempty"` // Number value.
+//	}
+//
+// Comments immediately preceding %union become the doc comment of yySymType.
+//
+// 2026-10-16: The new command
+//
+//	goyacc bench run -corpus dir [-pkg dir] [-func name] [-o file] [-count n] [-benchtime t]
+//
+// benchmarks the generated parser package in the -pkg directory, "." by
+// default, on every file in the -corpus directory and writes the results,
+// ns/op, MB/s, B/op and allocs/op per file, as JSON to the -o file or to
+// standard output. The package must provide the function named by -func,
+// benchParse by default, of type func([]byte) error, which parses its
+// argument. The results record the goyacc version and the fingerprint of the
+// parser output, see yyFingerprint, and the version of the Go toolchain
+// running the benchmarks, so they can be compared across goyacc versions to
+// track the performance of the parse tables and the parser driver.
+//
+// 2026-10-16: The new directive
+//
+//	%package name
+//
+// and the new option -package name, which takes precedence, set the package
+// name of the parser output. A package clause in the prologue is not needed
+// then and if present, its package name is replaced.
+//
+// 2026-10-16: The new option -lexguard n adds a guard against lexers stuck
+// returning the same token. If the lexer implements
+//
+//	type yyLexerPos interface {
+//		Pos() int
+//	}
+//
+// the position of the tokens is taken into account too. The parse is aborted
+// when the lexer returns the same token, at the same position, n times in a
+// row without the parser shifting it, like during error recovery. Tokens
+// shifted at one position, like the virtual DEDENT tokens of an indentation
+// sensitive lexer, do not count. The diagnostic is reported using the Error
+// method of the lexer and yyParse returns 1.
+//
+// 2026-10-16: The new directives
+//
+//	%output "file"
+//	%file-prefix "prefix"
+//
+// set the name of the parser output and the prefix of the output and report
+// file names, prefix.go and prefix.output, in the grammar, so goyacc needs no
+// flags. The report name for %output "name.go" is name.output. The -o and -v
+// options take precedence.
+//
+// 2026-10-16: Precedence declarations of terminals and %prec annotations of
+// rules never used to resolve a conflict are reported as warnings.
+//
+// 2026-10-16: The new option -actionfuncs emits the action of rule N as the
+// function
+//
+//	func yyActionN(yylex yyLexer, yyVAL *yySymType, yyS []yySymType, yypt int)
+//
+// called from the reduction switch, so the actions can be unit tested and
+// show up as distinct frames in stack traces and profiles. The actions can
+// then use only yylex, yyVAL and the values of the rule components and they
+// cannot return from yyParse.
+//
+// 2026-10-16: The new option -lexer type makes yyLexer an alias of an existing
+// lexer interface or type, for example one shared by several parsers with
+// different -p prefixes in one package, instead of declaring a new interface.
+// The type must have the methods
+//
+//	Lex(lval *yySymType) int
+//	Error(s string)
+//
+// or, for an interface type, its dynamic values must have them. The optional
+// yyLexerEx interface is then declared with all three methods instead of
+// embedding yyLexer.
+//
+// 2026-10-16: Token values can be declared also like in
+//
+//	%token NAME = 300
+//
+// The new option -freeze file records the values of the named tokens in file.
+// If the file exists, it is an error if a token changed its value or if a
+// token uses the value recorded for another token. New tokens are added to
+// the file.
+//
+// 2026-10-16: The new option -overlay name[=value] generates the parse table
+// of the grammar with name undefined for %if and %ifdef, plus an overlay of
+// the table entries added by defining it. The overlay, disabled initially, is
+// toggled at runtime by the generated function
+//
+//	func yyOverlay(name string, on bool) bool
+//
+// so an experimental syntax can be enabled without building a separate
+// parser. goyacc verifies that the automata of the grammar without overlays
+// and of the grammar with each single overlay are the automaton of the
+// grammar with all overlays restricted to their table entries, ie. that an
+// overlay only adds actions and states and never changes an existing action.
+// Several overlays may be enabled at once. Table entries needing more than
+// one overlay are not supported.
+//
+// 2026-10-16: The new directive %token-caseless declares tokens like %token
+// and records them as case-insensitive keywords, like in
+//
+//	%token-caseless SELECT FROM ORDER_BY "order by"
+//
+// The keyword is the token alias, if any, otherwise the token name. The
+// generated function
+//
+//	func yyKeyword(s string) (int, bool)
+//
+// returns the token of the keyword s, compared case-insensitively, for use by
+// the lexer.
+//
+// 2026-10-16: The parser output no longer depends on the map iteration order
+// for symbols whose names differ only in case, and it is tested to be the same
+// when goyacc runs on 32 bit and 64 bit hosts.
+//
+// 2026-10-16: Support character range terminals like in
+//
+//	%token <c> 'a'..'z'
+//	%%
+//	ident: 'a'..'z' | ident 'a'..'z' | ident '0'..'9'
+//
+// A range is a single terminal matching any character from its first to its
+// last character, inclusive, as returned by the lexer. Declaring a range in a
+// %token directive is optional, it can be used to set its type. Ranges must not
+// overlap each other or the character literals of the grammar. The generated
+// parser translates ranges using the new sorted table yyXLATRanges instead of
+// an yyXLAT entry per character.
+//
+// 2026-10-16: Support expected conflict counts. In the definitions section
+//
+//	%expect N
+//	%expect-rr N
+//
+// declare the number of shift/reduce and reduce/reduce conflicts of the
+// grammar. Following a precedence declaration on the same line, like in
+//
+//	%left '+' '-' %expect 1
+//
+// they apply to the conflicts on the declared tokens instead. In a rule
+// alternative, like in
+//
+//	e: e '+' e %expect 1
+//
+// they apply to the conflicts involving reductions by that rule. A conflict
+// counts against the rule annotation first, then against the precedence
+// declaration and then against the global declaration. If any declaration
+// exists, all counts must match exactly, with undeclared counts being zero,
+// or goyacc fails.
+//
+// 2026-10-16: The new directive
+//
+//	%define api.state.type {T}
+//
+// sets the type of the yys state field of yySymType, where T is one of the
+// integer types byte, int, int8, int16, int32, int64, uint, uint8, uint16,
+// uint32 or uint64. Using a smaller type than the default int shrinks the
+// parser stack entries. It is an error if T cannot represent all the parser
+// states.
+//
+// 2026-10-16: The generated file starts with the standard marker
+//
+//	// Code generated by goyacc. DO NOT EDIT.
+//
+// The new option -tags expr adds the build constraint //go:build expr, for
+// example -tags '!codeanalysis'. The new option -gitattributes adds the parser
+// output to the .gitattributes file of its directory as linguist-generated.
+//
+// 2026-10-16: Support conditional sections of the grammar. Lines enclosed in
+//
+//	%ifdef NAME, %ifndef NAME, %if NAME, %if !NAME, %if NAME == value or %if NAME != value
+//	%elif ...
+//	%else
+//	%endif
+//
+// are included or excluded according to the new -D name[=value] options. %if
+// NAME is true if NAME is defined with a value other than empty, 0 or false.
+// The directives must be on a line of their own.
+//
+// 2026-10-16: The new option -outdir dir writes the parser output, when not
+// an absolute path, to the directory dir, creating it if necessary. If the
+// prologue has no package clause, the package name is the base name of dir.
+//
+// 2026-10-16: Support typed mid-rule actions like in
+//
+//	a: b <T>{ $$ = f($1) } c { g($2) }
+//
+// The value of the mid-rule action, $$ within the action and $2 in the
+// example above, is of type T. It is equivalent to using $<T>$ and $<T>2.
+//
+// 2026-10-16: The token constants are grouped by the %token, %left, %right,
+// %nonassoc or %precedence directive first declaring them, sorted by name
+// within a group. Comments preceding the directive and comments following a
+// token name on the same line are carried over to the generated constants.
+// The new exported variable YyTokens, where Yy is the -p prefix with the first
+// letter upper cased, lists the named token values in declaration order.
+//
+// 2026-10-16: Nonterminals having rules at more than one place of the grammar
+// are reported as warnings listing the definition sites in the order their
+// alternatives are merged. The new option -nodups makes them errors.
+//
+// 2026-10-16: The new directive
+//
+//	%define api.value.type {T}
+//
+// declares the semantic value to be of the single Go type T, typically an
+// interface type, instead of the %union struct. The value is available in
+// yySymType as the field value. Accesses to $N of symbols having a declared
+// %type <U>, and to $<U>N, are type asserted to U unless U is T.
+//
+// 2026-10-16: String literals declared as token aliases, like in
+//
+//	%token PLUS "+"
+//
+// can be used in place of the token name in rule bodies, %prec and precedence
+// declarations. The generated token constants are annotated with their
+// aliases.
+//
 // 2018-03-23: The new option -pool enables using sync.Pool to recycle parser
 // stacks.
 //
@@ -114,6 +1127,265 @@
 //
 // - Minor changes in parser debug output.
 //
+// Conflicts
+//
+// The option -conflicts json writes the conflicts of the grammar to standard
+// output as a JSON document, for tools like pull request bots and dashboards
+// tracking the conflicts of a grammar over time. For example
+//
+//	{
+//		"shiftReduce": 1,
+//		"reduceReduce": 0,
+//		"conflicts": [
+//			{
+//				"state": 4,
+//				"lookahead": "'+'",
+//				"kind": "shift/reduce",
+//				"shifts": [
+//					{
+//						"rule": 1,
+//						"text": "E: E '+' E",
+//						"position": "expr.y:5:4"
+//					}
+//				],
+//				"reduces": [
+//					{
+//						"rule": 1,
+//						"text": "E: E '+' E",
+//						"position": "expr.y:5:4"
+//					}
+//				],
+//				"resolution": "shift",
+//				"precedence": false
+//			}
+//		]
+//	}
+//
+// The counts are of the conflicts not resolved by precedence, which are
+// listed too, with precedence true. The states and rules are numbered like in
+// the report, state -1 is a conflict not in the parse table, and the
+// resolution is the action of the parse table, "shift", "reduce", with the
+// rule reduced, or "error" for %nonassoc.
+//
+// Headers
+//
+// The generated files start with the marker recognized by the Go tools and
+// linters, followed by the //go:build line of -tags and %build-tags, if any.
+//
+//	// Code generated by goyacc. DO NOT EDIT.
+//
+// The option -header text replaces the marker by the text/template text
+// executed with the fields
+//
+//	Command string // The goyacc command line, like goyacc -o y.go y.y.
+//	Grammar string // The grammar file name.
+//	SHA256  string // The hexadecimal SHA-256 hash of the grammar source.
+//
+// Each line of the result is prefixed by //, and one of them must have the
+// form Code generated ... DO NOT EDIT. For example
+//
+//	goyacc -header 'Code generated by {{.Command}}; DO NOT EDIT.
+//	Grammar {{.Grammar}} sha256:{{.SHA256}}' expr.y
+//
+// writes
+//
+//	// Code generated by goyacc -header ... expr.y; DO NOT EDIT.
+//	// Grammar expr.y sha256:5f1c...
+//
+// Fingerprints
+//
+// The generated parser declares the constants
+//
+//	yyFingerprint   = "sha256:9c0e..."
+//	yyGoyaccVersion = "v1.2.0"
+//
+// where the fingerprint is the SHA-256 hash of the grammar source, the goyacc
+// version and the options generating the parser, including -D. The options
+// naming the outputs, like -o and -outdir, and the ones selecting the
+// reports, the checks, the warnings and the profiles do not change it. The
+// version is the one of the goyacc module, or (devel) if goyacc was not built
+// from a module version. The grammar report starts with both, so tests and
+// build tooling can detect a parser generated from a different grammar or by
+// a different goyacc, like
+//
+//	if yyFingerprint != want {
+//		t.Fatalf("stale parser, run go generate")
+//	}
+//
+// Rule graphs
+//
+// The option -rulegraph file writes the graph of the nonterminals, an edge
+// from each nonterminal to the ones in the right hand sides of its rules.
+// The recursive strongly connected components, the sets of nonterminals
+// referencing each other, directly or not, are highlighted, as they are the
+// parts of a grammar that cannot be understood, or untangled, one
+// nonterminal at a time. As a Graphviz graph, render it like
+//
+//	goyacc -rulegraph rules.dot expr.y && dot -Tsvg rules.dot > rules.svg
+//
+// the components are red clusters and the start symbol is bold. As JSON the
+// document is
+//
+//	{
+//		"start": "expr",
+//		"nonterminals": [
+//			{
+//				"name": "expr",
+//				"rules": [1, 2],
+//				"references": ["expr", "term"],
+//				"component": 0
+//			},
+//			...
+//		],
+//		"components": [["expr"], ["list", "item"]]
+//	}
+//
+// where component is the index of the component of a nonterminal, -1 if
+// none.
+//
+// Coverage
+//
+// With -cover the parser counts the reductions of each rule, like go test
+// -cover counts the statements executed. The generated code declares
+//
+//	func yyCoverage() []uint64
+//	func yyWriteCoverage(w io.Writer) error
+//
+// yyCoverage returns the numbers of reductions of the rules, indexed by the
+// rule number as in the grammar report, by all the parsers of the program.
+// The counters are updated atomically, the parsers may run concurrently.
+// yyWriteCoverage writes them, one rule per line, followed by the share of
+// the rules reduced at least once, like
+//
+//	         3 rule 1 E: E '+' NUM
+//	         0 rule 2 E: NUM
+//	1 of 2 rules covered (50.0%)
+//
+// so a test parsing its corpus can report the productions it never
+// exercises, in TestMain for example
+//
+//	func TestMain(m *testing.M) {
+//		rc := m.Run()
+//		yyWriteCoverage(os.Stderr)
+//		os.Exit(rc)
+//	}
+//
+// With -pure the counters are fields of the parser, the methods Coverage and
+// WriteCoverage of yyParser report the reductions of that parser.
+//
+// Skeletons
+//
+// The option -skeleton file replaces the built-in parser by the output of the
+// text/template file, so alternative parser runtimes, like instrumented or
+// push parsers, need not fork goyacc. The output is formatted by gofmt, if
+// possible, and the data of the template has the fields
+//
+//	BuildConstraint string  // Expression of the //go:build line, if any.
+//	Fingerprint     string  // Like the yyFingerprint constant, see Fingerprints.
+//	Header          string  // The comment lines heading the output, see Headers.
+//	Prefix          string  // Name prefix of the generated code, like yy.
+//	Prologue        string  // With the package clause and the imports of the generated code.
+//	Rules           []Rule  // Rule 0 is $accept: start $end.
+//	Start           int     // The start symbol.
+//	StateType       string  // Type of the state field yys of SymType.
+//	States          []State // State 0 is the initial state.
+//	SymType         string  // The struct type of the semantic values, including yys.
+//	Symbols         []Symbol
+//	Tail            string  // The code following the second %%.
+//	Version         string  // The goyacc version, like v1.2.0 or (devel).
+//
+// where
+//
+//	type Symbol struct {
+//		Name     string // Like NUM, '+' or expr.
+//		Value    int    // Token value of a terminal, -1 for $default.
+//		Terminal bool
+//		Alias    string // String alias of a token, like "number", if any.
+//		Type     string // The SymType field or the type of the semantic value, if any.
+//	}
+//
+//	type Rule struct {
+//		Sym        int    // The left hand side.
+//		Components []int  // The right hand side.
+//		Action     string // The Go code of the action including the braces, if any.
+//		Text       string // Like expr: expr '+' term.
+//	}
+//
+//	type State struct {
+//		Actions []struct {
+//			Sym  int    // A terminal, $default is the action on the others.
+//			Kind string // "shift", "reduce" or "accept".
+//			Arg  int    // The shift target state or the rule reduced.
+//		}
+//		Gotos []struct{ Sym, State int }
+//	}
+//
+// The symbols are referred to by their index in Symbols. The actions refer to
+// $$ as yyVAL and to $n as yyS[yypt-k], where k is the number of components
+// following n, like in the built-in parser. The imports of the prologue named
+// like __yyfmt__ "fmt" are removed if the output does not use them. For
+// example the template
+//
+//	{{.Prologue}}
+//
+//	type {{.Prefix}}SymType {{.SymType}}
+//
+//	func {{.Prefix}}Reduce(r int, yyVAL *{{.Prefix}}SymType, yyS []{{.Prefix}}SymType, yypt int) {
+//		switch r { {{- range $i, $r := .Rules}}{{if $r.Action}}
+//		case {{$i}}: // {{$r.Text}}
+//			{{$r.Action}}{{end}}{{end}}
+//		}
+//	}
+//
+//	{{.Tail}}
+//
+// generates the semantic actions of a parser.
+//
+// Warnings
+//
+// Each warning belongs to a category, named in the message like in
+//
+//	expr.y:7:1: nonterminal term useless in grammar [-Wuseless]
+//
+// The categories are
+//
+//	counterexamples  the derivations of a conflict not resolved by precedence
+//	default-action   a rule of a typed nonterminal without an action, whose $1
+//	                 has another type or which is empty
+//	duplicate        a nonterminal defined at more than one place
+//	empty-rule       an empty rule alternative not marked %empty, like in a: %empty | b
+//	identical        a rule alternative identical to another one
+//	lex              a token produced by no rule of the %lex section
+//	never-reduced    a rule never reduced as it loses all its conflicts
+//	precedence       a precedence declaration or %prec never resolving a conflict
+//	type             a symbol declared with different <type>s
+//	unused           a token used by no rule
+//	useless          a nonterminal or rule not deriving a sentence from the start symbol
+//
+// A counterexample shows a shortest sentential form reaching the conflict, with
+// a • at the lookahead, and the competing derivations of the conflicting
+// actions, like in
+//
+//	expr.y:9:4: shift/reduce conflict on '+' in state 4 [-Wcounterexamples]
+//	  Example: e '+' e • '+' e
+//	  Shift derivation: e → [ e '+' e → [ e • '+' e ] ]
+//	  Reduce derivation: e → [ e → [ e '+' e • ] '+' e ]
+//
+// The categories counterexamples, default-action, empty-rule, identical, lex
+// and never-reduced are disabled by default, the others enabled. The option
+// -Wcategory enables a category and -Wno-category disables it, -Wall and
+// -Wno-all do the same for the categories not set otherwise. With -Werror
+// goyacc fails on the enabled warnings.
+//
+// The command
+//
+//	goyacc vet [options] [input]
+//
+// analyzes the grammar like -n, without writing any files, with all the
+// categories enabled unless disabled by -Wno-category, and fails if there are
+// any warnings. The uses of $n of symbols without a type, when there is a
+// %union, are errors, as always.
+//
 // Links
 //
 // Referenced from elsewhere:
@@ -125,756 +1397,197 @@
 package main
 
 import (
-	"bufio"
-	"bytes"
 	"flag"
 	"fmt"
-	"go/format"
 	"go/scanner"
-	"go/token"
-	"io"
-	"io/ioutil"
 	"log"
 	"os"
-	"sort"
 	"strconv"
-	"strings"
 
-	"github.com/cznic/mathutil"
-	"github.com/cznic/parser/yacc"
-	"github.com/cznic/sortutil"
-	"github.com/cznic/strutil"
-	"github.com/cznic/y"
+	"github.com/cznic/goyacc/gen"
 )
 
-var (
-	oClosures   = flag.Bool("c", false, "report state closures")
-	oDlval      = flag.String("dlval", "lval", "debug value (runtime yyDebug >= 3)")
-	oDlvalf     = flag.String("dlvalf", "%+v", "debug format of -dlval (runtime yyDebug >= 3)")
-	oFollowSets = flag.Bool("fs", false, "emit the follow set table")
-	oLA         = flag.Bool("la", false, "report all lookahead sets")
-	oNoLines    = flag.Bool("l", false, "disable line directives (for compatibility ony - ignored)")
-	oOut        = flag.String("o", "y.go", "parser output")
-	oPool       = flag.Bool("pool", false, "uses sync.Pool to recycle parser stacks")
-	oPref       = flag.String("p", "yy", "name prefix to use in generated code")
-	oReducible  = flag.Bool("cr", false, "check all states are reducible")
-	oReport     = flag.String("v", "y.output", "create grammar report")
-	oResolved   = flag.Bool("ex", false, "explain how were conflicts resolved")
-	oXErrors    = flag.String("xe", "", "generate eXtra errors from examples source file")
-	oXErrorsGen = flag.String("xegen", "", "generate error from examples source file automatically from the grammar")
-)
+var o = gen.NewOptions() // Set by the flags.
 
-func main() {
-	log.SetFlags(0)
-	flag.Parse()
-	var in string
-	switch flag.NArg() {
-	case 0:
-		in = os.Stdin.Name()
-	case 1:
-		in = flag.Arg(0)
-	default:
-		log.Fatal("expected at most one non flag argument")
-	}
-
-	if err := main1(in); err != nil {
-		switch x := err.(type) {
-		case scanner.ErrorList:
-			for _, v := range x {
-				fmt.Fprintf(os.Stderr, "%v\n", v)
-			}
-			os.Exit(1)
-		default:
-			log.Fatal(err)
-		}
-	}
-}
-
-type symUsed struct {
-	sym  *y.Symbol
-	used int
+// warningFlag is the boolean flag Wcategory, or Wno-category if not on.
+type warningFlag struct {
+	category string
+	on       bool
 }
 
-type symsUsed []symUsed
-
-func (s symsUsed) Len() int      { return len(s) }
-func (s symsUsed) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
+func (w warningFlag) IsBoolFlag() bool { return true }
+func (w warningFlag) String() string   { return "" }
 
-func (s symsUsed) Less(i, j int) bool {
-	if s[i].used > s[j].used {
-		return true
-	}
-
-	if s[i].used < s[j].used {
-		return false
-	}
-
-	return strings.ToLower(s[i].sym.Name) < strings.ToLower(s[j].sym.Name)
-}
-
-func main1(in string) (err error) {
-	var out io.Writer
-	if nm := *oOut; nm != "" {
-		var f *os.File
-		var e error
-		if f, err = os.Create(nm); err != nil {
-			return err
-		}
-
-		defer func() {
-			if e := f.Close(); e != nil && err == nil {
-				err = e
-			}
-		}()
-		w := bufio.NewWriter(f)
-		defer func() {
-			if e := w.Flush(); e != nil && err == nil {
-				err = e
-			}
-		}()
-		buf := bytes.NewBuffer(nil)
-		out = buf
-		defer func() {
-			var dest []byte
-			if dest, e = format.Source(buf.Bytes()); e != nil {
-				dest = buf.Bytes()
-			}
-
-			if _, e = w.Write(dest); e != nil && err == nil {
-				err = e
-			}
-		}()
-	}
-
-	var rep io.Writer
-	if nm := *oReport; nm != "" {
-		f, err := os.Create(nm)
-		if err != nil {
-			return err
-		}
-
-		defer func() {
-			if e := f.Close(); e != nil && err == nil {
-				err = e
-			}
-		}()
-		w := bufio.NewWriter(f)
-		defer func() {
-			if e := w.Flush(); e != nil && err == nil {
-				err = e
-			}
-		}()
-		rep = w
-	}
-
-	var xerrors []byte
-	if nm := *oXErrors; nm != "" {
-		b, err := ioutil.ReadFile(nm)
-		if err != nil {
-			return err
-		}
-
-		xerrors = b
-	}
-
-	p, err := y.ProcessFile(token.NewFileSet(), in, &y.Options{
-		//NoDefault:   *oNoDefault,
-		AllowConflicts: true,
-		Closures:       *oClosures,
-		LA:             *oLA,
-		Reducible:      *oReducible,
-		Report:         rep,
-		Resolved:       *oResolved,
-		XErrorsName:    *oXErrors,
-		XErrorsSrc:     xerrors,
-	})
+func (w warningFlag) Set(s string) error {
+	v, err := strconv.ParseBool(s)
 	if err != nil {
 		return err
 	}
 
-	if fn := *oXErrorsGen; fn != "" {
-		f, err := os.OpenFile(fn, os.O_RDWR|os.O_CREATE, 0666)
-		if err != nil {
-			return err
-		}
-
-		b := bufio.NewWriter(f)
-		if err := p.SkeletonXErrors(b); err != nil {
-			return err
-		}
-
-		if err := b.Flush(); err != nil {
-			return err
-		}
-
-		if err := f.Close(); err != nil {
-			return err
-		}
-	}
-
-	msu := make(map[*y.Symbol]int, len(p.Syms)) // sym -> usage
-	for nm, sym := range p.Syms {
-		if nm == "" || nm == "ε" || nm == "$accept" || nm == "#" {
-			continue
-		}
-
-		msu[sym] = 0
-	}
-	var minArg, maxArg int
-	for _, state := range p.Table {
-		for _, act := range state {
-			msu[act.Sym]++
-			k, arg := act.Kind()
-			if k == 'a' {
-				continue
-			}
-
-			if k == 'r' {
-				arg = -arg
-			}
-			minArg, maxArg = mathutil.Min(minArg, arg), mathutil.Max(maxArg, arg)
-		}
-	}
-	su := make(symsUsed, 0, len(msu))
-	for sym, used := range msu {
-		su = append(su, symUsed{sym, used})
-	}
-	sort.Sort(su)
-
-	// ----------------------------------------------------------- Prologue
-	f := strutil.IndentFormatter(out, "\t")
-	f.Format("// Code generated by goyacc - DO NOT EDIT.\n\n")
-	f.Format("%s", injectImport(p.Prologue))
-	if *oPool {
-		f.Format(`
-var %[1]sPool = __sync__.Pool{New: func() interface{} { s := make([]%[1]sSymType, 200); return &s }}
-`, *oPref)
-	}
-	f.Format(`
-type %[1]sSymType %i%s%u
-
-type %[1]sXError struct {
-	state, xsym int
+	o.Warnings[w.category] = v == w.on
+	return nil
 }
-`, *oPref, p.UnionSrc)
 
-	// ---------------------------------------------------------- Constants
-	nsyms := map[string]*y.Symbol{}
-	a := make([]string, 0, len(msu))
-	maxTokName := 0
-	for sym := range msu {
-		nm := sym.Name
-		if nm == "$default" || nm == "$end" || sym.IsTerminal && nm[0] != '\'' && sym.Value > 0 {
-			maxTokName = mathutil.Max(maxTokName, len(nm))
-			a = append(a, nm)
-		}
-		nsyms[nm] = sym
+func init() {
+	flag.Var(o.Defines, "D", "define name[=value] for %if and %ifdef (can be repeated)")
+	flag.Var(o.Overlays, "overlay", "define name[=value] in a runtime parse table overlay (can be repeated)")
+	for _, c := range gen.WarningCategories() {
+		flag.Var(warningFlag{c, true}, "W"+c, "enable the "+c+" warnings")
+		flag.Var(warningFlag{c, false}, "Wno-"+c, "disable the "+c+" warnings")
 	}
-	sort.Strings(a)
-	f.Format("\nconst (%i\n")
-	maxTokName += len(*oPref)
-	for _, v := range a {
-		nm := v
-		switch nm {
-		case "error":
-			nm = *oPref + "ErrCode"
-		case "$default":
-			nm = *oPref + "Default"
-		case "$end":
-			nm = *oPref + "EofCode"
-		}
-		f.Format("%s%s = %d\n", nm, strings.Repeat(" ", maxTokName-len(nm)+1), nsyms[v].Value)
-	}
-	minArg-- // eg: [-13, 42], minArg -14 maps -13 to 1 so zero cell values -> empty.
-	f.Format("\n%sMaxDepth = 200\n", *oPref)
-	f.Format("%sTabOfs   = %d\n", *oPref, minArg)
-	f.Format("%u)")
-
-	// ---------------------------------------------------------- Variables
-	f.Format("\n\nvar (%i\n")
-
-	f.Format("\n%sPrec = map[int]int{%i\n", *oPref)
-	for i, v := range p.AssocDefs {
-		for _, w := range v.Syms {
-			if !w.IsTerminal {
-				continue
-			}
-
-			f.Format("%s: %v,\n", w.Name, i)
-		}
-	}
-	f.Format("}%u\n\n")
-
-	if *oFollowSets {
-		f.Format("%sFollow = [][]int{%i\n", *oPref)
-		for state, action := range p.Table {
-			f.Format("{")
-			for _, a := range action {
-				f.Format("%v, ", a.Sym.Value)
-			}
-			f.Format("}, // state %v\n", state)
-		}
-		f.Format("%u}\n\n")
-	}
-
-	// Lex translation table
-	f.Format("%sXLAT = map[int]int{%i\n", *oPref)
-	xlat := make(map[int]int, len(su))
-	var errSym int
-	for i, v := range su {
-		if v.sym.Name == "error" {
-			errSym = i
-		}
-		xlat[v.sym.Value] = i
-		f.Format("%6d: %3d, // %s (%dx)\n", v.sym.Value, i, v.sym.Name, msu[v.sym])
-	}
-	f.Format("%u}\n")
-
-	// Symbol names
-	f.Format("\n%sSymNames = []string{%i\n", *oPref)
-	for _, v := range su {
-		f.Format("%q,\n", strings.TrimSpace(v.sym.Name))
-	}
-	f.Format("%u}\n")
-
-	// Token literal strings
-	f.Format("\n%sTokenLiteralStrings = map[int]string{%i\n", *oPref)
-	for _, v := range su {
-		if sym := v.sym; sym.IsTerminal {
-			ls := sym.LiteralString
-			ls, _ = strconv.Unquote(ls)
-			ls = strings.TrimSpace(ls)
-			if ls == "" {
-				continue
-			}
-
-			f.Format("%d: %q,\n", sym.Value, ls)
-		}
-	}
-	f.Format("%u}\n")
-
-	// Reduction table
-	f.Format("\n%sReductions = map[int]struct{xsym, components int}{%i\n", *oPref)
-	for r, rule := range p.Rules {
-		f.Format("%d: {%d, %d},\n", r, xlat[rule.Sym.Value], len(rule.Components))
-	}
-	f.Format("%u}\n")
-
-	// XError table
-	f.Format("\n%[1]sXErrors = map[%[1]sXError]string{%i\n", *oPref)
-	for _, xerr := range p.XErrors {
-		state := xerr.Stack[len(xerr.Stack)-1]
-		xsym := -1
-		if xerr.Lookahead != nil {
-			xsym = xlat[xerr.Lookahead.Value]
-		}
-		f.Format("%[1]sXError{%d, %d}: \"%s\",\n", *oPref, state, xsym, xerr.Msg)
-	}
-	f.Format("%u}\n\n")
-
-	// Parse table
-	tbits := 32
-	switch n := mathutil.BitLen(maxArg - minArg + 1); {
-	case n < 8:
-		tbits = 8
-	case n < 16:
-		tbits = 16
-	}
-	f.Format("%sParseTab = [%d][]uint%d{%i\n", *oPref, len(p.Table), tbits)
-	nCells := 0
-	var tabRow sortutil.Uint64Slice
-	for si, state := range p.Table {
-		tabRow = tabRow[:0]
-		max := 0
-		for _, act := range state {
-			sym := act.Sym
-			xsym, ok := xlat[sym.Value]
-			if !ok {
-				panic("internal error 001")
-			}
-
-			max = mathutil.Max(max, xsym)
-			kind, arg := act.Kind()
-			switch kind {
-			case 'a':
-				arg = 0
-			case 'r':
-				arg *= -1
-			}
-			tabRow = append(tabRow, uint64(xsym)<<32|uint64(arg-minArg))
-		}
-		nCells += max
-		tabRow.Sort()
-		col := -1
-		if si%5 == 0 {
-			f.Format("// %d\n", si)
-		}
-		f.Format("{")
-		for i, v := range tabRow {
-			xsym := int(uint32(v >> 32))
-			arg := int(uint32(v))
-			if col+1 != xsym {
-				f.Format("%d: ", xsym)
-			}
-			switch {
-			case i == len(tabRow)-1:
-				f.Format("%d", arg)
-			default:
-				f.Format("%d, ", arg)
-			}
-			col = xsym
-		}
-		f.Format("},\n")
-	}
-	f.Format("%u}\n")
-	fmt.Fprintf(os.Stderr, "Parse table entries: %d of %d, x %d bits == %d bytes\n", nCells, len(p.Table)*len(msu), tbits, nCells*tbits/8)
-	if n := p.ConflictsSR; n != 0 {
-		fmt.Fprintf(os.Stderr, "conflicts: %d shift/reduce\n", n)
-	}
-	if n := p.ConflictsRR; n != 0 {
-		fmt.Fprintf(os.Stderr, "conflicts: %d reduce/reduce\n", n)
-	}
-
-	makeYYS := fmt.Sprintf("yyS := make([]%[1]sSymType, 200)\n", *oPref)
-	if *oPool {
-		makeYYS = fmt.Sprintf(`p := %[1]sPool.Get().(*[]%[1]sSymType)
-yyS := *p
-
-defer func() {
-	var v %[1]sSymType
-	for i := range yyS {
-		yyS[i] = v
-	}
-	%[1]sPool.Put(p)
-}()
-`, *oPref)
-	}
-
-	f.Format(`%u)
-
-var %[1]sDebug = 0
-
-type %[1]sLexer interface {
-	Lex(lval *%[1]sSymType) int
-	Error(s string)
+	flag.Var(warningFlag{"all", true}, "Wall", "enable all the warnings")
+	flag.Var(warningFlag{"all", false}, "Wno-all", "disable all the warnings")
+	flag.BoolVar(&o.ActionFuncs, "actionfuncs", o.ActionFuncs, "emit the rule actions as separate functions")
+	flag.BoolVar(&o.ActionPanic, "actionpanic", o.ActionPanic, "re-panic in the rule actions with the rule and its grammar position")
+	flag.BoolVar(&o.Bench, "bench", o.Bench, "write a parser benchmark to the output name with suffix _bench_test.go")
+	flag.StringVar(&o.CPUProfile, "cpuprofile", o.CPUProfile, "write a CPU profile of the generation to this file")
+	flag.IntVar(&o.Cancel, "cancel", o.Cancel, "add ParseContext checking the context every n parser steps")
+	flag.BoolVar(&o.Check, "check", o.Check, "compare the parser output to the existing file instead of writing any files")
+	flag.BoolVar(&o.Closures, "c", o.Closures, "report state closures")
+	flag.StringVar(&o.Conflicts, "conflicts", o.Conflicts, "write the conflicts to standard output in this format, json")
+	flag.BoolVar(&o.Cover, "cover", o.Cover, "count the reductions of each rule, reported by yyCoverage and yyWriteCoverage")
+	flag.StringVar(&o.DebugTag, "debugtag", o.DebugTag, "build tag enabling the parser debug code, which is removed without it")
+	flag.BoolVar(&o.Derivations, "derivations", o.Derivations, "add the derivations from the start symbol reaching the conflicts to the grammar report")
+	flag.StringVar(&o.Dlval, "dlval", o.Dlval, "debug value (runtime yyDebug >= 3)")
+	flag.StringVar(&o.Dlvalf, "dlvalf", o.Dlvalf, "debug format of -dlval (runtime yyDebug >= 3)")
+	flag.StringVar(&o.Dot, "dot", o.Dot, "write the LALR automaton as a Graphviz graph to this file")
+	flag.BoolVar(&o.DotConflicts, "dotconflicts", o.DotConflicts, "limit -dot to the states having conflicts and their predecessors")
+	flag.StringVar(&o.EOF, "eof", o.EOF, "name[=value] of the end of input token, overrides %eof")
+	flag.StringVar(&o.Embed, "embed", o.Embed, "store the grammar source in the parser, as text or gzip, returned by yyGrammar")
+	flag.BoolVar(&o.FollowSets, "fs", o.FollowSets, "emit the follow set table")
+	flag.StringVar(&o.Freeze, "freeze", o.Freeze, "file recording the token values, existing values must not change")
+	flag.BoolVar(&o.GitAttributes, "gitattributes", o.GitAttributes, "mark the parser output linguist-generated in .gitattributes")
+	flag.StringVar(&o.Header, "header", o.Header, "text/template of the comment heading the generated files")
+	flag.StringVar(&o.JSON, "json", o.JSON, "write the parse tables, symbols, rules and conflicts as JSON to this file")
+	flag.BoolVar(&o.JSONTrace, "jsontrace", o.JSONTrace, "add the JSON trace of the parser actions")
+	flag.BoolVar(&o.LA, "la", o.LA, "report all lookahead sets")
+	flag.IntVar(&o.LexGuard, "lexguard", o.LexGuard, "abort the parse if the lexer returns the same token this many times without progress")
+	flag.StringVar(&o.Lexer, "lexer", o.Lexer, "use the existing lexer type instead of declaring the yyLexer interface")
+	flag.IntVar(&o.MaxDepth, "maxdepth", o.MaxDepth, "default parser stack depth limit, 0 for no limit")
+	flag.IntVar(&o.MaxErrors, "maxerrors", o.MaxErrors, "default syntax errors limit, 0 for no limit")
+	flag.IntVar(&o.MaxSteps, "maxsteps", o.MaxSteps, "default limit of the parser shifts and reductions, 0 for no limit")
+	flag.StringVar(&o.MemProfile, "memprofile", o.MemProfile, "write a memory profile of the generation to this file")
+	flag.BoolVar(&o.NoDups, "nodups", o.NoDups, "forbid defining a nonterminal at more than one place")
+	flag.BoolVar(&o.NoLines, "l", o.NoLines, "disable the line directives mapping actions to the grammar")
+	flag.BoolVar(&o.NoOutput, "n", o.NoOutput, "analyze the grammar without writing any files, except the -v report")
+	flag.StringVar(&o.Out, "o", o.Out, "parser output, - for standard output")
+	flag.StringVar(&o.OutDir, "outdir", o.OutDir, "directory of the parser output, created if necessary")
+	flag.StringVar(&o.Package, "package", o.Package, "package name of the parser output")
+	flag.BoolVar(&o.Pool, "pool", o.Pool, "uses sync.Pool to recycle parser stacks")
+	flag.BoolVar(&o.PoolBench, "poolbench", o.PoolBench, "with -pool, write parser stack benchmarks to the output name with suffix _pool_test.go")
+	flag.StringVar(&o.Prefix, "p", o.Prefix, "name prefix to use in generated code, overrides %define api.prefix")
+	flag.BoolVar(&o.Profile, "profile", o.Profile, "report the time spent in the phases of the generation")
+	flag.BoolVar(&o.PtrStack, "ptrstack", o.PtrStack, "keep pointers to the semantic values on the parser stack")
+	flag.BoolVar(&o.Pure, "pure", o.Pure, "generate a parser without package level mutable state")
+	flag.BoolVar(&o.RaceGuard, "raceguard", o.RaceGuard, "panic when a parser instance is used by more than one goroutine at a time")
+	flag.BoolVar(&o.Reducible, "cr", o.Reducible, "check all states are reducible")
+	flag.BoolVar(&o.Repair, "repair", o.Repair, "suggest single token insertion or deletion repairs in syntax errors")
+	flag.StringVar(&o.Report, "v", o.Report, "create grammar report")
+	flag.StringVar(&o.ReportFormat, "report", o.ReportFormat, "format of the grammar report, text, html, json or markdown")
+	flag.StringVar(&o.ReportStates, "reportstates", o.ReportStates, "comma separated states the grammar report is limited to, with their neighbors")
+	flag.StringVar(&o.ReportSymbols, "reportsymbols", o.ReportSymbols, "comma separated symbols the grammar report is limited to the states of, with their neighbors")
+	flag.BoolVar(&o.Resolved, "ex", o.Resolved, "explain how were conflicts resolved")
+	flag.StringVar(&o.RuleGraph, "rulegraph", o.RuleGraph, "write the graph of the nonterminals referencing each other to this file, as JSON if it ends in .json, as a Graphviz graph otherwise")
+	flag.StringVar(&o.Skeleton, "skeleton", o.Skeleton, "text/template file generating the parser output instead of the built-in one")
+	flag.StringVar(&o.SrcName, "src-name", o.SrcName, "name of the grammar in the diagnostics and the line directives, like when read from standard input")
+	flag.IntVar(&o.Stack, "stack", o.Stack, "initial parser stack capacity")
+	flag.BoolVar(&o.Strict, "strict", o.Strict, "fail on the conflicts not expected by %expect and %expect-rr")
+	flag.StringVar(&o.Tags, "tags", o.Tags, "build constraint expression of the generated //go:build line")
+	flag.StringVar(&o.Tokens, "tokens", o.Tokens, "write the token constants, names and aliases to this file of another package")
+	flag.BoolVar(&o.Watch, "watch", o.Watch, "generate the outputs again whenever the grammar changes")
+	flag.BoolVar(&o.Werror, "Werror", o.Werror, "make the warnings errors")
+	flag.StringVar(&o.XErrors, "xe", o.XErrors, "generate eXtra errors from examples source file")
+	flag.StringVar(&o.XErrorsGen, "xegen", o.XErrorsGen, "generate error from examples source file automatically from the grammar")
+	flag.Usage = usage
 }
 
-type %[1]sLexerEx interface {
-	%[1]sLexer
-	Reduced(rule, state int, lval *%[1]sSymType) bool
+// commands are the goyacc commands, see Usage.
+var commands = []struct{ name, doc string }{
+	{"bench", "benchmark the parser of a grammar on a corpus"},
+	{"diff", "compare the automatons of two grammars"},
+	{"fmt", "format grammar files"},
+	{"gen", "generate the parser, the default"},
+	{"help", "show this help"},
+	{"lint", "report all the warnings of a grammar, like vet"},
+	{"report", "write the grammar report only"},
+	{"vet", "report all the warnings of a grammar"},
 }
 
-func %[1]sSymName(c int) (s string) {
-	x, ok := %[1]sXLAT[c]
-	if ok {
-		return %[1]sSymNames[x]
+func usage() {
+	w := flag.CommandLine.Output()
+	fmt.Fprintf(w, "usage: goyacc [command] [options] [input]\n\ncommands:\n")
+	for _, c := range commands {
+		fmt.Fprintf(w, "  %-8s %s\n", c.name, c.doc)
 	}
-
-	if c < 0x7f {
-		return __yyfmt__.Sprintf("%%q", c)
-	}
-
-	return __yyfmt__.Sprintf("%%d", c)
-}
-
-func %[1]slex1(yylex %[1]sLexer, lval *%[1]sSymType) (n int) {
-	n = yylex.Lex(lval)
-	if n <= 0 {
-		n = %[1]sEofCode
-	}
-	if %[1]sDebug >= 3 {
-		__yyfmt__.Printf("\nlex %%s(%%#x %%d), %[4]s: %[3]s\n", %[1]sSymName(n), n, n, %[4]s)
-	}
-	return n
+	fmt.Fprintf(w, "\noptions:\n")
+	flag.PrintDefaults()
 }
-	
-func %[1]sParse(yylex %[1]sLexer) int {
-	const yyError = %[2]d
-
-	yyEx, _ := yylex.(%[1]sLexerEx)
-	var yyn int
-	var yylval %[1]sSymType
-	var yyVAL %[1]sSymType
-	%[5]s
-
-	Nerrs := 0   /* number of errors */
-	Errflag := 0 /* error recovery flag */
-	yyerrok := func() { 
-		if %[1]sDebug >= 2 {
-			__yyfmt__.Printf("yyerrok()\n")
-		}
-		Errflag = 0
-	}
-	_ = yyerrok
-	yystate := 0
-	yychar := -1
-	var yyxchar int
-	var yyshift int
-	yyp := -1
-	goto yystack
-
-ret0:
-	return 0
-
-ret1:
-	return 1
-
-yystack:
-	/* put a state and value onto the stack */
-	yyp++
-	if yyp >= len(yyS) {
-		nyys := make([]%[1]sSymType, len(yyS)*2)
-		copy(nyys, yyS)
-		yyS = nyys
-	}
-	yyS[yyp] = yyVAL
-	yyS[yyp].yys = yystate
-
-yynewstate:
-	if yychar < 0 {
-		yylval.yys = yystate
-		yychar = %[1]slex1(yylex, &yylval)
-		var ok bool
-		if yyxchar, ok = %[1]sXLAT[yychar]; !ok {
-			yyxchar = len(%[1]sSymNames) // > tab width
-		}
-	}
-	if %[1]sDebug >= 4 {
-		var a []int
-		for _, v := range yyS[:yyp+1] {
-			a = append(a, v.yys)
-		}
-		__yyfmt__.Printf("state stack %%v\n", a)
-	}
-	row := %[1]sParseTab[yystate]
-	yyn = 0
-	if yyxchar < len(row) {
-		if yyn = int(row[yyxchar]); yyn != 0 {
-			yyn += %[1]sTabOfs
-		}
-	}
-	switch {
-	case yyn > 0: // shift
-		yychar = -1
-		yyVAL = yylval
-		yystate = yyn
-		yyshift = yyn
-		if %[1]sDebug >= 2 {
-			__yyfmt__.Printf("shift, and goto state %%d\n", yystate)
-		}
-		if Errflag > 0 {
-			Errflag--
-		}
-		goto yystack
-	case yyn < 0: // reduce
-	case yystate == 1: // accept
-		if %[1]sDebug >= 2 {
-			__yyfmt__.Println("accept")
-		}
-		goto ret0
-	}
-
-	if yyn == 0 {
-		/* error ... attempt to resume parsing */
-		switch Errflag {
-		case 0: /* brand new error */
-			if %[1]sDebug >= 1 {
-				__yyfmt__.Printf("no action for %%s in state %%d\n", %[1]sSymName(yychar), yystate)
-			}
-			msg, ok := %[1]sXErrors[%[1]sXError{yystate, yyxchar}]
-			if !ok {
-				msg, ok = %[1]sXErrors[%[1]sXError{yystate, -1}]
-			}
-			if !ok && yyshift != 0 {
-				msg, ok = %[1]sXErrors[%[1]sXError{yyshift, yyxchar}]
-			}
-			if !ok {
-				msg, ok = %[1]sXErrors[%[1]sXError{yyshift, -1}]
-			}
-			if yychar > 0 {
-				ls := %[1]sTokenLiteralStrings[yychar]
-				if ls == "" {
-					ls = %[1]sSymName(yychar)
-				}
-				if ls != "" {
-					switch {
-					case msg == "":
-						msg = __yyfmt__.Sprintf("unexpected %%s", ls)
-					default:
-						msg = __yyfmt__.Sprintf("unexpected %%s, %%s", ls, msg)
-					}
-				}
-			}
-			if msg == "" {
-				msg = "syntax error"
-			}
-			yylex.Error(msg)
-			Nerrs++
-			fallthrough
-
-		case 1, 2: /* incompletely recovered error ... try again */
-			Errflag = 3
-
-			/* find a state where "error" is a legal shift action */
-			for yyp >= 0 {
-				row := %[1]sParseTab[yyS[yyp].yys]
-				if yyError < len(row) {
-					yyn = int(row[yyError])+%[1]sTabOfs
-					if yyn > 0 { // hit
-						if %[1]sDebug >= 2 {
-							__yyfmt__.Printf("error recovery found error shift in state %%d\n", yyS[yyp].yys)
-						}
-						yystate = yyn /* simulate a shift of "error" */
-						goto yystack
-					}
-				}
-
-				/* the current p has no shift on "error", pop stack */
-				if %[1]sDebug >= 2 {
-					__yyfmt__.Printf("error recovery pops state %%d\n", yyS[yyp].yys)
-				}
-				yyp--
-			}
-			/* there is no state on the stack with an error shift ... abort */
-			if %[1]sDebug >= 2 {
-				__yyfmt__.Printf("error recovery failed\n")
-			}
-			goto ret1
 
-		case 3: /* no shift yet; clobber input char */
-			if %[1]sDebug >= 2 {
-				__yyfmt__.Printf("error recovery discards %%s\n", %[1]sSymName(yychar))
-			}
-			if yychar == %[1]sEofCode {
-				goto ret1
-			}
-
-			yychar = -1
-			goto yynewstate /* try again in the same state */
-		}
-	}
-
-	r := -yyn
-	x0 := %[1]sReductions[r]
-	x, n := x0.xsym, x0.components
-	yypt := yyp
-	_ = yypt // guard against "declared and not used"
-
-	yyp -= n
-	if yyp+1 >= len(yyS) {
-		nyys := make([]%[1]sSymType, len(yyS)*2)
-		copy(nyys, yyS)
-		yyS = nyys
-	}
-	yyVAL = yyS[yyp+1]
-
-	/* consult goto table to find next state */
-	exState := yystate
-	yystate = int(%[1]sParseTab[yyS[yyp].yys][x])+%[1]sTabOfs
-	/* reduction by production r */
-	if %[1]sDebug >= 2 {
-		__yyfmt__.Printf("reduce using rule %%v (%%s), and goto state %%d\n", r, %[1]sSymNames[x], yystate)
-	}
-
-	switch r {%i
-`,
-		*oPref, errSym, *oDlvalf, *oDlval, makeYYS)
-	for r, rule := range p.Rules {
-		if rule.Action == nil {
-			continue
+func main() {
+	log.SetFlags(0)
+	flag.Parse()
+	run := gen.Generate
+	switch cmd := flag.Arg(0); cmd {
+	case "bench":
+		if err := gen.Bench(flag.Args()[1:]); err != nil {
+			log.Fatal(err)
 		}
 
-		action := rule.Action.Values
-		if len(action) == 0 {
-			continue
+		return
+	case "diff":
+		flag.CommandLine.Parse(flag.Args()[1:])
+		if flag.NArg() != 2 {
+			log.Fatal("usage: goyacc diff [options] old.y new.y")
 		}
 
-		if len(action) == 1 {
-			part := action[0]
-			if part.Type == parser.ActionValueGo {
-				src := part.Src
-				src = src[1 : len(src)-1] // Remove lead '{' and trail '}'
-				if strings.TrimSpace(src) == "" {
-					continue
-				}
-			}
+		flag.Visit(func(f *flag.Flag) { o.Set[f.Name] = true })
+		exit(gen.Diff(flag.Arg(0), flag.Arg(1), o))
+		return
+	case "fmt":
+		if err := gen.Fmt(flag.Args()[1:]); err != nil {
+			log.Fatal(err)
 		}
 
-		components := rule.Components
-		typ := rule.Sym.Type
-		max := len(components)
-		if p := rule.Parent; p != nil {
-			max = rule.MaxParentDlr
-			components = p.Components
-		}
-		f.Format("case %d: ", r)
-		for _, part := range action {
-			num := part.Num
-			switch part.Type {
-			case parser.ActionValueGo:
-				f.Format("%s", part.Src)
-			case parser.ActionValueDlrDlr:
-				f.Format("yyVAL.%s", typ)
-				if typ == "" {
-					panic("internal error 002")
-				}
-			case parser.ActionValueDlrNum:
-				typ := p.Syms[components[num-1]].Type
-				if typ == "" {
-					panic("internal error 003")
-				}
-				f.Format("yyS[yypt-%d].%s", max-num, typ)
-			case parser.ActionValueDlrTagDlr:
-				f.Format("yyVAL.%s", part.Tag)
-			case parser.ActionValueDlrTagNum:
-				f.Format("yyS[yypt-%d].%s", max-num, part.Tag)
-			}
+		return
+	case "help":
+		flag.Usage()
+		return
+	case "gen", "lint", "report", "vet":
+		flag.CommandLine.Parse(flag.Args()[1:])
+		switch cmd {
+		case "lint", "vet":
+			run = gen.Vet
+		case "report":
+			run = gen.Report
 		}
-		f.Format("\n")
-	}
-	f.Format(`%u
 	}
 
-	if yyEx != nil && yyEx.Reduced(r, exState, &yyVAL) {
-		return -1
+	var in string
+	switch flag.NArg() {
+	case 0:
+		in = os.Stdin.Name()
+	case 1:
+		in = flag.Arg(0)
+	default:
+		log.Fatal("expected at most one non flag argument")
 	}
-	goto yystack /* stack new state and value */
-}
 
-%[2]s
-`, *oPref, p.Tail)
-	_ = oNoLines //TODO Ignored for now
-	return nil
+	flag.Visit(func(f *flag.Flag) { o.Set[f.Name] = true })
+	o.Command = os.Args
+	exit(run(in, o))
 }
 
-func injectImport(src string) string {
-	const inj0 = `
-
-import __yyfmt__ "fmt"
-`
-	inj := inj0
-	if *oPool {
-		inj += `import __sync__ "sync"
-`
-	}
-	fset := token.NewFileSet()
-	file := fset.AddFile("", -1, len(src))
-	var s scanner.Scanner
-	s.Init(
-		file,
-		[]byte(src),
-		nil,
-		scanner.ScanComments,
-	)
-	for {
-		switch _, tok, _ := s.Scan(); tok {
-		case token.EOF:
-			return inj + src
-		case token.PACKAGE:
-			s.Scan() // ident
-			pos, _, _ := s.Scan()
-			ofs := file.Offset(pos)
-			return src[:ofs] + inj + src[ofs:]
+// exit writes err, if not nil, to os.Stderr and exits with status 1.
+func exit(err error) {
+	switch x := err.(type) {
+	case nil:
+		// nop
+	case scanner.ErrorList:
+		for _, v := range x {
+			fmt.Fprintf(os.Stderr, "%v\n", v)
 		}
+		os.Exit(1)
+	default:
+		log.Fatal(err)
 	}
 }